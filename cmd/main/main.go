@@ -1,26 +1,54 @@
 package main
 
 import (
-	"rewrite/pkg/config"
-	"rewrite/pkg/controller"
-	"rewrite/pkg/database"
-
-	"github.com/labstack/echo/v4"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
 )
 
+const usage = `Usage: main <command> [flags]
+
+Commands:
+  serve                    start the HTTP server until SIGINT or SIGTERM, the default command
+  migrate up|down|status   apply pending migrations, revert the latest one or list them
+  seed                     create the built-in roles and permissions, and optionally dev users
+  user create              create a verified user, -admin grants the admin role
+  user reset-password      set the password of a user and end their sessions
+
+Run "main <command> -h" for the flags of a command.
+`
+
 func main() {
-	db, err := database.ConnectDB()
-	if err != nil {
-		panic(err)
+	err := run(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
 	}
 
-	err = database.MigrateDB(db)
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	if len(args) == 0 {
+		return serve(nil)
 	}
 
-	e := echo.New()
-	controller.InitControllers(e, db)
+	switch args[0] {
+	case "serve":
+		return serve(args[1:])
+	case "migrate":
+		return migrate(args[1:])
+	case "seed":
+		return seed(args[1:])
+	case "user":
+		return user(args[1:])
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		return nil
+	}
 
-	e.Logger.Fatal(e.Start(config.PORT))
+	return fmt.Errorf("unknown command %q\n\n%s", args[0], usage)
 }
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"rewrite/internal/user/dto"
+	"rewrite/internal/user/service"
+	"rewrite/pkg/config"
+	"rewrite/pkg/database"
+	"rewrite/pkg/entity"
+	"rewrite/pkg/utils"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+type TestSuiteMain struct {
+	suite.Suite
+	dbPath string
+}
+
+func (s *TestSuiteMain) SetupTest() {
+	s.dbPath = filepath.Join(s.T().TempDir(), "test.db")
+	s.T().Setenv("CONFIG_FILE", "")
+	s.T().Setenv("DB_DRIVER", config.DriverSQLite)
+	s.T().Setenv("DB_NAME", s.dbPath)
+	s.T().Setenv("JWT_SECRET", "k7Qp2vX9mB4nR8sT1wY6zC3fH5jL0dGa")
+	s.T().Setenv("PASSWORD_HASH_ALGORITHM", config.HashBcrypt)
+	s.T().Setenv("PASSWORD_MAX_LENGTH", "72")
+	s.T().Setenv("BCRYPT_COST", "4")
+}
+
+// stdin makes content the standard input until the end of the test.
+func (s *TestSuiteMain) stdin(content string) {
+	path := filepath.Join(s.T().TempDir(), "stdin")
+	s.Require().NoError(os.WriteFile(path, []byte(content), 0o600))
+
+	file, err := os.Open(path)
+	s.Require().NoError(err)
+
+	stdin := os.Stdin
+	os.Stdin = file
+	s.T().Cleanup(func() {
+		os.Stdin = stdin
+		file.Close()
+	})
+}
+
+func (s *TestSuiteMain) openDB() *gorm.DB {
+	db, err := database.ConnectDB(config.DatabaseConfig{Driver: config.DriverSQLite, Name: s.dbPath})
+	s.Require().NoError(err)
+	return db
+}
+
+func (s *TestSuiteMain) TestRun() {
+	for _, tt := range []struct {
+		Name          string
+		Args          []string
+		ExpectedError string
+	}{
+		{Name: "Help", Args: []string{"help"}},
+		{Name: "Help flag", Args: []string{"-h"}},
+		{Name: "Unknown command", Args: []string{"deploy"}, ExpectedError: `unknown command "deploy"`},
+		{Name: "Migrate without action", Args: []string{"migrate"}, ExpectedError: migrateUsage},
+		{Name: "Migrate with two actions", Args: []string{"migrate", "up", "down"}, ExpectedError: migrateUsage},
+		{Name: "Migrate unknown action", Args: []string{"migrate", "sideways"}, ExpectedError: migrateUsage},
+		{Name: "User without action", Args: []string{"user"}, ExpectedError: userUsage},
+		{Name: "User unknown action", Args: []string{"user", "delete"}, ExpectedError: userUsage},
+		{Name: "User create without email", Args: []string{"user", "create"}, ExpectedError: "-email is required"},
+		{Name: "User reset-password without email", Args: []string{"user", "reset-password"}, ExpectedError: "-email is required"},
+		{Name: "Unknown flag", Args: []string{"seed", "-verbose"}, ExpectedError: "flag provided but not defined: -verbose"},
+		{Name: "Invalid configuration", Args: []string{"seed", "-db-driver", "oracle"}, ExpectedError: `DB_DRIVER must be mysql, postgres or sqlite, got "oracle"`},
+	} {
+		s.Run(tt.Name, func() {
+			err := run(tt.Args)
+			if tt.ExpectedError == "" {
+				s.NoError(err)
+				return
+			}
+
+			s.ErrorContains(err, tt.ExpectedError)
+		})
+	}
+}
+
+func (s *TestSuiteMain) TestRunCommandHelp() {
+	for _, args := range [][]string{
+		{"migrate", "-h"},
+		{"seed", "-h"},
+		{"user", "create", "-h"},
+		{"user", "reset-password", "-h"},
+	} {
+		s.ErrorIs(run(args), flag.ErrHelp, args)
+	}
+}
+
+func (s *TestSuiteMain) TestUserRequestFromFlags() {
+	policy := config.Default().Password
+
+	for _, tt := range []struct {
+		Name            string
+		Email           string
+		Password        string
+		Stdin           string
+		ExpectedRequest dto.UserRequest
+		ExpectedError   string
+	}{
+		{
+			Name:            "Password flag",
+			Email:           " Admin@Example.com ",
+			Password:        "correct horse battery staple",
+			ExpectedRequest: dto.UserRequest{Email: "admin@example.com", Password: "correct horse battery staple"},
+		},
+		{
+			Name:            "Password from stdin",
+			Email:           "admin@example.com",
+			Stdin:           "correct horse battery staple\r\nignored\n",
+			ExpectedRequest: dto.UserRequest{Email: "admin@example.com", Password: "correct horse battery staple"},
+		},
+		{
+			Name:            "Password from stdin without newline",
+			Email:           "admin@example.com",
+			Stdin:           "correct horse battery staple",
+			ExpectedRequest: dto.UserRequest{Email: "admin@example.com", Password: "correct horse battery staple"},
+		},
+		{Name: "Missing email", Email: "  ", Password: "correct horse battery staple", ExpectedError: "-email is required"},
+		{Name: "Empty stdin", Email: "admin@example.com", ExpectedError: "read password: EOF"},
+		{Name: "Invalid email", Email: "admin", Password: "correct horse battery staple", ExpectedError: "email"},
+		{Name: "Short password", Email: "admin@example.com", Password: "short", ExpectedError: "password"},
+		{Name: "Empty password from stdin", Email: "admin@example.com", Stdin: "\n", ExpectedError: "password"},
+	} {
+		s.Run(tt.Name, func() {
+			s.stdin(tt.Stdin)
+
+			request, err := userRequestFromFlags(tt.Email, tt.Password, policy)
+			if tt.ExpectedError != "" {
+				s.ErrorContains(err, tt.ExpectedError)
+				s.Equal(dto.UserRequest{}, request)
+				return
+			}
+
+			s.NoError(err)
+			s.Equal(tt.ExpectedRequest, request)
+		})
+	}
+}
+
+func (s *TestSuiteMain) TestCreateAdminOnFreshDatabase() {
+	s.Require().NoError(run([]string{"migrate", "up"}))
+
+	err := run([]string{"user", "create", "-admin", "-email", "admin@example.com", "-password", "correct horse battery staple"})
+	s.Require().NoError(err)
+
+	var user entity.User
+	s.Require().NoError(s.openDB().Preload("Roles").Where("email = ?", "admin@example.com").First(&user).Error)
+	s.NotNil(user.VerifiedAt)
+	s.Require().Len(user.Roles, 1)
+	s.Equal(entity.RoleAdmin, user.Roles[0].Name)
+
+	err = run([]string{"user", "create", "-email", "admin@example.com", "-password", "correct horse battery staple"})
+	s.Error(err)
+}
+
+func (s *TestSuiteMain) TestCreateAdminRollsBackWithoutRole() {
+	s.Require().NoError(run([]string{"migrate", "up"}))
+
+	db := s.openDB()
+	s.Require().NoError(db.Exec("DELETE FROM role_permissions").Error)
+	s.Require().NoError(db.Exec("DELETE FROM roles").Error)
+
+	err := run([]string{"user", "create", "-admin", "-email", "admin@example.com", "-password", "correct horse battery staple"})
+	s.ErrorIs(err, service.ErrRoleNotFound)
+
+	var count int64
+	s.Require().NoError(db.Model(&entity.User{}).Count(&count).Error)
+	s.Zero(count, "the user is not kept without the admin role")
+}
+
+func (s *TestSuiteMain) TestCreateUserNeedsMigratedDatabase() {
+	err := run([]string{"user", "create", "-email", "admin@example.com", "-password", "correct horse battery staple"})
+	s.ErrorIs(err, database.ErrSchemaBehind)
+}
+
+func (s *TestSuiteMain) TestSeedUsers() {
+	s.Require().NoError(run([]string{"migrate", "up"}))
+
+	s.Require().NoError(run([]string{"seed", "-users", "3"}))
+	s.Require().NoError(run([]string{"seed", "-users", "4"}), "existing dev users are skipped")
+
+	var users []entity.User
+	s.Require().NoError(s.openDB().Order("id").Find(&users).Error)
+	s.Require().Len(users, 4)
+	s.Equal("user4@example.com", users[3].Email)
+	for _, user := range users {
+		s.NotNil(user.VerifiedAt)
+
+		_, err := (&utils.BcryptHasher{Cost: 4}).Verify(user.Password, "dev seed password")
+		s.NoError(err, "dev users log in with the default password")
+	}
+}
+
+func (s *TestSuiteMain) TestSeedUsersWeakPassword() {
+	s.Require().NoError(run([]string{"migrate", "up"}))
+
+	err := run([]string{"seed", "-users", "1", "-password", "password"})
+	s.EqualError(err, "password has appeared in a data breach, choose another one")
+}
+
+func TestCommands(t *testing.T) {
+	suite.Run(t, new(TestSuiteMain))
+}
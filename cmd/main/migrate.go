@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"rewrite/pkg/config"
+	"rewrite/pkg/database"
+	"text/tabwriter"
+	"time"
+)
+
+const migrateUsage = "usage: main migrate up|down|status"
+
+func migrate(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), migrateUsage)
+		flags.PrintDefaults()
+	}
+	cfg, err := config.Load(flags, args)
+	if err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return errors.New(migrateUsage)
+	}
+
+	db, err := database.ConnectDB(cfg.Database)
+	if err != nil {
+		return err
+	}
+
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	switch flags.Arg(0) {
+	case "up":
+		applied, err := migrator.Up()
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("applied %d migration(s), schema is at version %d\n", applied, migrator.Version())
+		return nil
+	case "down":
+		migration, err := migrator.Down()
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("reverted %04d_%s\n", migration.Version, migration.Name)
+		return nil
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			if status.Unknown {
+				appliedAt += " (unknown to this binary)"
+			}
+
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return w.Flush()
+	}
+
+	return errors.New(migrateUsage)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"rewrite/internal/user/dto"
+	"rewrite/internal/user/service"
+	"rewrite/pkg/config"
+	"rewrite/pkg/database"
+)
+
+func seed(args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	users := flags.Int("users", 0, "number of verified dev users to create, named user<n>@example.com")
+	password := flags.String("password", "dev seed password", "password of the dev users")
+	cfg, err := config.Load(flags, args)
+	if err != nil {
+		return err
+	}
+
+	db, err := connectMigratedDB(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = database.SeedDB(db, cfg.Database.AdminEmails)
+	if err != nil {
+		return err
+	}
+	fmt.Println("seeded built-in roles and permissions")
+
+	if *users <= 0 {
+		return nil
+	}
+
+	services, err := newServices(db, cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	created := 0
+	for i := 1; i <= *users; i++ {
+		_, err = services.user.ProvisionUser(dto.UserRequest{
+			Email:    fmt.Sprintf("user%d@example.com", i),
+			Password: *password,
+		}, ctx)
+		if err == service.ErrUserExists {
+			continue
+		}
+		if err != nil {
+			return describeInvalid(err)
+		}
+
+		created++
+	}
+
+	fmt.Printf("created %d dev user(s)\n", created)
+	return nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"rewrite/pkg/config"
+	"rewrite/pkg/controller"
+	"rewrite/pkg/database"
+	"rewrite/pkg/health"
+	"rewrite/pkg/lifecycle"
+	"rewrite/pkg/logging"
+	"rewrite/pkg/mailer"
+	"rewrite/pkg/metrics"
+	"rewrite/pkg/ratelimit"
+	"rewrite/pkg/tracing"
+	"rewrite/pkg/utils"
+	"rewrite/pkg/validation"
+	"syscall"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/exp/slog"
+)
+
+// serve runs the HTTP server until SIGINT or SIGTERM. It then fails readiness
+// probes for the shutdown delay, stops accepting connections, waits up to the
+// shutdown timeout for in-flight requests and runs the shutdown hooks. An
+// error is returned if any of that failed, so the process exits non-zero.
+func serve(args []string) (err error) {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	cfg, err := config.Load(flags, args)
+	if err != nil {
+		return err
+	}
+
+	level, ok := logging.ParseLevel(cfg.Log.Level)
+	if !ok {
+		return fmt.Errorf("unknown log level %q", cfg.Log.Level)
+	}
+	logger := logging.New(os.Stdout, level)
+	slog.SetDefault(logger)
+
+	lc := lifecycle.New()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+
+		shutdownErr := lc.Shutdown(ctx)
+		if err == nil {
+			err = shutdownErr
+		}
+	}()
+
+	flushTraces, err := tracing.Setup(cfg.Tracing)
+	if err != nil {
+		return err
+	}
+
+	// Registered first, so spans of every other hook are flushed too.
+	lc.OnShutdown("telemetry", flushTraces)
+
+	db, err := database.ConnectDB(cfg.Database)
+	if err != nil {
+		return err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	lc.OnShutdown("database", func(ctx context.Context) error {
+		return sqlDB.Close()
+	})
+
+	err = db.Use(metrics.GormPlugin{})
+	if err != nil {
+		return err
+	}
+
+	err = db.Use(tracing.GormPlugin{})
+	if err != nil {
+		return err
+	}
+
+	err = metrics.RegisterDBStats(sqlDB, cfg.Database.Name)
+	if err != nil {
+		return err
+	}
+
+	if cfg.Database.AutoMigrate {
+		err = database.MigrateDB(db)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = database.CheckSchema(db)
+	if err != nil {
+		return err
+	}
+
+	collisions, err := database.EmailCollisions(db)
+	if err != nil {
+		return err
+	}
+	if len(collisions) > 0 {
+		logger.Warn("accounts share an email in different case, merge or rename them so they can log in", "emails", collisions)
+	}
+
+	err = database.SeedDB(db, cfg.Database.AdminEmails)
+	if err != nil {
+		return err
+	}
+
+	keyRing, err := utils.LoadKeyRing(cfg.JWT)
+	if err != nil {
+		return err
+	}
+
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+
+	asyncMailer := mailer.NewAsyncMailer(mailer.NewMailer(cfg.Mail), 100, func(err error) {
+		logger.Error("sending email", "error", err)
+	})
+	lc.OnShutdown("mailer", func(ctx context.Context) error {
+		asyncMailer.Close()
+		return nil
+	})
+
+	passwordChecker, err := validation.LoadPasswordChecker(cfg.Password)
+	if err != nil {
+		return err
+	}
+
+	var rateLimitStore ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.RateLimit.Store == config.RateLimitStoreRedis {
+		options, err := redis.ParseURL(cfg.RateLimit.RedisURL)
+		if err != nil {
+			return fmt.Errorf("RATE_LIMIT_REDIS_URL: %w", err)
+		}
+
+		client := redis.NewClient(options)
+		lc.OnShutdown("redis", func(ctx context.Context) error {
+			return client.Close()
+		})
+		rateLimitStore = ratelimit.NewRedisStore(client)
+	}
+
+	registry := health.NewRegistry(cfg.Server.HealthCacheTTL, func(name string, err error) {
+		logger.Warn("health check failed", "check", name, "error", err)
+	})
+	registry.RegisterReadiness("database", cfg.Server.HealthCheckTimeout, func(ctx context.Context) error {
+		return database.PingDB(db, ctx)
+	})
+	registry.RegisterReadiness("migrations", cfg.Server.HealthCheckTimeout, func(ctx context.Context) error {
+		return database.CheckSchema(db.WithContext(ctx))
+	})
+
+	controller.InitControllers(e, db, cfg, keyRing, asyncMailer, rateLimitStore, passwordChecker, lc, registry)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Metrics are served on a port of their own so they are not exposed with
+	// the API. The server is stopped by a hook, after the requests have been
+	// drained, so it can still be scraped meanwhile.
+	metricsServer := &http.Server{
+		Addr:              cfg.Server.MetricsPort,
+		Handler:           metrics.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	lc.OnShutdown("metrics server", metricsServer.Shutdown)
+
+	metricsErr := make(chan error, 1)
+	go func() {
+		metricsErr <- metricsServer.ListenAndServe()
+	}()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- e.Start(cfg.Server.Port)
+	}()
+	logger.Info("server started", "address", cfg.Server.Port, "metrics_address", cfg.Server.MetricsPort)
+
+	select {
+	case err = <-serverErr:
+		return err
+	case err = <-metricsErr:
+		return fmt.Errorf("metrics server: %w", err)
+	case <-ctx.Done():
+	}
+
+	// A second signal kills the process right away.
+	stop()
+	registry.ShutDown()
+	logger.Info("shutting down", "drain_timeout", cfg.Server.ShutdownTimeout.String())
+	time.Sleep(cfg.Server.ShutdownDelay)
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	err = e.Shutdown(drainCtx)
+	if err != nil {
+		// Requests still running now would otherwise hold their connections
+		// while the database is closed under them.
+		e.Close()
+		return fmt.Errorf("draining requests: %w", err)
+	}
+
+	err = <-serverErr
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"rewrite/internal/user/repository"
+	"rewrite/internal/user/service"
+	"rewrite/pkg/config"
+	"rewrite/pkg/database"
+	"rewrite/pkg/mailer"
+	"rewrite/pkg/utils"
+	"rewrite/pkg/validation"
+
+	"gorm.io/gorm"
+)
+
+// services are the ones used by the HTTP handlers, so commands go through the
+// same rules as requests do.
+type services struct {
+	user service.UserService
+	role service.RoleService
+}
+
+func newServices(db *gorm.DB, cfg *config.Config) (*services, error) {
+	keyRing, err := utils.LoadKeyRing(cfg.JWT)
+	if err != nil {
+		return nil, err
+	}
+
+	passwordChecker, err := validation.LoadPasswordChecker(cfg.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	userRepository := repository.NewUserRepositoryImpl(db)
+	return &services{
+		user: service.NewUserServiceImpl(
+			userRepository,
+			repository.NewRefreshTokenRepositoryImpl(db),
+			repository.NewRevokedTokenRepositoryImpl(db),
+			repository.NewPasswordResetTokenRepositoryImpl(db),
+			repository.NewTwoFactorRepositoryImpl(db),
+			repository.NewLoginAttemptRepositoryImpl(db),
+			keyRing,
+			mailer.NewMailer(cfg.Mail),
+			utils.NewPasswordHasher(cfg.Hashing),
+			passwordChecker,
+			cfg,
+		),
+		role: service.NewRoleServiceImpl(repository.NewRoleRepositoryImpl(db), userRepository),
+	}, nil
+}
+
+// connectMigratedDB connects to the database and makes sure its schema is the
+// one this binary expects.
+func connectMigratedDB(cfg *config.Config) (*gorm.DB, error) {
+	db, err := database.ConnectDB(cfg.Database)
+	if err != nil {
+		return nil, err
+	}
+
+	err = database.CheckSchema(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"rewrite/internal/user/dto"
+	"rewrite/pkg/apperror"
+	"rewrite/pkg/config"
+	"rewrite/pkg/entity"
+	"rewrite/pkg/validation"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const userUsage = "usage: main user create|reset-password -email <email> [-password <password>]"
+
+func user(args []string) error {
+	if len(args) == 0 {
+		return errors.New(userUsage)
+	}
+
+	switch args[0] {
+	case "create":
+		return createUser(args[1:])
+	case "reset-password":
+		return resetPassword(args[1:])
+	}
+
+	return errors.New(userUsage)
+}
+
+func createUser(args []string) error {
+	flags := flag.NewFlagSet("user create", flag.ContinueOnError)
+	email := flags.String("email", "", "email of the new user")
+	password := flags.String("password", "", "password of the new user, read from stdin when left out")
+	admin := flags.Bool("admin", false, "grant the admin role")
+	cfg, err := config.Load(flags, args)
+	if err != nil {
+		return err
+	}
+
+	request, err := userRequestFromFlags(*email, *password, cfg.Password)
+	if err != nil {
+		return err
+	}
+
+	db, err := connectMigratedDB(cfg)
+	if err != nil {
+		return err
+	}
+
+	// The user is only created along with the admin role, so a failed grant
+	// can be retried without deleting the user first.
+	ctx := context.Background()
+	var created *dto.UserResponse
+	err = db.Transaction(func(tx *gorm.DB) error {
+		services, err := newServices(tx, cfg)
+		if err != nil {
+			return err
+		}
+
+		created, err = services.user.ProvisionUser(request, ctx)
+		if err != nil {
+			return err
+		}
+
+		if *admin {
+			return services.role.AssignRole(created.ID, entity.RoleAdmin, ctx)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return describeInvalid(err)
+	}
+
+	fmt.Printf("created user %d <%s>\n", created.ID, created.Email)
+	return nil
+}
+
+func resetPassword(args []string) error {
+	flags := flag.NewFlagSet("user reset-password", flag.ContinueOnError)
+	email := flags.String("email", "", "email of the user")
+	password := flags.String("password", "", "new password, read from stdin when left out")
+	cfg, err := config.Load(flags, args)
+	if err != nil {
+		return err
+	}
+
+	request, err := userRequestFromFlags(*email, *password, cfg.Password)
+	if err != nil {
+		return err
+	}
+
+	db, err := connectMigratedDB(cfg)
+	if err != nil {
+		return err
+	}
+
+	services, err := newServices(db, cfg)
+	if err != nil {
+		return err
+	}
+
+	err = services.user.SetPassword(request, context.Background())
+	if err != nil {
+		return describeInvalid(err)
+	}
+
+	fmt.Printf("password of <%s> reset, existing sessions were ended\n", request.Email)
+	return nil
+}
+
+// userRequestFromFlags reads the password from the first line of stdin when
+// it is not given as a flag, so it does not end up in the shell history. The
+// request is validated like the ones sent to the API.
+func userRequestFromFlags(email string, password string, policy config.PasswordConfig) (dto.UserRequest, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return dto.UserRequest{}, errors.New("-email is required")
+	}
+
+	if password == "" {
+		fmt.Fprint(os.Stderr, "Password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return dto.UserRequest{}, fmt.Errorf("read password: %w", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	request := dto.UserRequest{Email: email, Password: password}
+	request.Normalize()
+
+	err := validation.New(policy).Validate(&request)
+	if err != nil {
+		return dto.UserRequest{}, describeInvalid(err)
+	}
+
+	return request, nil
+}
+
+// describeInvalid spells out the failing fields of a validation error, whose
+// message alone does not tell what to fix.
+func describeInvalid(err error) error {
+	var invalid *apperror.Error
+	if !errors.As(err, &invalid) || len(invalid.Fields) == 0 {
+		return err
+	}
+
+	problems := make([]string, 0, len(invalid.Fields))
+	for _, field := range invalid.Fields {
+		problems = append(problems, field.Field+" "+field.Message)
+	}
+
+	return errors.New(strings.Join(problems, ", "))
+}
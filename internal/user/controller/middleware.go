@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"rewrite/pkg/config"
+	"rewrite/pkg/ratelimit"
+	"rewrite/pkg/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// JWT verifies the bearer token against the key ring, picking the key by the
+// kid header, and stores the *utils.Claims under the "user" context key.
+func (u *UserController) JWT() echo.MiddlewareFunc {
+	return middleware.JWTWithConfig(middleware.JWTConfig{
+		ParseTokenFunc: func(auth string, c echo.Context) (interface{}, error) {
+			return utils.ParseToken(u.keyRing, auth)
+		},
+		ErrorHandlerWithContext: func(err error, c echo.Context) error {
+			if err == middleware.ErrJWTMissing {
+				return ErrMissingToken
+			}
+
+			return ErrInvalidToken
+		},
+	})
+}
+
+// RejectRevokedToken must run after the JWT middleware. It refuses tokens that
+// were revoked by a logout before they expired.
+func (u *UserController) RejectRevokedToken(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		claims, ok := c.Get("user").(*utils.Claims)
+		if !ok {
+			return ErrInvalidToken
+		}
+
+		revoked, err := u.userService.IsTokenRevoked(claims, c.Request().Context())
+		if err != nil {
+			return err
+		}
+
+		if revoked {
+			return ErrInvalidToken
+		}
+
+		return next(c)
+	}
+}
+
+// RequirePermission must run after the JWT middleware. It refuses the request
+// unless one of the roles in the token grants the permission.
+func (u *UserController) RequirePermission(permission string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			claims, ok := c.Get("user").(*utils.Claims)
+			if !ok {
+				return ErrInvalidToken
+			}
+
+			allowed, err := u.roleService.HasPermission(claims.Roles, permission, c.Request().Context())
+			if err != nil {
+				return err
+			}
+
+			if !allowed {
+				return ErrForbidden
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// RequireSelfOrPermission must run after the JWT middleware on routes with an
+// :id parameter. Users may always act on their own record, acting on anyone
+// else's needs the permission.
+func (u *UserController) RequireSelfOrPermission(permission string) echo.MiddlewareFunc {
+	requirePermission := u.RequirePermission(permission)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		checked := requirePermission(next)
+
+		return func(c echo.Context) error {
+			claims, ok := c.Get("user").(*utils.Claims)
+			if !ok {
+				return ErrInvalidToken
+			}
+
+			if userID, err := parseUserID(c); err == nil && userID == claims.UserID {
+				return next(c)
+			}
+
+			return checked(c)
+		}
+	}
+}
+
+// rateLimit limits the routes of group by rule, or not at all when the rule
+// allows no requests.
+func (u *UserController) rateLimit(group string, rule config.RateLimitRule) echo.MiddlewareFunc {
+	if rule.Requests == 0 {
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return next
+		}
+	}
+
+	limit := ratelimit.Limit{Requests: rule.Requests, Window: rule.Window}
+	return ratelimit.Middleware(u.rateLimitStore, group, limit, ratelimit.KeyOf(rule.Key, u.config.RateLimit.APIKeyHeader))
+}
+
+// resendVerificationLimiter allows every client IP ResendLimit requests per
+// ResendWindow so the endpoint can not be used to flood someone's inbox.
+func (u *UserController) resendVerificationLimiter() echo.MiddlewareFunc {
+	return u.rateLimit("resend_verification", config.RateLimitRule{
+		Requests: u.config.Verification.ResendLimit,
+		Window:   u.config.Verification.ResendWindow,
+		Key:      config.RateLimitByIP,
+	})
+}
@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"net/http"
+	"rewrite/internal/user/dto"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (u *UserController) GetAllRoles(c echo.Context) error {
+	roles, err := u.roleService.FindAllRoles(c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Success getting roles",
+		"data":    roles,
+	})
+}
+
+func (u *UserController) GetAllPermissions(c echo.Context) error {
+	permissions, err := u.roleService.FindAllPermissions(c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Success getting permissions",
+		"data":    permissions,
+	})
+}
+
+func (u *UserController) CreateRole(c echo.Context) error {
+	var request dto.RoleRequest
+	err := bind(c, &request)
+	if err != nil {
+		return err
+	}
+
+	role, err := u.roleService.CreateRole(request, c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"message": "Success creating role",
+		"data":    role,
+	})
+}
+
+func (u *UserController) UpdateRole(c echo.Context) error {
+	var request dto.RoleRequest
+	err := bind(c, &request)
+	if err != nil {
+		return err
+	}
+
+	role, err := u.roleService.UpdateRole(c.Param("name"), request, c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Success updating role",
+		"data":    role,
+	})
+}
+
+func (u *UserController) DeleteRole(c echo.Context) error {
+	err := u.roleService.DeleteRole(c.Param("name"), c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Success deleting role",
+	})
+}
+
+func (u *UserController) AssignRole(c echo.Context) error {
+	userID, err := parseUserID(c)
+	if err != nil {
+		return err
+	}
+
+	err = u.roleService.AssignRole(userID, c.Param("name"), c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Success assigning role",
+	})
+}
+
+func (u *UserController) UnassignRole(c echo.Context) error {
+	userID, err := parseUserID(c)
+	if err != nil {
+		return err
+	}
+
+	err = u.roleService.UnassignRole(userID, c.Param("name"), c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Success unassigning role",
+	})
+}
@@ -0,0 +1,612 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"rewrite/internal/user/dto"
+	"rewrite/internal/user/service"
+	"rewrite/pkg/apperror"
+	"rewrite/pkg/entity"
+	"rewrite/pkg/utils"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockRoleService struct {
+	mock.Mock
+}
+
+func (m *MockRoleService) FindAllRoles(ctx context.Context) (dto.RolesResponse, error) {
+	args := m.Called()
+	return args.Get(0).(dto.RolesResponse), args.Error(1)
+}
+
+func (m *MockRoleService) FindAllPermissions(ctx context.Context) ([]string, error) {
+	args := m.Called()
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockRoleService) CreateRole(request dto.RoleRequest, ctx context.Context) (*dto.RoleResponse, error) {
+	args := m.Called(request)
+	return args.Get(0).(*dto.RoleResponse), args.Error(1)
+}
+
+func (m *MockRoleService) UpdateRole(name string, request dto.RoleRequest, ctx context.Context) (*dto.RoleResponse, error) {
+	args := m.Called(name, request)
+	return args.Get(0).(*dto.RoleResponse), args.Error(1)
+}
+
+func (m *MockRoleService) DeleteRole(name string, ctx context.Context) error {
+	args := m.Called(name)
+	return args.Error(0)
+}
+
+func (m *MockRoleService) AssignRole(userID uint, name string, ctx context.Context) error {
+	args := m.Called(userID, name)
+	return args.Error(0)
+}
+
+func (m *MockRoleService) UnassignRole(userID uint, name string, ctx context.Context) error {
+	args := m.Called(userID, name)
+	return args.Error(0)
+}
+
+func (m *MockRoleService) HasPermission(roles []string, permission string, ctx context.Context) (bool, error) {
+	args := m.Called(roles, permission)
+	return args.Bool(0), args.Error(1)
+}
+
+func (s *TestSuiteUserControllers) TestRequirePermission() {
+	for _, tc := range []struct {
+		Name           string
+		Claims         interface{}
+		Allowed        bool
+		FunctionError  error
+		ExpectedStatus int
+		ExpectedError  error
+	}{
+		{
+			Name:           "Permission granted",
+			Claims:         &utils.Claims{UserID: 1, Roles: []string{"admin"}},
+			Allowed:        true,
+			ExpectedStatus: 200,
+		},
+		{
+			Name:           "Permission not granted",
+			Claims:         &utils.Claims{UserID: 1, Roles: []string{"support"}},
+			ExpectedStatus: 403,
+			ExpectedError:  ErrForbidden,
+		},
+		{
+			Name:           "Missing claims",
+			Claims:         nil,
+			ExpectedStatus: 401,
+			ExpectedError:  ErrInvalidToken,
+		},
+		{
+			Name:           "Generic error from service",
+			Claims:         &utils.Claims{UserID: 1, Roles: []string{"admin"}},
+			FunctionError:  errors.New("Generic error"),
+			ExpectedStatus: 500,
+			ExpectedError:  errors.New("Generic error"),
+		},
+	} {
+		s.Run(tc.Name, func() {
+			s.SetupTest()
+
+			r := httptest.NewRequest("GET", "/users", nil)
+			w := httptest.NewRecorder()
+			c := s.echoApp.NewContext(r, w)
+			c.Set("user", tc.Claims)
+
+			s.mockRoleService.On("HasPermission", mock.Anything, "users:list").Return(tc.Allowed, tc.FunctionError)
+			err := s.userController.RequirePermission("users:list")(func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})(c)
+
+			if tc.ExpectedError != nil {
+				s.Equal(tc.ExpectedError, err)
+				s.Equal(tc.ExpectedStatus, apperror.Status(err))
+			} else {
+				s.NoError(err)
+				s.Equal(tc.ExpectedStatus, w.Result().StatusCode)
+			}
+
+			s.TearDownTest()
+		})
+	}
+}
+
+func (s *TestSuiteUserControllers) TestListUsersRequiresPermission() {
+	for _, tc := range []struct {
+		Name           string
+		User           *entity.User
+		Allowed        bool
+		ExpectedStatus int
+	}{
+		{
+			Name:           "Admin",
+			User:           &entity.User{Roles: []entity.Role{{Name: entity.RoleAdmin}}},
+			Allowed:        true,
+			ExpectedStatus: 200,
+		},
+		{
+			Name:           "Regular user",
+			User:           &entity.User{},
+			ExpectedStatus: 403,
+		},
+	} {
+		s.Run(tc.Name, func() {
+			s.SetupTest()
+			s.userController.InitRoutes(s.echoApp)
+
+			token, err := utils.GenerateToken(s.keyRing, tc.User, "", time.Minute)
+			s.NoError(err)
+
+			var roles []string
+			for _, role := range tc.User.Roles {
+				roles = append(roles, role.Name)
+			}
+
+			s.mockUserService.On("IsTokenRevoked", mock.Anything).Return(false, nil)
+			s.mockRoleService.On("HasPermission", roles, entity.PermissionUsersList).Return(tc.Allowed, nil)
+			s.mockUserService.On("FindAll", mock.Anything).Return(&dto.UsersPage{Users: dto.UsersResponse{{ID: 1, Email: "123@123.com"}}}, nil)
+
+			r := httptest.NewRequest("GET", "/users", nil)
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			s.echoApp.ServeHTTP(w, r)
+
+			s.Equal(tc.ExpectedStatus, w.Code)
+			s.mockRoleService.AssertCalled(s.T(), "HasPermission", roles, entity.PermissionUsersList)
+
+			s.TearDownTest()
+		})
+	}
+}
+
+func (s *TestSuiteUserControllers) TestGetAllRoles() {
+	for _, tc := range []struct {
+		Name           string
+		FunctionRoles  dto.RolesResponse
+		FunctionError  error
+		ExpectedStatus int
+		ExpectedBody   echo.Map
+		ExpectedError  error
+	}{
+		{
+			Name: "Success",
+			FunctionRoles: dto.RolesResponse{
+				{ID: 1, Name: "admin", Description: "Administrator", Permissions: []string{"users:list"}},
+			},
+			ExpectedStatus: 200,
+			ExpectedBody: echo.Map{
+				"message": "Success getting roles",
+				"data": []interface{}{
+					map[string]interface{}{
+						"id":          float64(1),
+						"name":        "admin",
+						"description": "Administrator",
+						"permissions": []interface{}{"users:list"},
+					},
+				},
+			},
+		},
+		{
+			Name:           "Generic error from service",
+			FunctionError:  errors.New("Generic error"),
+			ExpectedStatus: 500,
+			ExpectedError:  errors.New("Generic error"),
+		},
+	} {
+		s.Run(tc.Name, func() {
+			s.SetupTest()
+			s.mockRoleService.On("FindAllRoles").Return(tc.FunctionRoles, tc.FunctionError)
+
+			r := httptest.NewRequest("GET", "/roles", nil)
+			w := httptest.NewRecorder()
+			c := s.echoApp.NewContext(r, w)
+
+			err := s.userController.GetAllRoles(c)
+
+			if tc.ExpectedError != nil {
+				s.Equal(tc.ExpectedError, err)
+				s.Equal(tc.ExpectedStatus, apperror.Status(err))
+			} else {
+				s.NoError(err)
+
+				var response echo.Map
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				s.NoError(err)
+
+				s.Equal(tc.ExpectedStatus, w.Result().StatusCode)
+				s.Equal(tc.ExpectedBody, response)
+			}
+
+			s.TearDownTest()
+		})
+	}
+}
+
+func (s *TestSuiteUserControllers) TestGetAllPermissions() {
+	for _, tc := range []struct {
+		Name                string
+		FunctionPermissions []string
+		FunctionError       error
+		ExpectedStatus      int
+		ExpectedBody        echo.Map
+		ExpectedError       error
+	}{
+		{
+			Name:                "Success",
+			FunctionPermissions: []string{"roles:manage", "users:list"},
+			ExpectedStatus:      200,
+			ExpectedBody: echo.Map{
+				"message": "Success getting permissions",
+				"data":    []interface{}{"roles:manage", "users:list"},
+			},
+		},
+		{
+			Name:           "Generic error from service",
+			FunctionError:  errors.New("Generic error"),
+			ExpectedStatus: 500,
+			ExpectedError:  errors.New("Generic error"),
+		},
+	} {
+		s.Run(tc.Name, func() {
+			s.SetupTest()
+			s.mockRoleService.On("FindAllPermissions").Return(tc.FunctionPermissions, tc.FunctionError)
+
+			r := httptest.NewRequest("GET", "/permissions", nil)
+			w := httptest.NewRecorder()
+			c := s.echoApp.NewContext(r, w)
+
+			err := s.userController.GetAllPermissions(c)
+
+			if tc.ExpectedError != nil {
+				s.Equal(tc.ExpectedError, err)
+				s.Equal(tc.ExpectedStatus, apperror.Status(err))
+			} else {
+				s.NoError(err)
+
+				var response echo.Map
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				s.NoError(err)
+
+				s.Equal(tc.ExpectedStatus, w.Result().StatusCode)
+				s.Equal(tc.ExpectedBody, response)
+			}
+
+			s.TearDownTest()
+		})
+	}
+}
+
+func (s *TestSuiteUserControllers) TestCreateRole() {
+	for _, tc := range []struct {
+		Name           string
+		RequestBody    interface{}
+		FunctionRole   *dto.RoleResponse
+		FunctionError  error
+		ExpectedStatus int
+		ExpectedBody   echo.Map
+		ExpectedError  error
+	}{
+		{
+			Name:           "Success",
+			RequestBody:    dto.RoleRequest{Name: "support", Permissions: []string{"users:list"}},
+			FunctionRole:   &dto.RoleResponse{ID: 2, Name: "support", Permissions: []string{"users:list"}},
+			ExpectedStatus: 201,
+			ExpectedBody: echo.Map{
+				"message": "Success creating role",
+				"data": map[string]interface{}{
+					"id":          float64(2),
+					"name":        "support",
+					"description": "",
+					"permissions": []interface{}{"users:list"},
+				},
+			},
+		},
+		{
+			Name:           "Role exists",
+			RequestBody:    dto.RoleRequest{Name: "support"},
+			FunctionError:  service.ErrRoleExists,
+			ExpectedStatus: 409,
+			ExpectedError:  service.ErrRoleExists,
+		},
+		{
+			Name:           "Unknown permission",
+			RequestBody:    dto.RoleRequest{Name: "support", Permissions: []string{"users:fly"}},
+			FunctionError:  service.ErrUnknownPermission,
+			ExpectedStatus: 400,
+			ExpectedError:  service.ErrUnknownPermission,
+		},
+		{
+			Name:           "Generic error from service",
+			RequestBody:    dto.RoleRequest{Name: "support"},
+			FunctionError:  errors.New("Generic error"),
+			ExpectedStatus: 500,
+			ExpectedError:  errors.New("Generic error"),
+		},
+		{
+			Name:           "Error invalid request body",
+			RequestBody:    "invalid body",
+			ExpectedStatus: 400,
+			ExpectedError:  ErrBadRequestBody,
+		},
+	} {
+		s.Run(tc.Name, func() {
+			s.SetupTest()
+
+			jsonBody, err := json.Marshal(tc.RequestBody)
+			s.NoError(err)
+
+			r := httptest.NewRequest("POST", "/roles", bytes.NewBuffer(jsonBody))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			c := s.echoApp.NewContext(r, w)
+
+			s.mockRoleService.On("CreateRole", tc.RequestBody).Return(tc.FunctionRole, tc.FunctionError)
+			err = s.userController.CreateRole(c)
+
+			if tc.ExpectedError != nil {
+				s.Equal(tc.ExpectedError, err)
+				s.Equal(tc.ExpectedStatus, apperror.Status(err))
+			} else {
+				s.NoError(err)
+
+				var response echo.Map
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				s.NoError(err)
+
+				s.Equal(tc.ExpectedStatus, w.Result().StatusCode)
+				s.Equal(tc.ExpectedBody, response)
+			}
+
+			s.TearDownTest()
+		})
+	}
+}
+
+func (s *TestSuiteUserControllers) TestUpdateRole() {
+	for _, tc := range []struct {
+		Name           string
+		RoleName       string
+		RequestBody    dto.RoleRequest
+		FunctionRole   *dto.RoleResponse
+		FunctionError  error
+		ExpectedStatus int
+		ExpectedError  error
+	}{
+		{
+			Name:           "Success",
+			RoleName:       "support",
+			RequestBody:    dto.RoleRequest{Description: "Support staff", Permissions: []string{"users:list"}},
+			FunctionRole:   &dto.RoleResponse{ID: 2, Name: "support", Description: "Support staff", Permissions: []string{"users:list"}},
+			ExpectedStatus: 200,
+		},
+		{
+			Name:           "Role not found",
+			RoleName:       "support",
+			FunctionError:  service.ErrRoleNotFound,
+			ExpectedStatus: 404,
+			ExpectedError:  service.ErrRoleNotFound,
+		},
+		{
+			Name:           "Admin role",
+			RoleName:       "admin",
+			FunctionError:  service.ErrBuiltInRole,
+			ExpectedStatus: 409,
+			ExpectedError:  service.ErrBuiltInRole,
+		},
+		{
+			Name:           "Unknown permission",
+			RoleName:       "support",
+			RequestBody:    dto.RoleRequest{Permissions: []string{"users:fly"}},
+			FunctionError:  service.ErrUnknownPermission,
+			ExpectedStatus: 400,
+			ExpectedError:  service.ErrUnknownPermission,
+		},
+	} {
+		s.Run(tc.Name, func() {
+			s.SetupTest()
+
+			jsonBody, err := json.Marshal(tc.RequestBody)
+			s.NoError(err)
+
+			r := httptest.NewRequest("PUT", "/", bytes.NewBuffer(jsonBody))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			c := s.echoApp.NewContext(r, w)
+			c.SetPath("/roles/:name")
+			c.SetParamNames("name")
+			c.SetParamValues(tc.RoleName)
+
+			s.mockRoleService.On("UpdateRole", tc.RoleName, tc.RequestBody).Return(tc.FunctionRole, tc.FunctionError)
+			err = s.userController.UpdateRole(c)
+
+			if tc.ExpectedError != nil {
+				s.Equal(tc.ExpectedError, err)
+				s.Equal(tc.ExpectedStatus, apperror.Status(err))
+			} else {
+				s.NoError(err)
+				s.Equal(tc.ExpectedStatus, w.Result().StatusCode)
+			}
+
+			s.TearDownTest()
+		})
+	}
+}
+
+func (s *TestSuiteUserControllers) TestDeleteRole() {
+	for _, tc := range []struct {
+		Name           string
+		RoleName       string
+		FunctionError  error
+		ExpectedStatus int
+		ExpectedError  error
+	}{
+		{
+			Name:           "Success",
+			RoleName:       "support",
+			ExpectedStatus: 200,
+		},
+		{
+			Name:           "Role not found",
+			RoleName:       "support",
+			FunctionError:  service.ErrRoleNotFound,
+			ExpectedStatus: 404,
+			ExpectedError:  service.ErrRoleNotFound,
+		},
+		{
+			Name:           "Admin role",
+			RoleName:       "admin",
+			FunctionError:  service.ErrBuiltInRole,
+			ExpectedStatus: 409,
+			ExpectedError:  service.ErrBuiltInRole,
+		},
+	} {
+		s.Run(tc.Name, func() {
+			s.SetupTest()
+
+			r := httptest.NewRequest("DELETE", "/", nil)
+			w := httptest.NewRecorder()
+			c := s.echoApp.NewContext(r, w)
+			c.SetPath("/roles/:name")
+			c.SetParamNames("name")
+			c.SetParamValues(tc.RoleName)
+
+			s.mockRoleService.On("DeleteRole", tc.RoleName).Return(tc.FunctionError)
+			err := s.userController.DeleteRole(c)
+
+			if tc.ExpectedError != nil {
+				s.Equal(tc.ExpectedError, err)
+				s.Equal(tc.ExpectedStatus, apperror.Status(err))
+			} else {
+				s.NoError(err)
+				s.Equal(tc.ExpectedStatus, w.Result().StatusCode)
+			}
+
+			s.TearDownTest()
+		})
+	}
+}
+
+func (s *TestSuiteUserControllers) TestAssignRole() {
+	for _, tc := range []struct {
+		Name           string
+		UserID         string
+		FunctionError  error
+		ExpectedStatus int
+		ExpectedError  error
+	}{
+		{
+			Name:           "Success",
+			UserID:         "1",
+			ExpectedStatus: 200,
+		},
+		{
+			Name:           "User not found",
+			UserID:         "1",
+			FunctionError:  service.ErrUserNotFound,
+			ExpectedStatus: 404,
+			ExpectedError:  service.ErrUserNotFound,
+		},
+		{
+			Name:           "Role not found",
+			UserID:         "1",
+			FunctionError:  service.ErrRoleNotFound,
+			ExpectedStatus: 404,
+			ExpectedError:  service.ErrRoleNotFound,
+		},
+		{
+			Name:           "Invalid user id",
+			UserID:         "abc",
+			ExpectedStatus: 400,
+			ExpectedError:  ErrInvalidUserID,
+		},
+	} {
+		s.Run(tc.Name, func() {
+			s.SetupTest()
+
+			r := httptest.NewRequest("PUT", "/", nil)
+			w := httptest.NewRecorder()
+			c := s.echoApp.NewContext(r, w)
+			c.SetPath("/users/:id/roles/:name")
+			c.SetParamNames("id", "name")
+			c.SetParamValues(tc.UserID, "support")
+
+			s.mockRoleService.On("AssignRole", uint(1), "support").Return(tc.FunctionError)
+			err := s.userController.AssignRole(c)
+
+			if tc.ExpectedError != nil {
+				s.Equal(tc.ExpectedError, err)
+				s.Equal(tc.ExpectedStatus, apperror.Status(err))
+			} else {
+				s.NoError(err)
+				s.Equal(tc.ExpectedStatus, w.Result().StatusCode)
+			}
+
+			s.TearDownTest()
+		})
+	}
+}
+
+func (s *TestSuiteUserControllers) TestUnassignRole() {
+	for _, tc := range []struct {
+		Name           string
+		UserID         string
+		FunctionError  error
+		ExpectedStatus int
+		ExpectedError  error
+	}{
+		{
+			Name:           "Success",
+			UserID:         "1",
+			ExpectedStatus: 200,
+		},
+		{
+			Name:           "Role not found",
+			UserID:         "1",
+			FunctionError:  service.ErrRoleNotFound,
+			ExpectedStatus: 404,
+			ExpectedError:  service.ErrRoleNotFound,
+		},
+		{
+			Name:           "Invalid user id",
+			UserID:         "-1",
+			ExpectedStatus: 400,
+			ExpectedError:  ErrInvalidUserID,
+		},
+	} {
+		s.Run(tc.Name, func() {
+			s.SetupTest()
+
+			r := httptest.NewRequest("DELETE", "/", nil)
+			w := httptest.NewRecorder()
+			c := s.echoApp.NewContext(r, w)
+			c.SetPath("/users/:id/roles/:name")
+			c.SetParamNames("id", "name")
+			c.SetParamValues(tc.UserID, "support")
+
+			s.mockRoleService.On("UnassignRole", uint(1), "support").Return(tc.FunctionError)
+			err := s.userController.UnassignRole(c)
+
+			if tc.ExpectedError != nil {
+				s.Equal(tc.ExpectedError, err)
+				s.Equal(tc.ExpectedStatus, apperror.Status(err))
+			} else {
+				s.NoError(err)
+				s.Equal(tc.ExpectedStatus, w.Result().StatusCode)
+			}
+
+			s.TearDownTest()
+		})
+	}
+}
@@ -1,72 +1,246 @@
 package controller
 
 import (
-	"errors"
 	"net/http"
 	"rewrite/internal/user/dto"
 	"rewrite/internal/user/service"
+	"rewrite/pkg/apperror"
 	"rewrite/pkg/config"
+	"rewrite/pkg/entity"
+	"rewrite/pkg/ratelimit"
+	"rewrite/pkg/utils"
+	"strconv"
 
 	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
 )
 
 var (
-	ErrBadRequestBody     = errors.New("bad request body")
-	ErrInvalidCredentials = errors.New("invalid email or password")
-	ErrNoUserFound        = errors.New("no user found")
+	ErrBadRequestBody  = apperror.New(apperror.CodeMalformedBody, apperror.Invalid, "bad request body")
+	ErrBadRequestQuery = apperror.New(apperror.CodeMalformedQuery, apperror.Invalid, "bad request query")
+	ErrMissingToken    = apperror.New(apperror.CodeMissingToken, apperror.Invalid, "missing or malformed jwt")
+	ErrInvalidToken    = apperror.New(apperror.CodeInvalidToken, apperror.Unauthorized, "invalid or expired jwt")
+	ErrForbidden       = apperror.New(apperror.CodeForbidden, apperror.Forbidden, "insufficient permission")
+	ErrInvalidUserID   = apperror.New(apperror.CodeInvalidUserID, apperror.Invalid, "invalid user id")
 )
 
 type UserController struct {
-	userService service.UserService
+	userService    service.UserService
+	roleService    service.RoleService
+	keyRing        *utils.KeyRing
+	rateLimitStore ratelimit.Store
+	config         *config.Config
 }
 
-func NewUserController(userService service.UserService) *UserController {
-	return &UserController{userService}
+func NewUserController(userService service.UserService, roleService service.RoleService, keyRing *utils.KeyRing, rateLimitStore ratelimit.Store, config *config.Config) *UserController {
+	return &UserController{userService, roleService, keyRing, rateLimitStore, config}
 }
 
 func (u *UserController) InitRoutes(e *echo.Echo) {
 	// Routes with authentication
 	secure := e.Group("")
-	secure.Use(middleware.JWT([]byte(config.JWT_SECRET)))
+	secure.Use(u.JWT(), u.RejectRevokedToken, u.rateLimit("api", u.config.RateLimit.API))
 
-	secure.GET("/users", u.GetAllUser)
+	secure.GET("/users", u.GetAllUser, u.RequirePermission(entity.PermissionUsersList))
+	secure.GET("/me", u.GetMe)
+	secure.PATCH("/me", u.UpdateMe)
 
-	// Public routes
-	e.POST("/users", u.CreateUser)
-	e.POST("/login", u.Login)
+	manageUser := u.RequireSelfOrPermission(entity.PermissionUsersManage)
+	secure.GET("/users/:id", u.GetUser, manageUser)
+	secure.PATCH("/users/:id", u.UpdateUser, manageUser)
+	secure.DELETE("/users/:id", u.DeleteUser, manageUser)
+	// Not allowed on oneself, or a lockout could be lifted with a stolen
+	// session.
+	secure.POST("/users/:id/unlock", u.UnlockUser, u.RequirePermission(entity.PermissionUsersManage))
+
+	secure.POST("/logout", u.Logout)
+	secure.POST("/logout/all", u.LogoutAll)
+	secure.POST("/2fa/enroll", u.EnrollTwoFactor)
+	secure.POST("/2fa/confirm", u.ConfirmTwoFactor)
+	secure.POST("/2fa/disable", u.DisableTwoFactor)
+
+	// Role management
+	manageRoles := u.RequirePermission(entity.PermissionRolesManage)
+	secure.GET("/roles", u.GetAllRoles, manageRoles)
+	secure.POST("/roles", u.CreateRole, manageRoles)
+	secure.PUT("/roles/:name", u.UpdateRole, manageRoles)
+	secure.DELETE("/roles/:name", u.DeleteRole, manageRoles)
+	secure.GET("/permissions", u.GetAllPermissions, manageRoles)
+	secure.PUT("/users/:id/roles/:name", u.AssignRole, manageRoles)
+	secure.DELETE("/users/:id/roles/:name", u.UnassignRole, manageRoles)
+
+	// Public routes. Middlewares are set per route rather than on a group,
+	// a group would also catch the requests matching no route.
+	e.POST("/users", u.CreateUser, u.rateLimit("signup", u.config.RateLimit.Signup))
+	e.GET("/users/verify", u.VerifyEmail)
+	e.POST("/users/verify/resend", u.ResendVerification, u.resendVerificationLimiter())
+
+	authLimit := u.rateLimit("auth", u.config.RateLimit.Auth)
+	e.POST("/login", u.Login, authLimit)
+	e.POST("/login/mfa", u.LoginMFA, authLimit)
+	e.POST("/token/refresh", u.RefreshToken, authLimit)
+	e.POST("/password/forgot", u.ForgotPassword, authLimit)
+	e.POST("/password/reset", u.ResetPassword, authLimit)
 }
 
 func (u *UserController) GetAllUser(c echo.Context) error {
-	users, err := u.userService.FindAll(c.Request().Context())
+	var query dto.UserListQuery
+	err := (&echo.DefaultBinder{}).BindQueryParams(c, &query)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return ErrBadRequestQuery
 	}
 
-	if len(users) == 0 {
-		return echo.NewHTTPError(http.StatusNotFound, ErrNoUserFound.Error())
+	page, err := u.userService.FindAll(query, c.Request().Context())
+	if err != nil {
+		return err
 	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"message": "Success getting users",
-		"data":    users,
+		"data":    page.Users,
+		"meta":    page.Meta,
+	})
+}
+
+func (u *UserController) GetUser(c echo.Context) error {
+	userID, err := parseUserID(c)
+	if err != nil {
+		return err
+	}
+
+	return u.getUser(c, userID)
+}
+
+func (u *UserController) GetMe(c echo.Context) error {
+	claims := c.Get("user").(*utils.Claims)
+
+	return u.getUser(c, claims.UserID)
+}
+
+func (u *UserController) UpdateUser(c echo.Context) error {
+	userID, err := parseUserID(c)
+	if err != nil {
+		return err
+	}
+
+	return u.updateUser(c, userID)
+}
+
+func (u *UserController) UpdateMe(c echo.Context) error {
+	claims := c.Get("user").(*utils.Claims)
+
+	return u.updateUser(c, claims.UserID)
+}
+
+func (u *UserController) DeleteUser(c echo.Context) error {
+	userID, err := parseUserID(c)
+	if err != nil {
+		return err
+	}
+
+	err = u.userService.DeleteUser(userID, c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Success deleting user",
+	})
+}
+
+// UnlockUser lifts the lockout of a user who failed to log in too often.
+func (u *UserController) UnlockUser(c echo.Context) error {
+	userID, err := parseUserID(c)
+	if err != nil {
+		return err
+	}
+
+	err = u.userService.UnlockUser(userID, c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Success unlocking user",
+	})
+}
+
+func (u *UserController) getUser(c echo.Context, userID uint) error {
+	user, err := u.userService.FindByID(userID, c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Success getting user",
+		"data":    user,
 	})
 }
 
+func (u *UserController) updateUser(c echo.Context, userID uint) error {
+	claims := c.Get("user").(*utils.Claims)
+
+	var request dto.UpdateUserRequest
+	err := bind(c, &request)
+	if err != nil {
+		return err
+	}
+
+	err = c.Validate(&request)
+	if err != nil {
+		return err
+	}
+
+	user, err := u.userService.UpdateUser(claims.UserID, userID, request, c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Success updating user",
+		"data":    user,
+	})
+}
+
+// bind binds the request into i. Validation errors raised by the binder, such
+// as unknown fields, are kept, any other error means the body is malformed.
+func bind(c echo.Context, i interface{}) error {
+	err := c.Bind(i)
+	if _, ok := err.(*apperror.Error); ok {
+		return err
+	}
+
+	if err != nil {
+		return ErrBadRequestBody
+	}
+
+	return nil
+}
+
+// parseUserID reads the :id path parameter.
+func parseUserID(c echo.Context) (uint, error) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return 0, ErrInvalidUserID
+	}
+
+	return uint(userID), nil
+}
+
 func (u *UserController) CreateUser(c echo.Context) error {
 	var user dto.UserRequest
-	err := c.Bind(&user)
+	err := bind(c, &user)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, ErrBadRequestBody.Error())
+		return err
 	}
 
-	err = u.userService.CreateUser(user, c.Request().Context())
+	err = c.Validate(&user)
 	if err != nil {
-		if err == service.ErrUserExists {
-			return echo.NewHTTPError(http.StatusConflict, err.Error())
-		}
+		return err
+	}
 
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	err = u.userService.CreateUser(user, c.Request().Context())
+	if err != nil {
+		return err
 	}
 
 	return c.JSON(http.StatusCreated, map[string]interface{}{
@@ -76,22 +250,230 @@ func (u *UserController) CreateUser(c echo.Context) error {
 
 func (u *UserController) Login(c echo.Context) error {
 	var user dto.UserRequest
-	err := c.Bind(&user)
+	err := bind(c, &user)
+	if err != nil {
+		return err
+	}
+
+	// Not validated, passwords set before the password policy changed must
+	// keep working. Anything invalid is a failed login.
+
+	ctx := service.WithClientIP(c.Request().Context(), c.RealIP())
+	token, err := u.userService.Login(user, ctx)
+	if err != nil {
+		return err
+	}
+
+	if token.MFAToken != "" {
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"message":   "Two-factor authentication required",
+			"mfa_token": token.MFAToken,
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":       "Login success",
+		"token":         token.AccessToken,
+		"refresh_token": token.RefreshToken,
+	})
+}
+
+func (u *UserController) RefreshToken(c echo.Context) error {
+	var request dto.RefreshTokenRequest
+	err := bind(c, &request)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, ErrBadRequestBody.Error())
+		return err
 	}
 
-	token, err := u.userService.Login(user, c.Request().Context())
+	token, err := u.userService.RefreshToken(request, c.Request().Context())
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
-	if token == "" {
-		return echo.NewHTTPError(http.StatusUnauthorized, ErrInvalidCredentials.Error())
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":       "Refresh token success",
+		"token":         token.AccessToken,
+		"refresh_token": token.RefreshToken,
+	})
+}
+
+func (u *UserController) Logout(c echo.Context) error {
+	claims := c.Get("user").(*utils.Claims)
+
+	err := u.userService.Logout(claims, c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Logout success",
+	})
+}
+
+func (u *UserController) LogoutAll(c echo.Context) error {
+	claims := c.Get("user").(*utils.Claims)
+
+	err := u.userService.LogoutAll(claims, c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Logout from all sessions success",
+	})
+}
+
+func (u *UserController) ForgotPassword(c echo.Context) error {
+	var request dto.ForgotPasswordRequest
+	err := bind(c, &request)
+	if err != nil {
+		return err
+	}
+
+	err = c.Validate(&request)
+	if err != nil {
+		return err
+	}
+
+	err = u.userService.ForgotPassword(request, c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusAccepted, map[string]interface{}{
+		"message": "If the email is registered, a password reset link has been sent",
+	})
+}
+
+func (u *UserController) ResetPassword(c echo.Context) error {
+	var request dto.ResetPasswordRequest
+	err := bind(c, &request)
+	if err != nil {
+		return err
+	}
+
+	err = c.Validate(&request)
+	if err != nil {
+		return err
+	}
+
+	err = u.userService.ResetPassword(request, c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Password reset success",
+	})
+}
+
+func (u *UserController) VerifyEmail(c echo.Context) error {
+	err := u.userService.VerifyEmail(c.QueryParam("token"), c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Email verified",
+	})
+}
+
+func (u *UserController) ResendVerification(c echo.Context) error {
+	var request dto.ResendVerificationRequest
+	err := bind(c, &request)
+	if err != nil {
+		return err
+	}
+
+	err = c.Validate(&request)
+	if err != nil {
+		return err
+	}
+
+	err = u.userService.ResendVerification(request, c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusAccepted, map[string]interface{}{
+		"message": "If the email is registered and not verified yet, a verification link has been sent",
+	})
+}
+
+func (u *UserController) LoginMFA(c echo.Context) error {
+	var request dto.MFALoginRequest
+	err := bind(c, &request)
+	if err != nil {
+		return err
+	}
+
+	token, err := u.userService.LoginMFA(request, c.Request().Context())
+	if err == service.ErrInvalidTwoFactorCode {
+		// A wrong code fails the login, while it is a bad request when
+		// managing two-factor authentication.
+		return service.ErrInvalidTwoFactorCode.WithKind(apperror.Unauthorized)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":       "Login success",
+		"token":         token.AccessToken,
+		"refresh_token": token.RefreshToken,
+	})
+}
+
+func (u *UserController) EnrollTwoFactor(c echo.Context) error {
+	claims := c.Get("user").(*utils.Claims)
+
+	enrollment, err := u.userService.EnrollTwoFactor(claims.UserID, c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Scan the otpauth uri and confirm with a code to enable two-factor authentication",
+		"data":    enrollment,
+	})
+}
+
+func (u *UserController) ConfirmTwoFactor(c echo.Context) error {
+	claims := c.Get("user").(*utils.Claims)
+
+	var request dto.TwoFactorCodeRequest
+	err := bind(c, &request)
+	if err != nil {
+		return err
+	}
+
+	recoveryCodes, err := u.userService.ConfirmTwoFactor(claims.UserID, request, c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Two-factor authentication enabled",
+		"data":    recoveryCodes,
+	})
+}
+
+func (u *UserController) DisableTwoFactor(c echo.Context) error {
+	claims := c.Get("user").(*utils.Claims)
+
+	var request dto.TwoFactorCodeRequest
+	err := bind(c, &request)
+	if err != nil {
+		return err
+	}
+
+	err = u.userService.DisableTwoFactor(claims.UserID, request, c.Request().Context())
+	if err != nil {
+		return err
 	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"message": "Login success",
-		"token":   token,
+		"message": "Two-factor authentication disabled",
 	})
 }
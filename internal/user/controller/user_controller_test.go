@@ -3,13 +3,25 @@ package controller
 import (
 	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"encoding/json"
 	"errors"
+	"net/http"
 	"net/http/httptest"
 	"rewrite/internal/user/dto"
 	"rewrite/internal/user/service"
+	"rewrite/pkg/apperror"
+	"rewrite/pkg/config"
+	"rewrite/pkg/entity"
+	"rewrite/pkg/ratelimit"
+	"rewrite/pkg/utils"
+	"rewrite/pkg/validation"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
@@ -17,11 +29,28 @@ import (
 
 type MockUserService struct {
 	mock.Mock
+	// clientIPs are the client IPs logins were attempted from.
+	clientIPs []string
 }
 
-func (m *MockUserService) FindAll(ctx context.Context) (dto.UsersResponse, error) {
-	args := m.Called()
-	return args.Get(0).(dto.UsersResponse), args.Error(1)
+func (m *MockUserService) FindAll(query dto.UserListQuery, ctx context.Context) (*dto.UsersPage, error) {
+	args := m.Called(query)
+	return args.Get(0).(*dto.UsersPage), args.Error(1)
+}
+
+func (m *MockUserService) FindByID(id uint, ctx context.Context) (*dto.UserResponse, error) {
+	args := m.Called(id)
+	return args.Get(0).(*dto.UserResponse), args.Error(1)
+}
+
+func (m *MockUserService) UpdateUser(actorID uint, id uint, request dto.UpdateUserRequest, ctx context.Context) (*dto.UserResponse, error) {
+	args := m.Called(actorID, id, request)
+	return args.Get(0).(*dto.UserResponse), args.Error(1)
+}
+
+func (m *MockUserService) DeleteUser(id uint, ctx context.Context) error {
+	args := m.Called(id)
+	return args.Error(0)
 }
 
 func (m *MockUserService) CreateUser(user dto.UserRequest, ctx context.Context) error {
@@ -29,26 +58,142 @@ func (m *MockUserService) CreateUser(user dto.UserRequest, ctx context.Context)
 	return args.Error(0)
 }
 
-func (m *MockUserService) Login(user dto.UserRequest, ctx context.Context) (string, error) {
+func (m *MockUserService) ProvisionUser(user dto.UserRequest, ctx context.Context) (*dto.UserResponse, error) {
 	args := m.Called(user)
-	return args.String(0), args.Error(1)
+	return args.Get(0).(*dto.UserResponse), args.Error(1)
+}
+
+func (m *MockUserService) SetPassword(user dto.UserRequest, ctx context.Context) error {
+	args := m.Called(user)
+	return args.Error(0)
+}
+
+func (m *MockUserService) Login(user dto.UserRequest, ctx context.Context) (*dto.TokenResponse, error) {
+	m.clientIPs = append(m.clientIPs, service.ClientIP(ctx))
+	args := m.Called(user)
+	return args.Get(0).(*dto.TokenResponse), args.Error(1)
+}
+
+func (m *MockUserService) RefreshToken(request dto.RefreshTokenRequest, ctx context.Context) (*dto.TokenResponse, error) {
+	args := m.Called(request)
+	return args.Get(0).(*dto.TokenResponse), args.Error(1)
+}
+
+func (m *MockUserService) Logout(claims *utils.Claims, ctx context.Context) error {
+	args := m.Called(claims)
+	return args.Error(0)
+}
+
+func (m *MockUserService) LogoutAll(claims *utils.Claims, ctx context.Context) error {
+	args := m.Called(claims)
+	return args.Error(0)
+}
+
+func (m *MockUserService) IsTokenRevoked(claims *utils.Claims, ctx context.Context) (bool, error) {
+	args := m.Called(claims)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockUserService) PruneRevokedTokens(ctx context.Context) (int64, error) {
+	args := m.Called()
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserService) UnlockUser(id uint, ctx context.Context) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockUserService) PruneLoginAttempts(ctx context.Context) (int64, error) {
+	args := m.Called()
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserService) ForgotPassword(request dto.ForgotPasswordRequest, ctx context.Context) error {
+	args := m.Called(request)
+	return args.Error(0)
+}
+
+func (m *MockUserService) ResetPassword(request dto.ResetPasswordRequest, ctx context.Context) error {
+	args := m.Called(request)
+	return args.Error(0)
+}
+
+func (m *MockUserService) VerifyEmail(token string, ctx context.Context) error {
+	args := m.Called(token)
+	return args.Error(0)
+}
+
+func (m *MockUserService) ResendVerification(request dto.ResendVerificationRequest, ctx context.Context) error {
+	args := m.Called(request)
+	return args.Error(0)
+}
+
+func (m *MockUserService) EnrollTwoFactor(userID uint, ctx context.Context) (*dto.TwoFactorEnrollResponse, error) {
+	args := m.Called(userID)
+	return args.Get(0).(*dto.TwoFactorEnrollResponse), args.Error(1)
+}
+
+func (m *MockUserService) ConfirmTwoFactor(userID uint, request dto.TwoFactorCodeRequest, ctx context.Context) (*dto.RecoveryCodesResponse, error) {
+	args := m.Called(userID, request)
+	return args.Get(0).(*dto.RecoveryCodesResponse), args.Error(1)
+}
+
+func (m *MockUserService) DisableTwoFactor(userID uint, request dto.TwoFactorCodeRequest, ctx context.Context) error {
+	args := m.Called(userID, request)
+	return args.Error(0)
+}
+
+func (m *MockUserService) LoginMFA(request dto.MFALoginRequest, ctx context.Context) (*dto.TokenResponse, error) {
+	args := m.Called(request)
+	return args.Get(0).(*dto.TokenResponse), args.Error(1)
 }
 
 type TestSuiteUserControllers struct {
 	suite.Suite
 	mockUserService *MockUserService
+	mockRoleService *MockRoleService
+	keyRing         *utils.KeyRing
+	config          *config.Config
+	retiringKey     *utils.Key
 	userController  *UserController
 	echoApp         *echo.Echo
 }
 
+func newEd25519Key(id string) *utils.Key {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	return &utils.Key{
+		ID:        id,
+		Method:    jwt.SigningMethodEdDSA,
+		SignKey:   private,
+		VerifyKey: public,
+	}
+}
+
 func (s *TestSuiteUserControllers) SetupTest() {
 	s.mockUserService = new(MockUserService)
-	s.userController = NewUserController(s.mockUserService)
+	s.mockRoleService = new(MockRoleService)
+	s.retiringKey = newEd25519Key("retiring")
+	s.keyRing = utils.NewKeyRing(newEd25519Key("active"), s.retiringKey)
+	s.config = config.Default()
+	s.userController = NewUserController(s.mockUserService, s.mockRoleService, s.keyRing, ratelimit.NewMemoryStore(), s.config)
 	s.echoApp = echo.New()
+	s.echoApp.HTTPErrorHandler = apperror.HTTPErrorHandler
+	s.echoApp.Binder = &validation.Binder{}
+	s.echoApp.JSONSerializer = validation.JSONSerializer{}
+	s.echoApp.Validator = validation.New(config.Default().Password)
 }
 
 func (s *TestSuiteUserControllers) TearDownTest() {
 	s.mockUserService = nil
+	s.mockRoleService = nil
+	s.keyRing = nil
+	s.config = nil
+	s.retiringKey = nil
 	s.userController = nil
 	s.echoApp = nil
 }
@@ -60,25 +205,34 @@ func (s *TestSuiteUserControllers) TestInitRoutes() {
 }
 
 func (s *TestSuiteUserControllers) TestGetAllUser() {
+	nextCursor := "eyJzIjoiaWQiLCJpZCI6Mn0"
+
 	for _, tc := range []struct {
 		Name           string
-		FunctionUsers  dto.UsersResponse
+		Query          string
+		ExpectedQuery  dto.UserListQuery
+		FunctionPage   *dto.UsersPage
 		FunctionError  error
 		ExpectedStatus int
 		ExpectedBody   echo.Map
 		ExpectedError  error
 	}{
 		{
-			Name: "Success Get All User",
-			FunctionUsers: dto.UsersResponse{
-				{
-					ID:    1,
-					Email: "123@123.com",
-				},
-				{
-					ID:    2,
-					Email: "456@456.com",
+			Name:          "Success Get All User",
+			Query:         "?limit=2&sort=-created_at&email=example&created_from=2024-01-01T00:00:00Z",
+			ExpectedQuery: dto.UserListQuery{Limit: 2, Sort: "-created_at", Email: "example", CreatedFrom: "2024-01-01T00:00:00Z"},
+			FunctionPage: &dto.UsersPage{
+				Users: dto.UsersResponse{
+					{
+						ID:    1,
+						Email: "123@123.com",
+					},
+					{
+						ID:    2,
+						Email: "456@456.com",
+					},
 				},
+				Meta: dto.PageMeta{Total: 5, Limit: 2, NextCursor: &nextCursor},
 			},
 			ExpectedStatus: 200,
 			ExpectedBody: echo.Map{
@@ -93,17 +247,61 @@ func (s *TestSuiteUserControllers) TestGetAllUser() {
 						"email": "456@456.com",
 					},
 				},
+				"meta": map[string]interface{}{
+					"total":       float64(5),
+					"limit":       float64(2),
+					"offset":      float64(0),
+					"next_cursor": nextCursor,
+				},
 			},
 		},
 		{
-			Name:           "Error no user found",
-			FunctionUsers:  dto.UsersResponse{},
-			ExpectedStatus: 404,
-			ExpectedError:  ErrNoUserFound,
+			Name:          "Success empty page",
+			Query:         "?offset=40",
+			ExpectedQuery: dto.UserListQuery{Offset: 40},
+			FunctionPage: &dto.UsersPage{
+				Users: dto.UsersResponse{},
+				Meta:  dto.PageMeta{Total: 5, Limit: 20, Offset: 40},
+			},
+			ExpectedStatus: 200,
+			ExpectedBody: echo.Map{
+				"message": "Success getting users",
+				"data":    []interface{}{},
+				"meta": map[string]interface{}{
+					"total":       float64(5),
+					"limit":       float64(20),
+					"offset":      float64(40),
+					"next_cursor": nil,
+				},
+			},
+		},
+		{
+			Name:           "Error malformed query",
+			Query:          "?limit=abc",
+			ExpectedStatus: 400,
+			ExpectedError:  ErrBadRequestQuery,
+		},
+		{
+			Name:           "Error invalid sort",
+			Query:          "?sort=password",
+			ExpectedQuery:  dto.UserListQuery{Sort: "password"},
+			FunctionPage:   (*dto.UsersPage)(nil),
+			FunctionError:  service.ErrInvalidSort,
+			ExpectedStatus: 400,
+			ExpectedError:  service.ErrInvalidSort,
+		},
+		{
+			Name:           "Error invalid cursor",
+			Query:          "?cursor=abc",
+			ExpectedQuery:  dto.UserListQuery{Cursor: "abc"},
+			FunctionPage:   (*dto.UsersPage)(nil),
+			FunctionError:  service.ErrInvalidCursor,
+			ExpectedStatus: 400,
+			ExpectedError:  service.ErrInvalidCursor,
 		},
 		{
 			Name:           "Generic error from service",
-			FunctionUsers:  dto.UsersResponse{},
+			FunctionPage:   (*dto.UsersPage)(nil),
 			FunctionError:  errors.New("Generic error"),
 			ExpectedStatus: 500,
 			ExpectedError:  errors.New("Generic error"),
@@ -111,16 +309,17 @@ func (s *TestSuiteUserControllers) TestGetAllUser() {
 	} {
 		s.Run(tc.Name, func() {
 			s.SetupTest()
-			s.mockUserService.On("FindAll").Return(tc.FunctionUsers, tc.FunctionError)
+			s.mockUserService.On("FindAll", tc.ExpectedQuery).Return(tc.FunctionPage, tc.FunctionError)
 
-			r := httptest.NewRequest("GET", "/users", nil)
+			r := httptest.NewRequest("GET", "/users"+tc.Query, nil)
 			w := httptest.NewRecorder()
 			c := s.echoApp.NewContext(r, w)
 
 			err := s.userController.GetAllUser(c)
 
 			if tc.ExpectedError != nil {
-				s.Equal(echo.NewHTTPError(tc.ExpectedStatus, tc.ExpectedError.Error()), err)
+				s.Equal(tc.ExpectedError, err)
+				s.Equal(tc.ExpectedStatus, apperror.Status(err))
 			} else {
 				s.NoError(err)
 
@@ -137,51 +336,158 @@ func (s *TestSuiteUserControllers) TestGetAllUser() {
 	}
 }
 
-func (s *TestSuiteUserControllers) TestCreateUser() {
+func (s *TestSuiteUserControllers) TestGetUser() {
 	for _, tc := range []struct {
 		Name           string
-		RequestBody    interface{}
-		RequestContent string
+		UserID         string
+		FunctionUser   *dto.UserResponse
 		FunctionError  error
 		ExpectedStatus int
 		ExpectedBody   echo.Map
 		ExpectedError  error
 	}{
 		{
-			Name: "Success Create User",
-			RequestBody: dto.UserRequest{
-				Email:    "123@123.com",
-				Password: "123",
-			},
-			RequestContent: "application/json",
-			ExpectedStatus: 201,
+			Name:           "Success",
+			UserID:         "1",
+			FunctionUser:   &dto.UserResponse{ID: 1, Email: "123@123.com"},
+			ExpectedStatus: 200,
 			ExpectedBody: echo.Map{
-				"message": "Success creating user",
+				"message": "Success getting user",
+				"data": map[string]interface{}{
+					"id":    float64(1),
+					"email": "123@123.com",
+				},
 			},
 		},
 		{
-			Name: "Error user already exist",
-			RequestBody: dto.UserRequest{
-				Email:    "123@123.com",
-				Password: "123",
-			},
-			RequestContent: "application/json",
-			FunctionError:  service.ErrUserExists,
-			ExpectedStatus: 409,
-			ExpectedError:  service.ErrUserExists,
+			Name:           "User not found",
+			UserID:         "1",
+			FunctionError:  service.ErrUserNotFound,
+			ExpectedStatus: 404,
+			ExpectedError:  service.ErrUserNotFound,
+		},
+		{
+			Name:           "Invalid user id",
+			UserID:         "abc",
+			ExpectedStatus: 400,
+			ExpectedError:  ErrInvalidUserID,
 		},
 		{
 			Name:           "Generic error from service",
-			RequestBody:    dto.UserRequest{},
-			RequestContent: "application/json",
+			UserID:         "1",
 			FunctionError:  errors.New("Generic error"),
 			ExpectedStatus: 500,
 			ExpectedError:  errors.New("Generic error"),
 		},
+	} {
+		s.Run(tc.Name, func() {
+			s.SetupTest()
+			s.mockUserService.On("FindByID", uint(1)).Return(tc.FunctionUser, tc.FunctionError)
+
+			r := httptest.NewRequest("GET", "/", nil)
+			w := httptest.NewRecorder()
+			c := s.echoApp.NewContext(r, w)
+			c.SetPath("/users/:id")
+			c.SetParamNames("id")
+			c.SetParamValues(tc.UserID)
+
+			err := s.userController.GetUser(c)
+
+			if tc.ExpectedError != nil {
+				s.Equal(tc.ExpectedError, err)
+				s.Equal(tc.ExpectedStatus, apperror.Status(err))
+			} else {
+				s.NoError(err)
+
+				var response echo.Map
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				s.NoError(err)
+
+				s.Equal(tc.ExpectedStatus, w.Result().StatusCode)
+				s.Equal(tc.ExpectedBody, response)
+			}
+
+			s.TearDownTest()
+		})
+	}
+}
+
+func (s *TestSuiteUserControllers) TestGetMe() {
+	s.mockUserService.On("FindByID", uint(7)).Return(&dto.UserResponse{ID: 7, Email: "123@123.com"}, nil)
+
+	r := httptest.NewRequest("GET", "/me", nil)
+	w := httptest.NewRecorder()
+	c := s.echoApp.NewContext(r, w)
+	c.Set("user", &utils.Claims{UserID: 7})
+
+	err := s.userController.GetMe(c)
+	s.NoError(err)
+	s.Equal(http.StatusOK, w.Code)
+	s.mockUserService.AssertCalled(s.T(), "FindByID", uint(7))
+}
+
+func (s *TestSuiteUserControllers) TestUpdateUser() {
+	email := "456@456.com"
+
+	for _, tc := range []struct {
+		Name           string
+		UserID         string
+		RequestBody    interface{}
+		FunctionUser   *dto.UserResponse
+		FunctionError  error
+		ExpectedStatus int
+		ExpectedBody   echo.Map
+		ExpectedError  error
+	}{
+		{
+			Name:           "Success",
+			UserID:         "1",
+			RequestBody:    dto.UpdateUserRequest{Email: &email},
+			FunctionUser:   &dto.UserResponse{ID: 1, Email: email},
+			ExpectedStatus: 200,
+			ExpectedBody: echo.Map{
+				"message": "Success updating user",
+				"data": map[string]interface{}{
+					"id":    float64(1),
+					"email": email,
+				},
+			},
+		},
+		{
+			Name:           "Email taken",
+			UserID:         "1",
+			RequestBody:    dto.UpdateUserRequest{Email: &email},
+			FunctionError:  service.ErrUserExists,
+			ExpectedStatus: 409,
+			ExpectedError:  service.ErrUserExists,
+		},
+		{
+			Name:           "Wrong current password",
+			UserID:         "1",
+			RequestBody:    dto.UpdateUserRequest{Email: &email},
+			FunctionError:  service.ErrWrongPassword,
+			ExpectedStatus: 403,
+			ExpectedError:  service.ErrWrongPassword,
+		},
+		{
+			Name:           "User not found",
+			UserID:         "1",
+			RequestBody:    dto.UpdateUserRequest{Email: &email},
+			FunctionError:  service.ErrUserNotFound,
+			ExpectedStatus: 404,
+			ExpectedError:  service.ErrUserNotFound,
+		},
+		{
+			Name:           "Invalid user id",
+			UserID:         "abc",
+			RequestBody:    dto.UpdateUserRequest{Email: &email},
+			ExpectedStatus: 400,
+			ExpectedError:  ErrInvalidUserID,
+		},
 		{
 			Name:           "Error invalid request body",
+			UserID:         "1",
 			RequestBody:    "invalid body",
-			RequestContent: "application/json",
 			ExpectedStatus: 400,
 			ExpectedError:  ErrBadRequestBody,
 		},
@@ -192,16 +498,21 @@ func (s *TestSuiteUserControllers) TestCreateUser() {
 			jsonBody, err := json.Marshal(tc.RequestBody)
 			s.NoError(err)
 
-			r := httptest.NewRequest("POST", "/users", bytes.NewBuffer(jsonBody))
-			r.Header.Set("Content-Type", tc.RequestContent)
+			r := httptest.NewRequest("PATCH", "/", bytes.NewBuffer(jsonBody))
+			r.Header.Set("Content-Type", "application/json")
 			w := httptest.NewRecorder()
 			c := s.echoApp.NewContext(r, w)
+			c.SetPath("/users/:id")
+			c.SetParamNames("id")
+			c.SetParamValues(tc.UserID)
+			c.Set("user", &utils.Claims{UserID: 2})
 
-			s.mockUserService.On("CreateUser", tc.RequestBody).Return(tc.FunctionError)
-			err = s.userController.CreateUser(c)
+			s.mockUserService.On("UpdateUser", uint(2), uint(1), mock.Anything).Return(tc.FunctionUser, tc.FunctionError)
+			err = s.userController.UpdateUser(c)
 
 			if tc.ExpectedError != nil {
-				s.Equal(echo.NewHTTPError(tc.ExpectedStatus, tc.ExpectedError.Error()), err)
+				s.Equal(tc.ExpectedError, err)
+				s.Equal(tc.ExpectedStatus, apperror.Status(err))
 			} else {
 				s.NoError(err)
 
@@ -211,6 +522,7 @@ func (s *TestSuiteUserControllers) TestCreateUser() {
 
 				s.Equal(tc.ExpectedStatus, w.Result().StatusCode)
 				s.Equal(tc.ExpectedBody, response)
+				s.mockUserService.AssertCalled(s.T(), "UpdateUser", uint(2), uint(1), tc.RequestBody)
 			}
 
 			s.TearDownTest()
@@ -218,74 +530,1435 @@ func (s *TestSuiteUserControllers) TestCreateUser() {
 	}
 }
 
-func (s *TestSuiteUserControllers) TestLogin() {
+func (s *TestSuiteUserControllers) TestUpdateMe() {
+	password := "new-password"
+	request := dto.UpdateUserRequest{Password: &password, CurrentPassword: "123"}
+	s.mockUserService.On("UpdateUser", uint(7), uint(7), request).Return(&dto.UserResponse{ID: 7}, nil)
+
+	jsonBody, err := json.Marshal(request)
+	s.NoError(err)
+
+	r := httptest.NewRequest("PATCH", "/me", bytes.NewBuffer(jsonBody))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	c := s.echoApp.NewContext(r, w)
+	c.Set("user", &utils.Claims{UserID: 7})
+
+	err = s.userController.UpdateMe(c)
+	s.NoError(err)
+	s.Equal(http.StatusOK, w.Code)
+	s.mockUserService.AssertCalled(s.T(), "UpdateUser", uint(7), uint(7), request)
+}
+
+func (s *TestSuiteUserControllers) TestDeleteUser() {
 	for _, tc := range []struct {
 		Name           string
-		RequestBody    interface{}
-		RequestContent string
+		UserID         string
 		FunctionError  error
-		FunctionReturn string
 		ExpectedStatus int
-		ExpectedBody   echo.Map
 		ExpectedError  error
 	}{
 		{
-			Name: "Success Login",
-			RequestBody: dto.UserRequest{
-				Email:    "123@123.com",
-				Password: "123",
-			},
-			RequestContent: "application/json",
-			FunctionReturn: "token",
+			Name:           "Success",
+			UserID:         "1",
 			ExpectedStatus: 200,
-			ExpectedBody: echo.Map{
-				"message": "Login success",
-				"token":   "token",
-			},
 		},
 		{
-			Name: "Error invalid email or password",
-			RequestBody: dto.UserRequest{
-				Email:    "123@123.com",
-				Password: "123",
-			},
-			RequestContent: "application/json",
-			FunctionReturn: "",
-			ExpectedStatus: 401,
-			ExpectedError:  ErrInvalidCredentials,
+			Name:           "User not found",
+			UserID:         "1",
+			FunctionError:  service.ErrUserNotFound,
+			ExpectedStatus: 404,
+			ExpectedError:  service.ErrUserNotFound,
+		},
+		{
+			Name:           "Invalid user id",
+			UserID:         "abc",
+			ExpectedStatus: 400,
+			ExpectedError:  ErrInvalidUserID,
 		},
 		{
 			Name:           "Generic error from service",
-			RequestBody:    dto.UserRequest{},
-			RequestContent: "application/json",
+			UserID:         "1",
 			FunctionError:  errors.New("Generic error"),
 			ExpectedStatus: 500,
 			ExpectedError:  errors.New("Generic error"),
 		},
+	} {
+		s.Run(tc.Name, func() {
+			s.SetupTest()
+			s.mockUserService.On("DeleteUser", uint(1)).Return(tc.FunctionError)
+
+			r := httptest.NewRequest("DELETE", "/", nil)
+			w := httptest.NewRecorder()
+			c := s.echoApp.NewContext(r, w)
+			c.SetPath("/users/:id")
+			c.SetParamNames("id")
+			c.SetParamValues(tc.UserID)
+
+			err := s.userController.DeleteUser(c)
+
+			if tc.ExpectedError != nil {
+				s.Equal(tc.ExpectedError, err)
+				s.Equal(tc.ExpectedStatus, apperror.Status(err))
+			} else {
+				s.NoError(err)
+				s.Equal(tc.ExpectedStatus, w.Result().StatusCode)
+			}
+
+			s.TearDownTest()
+		})
+	}
+}
+
+func (s *TestSuiteUserControllers) TestUnlockUser() {
+	for _, tc := range []struct {
+		Name           string
+		UserID         string
+		FunctionError  error
+		ExpectedStatus int
+		ExpectedError  error
+	}{
+		{
+			Name:           "Success",
+			UserID:         "1",
+			ExpectedStatus: 200,
+		},
 		{
-			Name:           "Error invalid request body",
-			RequestBody:    "invalid body",
-			RequestContent: "application/json",
+			Name:           "User not found",
+			UserID:         "1",
+			FunctionError:  service.ErrUserNotFound,
+			ExpectedStatus: 404,
+			ExpectedError:  service.ErrUserNotFound,
+		},
+		{
+			Name:           "Invalid user id",
+			UserID:         "abc",
 			ExpectedStatus: 400,
-			ExpectedError:  ErrBadRequestBody,
+			ExpectedError:  ErrInvalidUserID,
 		},
 	} {
 		s.Run(tc.Name, func() {
 			s.SetupTest()
+			s.mockUserService.On("UnlockUser", uint(1)).Return(tc.FunctionError)
 
-			jsonBody, err := json.Marshal(tc.RequestBody)
-			s.NoError(err)
-
-			r := httptest.NewRequest("POST", "/users", bytes.NewBuffer(jsonBody))
-			r.Header.Set("Content-Type", tc.RequestContent)
+			r := httptest.NewRequest("POST", "/", nil)
 			w := httptest.NewRecorder()
 			c := s.echoApp.NewContext(r, w)
+			c.SetPath("/users/:id/unlock")
+			c.SetParamNames("id")
+			c.SetParamValues(tc.UserID)
 
-			s.mockUserService.On("Login", tc.RequestBody).Return(tc.FunctionReturn, tc.FunctionError)
-			err = s.userController.Login(c)
+			err := s.userController.UnlockUser(c)
+
+			if tc.ExpectedError != nil {
+				s.Equal(tc.ExpectedError, err)
+				s.Equal(tc.ExpectedStatus, apperror.Status(err))
+			} else {
+				s.NoError(err)
+				s.Equal(tc.ExpectedStatus, w.Result().StatusCode)
+			}
+
+			s.TearDownTest()
+		})
+	}
+}
+
+func (s *TestSuiteUserControllers) TestRequireSelfOrPermission() {
+	for _, tc := range []struct {
+		Name           string
+		UserID         string
+		Claims         interface{}
+		Allowed        bool
+		ExpectLookup   bool
+		ExpectedStatus int
+		ExpectedError  error
+	}{
+		{
+			Name:           "Own record",
+			UserID:         "1",
+			Claims:         &utils.Claims{UserID: 1},
+			ExpectedStatus: 200,
+		},
+		{
+			Name:           "Someone else's record with permission",
+			UserID:         "2",
+			Claims:         &utils.Claims{UserID: 1, Roles: []string{"admin"}},
+			Allowed:        true,
+			ExpectLookup:   true,
+			ExpectedStatus: 200,
+		},
+		{
+			Name:           "Someone else's record without permission",
+			UserID:         "2",
+			Claims:         &utils.Claims{UserID: 1},
+			ExpectLookup:   true,
+			ExpectedStatus: 403,
+			ExpectedError:  ErrForbidden,
+		},
+		{
+			Name:           "Missing claims",
+			UserID:         "1",
+			Claims:         nil,
+			ExpectedStatus: 401,
+			ExpectedError:  ErrInvalidToken,
+		},
+	} {
+		s.Run(tc.Name, func() {
+			s.SetupTest()
+
+			r := httptest.NewRequest("GET", "/", nil)
+			w := httptest.NewRecorder()
+			c := s.echoApp.NewContext(r, w)
+			c.SetPath("/users/:id")
+			c.SetParamNames("id")
+			c.SetParamValues(tc.UserID)
+			c.Set("user", tc.Claims)
+
+			s.mockRoleService.On("HasPermission", mock.Anything, entity.PermissionUsersManage).Return(tc.Allowed, nil)
+			err := s.userController.RequireSelfOrPermission(entity.PermissionUsersManage)(func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})(c)
+
+			if tc.ExpectedError != nil {
+				s.Equal(tc.ExpectedError, err)
+				s.Equal(tc.ExpectedStatus, apperror.Status(err))
+			} else {
+				s.NoError(err)
+				s.Equal(tc.ExpectedStatus, w.Result().StatusCode)
+			}
+
+			if tc.ExpectLookup {
+				s.mockRoleService.AssertCalled(s.T(), "HasPermission", mock.Anything, entity.PermissionUsersManage)
+			} else {
+				s.mockRoleService.AssertNotCalled(s.T(), "HasPermission", mock.Anything, mock.Anything)
+			}
+
+			s.TearDownTest()
+		})
+	}
+}
+
+func (s *TestSuiteUserControllers) TestCreateUser() {
+	for _, tc := range []struct {
+		Name           string
+		RequestBody    interface{}
+		RequestContent string
+		FunctionError  error
+		ExpectedStatus int
+		ExpectedBody   echo.Map
+		ExpectedError  error
+	}{
+		{
+			Name: "Success Create User",
+			RequestBody: dto.UserRequest{
+				Email:    "123@123.com",
+				Password: "12345678",
+			},
+			RequestContent: "application/json",
+			ExpectedStatus: 201,
+			ExpectedBody: echo.Map{
+				"message": "Success creating user",
+			},
+		},
+		{
+			Name: "Error user already exist",
+			RequestBody: dto.UserRequest{
+				Email:    "123@123.com",
+				Password: "12345678",
+			},
+			RequestContent: "application/json",
+			FunctionError:  service.ErrUserExists,
+			ExpectedStatus: 409,
+			ExpectedError:  service.ErrUserExists,
+		},
+		{
+			Name:           "Generic error from service",
+			RequestBody:    dto.UserRequest{Email: "123@123.com", Password: "12345678"},
+			RequestContent: "application/json",
+			FunctionError:  errors.New("Generic error"),
+			ExpectedStatus: 500,
+			ExpectedError:  errors.New("Generic error"),
+		},
+		{
+			Name:           "Error invalid request body",
+			RequestBody:    "invalid body",
+			RequestContent: "application/json",
+			ExpectedStatus: 400,
+			ExpectedError:  ErrBadRequestBody,
+		},
+		{
+			Name: "Error invalid email and password",
+			RequestBody: dto.UserRequest{
+				Email:    "123",
+				Password: "123",
+			},
+			RequestContent: "application/json",
+			ExpectedStatus: 422,
+			ExpectedError: apperror.Validation(
+				apperror.FieldError{Field: "email", Rule: "email", Message: "must be a valid email address"},
+				apperror.FieldError{Field: "password", Rule: "password", Message: "must be at least 8 characters long"},
+			),
+		},
+		{
+			Name: "Error password too long",
+			RequestBody: dto.UserRequest{
+				Email:    "123@123.com",
+				Password: strings.Repeat("a", 129),
+			},
+			RequestContent: "application/json",
+			ExpectedStatus: 422,
+			ExpectedError: apperror.Validation(
+				apperror.FieldError{Field: "password", Rule: "password", Message: "must be at most 128 bytes long"},
+			),
+		},
+		{
+			Name: "Error unknown field",
+			RequestBody: echo.Map{
+				"email":    "123@123.com",
+				"password": "12345678",
+				"role":     "admin",
+			},
+			RequestContent: "application/json",
+			ExpectedStatus: 422,
+			ExpectedError: apperror.Validation(
+				apperror.FieldError{Field: "role", Rule: "unknown", Message: "is not a known field"},
+			),
+		},
+	} {
+		s.Run(tc.Name, func() {
+			s.SetupTest()
+
+			jsonBody, err := json.Marshal(tc.RequestBody)
+			s.NoError(err)
+
+			r := httptest.NewRequest("POST", "/users", bytes.NewBuffer(jsonBody))
+			r.Header.Set("Content-Type", tc.RequestContent)
+			w := httptest.NewRecorder()
+			c := s.echoApp.NewContext(r, w)
+
+			s.mockUserService.On("CreateUser", tc.RequestBody).Return(tc.FunctionError)
+			err = s.userController.CreateUser(c)
+
+			if tc.ExpectedError != nil {
+				s.Equal(tc.ExpectedError, err)
+				s.Equal(tc.ExpectedStatus, apperror.Status(err))
+			} else {
+				s.NoError(err)
+
+				var response echo.Map
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				s.NoError(err)
+
+				s.Equal(tc.ExpectedStatus, w.Result().StatusCode)
+				s.Equal(tc.ExpectedBody, response)
+			}
+
+			s.TearDownTest()
+		})
+	}
+}
+
+func (s *TestSuiteUserControllers) TestLogin() {
+	for _, tc := range []struct {
+		Name           string
+		RequestBody    interface{}
+		RequestContent string
+		FunctionError  error
+		FunctionReturn *dto.TokenResponse
+		ExpectedStatus int
+		ExpectedBody   echo.Map
+		ExpectedError  error
+	}{
+		{
+			Name: "Success Login",
+			RequestBody: dto.UserRequest{
+				Email:    "123@123.com",
+				Password: "123",
+			},
+			RequestContent: "application/json",
+			FunctionReturn: &dto.TokenResponse{
+				AccessToken:  "token",
+				RefreshToken: "refresh",
+			},
+			ExpectedStatus: 200,
+			ExpectedBody: echo.Map{
+				"message":       "Login success",
+				"token":         "token",
+				"refresh_token": "refresh",
+			},
+		},
+		{
+			Name: "Error invalid email or password",
+			RequestBody: dto.UserRequest{
+				Email:    "123@123.com",
+				Password: "123",
+			},
+			RequestContent: "application/json",
+			FunctionError:  service.ErrInvalidCredentials,
+			ExpectedStatus: 401,
+			ExpectedError:  service.ErrInvalidCredentials,
+		},
+		{
+			Name: "Two-factor authentication required",
+			RequestBody: dto.UserRequest{
+				Email:    "123@123.com",
+				Password: "123",
+			},
+			RequestContent: "application/json",
+			FunctionReturn: &dto.TokenResponse{
+				MFAToken: "mfa",
+			},
+			ExpectedStatus: 200,
+			ExpectedBody: echo.Map{
+				"message":   "Two-factor authentication required",
+				"mfa_token": "mfa",
+			},
+		},
+		{
+			Name: "Error email not verified",
+			RequestBody: dto.UserRequest{
+				Email:    "123@123.com",
+				Password: "123",
+			},
+			RequestContent: "application/json",
+			FunctionError:  service.ErrEmailNotVerified,
+			ExpectedStatus: 403,
+			ExpectedError:  service.ErrEmailNotVerified,
+		},
+		{
+			Name:           "Generic error from service",
+			RequestBody:    dto.UserRequest{},
+			RequestContent: "application/json",
+			FunctionError:  errors.New("Generic error"),
+			ExpectedStatus: 500,
+			ExpectedError:  errors.New("Generic error"),
+		},
+		{
+			Name:           "Error invalid request body",
+			RequestBody:    "invalid body",
+			RequestContent: "application/json",
+			ExpectedStatus: 400,
+			ExpectedError:  ErrBadRequestBody,
+		},
+	} {
+		s.Run(tc.Name, func() {
+			s.SetupTest()
+
+			jsonBody, err := json.Marshal(tc.RequestBody)
+			s.NoError(err)
+
+			r := httptest.NewRequest("POST", "/users", bytes.NewBuffer(jsonBody))
+			r.Header.Set("Content-Type", tc.RequestContent)
+			w := httptest.NewRecorder()
+			c := s.echoApp.NewContext(r, w)
+
+			s.mockUserService.On("Login", tc.RequestBody).Return(tc.FunctionReturn, tc.FunctionError)
+			err = s.userController.Login(c)
+
+			if tc.ExpectedError != nil {
+				s.Equal(tc.ExpectedError, err)
+				s.Equal(tc.ExpectedStatus, apperror.Status(err))
+			} else {
+				s.NoError(err)
+
+				var response echo.Map
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				s.NoError(err)
+
+				s.Equal(tc.ExpectedStatus, w.Result().StatusCode)
+				s.Equal(tc.ExpectedBody, response)
+			}
+
+			s.TearDownTest()
+		})
+	}
+}
+
+func (s *TestSuiteUserControllers) TestLoginIgnoresSpoofedForwardedFor() {
+	s.echoApp.IPExtractor = echo.ExtractIPDirect()
+	request := dto.UserRequest{Email: "123@123.com", Password: "123"}
+	s.mockUserService.On("Login", request).Return((*dto.TokenResponse)(nil), service.ErrInvalidCredentials)
+
+	for _, forwardedFor := range []string{"198.51.100.1", "198.51.100.2", "198.51.100.3"} {
+		jsonBody, err := json.Marshal(request)
+		s.NoError(err)
+
+		r := httptest.NewRequest("POST", "/login", bytes.NewBuffer(jsonBody))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("X-Forwarded-For", forwardedFor)
+		c := s.echoApp.NewContext(r, httptest.NewRecorder())
+
+		s.Equal(service.ErrInvalidCredentials, s.userController.Login(c))
+	}
+
+	s.Equal([]string{"192.0.2.1", "192.0.2.1", "192.0.2.1"}, s.mockUserService.clientIPs)
+}
+
+func (s *TestSuiteUserControllers) TestRefreshToken() {
+	for _, tc := range []struct {
+		Name           string
+		RequestBody    interface{}
+		RequestContent string
+		FunctionError  error
+		FunctionReturn *dto.TokenResponse
+		ExpectedStatus int
+		ExpectedBody   echo.Map
+		ExpectedError  error
+	}{
+		{
+			Name: "Success Refresh Token",
+			RequestBody: dto.RefreshTokenRequest{
+				RefreshToken: "refresh",
+			},
+			RequestContent: "application/json",
+			FunctionReturn: &dto.TokenResponse{
+				AccessToken:  "new token",
+				RefreshToken: "new refresh",
+			},
+			ExpectedStatus: 200,
+			ExpectedBody: echo.Map{
+				"message":       "Refresh token success",
+				"token":         "new token",
+				"refresh_token": "new refresh",
+			},
+		},
+		{
+			Name: "Error invalid refresh token",
+			RequestBody: dto.RefreshTokenRequest{
+				RefreshToken: "refresh",
+			},
+			RequestContent: "application/json",
+			FunctionError:  service.ErrInvalidRefreshToken,
+			ExpectedStatus: 401,
+			ExpectedError:  service.ErrInvalidRefreshToken,
+		},
+		{
+			Name: "Error refresh token reused",
+			RequestBody: dto.RefreshTokenRequest{
+				RefreshToken: "refresh",
+			},
+			RequestContent: "application/json",
+			FunctionError:  service.ErrRefreshTokenReused,
+			ExpectedStatus: 401,
+			ExpectedError:  service.ErrRefreshTokenReused,
+		},
+		{
+			Name:           "Generic error from service",
+			RequestBody:    dto.RefreshTokenRequest{},
+			RequestContent: "application/json",
+			FunctionError:  errors.New("Generic error"),
+			ExpectedStatus: 500,
+			ExpectedError:  errors.New("Generic error"),
+		},
+		{
+			Name:           "Error invalid request body",
+			RequestBody:    "invalid body",
+			RequestContent: "application/json",
+			ExpectedStatus: 400,
+			ExpectedError:  ErrBadRequestBody,
+		},
+	} {
+		s.Run(tc.Name, func() {
+			s.SetupTest()
+
+			jsonBody, err := json.Marshal(tc.RequestBody)
+			s.NoError(err)
+
+			r := httptest.NewRequest("POST", "/token/refresh", bytes.NewBuffer(jsonBody))
+			r.Header.Set("Content-Type", tc.RequestContent)
+			w := httptest.NewRecorder()
+			c := s.echoApp.NewContext(r, w)
+
+			s.mockUserService.On("RefreshToken", tc.RequestBody).Return(tc.FunctionReturn, tc.FunctionError)
+			err = s.userController.RefreshToken(c)
+
+			if tc.ExpectedError != nil {
+				s.Equal(tc.ExpectedError, err)
+				s.Equal(tc.ExpectedStatus, apperror.Status(err))
+			} else {
+				s.NoError(err)
+
+				var response echo.Map
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				s.NoError(err)
+
+				s.Equal(tc.ExpectedStatus, w.Result().StatusCode)
+				s.Equal(tc.ExpectedBody, response)
+			}
+
+			s.TearDownTest()
+		})
+	}
+}
+
+func (s *TestSuiteUserControllers) TestLogout() {
+	for _, tc := range []struct {
+		Name           string
+		Handler        func(u *UserController) echo.HandlerFunc
+		Method         string
+		FunctionError  error
+		ExpectedStatus int
+		ExpectedBody   echo.Map
+		ExpectedError  error
+	}{
+		{
+			Name:           "Success Logout",
+			Handler:        func(u *UserController) echo.HandlerFunc { return u.Logout },
+			Method:         "Logout",
+			ExpectedStatus: 200,
+			ExpectedBody: echo.Map{
+				"message": "Logout success",
+			},
+		},
+		{
+			Name:           "Generic error from service on Logout",
+			Handler:        func(u *UserController) echo.HandlerFunc { return u.Logout },
+			Method:         "Logout",
+			FunctionError:  errors.New("Generic error"),
+			ExpectedStatus: 500,
+			ExpectedError:  errors.New("Generic error"),
+		},
+		{
+			Name:           "Success Logout All",
+			Handler:        func(u *UserController) echo.HandlerFunc { return u.LogoutAll },
+			Method:         "LogoutAll",
+			ExpectedStatus: 200,
+			ExpectedBody: echo.Map{
+				"message": "Logout from all sessions success",
+			},
+		},
+		{
+			Name:           "Generic error from service on Logout All",
+			Handler:        func(u *UserController) echo.HandlerFunc { return u.LogoutAll },
+			Method:         "LogoutAll",
+			FunctionError:  errors.New("Generic error"),
+			ExpectedStatus: 500,
+			ExpectedError:  errors.New("Generic error"),
+		},
+	} {
+		s.Run(tc.Name, func() {
+			s.SetupTest()
+
+			claims := &utils.Claims{UserID: 1}
+			r := httptest.NewRequest("POST", "/logout", nil)
+			w := httptest.NewRecorder()
+			c := s.echoApp.NewContext(r, w)
+			c.Set("user", claims)
+
+			s.mockUserService.On(tc.Method, claims).Return(tc.FunctionError)
+			err := tc.Handler(s.userController)(c)
+
+			if tc.ExpectedError != nil {
+				s.Equal(tc.ExpectedError, err)
+				s.Equal(tc.ExpectedStatus, apperror.Status(err))
+			} else {
+				s.NoError(err)
+
+				var response echo.Map
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				s.NoError(err)
+
+				s.Equal(tc.ExpectedStatus, w.Result().StatusCode)
+				s.Equal(tc.ExpectedBody, response)
+			}
+
+			s.TearDownTest()
+		})
+	}
+}
+
+func (s *TestSuiteUserControllers) TestJWT() {
+	signWith := func(key *utils.Key, method jwt.SigningMethod, signKey interface{}) string {
+		token := jwt.NewWithClaims(method, utils.Claims{
+			UserID:  1,
+			Purpose: utils.PurposeAccess,
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			},
+		})
+		token.Header["kid"] = key.ID
+		signed, err := token.SignedString(signKey)
+		s.NoError(err)
+		return signed
+	}
+
+	for _, tc := range []struct {
+		Name           string
+		Token          func() string
+		ExpectedStatus int
+	}{
+		{
+			Name: "Token signed by active key",
+			Token: func() string {
+				signed, err := utils.GenerateToken(s.keyRing, &entity.User{}, "", time.Minute)
+				s.NoError(err)
+				return signed
+			},
+			ExpectedStatus: 200,
+		},
+		{
+			Name: "Token signed by retiring key",
+			Token: func() string {
+				return signWith(s.retiringKey, jwt.SigningMethodEdDSA, s.retiringKey.SignKey)
+			},
+			ExpectedStatus: 200,
+		},
+		{
+			Name: "Token minted for another purpose",
+			Token: func() string {
+				signed, err := utils.GenerateVerificationToken(s.keyRing, &entity.User{}, time.Minute)
+				s.NoError(err)
+				return signed
+			},
+			ExpectedStatus: 401,
+		},
+		{
+			Name: "Token with unknown kid",
+			Token: func() string {
+				return signWith(newEd25519Key("unknown"), jwt.SigningMethodEdDSA, newEd25519Key("unknown").SignKey)
+			},
+			ExpectedStatus: 401,
+		},
+		{
+			Name: "Token with algorithm not matching the key",
+			Token: func() string {
+				return signWith(s.retiringKey, jwt.SigningMethodHS256, []byte(s.retiringKey.VerifyKey.(ed25519.PublicKey)))
+			},
+			ExpectedStatus: 401,
+		},
+	} {
+		s.Run(tc.Name, func() {
+			s.SetupTest()
+
+			r := httptest.NewRequest("GET", "/users", nil)
+			r.Header.Set(echo.HeaderAuthorization, "Bearer "+tc.Token())
+			w := httptest.NewRecorder()
+			c := s.echoApp.NewContext(r, w)
+
+			err := s.userController.JWT()(func(c echo.Context) error {
+				s.IsType(&utils.Claims{}, c.Get("user"))
+				return c.NoContent(http.StatusOK)
+			})(c)
+
+			if tc.ExpectedStatus != 200 {
+				s.Error(err)
+				s.Equal(tc.ExpectedStatus, apperror.Status(err))
+			} else {
+				s.NoError(err)
+				s.Equal(tc.ExpectedStatus, w.Result().StatusCode)
+			}
+
+			s.TearDownTest()
+		})
+	}
+}
+
+func (s *TestSuiteUserControllers) TestRejectRevokedToken() {
+	for _, tc := range []struct {
+		Name           string
+		Claims         interface{}
+		Revoked        bool
+		FunctionError  error
+		ExpectedStatus int
+		ExpectedError  error
+	}{
+		{
+			Name:           "Token not revoked",
+			Claims:         &utils.Claims{UserID: 1},
+			ExpectedStatus: 200,
+		},
+		{
+			Name:           "Token revoked",
+			Claims:         &utils.Claims{UserID: 1},
+			Revoked:        true,
+			ExpectedStatus: 401,
+			ExpectedError:  ErrInvalidToken,
+		},
+		{
+			Name:           "Missing claims",
+			Claims:         nil,
+			ExpectedStatus: 401,
+			ExpectedError:  ErrInvalidToken,
+		},
+		{
+			Name:           "Generic error from service",
+			Claims:         &utils.Claims{UserID: 1},
+			FunctionError:  errors.New("Generic error"),
+			ExpectedStatus: 500,
+			ExpectedError:  errors.New("Generic error"),
+		},
+	} {
+		s.Run(tc.Name, func() {
+			s.SetupTest()
+
+			r := httptest.NewRequest("GET", "/users", nil)
+			w := httptest.NewRecorder()
+			c := s.echoApp.NewContext(r, w)
+			c.Set("user", tc.Claims)
+
+			s.mockUserService.On("IsTokenRevoked", mock.Anything).Return(tc.Revoked, tc.FunctionError)
+			err := s.userController.RejectRevokedToken(func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})(c)
+
+			if tc.ExpectedError != nil {
+				s.Equal(tc.ExpectedError, err)
+				s.Equal(tc.ExpectedStatus, apperror.Status(err))
+			} else {
+				s.NoError(err)
+				s.Equal(tc.ExpectedStatus, w.Result().StatusCode)
+			}
+
+			s.TearDownTest()
+		})
+	}
+}
+
+func (s *TestSuiteUserControllers) TestForgotPassword() {
+	for _, tc := range []struct {
+		Name           string
+		RequestBody    interface{}
+		RequestContent string
+		FunctionError  error
+		ExpectedStatus int
+		ExpectedBody   echo.Map
+		ExpectedError  error
+	}{
+		{
+			Name: "Success Forgot Password",
+			RequestBody: dto.ForgotPasswordRequest{
+				Email: "123@123.com",
+			},
+			RequestContent: "application/json",
+			ExpectedStatus: 202,
+			ExpectedBody: echo.Map{
+				"message": "If the email is registered, a password reset link has been sent",
+			},
+		},
+		{
+			Name:           "Generic error from service",
+			RequestBody:    dto.ForgotPasswordRequest{Email: "123@123.com"},
+			RequestContent: "application/json",
+			FunctionError:  errors.New("Generic error"),
+			ExpectedStatus: 500,
+			ExpectedError:  errors.New("Generic error"),
+		},
+		{
+			Name:           "Error invalid request body",
+			RequestBody:    "invalid body",
+			RequestContent: "application/json",
+			ExpectedStatus: 400,
+			ExpectedError:  ErrBadRequestBody,
+		},
+	} {
+		s.Run(tc.Name, func() {
+			s.SetupTest()
+
+			jsonBody, err := json.Marshal(tc.RequestBody)
+			s.NoError(err)
+
+			r := httptest.NewRequest("POST", "/password/forgot", bytes.NewBuffer(jsonBody))
+			r.Header.Set("Content-Type", tc.RequestContent)
+			w := httptest.NewRecorder()
+			c := s.echoApp.NewContext(r, w)
+
+			s.mockUserService.On("ForgotPassword", tc.RequestBody).Return(tc.FunctionError)
+			err = s.userController.ForgotPassword(c)
+
+			if tc.ExpectedError != nil {
+				s.Equal(tc.ExpectedError, err)
+				s.Equal(tc.ExpectedStatus, apperror.Status(err))
+			} else {
+				s.NoError(err)
+
+				var response echo.Map
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				s.NoError(err)
+
+				s.Equal(tc.ExpectedStatus, w.Result().StatusCode)
+				s.Equal(tc.ExpectedBody, response)
+			}
+
+			s.TearDownTest()
+		})
+	}
+}
+
+func (s *TestSuiteUserControllers) TestResetPassword() {
+	for _, tc := range []struct {
+		Name           string
+		RequestBody    interface{}
+		RequestContent string
+		FunctionError  error
+		ExpectedStatus int
+		ExpectedBody   echo.Map
+		ExpectedError  error
+	}{
+		{
+			Name: "Success Reset Password",
+			RequestBody: dto.ResetPasswordRequest{
+				Token:    "token",
+				Password: "new-password",
+			},
+			RequestContent: "application/json",
+			ExpectedStatus: 200,
+			ExpectedBody: echo.Map{
+				"message": "Password reset success",
+			},
+		},
+		{
+			Name: "Error invalid reset token",
+			RequestBody: dto.ResetPasswordRequest{
+				Token:    "token",
+				Password: "new-password",
+			},
+			RequestContent: "application/json",
+			FunctionError:  service.ErrInvalidResetToken,
+			ExpectedStatus: 400,
+			ExpectedError:  service.ErrInvalidResetToken,
+		},
+		{
+			Name:           "Generic error from service",
+			RequestBody:    dto.ResetPasswordRequest{Token: "token", Password: "new-password"},
+			RequestContent: "application/json",
+			FunctionError:  errors.New("Generic error"),
+			ExpectedStatus: 500,
+			ExpectedError:  errors.New("Generic error"),
+		},
+		{
+			Name:           "Error invalid request body",
+			RequestBody:    "invalid body",
+			RequestContent: "application/json",
+			ExpectedStatus: 400,
+			ExpectedError:  ErrBadRequestBody,
+		},
+	} {
+		s.Run(tc.Name, func() {
+			s.SetupTest()
+
+			jsonBody, err := json.Marshal(tc.RequestBody)
+			s.NoError(err)
+
+			r := httptest.NewRequest("POST", "/password/reset", bytes.NewBuffer(jsonBody))
+			r.Header.Set("Content-Type", tc.RequestContent)
+			w := httptest.NewRecorder()
+			c := s.echoApp.NewContext(r, w)
+
+			s.mockUserService.On("ResetPassword", tc.RequestBody).Return(tc.FunctionError)
+			err = s.userController.ResetPassword(c)
+
+			if tc.ExpectedError != nil {
+				s.Equal(tc.ExpectedError, err)
+				s.Equal(tc.ExpectedStatus, apperror.Status(err))
+			} else {
+				s.NoError(err)
+
+				var response echo.Map
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				s.NoError(err)
+
+				s.Equal(tc.ExpectedStatus, w.Result().StatusCode)
+				s.Equal(tc.ExpectedBody, response)
+			}
+
+			s.TearDownTest()
+		})
+	}
+}
+
+func (s *TestSuiteUserControllers) TestVerifyEmail() {
+	for _, tc := range []struct {
+		Name           string
+		Token          string
+		FunctionError  error
+		ExpectedStatus int
+		ExpectedBody   echo.Map
+		ExpectedError  error
+	}{
+		{
+			Name:           "Success Verify Email",
+			Token:          "token",
+			ExpectedStatus: 200,
+			ExpectedBody: echo.Map{
+				"message": "Email verified",
+			},
+		},
+		{
+			Name:           "Error invalid verification link",
+			Token:          "token",
+			FunctionError:  service.ErrInvalidVerification,
+			ExpectedStatus: 400,
+			ExpectedError:  service.ErrInvalidVerification,
+		},
+		{
+			Name:           "Generic error from service",
+			Token:          "token",
+			FunctionError:  errors.New("Generic error"),
+			ExpectedStatus: 500,
+			ExpectedError:  errors.New("Generic error"),
+		},
+	} {
+		s.Run(tc.Name, func() {
+			s.SetupTest()
+
+			r := httptest.NewRequest("GET", "/users/verify?token="+tc.Token, nil)
+			w := httptest.NewRecorder()
+			c := s.echoApp.NewContext(r, w)
+
+			s.mockUserService.On("VerifyEmail", tc.Token).Return(tc.FunctionError)
+			err := s.userController.VerifyEmail(c)
+
+			if tc.ExpectedError != nil {
+				s.Equal(tc.ExpectedError, err)
+				s.Equal(tc.ExpectedStatus, apperror.Status(err))
+			} else {
+				s.NoError(err)
+
+				var response echo.Map
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				s.NoError(err)
+
+				s.Equal(tc.ExpectedStatus, w.Result().StatusCode)
+				s.Equal(tc.ExpectedBody, response)
+			}
+
+			s.TearDownTest()
+		})
+	}
+}
+
+func (s *TestSuiteUserControllers) TestResendVerification() {
+	for _, tc := range []struct {
+		Name           string
+		RequestBody    interface{}
+		RequestContent string
+		FunctionError  error
+		ExpectedStatus int
+		ExpectedBody   echo.Map
+		ExpectedError  error
+	}{
+		{
+			Name: "Success Resend Verification",
+			RequestBody: dto.ResendVerificationRequest{
+				Email: "123@123.com",
+			},
+			RequestContent: "application/json",
+			ExpectedStatus: 202,
+			ExpectedBody: echo.Map{
+				"message": "If the email is registered and not verified yet, a verification link has been sent",
+			},
+		},
+		{
+			Name:           "Generic error from service",
+			RequestBody:    dto.ResendVerificationRequest{Email: "123@123.com"},
+			RequestContent: "application/json",
+			FunctionError:  errors.New("Generic error"),
+			ExpectedStatus: 500,
+			ExpectedError:  errors.New("Generic error"),
+		},
+		{
+			Name:           "Error invalid request body",
+			RequestBody:    "invalid body",
+			RequestContent: "application/json",
+			ExpectedStatus: 400,
+			ExpectedError:  ErrBadRequestBody,
+		},
+	} {
+		s.Run(tc.Name, func() {
+			s.SetupTest()
+
+			jsonBody, err := json.Marshal(tc.RequestBody)
+			s.NoError(err)
+
+			r := httptest.NewRequest("POST", "/users/verify/resend", bytes.NewBuffer(jsonBody))
+			r.Header.Set("Content-Type", tc.RequestContent)
+			w := httptest.NewRecorder()
+			c := s.echoApp.NewContext(r, w)
+
+			s.mockUserService.On("ResendVerification", tc.RequestBody).Return(tc.FunctionError)
+			err = s.userController.ResendVerification(c)
+
+			if tc.ExpectedError != nil {
+				s.Equal(tc.ExpectedError, err)
+				s.Equal(tc.ExpectedStatus, apperror.Status(err))
+			} else {
+				s.NoError(err)
+
+				var response echo.Map
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				s.NoError(err)
+
+				s.Equal(tc.ExpectedStatus, w.Result().StatusCode)
+				s.Equal(tc.ExpectedBody, response)
+			}
+
+			s.TearDownTest()
+		})
+	}
+}
+
+func (s *TestSuiteUserControllers) TestResendVerificationRateLimit() {
+	s.userController.InitRoutes(s.echoApp)
+	s.mockUserService.On("ResendVerification", mock.Anything).Return(nil)
+
+	var statuses []int
+	for i := 0; i < s.config.Verification.ResendLimit+1; i++ {
+		r := httptest.NewRequest("POST", "/users/verify/resend", bytes.NewBufferString(`{"email":"123@123.com"}`))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.echoApp.ServeHTTP(w, r)
+		statuses = append(statuses, w.Code)
+	}
+
+	s.Equal(http.StatusAccepted, statuses[0])
+	s.Equal(http.StatusTooManyRequests, statuses[len(statuses)-1])
+}
+
+func (s *TestSuiteUserControllers) TestSignupRateLimit() {
+	s.config.RateLimit.Signup.Requests = 2
+	s.userController.InitRoutes(s.echoApp)
+	s.mockUserService.On("CreateUser", mock.Anything).Return(nil)
+
+	var responses []*httptest.ResponseRecorder
+	for i := 0; i < 3; i++ {
+		r := httptest.NewRequest("POST", "/users", bytes.NewBufferString(`{"email":"123@123.com","password":"12345678"}`))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.echoApp.ServeHTTP(w, r)
+		responses = append(responses, w)
+	}
+
+	s.Equal(http.StatusCreated, responses[0].Code)
+	s.Equal("2", responses[0].Header().Get(ratelimit.HeaderLimit))
+	s.Equal("1", responses[0].Header().Get(ratelimit.HeaderRemaining))
+	s.Equal(http.StatusTooManyRequests, responses[2].Code)
+	s.NotEmpty(responses[2].Header().Get(echo.HeaderRetryAfter))
+	s.mockUserService.AssertNumberOfCalls(s.T(), "CreateUser", 2)
+}
+
+func (s *TestSuiteUserControllers) TestLoginMFA() {
+	for _, tc := range []struct {
+		Name           string
+		RequestBody    interface{}
+		RequestContent string
+		FunctionError  error
+		FunctionReturn *dto.TokenResponse
+		ExpectedStatus int
+		ExpectedBody   echo.Map
+		ExpectedError  error
+	}{
+		{
+			Name: "Success Login MFA",
+			RequestBody: dto.MFALoginRequest{
+				MFAToken: "mfa",
+				Code:     "123456",
+			},
+			RequestContent: "application/json",
+			FunctionReturn: &dto.TokenResponse{
+				AccessToken:  "token",
+				RefreshToken: "refresh",
+			},
+			ExpectedStatus: 200,
+			ExpectedBody: echo.Map{
+				"message":       "Login success",
+				"token":         "token",
+				"refresh_token": "refresh",
+			},
+		},
+		{
+			Name: "Error invalid mfa token",
+			RequestBody: dto.MFALoginRequest{
+				MFAToken: "mfa",
+				Code:     "123456",
+			},
+			RequestContent: "application/json",
+			FunctionError:  service.ErrInvalidMFAToken,
+			ExpectedStatus: 401,
+			ExpectedError:  service.ErrInvalidMFAToken,
+		},
+		{
+			Name: "Error invalid two-factor code",
+			RequestBody: dto.MFALoginRequest{
+				MFAToken: "mfa",
+				Code:     "123456",
+			},
+			RequestContent: "application/json",
+			FunctionError:  service.ErrInvalidTwoFactorCode,
+			ExpectedStatus: 401,
+			ExpectedError:  service.ErrInvalidTwoFactorCode.WithKind(apperror.Unauthorized),
+		},
+		{
+			Name:           "Generic error from service",
+			RequestBody:    dto.MFALoginRequest{},
+			RequestContent: "application/json",
+			FunctionError:  errors.New("Generic error"),
+			ExpectedStatus: 500,
+			ExpectedError:  errors.New("Generic error"),
+		},
+		{
+			Name:           "Error invalid request body",
+			RequestBody:    "invalid body",
+			RequestContent: "application/json",
+			ExpectedStatus: 400,
+			ExpectedError:  ErrBadRequestBody,
+		},
+	} {
+		s.Run(tc.Name, func() {
+			s.SetupTest()
+
+			jsonBody, err := json.Marshal(tc.RequestBody)
+			s.NoError(err)
+
+			r := httptest.NewRequest("POST", "/login/mfa", bytes.NewBuffer(jsonBody))
+			r.Header.Set("Content-Type", tc.RequestContent)
+			w := httptest.NewRecorder()
+			c := s.echoApp.NewContext(r, w)
+
+			s.mockUserService.On("LoginMFA", tc.RequestBody).Return(tc.FunctionReturn, tc.FunctionError)
+			err = s.userController.LoginMFA(c)
+
+			if tc.ExpectedError != nil {
+				s.Equal(tc.ExpectedError, err)
+				s.Equal(tc.ExpectedStatus, apperror.Status(err))
+			} else {
+				s.NoError(err)
+
+				var response echo.Map
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				s.NoError(err)
+
+				s.Equal(tc.ExpectedStatus, w.Result().StatusCode)
+				s.Equal(tc.ExpectedBody, response)
+			}
+
+			s.TearDownTest()
+		})
+	}
+}
+
+func (s *TestSuiteUserControllers) TestEnrollTwoFactor() {
+	for _, tc := range []struct {
+		Name           string
+		FunctionReturn *dto.TwoFactorEnrollResponse
+		FunctionError  error
+		ExpectedStatus int
+		ExpectedBody   echo.Map
+		ExpectedError  error
+	}{
+		{
+			Name: "Success Enroll Two Factor",
+			FunctionReturn: &dto.TwoFactorEnrollResponse{
+				Secret:     "SECRET",
+				OTPAuthURI: "otpauth://totp/rewrite:123@123.com?secret=SECRET",
+			},
+			ExpectedStatus: 200,
+			ExpectedBody: echo.Map{
+				"message": "Scan the otpauth uri and confirm with a code to enable two-factor authentication",
+				"data": map[string]interface{}{
+					"secret":      "SECRET",
+					"otpauth_uri": "otpauth://totp/rewrite:123@123.com?secret=SECRET",
+				},
+			},
+		},
+		{
+			Name:           "Error already enabled",
+			FunctionError:  service.ErrTwoFactorAlreadyEnabled,
+			ExpectedStatus: 409,
+			ExpectedError:  service.ErrTwoFactorAlreadyEnabled,
+		},
+		{
+			Name:           "Generic error from service",
+			FunctionError:  errors.New("Generic error"),
+			ExpectedStatus: 500,
+			ExpectedError:  errors.New("Generic error"),
+		},
+	} {
+		s.Run(tc.Name, func() {
+			s.SetupTest()
+
+			r := httptest.NewRequest("POST", "/2fa/enroll", nil)
+			w := httptest.NewRecorder()
+			c := s.echoApp.NewContext(r, w)
+			c.Set("user", &utils.Claims{UserID: 1})
+
+			s.mockUserService.On("EnrollTwoFactor", uint(1)).Return(tc.FunctionReturn, tc.FunctionError)
+			err := s.userController.EnrollTwoFactor(c)
+
+			if tc.ExpectedError != nil {
+				s.Equal(tc.ExpectedError, err)
+				s.Equal(tc.ExpectedStatus, apperror.Status(err))
+			} else {
+				s.NoError(err)
+
+				var response echo.Map
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				s.NoError(err)
+
+				s.Equal(tc.ExpectedStatus, w.Result().StatusCode)
+				s.Equal(tc.ExpectedBody, response)
+			}
+
+			s.TearDownTest()
+		})
+	}
+}
+
+func (s *TestSuiteUserControllers) TestConfirmTwoFactor() {
+	for _, tc := range []struct {
+		Name           string
+		RequestBody    interface{}
+		FunctionReturn *dto.RecoveryCodesResponse
+		FunctionError  error
+		ExpectedStatus int
+		ExpectedBody   echo.Map
+		ExpectedError  error
+	}{
+		{
+			Name:        "Success Confirm Two Factor",
+			RequestBody: dto.TwoFactorCodeRequest{Code: "123456"},
+			FunctionReturn: &dto.RecoveryCodesResponse{
+				RecoveryCodes: []string{"aaaaa-bbbbb"},
+			},
+			ExpectedStatus: 200,
+			ExpectedBody: echo.Map{
+				"message": "Two-factor authentication enabled",
+				"data": map[string]interface{}{
+					"recovery_codes": []interface{}{"aaaaa-bbbbb"},
+				},
+			},
+		},
+		{
+			Name:           "Error invalid code",
+			RequestBody:    dto.TwoFactorCodeRequest{Code: "123456"},
+			FunctionError:  service.ErrInvalidTwoFactorCode,
+			ExpectedStatus: 400,
+			ExpectedError:  service.ErrInvalidTwoFactorCode,
+		},
+		{
+			Name:           "Error not enrolled",
+			RequestBody:    dto.TwoFactorCodeRequest{Code: "123456"},
+			FunctionError:  service.ErrTwoFactorNotEnrolled,
+			ExpectedStatus: 400,
+			ExpectedError:  service.ErrTwoFactorNotEnrolled,
+		},
+		{
+			Name:           "Error already enabled",
+			RequestBody:    dto.TwoFactorCodeRequest{Code: "123456"},
+			FunctionError:  service.ErrTwoFactorAlreadyEnabled,
+			ExpectedStatus: 409,
+			ExpectedError:  service.ErrTwoFactorAlreadyEnabled,
+		},
+		{
+			Name:           "Generic error from service",
+			RequestBody:    dto.TwoFactorCodeRequest{},
+			FunctionError:  errors.New("Generic error"),
+			ExpectedStatus: 500,
+			ExpectedError:  errors.New("Generic error"),
+		},
+		{
+			Name:           "Error invalid request body",
+			RequestBody:    "invalid body",
+			ExpectedStatus: 400,
+			ExpectedError:  ErrBadRequestBody,
+		},
+	} {
+		s.Run(tc.Name, func() {
+			s.SetupTest()
+
+			jsonBody, err := json.Marshal(tc.RequestBody)
+			s.NoError(err)
+
+			r := httptest.NewRequest("POST", "/2fa/confirm", bytes.NewBuffer(jsonBody))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			c := s.echoApp.NewContext(r, w)
+			c.Set("user", &utils.Claims{UserID: 1})
+
+			s.mockUserService.On("ConfirmTwoFactor", uint(1), tc.RequestBody).Return(tc.FunctionReturn, tc.FunctionError)
+			err = s.userController.ConfirmTwoFactor(c)
+
+			if tc.ExpectedError != nil {
+				s.Equal(tc.ExpectedError, err)
+				s.Equal(tc.ExpectedStatus, apperror.Status(err))
+			} else {
+				s.NoError(err)
+
+				var response echo.Map
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				s.NoError(err)
+
+				s.Equal(tc.ExpectedStatus, w.Result().StatusCode)
+				s.Equal(tc.ExpectedBody, response)
+			}
+
+			s.TearDownTest()
+		})
+	}
+}
+
+func (s *TestSuiteUserControllers) TestDisableTwoFactor() {
+	for _, tc := range []struct {
+		Name           string
+		RequestBody    interface{}
+		FunctionError  error
+		ExpectedStatus int
+		ExpectedBody   echo.Map
+		ExpectedError  error
+	}{
+		{
+			Name:           "Success Disable Two Factor",
+			RequestBody:    dto.TwoFactorCodeRequest{Code: "123456"},
+			ExpectedStatus: 200,
+			ExpectedBody: echo.Map{
+				"message": "Two-factor authentication disabled",
+			},
+		},
+		{
+			Name:           "Error invalid code",
+			RequestBody:    dto.TwoFactorCodeRequest{Code: "123456"},
+			FunctionError:  service.ErrInvalidTwoFactorCode,
+			ExpectedStatus: 400,
+			ExpectedError:  service.ErrInvalidTwoFactorCode,
+		},
+		{
+			Name:           "Error not enabled",
+			RequestBody:    dto.TwoFactorCodeRequest{Code: "123456"},
+			FunctionError:  service.ErrTwoFactorNotEnabled,
+			ExpectedStatus: 400,
+			ExpectedError:  service.ErrTwoFactorNotEnabled,
+		},
+		{
+			Name:           "Generic error from service",
+			RequestBody:    dto.TwoFactorCodeRequest{},
+			FunctionError:  errors.New("Generic error"),
+			ExpectedStatus: 500,
+			ExpectedError:  errors.New("Generic error"),
+		},
+		{
+			Name:           "Error invalid request body",
+			RequestBody:    "invalid body",
+			ExpectedStatus: 400,
+			ExpectedError:  ErrBadRequestBody,
+		},
+	} {
+		s.Run(tc.Name, func() {
+			s.SetupTest()
+
+			jsonBody, err := json.Marshal(tc.RequestBody)
+			s.NoError(err)
+
+			r := httptest.NewRequest("POST", "/2fa/disable", bytes.NewBuffer(jsonBody))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			c := s.echoApp.NewContext(r, w)
+			c.Set("user", &utils.Claims{UserID: 1})
+
+			s.mockUserService.On("DisableTwoFactor", uint(1), tc.RequestBody).Return(tc.FunctionError)
+			err = s.userController.DisableTwoFactor(c)
 
 			if tc.ExpectedError != nil {
-				s.Equal(echo.NewHTTPError(tc.ExpectedStatus, tc.ExpectedError.Error()), err)
+				s.Equal(tc.ExpectedError, err)
+				s.Equal(tc.ExpectedStatus, apperror.Status(err))
 			} else {
 				s.NoError(err)
 
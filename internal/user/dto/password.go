@@ -0,0 +1,14 @@
+package dto
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+func (f *ForgotPasswordRequest) Normalize() {
+	f.Email = normalizeEmail(f.Email)
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,password"`
+}
@@ -0,0 +1,36 @@
+package dto
+
+import "rewrite/pkg/entity"
+
+type RoleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type RoleResponse struct {
+	ID          uint     `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type RolesResponse []RoleResponse
+
+func (r *RoleResponse) FromEntity(entity *entity.Role) {
+	r.ID = entity.ID
+	r.Name = entity.Name
+	r.Description = entity.Description
+	r.Permissions = make([]string, 0, len(entity.Permissions))
+	for _, permission := range entity.Permissions {
+		r.Permissions = append(r.Permissions, permission.Name)
+	}
+}
+
+func (r *RolesResponse) FromEntity(entities entity.Roles) {
+	for _, each := range entities {
+		var role RoleResponse
+		role.FromEntity(&each)
+		*r = append(*r, role)
+	}
+}
@@ -0,0 +1,83 @@
+package dto
+
+import (
+	"rewrite/pkg/entity"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleResponse_FromEntity(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   *RoleResponse
+		entity *entity.Role
+	}{
+		{
+			name: "RoleResponse FromEntity",
+			want: &RoleResponse{
+				ID:          1,
+				Name:        "admin",
+				Description: "Administrator",
+				Permissions: []string{"users:list", "roles:manage"},
+			},
+			entity: &entity.Role{
+				ID:          1,
+				Name:        "admin",
+				Description: "Administrator",
+				Permissions: []entity.Permission{{Name: "users:list"}, {Name: "roles:manage"}},
+			},
+		},
+		{
+			name: "RoleResponse FromEntity without permissions",
+			want: &RoleResponse{
+				Name:        "support",
+				Permissions: []string{},
+			},
+			entity: &entity.Role{
+				Name: "support",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &RoleResponse{}
+			r.FromEntity(tt.entity)
+
+			assert.Equal(t, tt.want, r)
+		})
+	}
+}
+
+func TestRolesResponse_FromEntity(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   *RolesResponse
+		entity entity.Roles
+	}{
+		{
+			name: "RolesResponse FromEntity",
+			want: &RolesResponse{
+				{Name: "admin", Permissions: []string{"users:list"}},
+				{Name: "support", Permissions: []string{}},
+			},
+			entity: entity.Roles{
+				{Name: "admin", Permissions: []entity.Permission{{Name: "users:list"}}},
+				{Name: "support"},
+			},
+		},
+		{
+			name:   "RolesResponse FromEntity with empty field",
+			want:   &RolesResponse{},
+			entity: entity.Roles{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &RolesResponse{}
+			r.FromEntity(tt.entity)
+
+			assert.Equal(t, tt.want, r)
+		})
+	}
+}
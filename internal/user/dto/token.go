@@ -0,0 +1,13 @@
+package dto
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// TokenResponse holds either the issued token pair or, when the user has two
+// factor authentication enabled, only the MFA token to finish the login with.
+type TokenResponse struct {
+	AccessToken  string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	MFAToken     string `json:"mfa_token,omitempty"`
+}
@@ -1,10 +1,19 @@
 package dto
 
-import "rewrite/pkg/entity"
+import (
+	"rewrite/pkg/entity"
+	"strings"
+)
 
 type UserRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required,email,max=254"`
+	Password string `json:"password" validate:"required,password"`
+}
+
+// Normalize trims and lower cases the email, so addresses differing in case
+// belong to the same account.
+func (u *UserRequest) Normalize() {
+	u.Email = normalizeEmail(u.Email)
 }
 
 type UsersRequest []UserRequest
@@ -16,9 +25,25 @@ func (u *UserRequest) ToEntity() *entity.User {
 	}
 }
 
+// UpdateUserRequest is a partial update, fields left out are not changed.
+// CurrentPassword is required when users change their own email or password.
+type UpdateUserRequest struct {
+	Email           *string `json:"email" validate:"omitempty,email,max=254"`
+	Password        *string `json:"password" validate:"omitempty,password"`
+	CurrentPassword string  `json:"current_password"`
+}
+
+func (u *UpdateUserRequest) Normalize() {
+	if u.Email != nil {
+		email := normalizeEmail(*u.Email)
+		u.Email = &email
+	}
+}
+
 type UserResponse struct {
-	ID    uint   `json:"id"`
-	Email string `json:"email"`
+	ID    uint     `json:"id"`
+	Email string   `json:"email"`
+	Roles []string `json:"roles,omitempty"`
 }
 
 type UsersResponse []UserResponse
@@ -26,6 +51,9 @@ type UsersResponse []UserResponse
 func (u *UserResponse) FromEntity(entity *entity.User) {
 	u.ID = entity.ID
 	u.Email = entity.Email
+	for _, role := range entity.Roles {
+		u.Roles = append(u.Roles, role.Name)
+	}
 }
 
 func (u *UsersResponse) FromEntity(entities entity.Users) {
@@ -35,3 +63,40 @@ func (u *UsersResponse) FromEntity(entities entity.Users) {
 		*u = append(*u, user)
 	}
 }
+
+// UserListQuery are the query parameters of the user listing. Sort is one of
+// the whitelisted fields, prefixed with "-" for descending order. Cursor and
+// Offset are two ways to page and can not be combined.
+type UserListQuery struct {
+	Cursor      string `query:"cursor"`
+	Offset      int    `query:"offset"`
+	Limit       int    `query:"limit"`
+	Sort        string `query:"sort"`
+	Email       string `query:"email"`
+	CreatedFrom string `query:"created_from"`
+	CreatedTo   string `query:"created_to"`
+}
+
+type PageMeta struct {
+	Total      int64   `json:"total"`
+	Limit      int     `json:"limit"`
+	Offset     int     `json:"offset"`
+	NextCursor *string `json:"next_cursor"`
+}
+
+type UsersPage struct {
+	Users UsersResponse
+	Meta  PageMeta
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+func (r *ResendVerificationRequest) Normalize() {
+	r.Email = normalizeEmail(r.Email)
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
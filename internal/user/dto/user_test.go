@@ -48,6 +48,33 @@ func TestUserRequest_ToEntity(t *testing.T) {
 	}
 }
 
+func TestUserRequest_Normalize(t *testing.T) {
+	tests := []struct {
+		name  string
+		email string
+		want  string
+	}{
+		{
+			name:  "UserRequest Normalize",
+			email: " Foo.Bar@Example.COM\n",
+			want:  "foo.bar@example.com",
+		},
+		{
+			name:  "UserRequest Normalize with empty field",
+			email: "",
+			want:  "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &UserRequest{Email: tt.email, Password: " Secret "}
+			u.Normalize()
+
+			assert.Equal(t, &UserRequest{Email: tt.want, Password: " Secret "}, u)
+		})
+	}
+}
+
 func TestUserResponse_FromEntity(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -63,6 +90,17 @@ func TestUserResponse_FromEntity(t *testing.T) {
 				Email: "123@123.com",
 			},
 		},
+		{
+			name: "UserResponse FromEntity with roles",
+			want: &UserResponse{
+				Email: "123@123.com",
+				Roles: []string{"admin", "support"},
+			},
+			entity: &entity.User{
+				Email: "123@123.com",
+				Roles: []entity.Role{{Name: "admin"}, {Name: "support"}},
+			},
+		},
 		{
 			name: "UserResponse FromEntity with empty string",
 			want: &UserResponse{
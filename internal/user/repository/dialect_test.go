@@ -0,0 +1,318 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"rewrite/pkg/database"
+	"rewrite/pkg/entity"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// TestSuiteDialect runs the repositories against a real database, migrated
+// with the embedded migrations of its dialect. SQLite always runs, MySQL and
+// PostgreSQL run when TEST_MYSQL_DSN or TEST_POSTGRES_DSN is set. The
+// databases behind those DSNs are emptied before every test.
+type TestSuiteDialect struct {
+	suite.Suite
+	dialector      gorm.Dialector
+	db             *gorm.DB
+	userRepository UserRepository
+	roleRepository RoleRepository
+	loginAttempts  LoginAttemptRepository
+	ctx            context.Context
+}
+
+func (s *TestSuiteDialect) SetupSuite() {
+	db, err := gorm.Open(s.dialector, &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	s.Require().NoError(err)
+
+	if s.dialector.Name() == "sqlite" {
+		// Every connection to an in-memory database gets a database of its
+		// own.
+		sqlDB, err := db.DB()
+		s.Require().NoError(err)
+		sqlDB.SetMaxOpenConns(1)
+	}
+
+	migrator, err := database.NewMigrator(db)
+	s.Require().NoError(err)
+	_, err = migrator.Up()
+	s.Require().NoError(err)
+	s.Require().NoError(migrator.Check())
+
+	s.db = db
+	s.userRepository = NewUserRepositoryImpl(db)
+	s.roleRepository = NewRoleRepositoryImpl(db)
+	s.loginAttempts = NewLoginAttemptRepositoryImpl(db)
+	s.ctx = context.Background()
+}
+
+func (s *TestSuiteDialect) SetupTest() {
+	for _, table := range []string{
+		"user_roles",
+		"role_permissions",
+		"recovery_codes",
+		"two_factors",
+		"password_reset_tokens",
+		"refresh_tokens",
+		"revoked_tokens",
+		"login_attempts",
+		"users",
+		"roles",
+		"permissions",
+	} {
+		s.Require().NoError(s.db.Exec("DELETE FROM " + table).Error)
+	}
+}
+
+func (s *TestSuiteDialect) TearDownSuite() {
+	sqlDB, err := s.db.DB()
+	s.Require().NoError(err)
+	s.NoError(sqlDB.Close())
+}
+
+func (s *TestSuiteDialect) createUser(email string) *entity.User {
+	user := &entity.User{Email: email, Password: "hash"}
+	s.Require().NoError(s.userRepository.CreateUser(user, s.ctx))
+	return user
+}
+
+func (s *TestSuiteDialect) TestCreateUserDuplicateEmail() {
+	s.createUser("123@123.com")
+
+	err := s.userRepository.CreateUser(&entity.User{Email: "123@123.com"}, s.ctx)
+	s.Equal(ErrEmailAlreadyExist, err)
+}
+
+func (s *TestSuiteDialect) TestUpdateCredentials() {
+	s.createUser("123@123.com")
+	user := s.createUser("456@456.com")
+
+	err := s.userRepository.UpdateCredentials(user.ID, "123@123.com", "new hash", s.ctx)
+	s.Equal(ErrEmailAlreadyExist, err)
+
+	found, err := s.userRepository.FindByID(user.ID, s.ctx)
+	s.NoError(err)
+	s.Equal("hash", found.Password, "the password is rolled back with the email")
+
+	err = s.userRepository.UpdateCredentials(user.ID, "789@789.com", "new hash", s.ctx)
+	s.NoError(err)
+
+	found, err = s.userRepository.FindByID(user.ID, s.ctx)
+	s.NoError(err)
+	s.Equal("789@789.com", found.Email)
+	s.Equal("new hash", found.Password)
+	s.Nil(found.VerifiedAt)
+
+	err = s.userRepository.UpdateCredentials(user.ID, "", "newer hash", s.ctx)
+	s.NoError(err)
+
+	found, err = s.userRepository.FindByID(user.ID, s.ctx)
+	s.NoError(err)
+	s.Equal("789@789.com", found.Email)
+	s.Equal("newer hash", found.Password)
+}
+
+func (s *TestSuiteDialect) TestFindAll() {
+	for _, email := range []string{"b_1@example.com", "bx1@example.com", "A%1@example.com", "c!1@example.com"} {
+		s.createUser(email)
+	}
+
+	users, total, err := s.userRepository.FindAll(UserFilter{Email: "B_", SortField: "id", Limit: 10}, s.ctx)
+	s.NoError(err)
+	s.Equal(int64(1), total)
+	s.Require().Len(users, 1)
+	s.Equal("b_1@example.com", users[0].Email)
+
+	users, _, err = s.userRepository.FindAll(UserFilter{Email: "a%", SortField: "id", Limit: 10}, s.ctx)
+	s.NoError(err)
+	s.Require().Len(users, 1)
+	s.Equal("A%1@example.com", users[0].Email)
+
+	users, _, err = s.userRepository.FindAll(UserFilter{Email: "c!", SortField: "id", Limit: 10}, s.ctx)
+	s.NoError(err)
+	s.Require().Len(users, 1)
+	s.Equal("c!1@example.com", users[0].Email)
+
+	var emails []string
+	filter := UserFilter{SortField: "email", SortDesc: true, Limit: 3}
+	for {
+		users, total, err = s.userRepository.FindAll(filter, s.ctx)
+		s.Require().NoError(err)
+		s.Equal(int64(4), total)
+
+		for _, user := range users {
+			emails = append(emails, user.Email)
+		}
+
+		if len(users) < filter.Limit {
+			break
+		}
+
+		last := users[len(users)-1]
+		filter.After = &UserCursor{Value: last.Email, ID: last.ID}
+	}
+	s.Equal([]string{"c!1@example.com", "bx1@example.com", "b_1@example.com", "A%1@example.com"}, emails)
+
+	from := time.Now().Add(-time.Hour)
+	users, _, err = s.userRepository.FindAll(UserFilter{CreatedFrom: &from, SortField: "created_at", Limit: 10}, s.ctx)
+	s.NoError(err)
+	s.Len(users, 4)
+}
+
+func (s *TestSuiteDialect) TestDeleteUser() {
+	user := s.createUser("123@123.com")
+
+	s.NoError(s.userRepository.DeleteUser(user.ID, s.ctx))
+
+	_, err := s.userRepository.FindByID(user.ID, s.ctx)
+	s.Equal(gorm.ErrRecordNotFound, err)
+
+	s.Equal(gorm.ErrRecordNotFound, s.userRepository.DeleteUser(user.ID, s.ctx))
+}
+
+func (s *TestSuiteDialect) TestRoles() {
+	s.Require().NoError(database.SeedDB(s.db, nil))
+	user := s.createUser("123@123.com")
+
+	permissions, err := s.roleRepository.FindPermissionsByName([]string{entity.PermissionUsersList}, s.ctx)
+	s.Require().NoError(err)
+
+	role := &entity.Role{Name: "support", Permissions: permissions}
+	s.Require().NoError(s.roleRepository.CreateRole(role, s.ctx))
+	s.Equal(ErrRoleAlreadyExist, s.roleRepository.CreateRole(&entity.Role{Name: "support"}, s.ctx))
+
+	s.NoError(s.roleRepository.AssignRole(user.ID, role.ID, s.ctx))
+	s.NoError(s.roleRepository.AssignRole(user.ID, role.ID, s.ctx))
+
+	found, err := s.userRepository.FindByEmail("123@123.com", s.ctx)
+	s.NoError(err)
+	s.Require().Len(found.Roles, 1)
+	s.Equal("support", found.Roles[0].Name)
+
+	allowed, err := s.roleRepository.HasPermission([]string{"support"}, entity.PermissionUsersList, s.ctx)
+	s.NoError(err)
+	s.True(allowed)
+
+	allowed, err = s.roleRepository.HasPermission([]string{"support"}, entity.PermissionUsersManage, s.ctx)
+	s.NoError(err)
+	s.False(allowed)
+
+	permissions, err = s.roleRepository.FindPermissionsByName([]string{entity.PermissionUsersManage}, s.ctx)
+	s.Require().NoError(err)
+	role.Description = "Support staff"
+	role.Permissions = permissions
+	s.NoError(s.roleRepository.UpdateRole(role, s.ctx))
+
+	updated, err := s.roleRepository.FindRoleByName("support", s.ctx)
+	s.NoError(err)
+	s.Equal("Support staff", updated.Description)
+	s.Require().Len(updated.Permissions, 1)
+	s.Equal(entity.PermissionUsersManage, updated.Permissions[0].Name)
+
+	s.NoError(s.roleRepository.UnassignRole(user.ID, role.ID, s.ctx))
+	s.NoError(s.roleRepository.DeleteRole(role, s.ctx))
+
+	_, err = s.roleRepository.FindRoleByName("support", s.ctx)
+	s.Equal(gorm.ErrRecordNotFound, err)
+}
+
+func (s *TestSuiteDialect) TestLoginAttempts() {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	for i := 1; i <= 3; i++ {
+		attempt, err := s.loginAttempts.RecordFailure("email:123@123.com", now, time.Hour, s.ctx)
+		s.Require().NoError(err)
+		s.Equal(i, attempt.Failures)
+	}
+
+	s.NoError(s.loginAttempts.Block("email:123@123.com", now.Add(time.Minute), s.ctx))
+
+	// Failures older than the window are forgotten.
+	_, err := s.loginAttempts.RecordFailure("ip:192.0.2.1", now.Add(-2*time.Hour), time.Hour, s.ctx)
+	s.Require().NoError(err)
+	attempt, err := s.loginAttempts.RecordFailure("ip:192.0.2.1", now, time.Hour, s.ctx)
+	s.Require().NoError(err)
+	s.Equal(1, attempt.Failures)
+
+	attempts, err := s.loginAttempts.FindByKeys([]string{"email:123@123.com", "ip:192.0.2.1", "ip:192.0.2.2"}, s.ctx)
+	s.NoError(err)
+	s.Require().Len(attempts, 2)
+	for _, attempt := range attempts {
+		if attempt.Key == "email:123@123.com" {
+			s.Require().NotNil(attempt.BlockedUntil)
+			s.True(now.Add(time.Minute).Equal(*attempt.BlockedUntil))
+		} else {
+			s.Nil(attempt.BlockedUntil, "attempts are inserted unblocked")
+		}
+	}
+
+	deleted, err := s.loginAttempts.DeleteStale(now.Add(90*time.Minute), time.Hour, s.ctx)
+	s.NoError(err)
+	s.Equal(int64(2), deleted)
+
+	_, err = s.loginAttempts.RecordFailure("ip:192.0.2.1", now, time.Hour, s.ctx)
+	s.Require().NoError(err)
+	s.NoError(s.loginAttempts.DeleteByKeys([]string{"ip:192.0.2.1"}, s.ctx))
+
+	attempts, err = s.loginAttempts.FindByKeys([]string{"ip:192.0.2.1"}, s.ctx)
+	s.NoError(err)
+	s.Empty(attempts)
+}
+
+func (s *TestSuiteDialect) TestIsRevokedAtWholeSeconds() {
+	user := s.createUser("123@123.com")
+	revokedAt := time.Date(2024, 1, 1, 10, 0, 0, 300*int(time.Millisecond), time.UTC)
+	revokedTokens := NewRevokedTokenRepositoryImpl(s.db)
+	s.Require().NoError(revokedTokens.CreateRevokedToken(&entity.RevokedToken{
+		CreatedAt: revokedAt,
+		UserID:    user.ID,
+		ExpiresAt: revokedAt.Add(time.Hour),
+	}, s.ctx))
+
+	for _, tt := range []struct {
+		Name            string
+		IssuedAt        time.Time
+		ExpectedRevoked bool
+	}{
+		{Name: "Issued a second before", IssuedAt: revokedAt.Add(-time.Second).Truncate(time.Second), ExpectedRevoked: true},
+		{Name: "Issued in the same second", IssuedAt: revokedAt.Truncate(time.Second)},
+		{Name: "Issued a second after", IssuedAt: revokedAt.Add(time.Second).Truncate(time.Second)},
+	} {
+		s.Run(tt.Name, func() {
+			revoked, err := revokedTokens.IsRevoked("", user.ID, tt.IssuedAt, s.ctx)
+			s.NoError(err)
+			s.Equal(tt.ExpectedRevoked, revoked)
+		})
+	}
+}
+
+func TestDialects(t *testing.T) {
+	dialectors := map[string]gorm.Dialector{
+		"sqlite": sqlite.Open(":memory:?_pragma=foreign_keys(1)"),
+	}
+
+	if dsn := os.Getenv("TEST_MYSQL_DSN"); dsn != "" {
+		dialectors["mysql"] = mysql.Open(dsn)
+	}
+
+	if dsn := os.Getenv("TEST_POSTGRES_DSN"); dsn != "" {
+		dialectors["postgres"] = postgres.Open(dsn)
+	}
+
+	for name, dialector := range dialectors {
+		t.Run(name, func(t *testing.T) {
+			suite.Run(t, &TestSuiteDialect{dialector: dialector})
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+	"rewrite/pkg/entity"
+	"time"
+)
+
+// LoginAttemptRepository stores the failed logins counted per key. The SQL
+// implementation is shared by every instance, the memory one is local to the
+// process.
+type LoginAttemptRepository interface {
+	// FindByKeys returns the attempts of keys, leaving out keys without any.
+	FindByKeys(keys []string, ctx context.Context) ([]entity.LoginAttempt, error)
+	// RecordFailure counts a failure of key at now and returns the updated
+	// attempt. Failures older than window are forgotten first.
+	RecordFailure(key string, now time.Time, window time.Duration, ctx context.Context) (*entity.LoginAttempt, error)
+	Block(key string, until time.Time, ctx context.Context) error
+	DeleteByKeys(keys []string, ctx context.Context) error
+	// DeleteStale removes the attempts whose failures are forgotten and that
+	// are not blocked anymore.
+	DeleteStale(now time.Time, window time.Duration, ctx context.Context) (int64, error)
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"rewrite/pkg/entity"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type LoginAttemptRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewLoginAttemptRepositoryImpl(db *gorm.DB) LoginAttemptRepository {
+	return &LoginAttemptRepositoryImpl{db}
+}
+
+func (r *LoginAttemptRepositoryImpl) FindByKeys(keys []string, ctx context.Context) ([]entity.LoginAttempt, error) {
+	var attempts []entity.LoginAttempt
+	err := r.db.WithContext(ctx).Where("attempt_key IN ?", keys).Find(&attempts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return attempts, nil
+}
+
+// RecordFailure counts the failure with a single upsert, so concurrent
+// failures are all counted.
+func (r *LoginAttemptRepositoryImpl) RecordFailure(key string, now time.Time, window time.Duration, ctx context.Context) (*entity.LoginAttempt, error) {
+	attempt := entity.LoginAttempt{Key: key, Failures: 1, LastFailureAt: now}
+
+	var result *entity.LoginAttempt
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "attempt_key"}},
+			DoUpdates: clause.Set{
+				{
+					Column: clause.Column{Name: "failures"},
+					Value:  gorm.Expr("CASE WHEN login_attempts.last_failure_at < ? THEN 1 ELSE login_attempts.failures + 1 END", now.Add(-window)),
+				},
+				{Column: clause.Column{Name: "last_failure_at"}, Value: now},
+			},
+		}).Create(&attempt).Error
+		if err != nil {
+			return err
+		}
+
+		result = &entity.LoginAttempt{}
+		return tx.Where("attempt_key = ?", key).Take(result).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *LoginAttemptRepositoryImpl) Block(key string, until time.Time, ctx context.Context) error {
+	return r.db.WithContext(ctx).
+		Model(&entity.LoginAttempt{}).
+		Where("attempt_key = ?", key).
+		Update("blocked_until", until).Error
+}
+
+func (r *LoginAttemptRepositoryImpl) DeleteByKeys(keys []string, ctx context.Context) error {
+	return r.db.WithContext(ctx).Where("attempt_key IN ?", keys).Delete(&entity.LoginAttempt{}).Error
+}
+
+func (r *LoginAttemptRepositoryImpl) DeleteStale(now time.Time, window time.Duration, ctx context.Context) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Where("last_failure_at < ? AND (blocked_until IS NULL OR blocked_until < ?)", now.Add(-window), now).
+		Delete(&entity.LoginAttempt{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	return result.RowsAffected, nil
+}
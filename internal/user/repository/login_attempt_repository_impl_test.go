@@ -0,0 +1,230 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"rewrite/pkg/entity"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type TestSuiteLoginAttemptRepository struct {
+	suite.Suite
+	Mock                   sqlmock.Sqlmock
+	loginAttemptRepository LoginAttemptRepository
+	ctx                    context.Context
+}
+
+func (s *TestSuiteLoginAttemptRepository) SetupTest() {
+	dbMock, mock, err := sqlmock.New()
+	s.NoError(err)
+
+	DB, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      dbMock,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	s.NoError(err)
+
+	s.Mock = mock
+	s.loginAttemptRepository = NewLoginAttemptRepositoryImpl(DB)
+	s.ctx = context.Background()
+}
+
+func (s *TestSuiteLoginAttemptRepository) TeardownTest() {
+	s.Mock = nil
+	s.loginAttemptRepository = nil
+	s.ctx = nil
+}
+
+func (s *TestSuiteLoginAttemptRepository) TestRecordFailure() {
+	now := time.Now()
+
+	for _, tt := range []struct {
+		Name           string
+		UpsertErr      error
+		Rows           *sqlmock.Rows
+		ExpectedReturn *entity.LoginAttempt
+		ExpectedErr    error
+	}{
+		{
+			Name:           "Success",
+			Rows:           sqlmock.NewRows([]string{"attempt_key", "failures", "last_failure_at", "blocked_until"}).AddRow("ip:192.0.2.1", 2, now, nil),
+			ExpectedReturn: &entity.LoginAttempt{Key: "ip:192.0.2.1", Failures: 2, LastFailureAt: now},
+		},
+		{
+			Name:        "Generic Error from DB",
+			UpsertErr:   errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			upsert := "INSERT INTO `login_attempts` (`attempt_key`,`failures`,`last_failure_at`,`blocked_until`) VALUES (?,?,?,?) " +
+				"ON DUPLICATE KEY UPDATE `failures`=CASE WHEN login_attempts.last_failure_at < ? THEN 1 ELSE login_attempts.failures + 1 END,`last_failure_at`=?"
+
+			s.Mock.ExpectBegin()
+			if tt.UpsertErr != nil {
+				s.Mock.ExpectExec(regexp.QuoteMeta(upsert)).WillReturnError(tt.UpsertErr)
+				s.Mock.ExpectRollback()
+			} else {
+				s.Mock.ExpectExec(regexp.QuoteMeta(upsert)).
+					WithArgs("ip:192.0.2.1", 1, now, nil, now.Add(-time.Hour), now).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				s.Mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `login_attempts` WHERE attempt_key = ? LIMIT 1")).
+					WithArgs("ip:192.0.2.1").
+					WillReturnRows(tt.Rows)
+				s.Mock.ExpectCommit()
+			}
+
+			result, err := s.loginAttemptRepository.RecordFailure("ip:192.0.2.1", now, time.Hour, s.ctx)
+
+			s.Equal(tt.ExpectedReturn, result)
+			s.Equal(tt.ExpectedErr, err)
+			s.NoError(s.Mock.ExpectationsWereMet())
+		})
+		s.TeardownTest()
+	}
+}
+
+func (s *TestSuiteLoginAttemptRepository) TestFindByKeys() {
+	for _, tt := range []struct {
+		Name           string
+		Rows           *sqlmock.Rows
+		Err            error
+		ExpectedReturn []entity.LoginAttempt
+		ExpectedErr    error
+	}{
+		{
+			Name:           "Success",
+			Rows:           sqlmock.NewRows([]string{"attempt_key", "failures"}).AddRow("email:123@123.com", 3),
+			ExpectedReturn: []entity.LoginAttempt{{Key: "email:123@123.com", Failures: 3}},
+		},
+		{
+			Name:        "Generic Error from DB",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			query := s.Mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `login_attempts` WHERE attempt_key IN (?,?)")).
+				WithArgs("email:123@123.com", "ip:192.0.2.1")
+			if tt.Err != nil {
+				query.WillReturnError(tt.Err)
+			} else {
+				query.WillReturnRows(tt.Rows)
+			}
+
+			result, err := s.loginAttemptRepository.FindByKeys([]string{"email:123@123.com", "ip:192.0.2.1"}, s.ctx)
+
+			s.Equal(tt.ExpectedReturn, result)
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TeardownTest()
+	}
+}
+
+func (s *TestSuiteLoginAttemptRepository) TestDeleteStale() {
+	for _, tt := range []struct {
+		Name           string
+		Err            error
+		ExpectedReturn int64
+		ExpectedErr    error
+	}{
+		{
+			Name:           "Success",
+			ExpectedReturn: 2,
+		},
+		{
+			Name:        "Generic Error from DB",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			query := "DELETE FROM `login_attempts` WHERE last_failure_at < ? AND (blocked_until IS NULL OR blocked_until < ?)"
+
+			s.Mock.ExpectBegin()
+			if tt.Err != nil {
+				s.Mock.ExpectExec(regexp.QuoteMeta(query)).WillReturnError(tt.Err)
+				s.Mock.ExpectRollback()
+			} else {
+				s.Mock.ExpectExec(regexp.QuoteMeta(query)).WillReturnResult(sqlmock.NewResult(0, tt.ExpectedReturn))
+				s.Mock.ExpectCommit()
+			}
+
+			result, err := s.loginAttemptRepository.DeleteStale(time.Now(), time.Hour, s.ctx)
+
+			s.Equal(tt.ExpectedReturn, result)
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TeardownTest()
+	}
+}
+
+func TestLoginAttemptRepository(t *testing.T) {
+	suite.Run(t, new(TestSuiteLoginAttemptRepository))
+}
+
+func TestMemoryLoginAttemptRepository(t *testing.T) {
+	suite.Run(t, new(TestSuiteMemoryLoginAttemptRepository))
+}
+
+type TestSuiteMemoryLoginAttemptRepository struct {
+	suite.Suite
+	loginAttemptRepository LoginAttemptRepository
+	ctx                    context.Context
+}
+
+func (s *TestSuiteMemoryLoginAttemptRepository) SetupTest() {
+	s.loginAttemptRepository = NewMemoryLoginAttemptRepository()
+	s.ctx = context.Background()
+}
+
+func (s *TestSuiteMemoryLoginAttemptRepository) TestLoginAttempts() {
+	now := time.Now()
+	blockedUntil := now.Add(time.Minute)
+
+	for i := 1; i <= 3; i++ {
+		attempt, err := s.loginAttemptRepository.RecordFailure("email:123@123.com", now, time.Hour, s.ctx)
+		s.NoError(err)
+		s.Equal(i, attempt.Failures)
+	}
+
+	s.NoError(s.loginAttemptRepository.Block("email:123@123.com", now.Add(time.Minute), s.ctx))
+	s.NoError(s.loginAttemptRepository.Block("email:456@456.com", now.Add(time.Minute), s.ctx))
+
+	_, err := s.loginAttemptRepository.RecordFailure("ip:192.0.2.1", now.Add(-2*time.Hour), time.Hour, s.ctx)
+	s.NoError(err)
+	attempt, err := s.loginAttemptRepository.RecordFailure("ip:192.0.2.1", now, time.Hour, s.ctx)
+	s.NoError(err)
+	s.Equal(1, attempt.Failures)
+
+	attempts, err := s.loginAttemptRepository.FindByKeys([]string{"email:123@123.com", "email:456@456.com", "ip:192.0.2.1"}, s.ctx)
+	s.NoError(err)
+	s.Equal([]entity.LoginAttempt{
+		{Key: "email:123@123.com", Failures: 3, LastFailureAt: now, BlockedUntil: &blockedUntil},
+		{Key: "ip:192.0.2.1", Failures: 1, LastFailureAt: now},
+	}, attempts)
+
+	// Blocked attempts are kept until the block is over.
+	deleted, err := s.loginAttemptRepository.DeleteStale(now.Add(61*time.Minute), time.Hour, s.ctx)
+	s.NoError(err)
+	s.Equal(int64(2), deleted)
+
+	_, err = s.loginAttemptRepository.RecordFailure("ip:192.0.2.1", now, time.Hour, s.ctx)
+	s.NoError(err)
+	s.NoError(s.loginAttemptRepository.DeleteByKeys([]string{"ip:192.0.2.1"}, s.ctx))
+
+	attempts, err = s.loginAttemptRepository.FindByKeys([]string{"ip:192.0.2.1"}, s.ctx)
+	s.NoError(err)
+	s.Empty(attempts)
+}
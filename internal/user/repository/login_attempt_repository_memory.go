@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"rewrite/pkg/entity"
+	"sync"
+	"time"
+)
+
+// MemoryLoginAttemptRepository keeps the attempts in the process. It suits a
+// single instance, with several instances every one counts its own failures.
+type MemoryLoginAttemptRepository struct {
+	mu       sync.Mutex
+	attempts map[string]entity.LoginAttempt
+}
+
+func NewMemoryLoginAttemptRepository() LoginAttemptRepository {
+	return &MemoryLoginAttemptRepository{attempts: map[string]entity.LoginAttempt{}}
+}
+
+func (r *MemoryLoginAttemptRepository) FindByKeys(keys []string, ctx context.Context) ([]entity.LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var attempts []entity.LoginAttempt
+	for _, key := range keys {
+		if attempt, ok := r.attempts[key]; ok {
+			attempts = append(attempts, attempt)
+		}
+	}
+
+	return attempts, nil
+}
+
+func (r *MemoryLoginAttemptRepository) RecordFailure(key string, now time.Time, window time.Duration, ctx context.Context) (*entity.LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempt, ok := r.attempts[key]
+	if !ok || attempt.LastFailureAt.Before(now.Add(-window)) {
+		attempt.Key = key
+		attempt.Failures = 0
+	}
+
+	attempt.Failures++
+	attempt.LastFailureAt = now
+	r.attempts[key] = attempt
+	return &attempt, nil
+}
+
+func (r *MemoryLoginAttemptRepository) Block(key string, until time.Time, ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if attempt, ok := r.attempts[key]; ok {
+		attempt.BlockedUntil = &until
+		r.attempts[key] = attempt
+	}
+
+	return nil
+}
+
+func (r *MemoryLoginAttemptRepository) DeleteByKeys(keys []string, ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, key := range keys {
+		delete(r.attempts, key)
+	}
+
+	return nil
+}
+
+func (r *MemoryLoginAttemptRepository) DeleteStale(now time.Time, window time.Duration, ctx context.Context) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	for key, attempt := range r.attempts {
+		if attempt.LastFailureAt.Before(now.Add(-window)) && (attempt.BlockedUntil == nil || attempt.BlockedUntil.Before(now)) {
+			delete(r.attempts, key)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
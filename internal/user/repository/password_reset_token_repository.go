@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"context"
+	"rewrite/pkg/entity"
+)
+
+type PasswordResetTokenRepository interface {
+	CreatePasswordResetToken(token *entity.PasswordResetToken, ctx context.Context) error
+	FindByTokenHash(hash string, ctx context.Context) (*entity.PasswordResetToken, error)
+	MarkAsUsed(id uint, ctx context.Context) error
+	RevokeByUserID(userID uint, ctx context.Context) error
+}
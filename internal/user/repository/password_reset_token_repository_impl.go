@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"rewrite/pkg/entity"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPasswordResetTokenAlreadyUsed = errors.New("password reset token already used")
+)
+
+type PasswordResetTokenRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewPasswordResetTokenRepositoryImpl(db *gorm.DB) PasswordResetTokenRepository {
+	return &PasswordResetTokenRepositoryImpl{db}
+}
+
+func (p *PasswordResetTokenRepositoryImpl) CreatePasswordResetToken(token *entity.PasswordResetToken, ctx context.Context) error {
+	return p.db.WithContext(ctx).Create(token).Error
+}
+
+func (p *PasswordResetTokenRepositoryImpl) FindByTokenHash(hash string, ctx context.Context) (*entity.PasswordResetToken, error) {
+	var token entity.PasswordResetToken
+
+	err := p.db.WithContext(ctx).Where("token_hash = ?", hash).First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// MarkAsUsed only matches an unused token so a reset token can not be
+// redeemed twice by concurrent requests.
+func (p *PasswordResetTokenRepositoryImpl) MarkAsUsed(id uint, ctx context.Context) error {
+	result := p.db.WithContext(ctx).
+		Model(&entity.PasswordResetToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrPasswordResetTokenAlreadyUsed
+	}
+
+	return nil
+}
+
+// RevokeByUserID uses up every unused reset token of the user, so only the
+// link sent last can be redeemed and none once the password was reset.
+func (p *PasswordResetTokenRepositoryImpl) RevokeByUserID(userID uint, ctx context.Context) error {
+	return p.db.WithContext(ctx).
+		Model(&entity.PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now()).Error
+}
@@ -0,0 +1,209 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"rewrite/pkg/entity"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type TestSuitePasswordResetTokenRepository struct {
+	suite.Suite
+	Mock                         sqlmock.Sqlmock
+	passwordResetTokenRepository PasswordResetTokenRepository
+	ctx                          context.Context
+}
+
+func (s *TestSuitePasswordResetTokenRepository) SetupTest() {
+	dbMock, mock, err := sqlmock.New()
+	s.NoError(err)
+
+	DB, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      dbMock,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	s.NoError(err)
+
+	s.Mock = mock
+	s.passwordResetTokenRepository = NewPasswordResetTokenRepositoryImpl(DB)
+	s.ctx = context.Background()
+}
+
+func (s *TestSuitePasswordResetTokenRepository) TeardownTest() {
+	s.Mock = nil
+	s.passwordResetTokenRepository = nil
+	s.ctx = nil
+}
+
+func (s *TestSuitePasswordResetTokenRepository) TestCreatePasswordResetToken() {
+	for _, tt := range []struct {
+		Name        string
+		Query       string
+		Err         error
+		ExpectedErr error
+	}{
+		{
+			Name:  "Success",
+			Query: "INSERT INTO `password_reset_tokens` (`created_at`,`updated_at`,`deleted_at`,`user_id`,`token_hash`,`expires_at`,`used_at`) VALUES (?,?,?,?,?,?,?)",
+		},
+		{
+			Name:        "Generic Error from DB",
+			Query:       "INSERT INTO `password_reset_tokens` (`created_at`,`updated_at`,`deleted_at`,`user_id`,`token_hash`,`expires_at`,`used_at`) VALUES (?,?,?,?,?,?,?)",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.Mock.ExpectBegin()
+			if tt.Err != nil {
+				s.Mock.ExpectExec(regexp.QuoteMeta(tt.Query)).WillReturnError(tt.Err)
+				s.Mock.ExpectRollback()
+			} else {
+				s.Mock.ExpectExec(regexp.QuoteMeta(tt.Query)).WillReturnResult(sqlmock.NewResult(1, 1))
+				s.Mock.ExpectCommit()
+			}
+
+			err := s.passwordResetTokenRepository.CreatePasswordResetToken(&entity.PasswordResetToken{}, s.ctx)
+
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TeardownTest()
+	}
+}
+
+func (s *TestSuitePasswordResetTokenRepository) TestFindByTokenHash() {
+	for _, tt := range []struct {
+		Name           string
+		Query          string
+		Rows           *sqlmock.Rows
+		Err            error
+		ExpectedReturn *entity.PasswordResetToken
+		ExpectedErr    error
+	}{
+		{
+			Name:  "Success",
+			Query: "SELECT * FROM `password_reset_tokens` WHERE token_hash = ? AND `password_reset_tokens`.`deleted_at` IS NULL ORDER BY `password_reset_tokens`.`id` LIMIT 1",
+			Rows: sqlmock.NewRows([]string{"user_id", "token_hash"}).
+				AddRow(1, "hash"),
+			ExpectedReturn: &entity.PasswordResetToken{
+				UserID:    1,
+				TokenHash: "hash",
+			},
+		},
+		{
+			Name:        "Generic Error from DB",
+			Query:       "SELECT * FROM `password_reset_tokens` WHERE token_hash = ? AND `password_reset_tokens`.`deleted_at` IS NULL ORDER BY `password_reset_tokens`.`id` LIMIT 1",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			if tt.Err != nil {
+				s.Mock.ExpectQuery(regexp.QuoteMeta(tt.Query)).WillReturnError(tt.Err)
+			} else {
+				s.Mock.ExpectQuery(regexp.QuoteMeta(tt.Query)).WillReturnRows(tt.Rows)
+			}
+
+			result, err := s.passwordResetTokenRepository.FindByTokenHash("hash", s.ctx)
+
+			s.Equal(tt.ExpectedReturn, result)
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TeardownTest()
+	}
+}
+
+func (s *TestSuitePasswordResetTokenRepository) TestMarkAsUsed() {
+	for _, tt := range []struct {
+		Name         string
+		Query        string
+		RowsAffected int64
+		Err          error
+		ExpectedErr  error
+	}{
+		{
+			Name:         "Success",
+			Query:        "UPDATE `password_reset_tokens` SET `used_at`=?,`updated_at`=? WHERE (id = ? AND used_at IS NULL) AND `password_reset_tokens`.`deleted_at` IS NULL",
+			RowsAffected: 1,
+		},
+		{
+			Name:         "Token already used",
+			Query:        "UPDATE `password_reset_tokens` SET `used_at`=?,`updated_at`=? WHERE (id = ? AND used_at IS NULL) AND `password_reset_tokens`.`deleted_at` IS NULL",
+			RowsAffected: 0,
+			ExpectedErr:  ErrPasswordResetTokenAlreadyUsed,
+		},
+		{
+			Name:        "Generic Error from DB",
+			Query:       "UPDATE `password_reset_tokens` SET `used_at`=?,`updated_at`=? WHERE (id = ? AND used_at IS NULL) AND `password_reset_tokens`.`deleted_at` IS NULL",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.Mock.ExpectBegin()
+			if tt.Err != nil {
+				s.Mock.ExpectExec(regexp.QuoteMeta(tt.Query)).WillReturnError(tt.Err)
+				s.Mock.ExpectRollback()
+			} else {
+				s.Mock.ExpectExec(regexp.QuoteMeta(tt.Query)).WillReturnResult(sqlmock.NewResult(0, tt.RowsAffected))
+				s.Mock.ExpectCommit()
+			}
+
+			err := s.passwordResetTokenRepository.MarkAsUsed(1, s.ctx)
+
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TeardownTest()
+	}
+}
+
+func (s *TestSuitePasswordResetTokenRepository) TestRevokeByUserID() {
+	for _, tt := range []struct {
+		Name        string
+		Query       string
+		Err         error
+		ExpectedErr error
+	}{
+		{
+			Name:  "Success",
+			Query: "UPDATE `password_reset_tokens` SET `used_at`=?,`updated_at`=? WHERE (user_id = ? AND used_at IS NULL) AND `password_reset_tokens`.`deleted_at` IS NULL",
+		},
+		{
+			Name:        "Generic Error from DB",
+			Query:       "UPDATE `password_reset_tokens` SET `used_at`=?,`updated_at`=? WHERE (user_id = ? AND used_at IS NULL) AND `password_reset_tokens`.`deleted_at` IS NULL",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.Mock.ExpectBegin()
+			if tt.Err != nil {
+				s.Mock.ExpectExec(regexp.QuoteMeta(tt.Query)).WillReturnError(tt.Err)
+				s.Mock.ExpectRollback()
+			} else {
+				s.Mock.ExpectExec(regexp.QuoteMeta(tt.Query)).WillReturnResult(sqlmock.NewResult(0, 2))
+				s.Mock.ExpectCommit()
+			}
+
+			err := s.passwordResetTokenRepository.RevokeByUserID(1, s.ctx)
+
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TeardownTest()
+	}
+}
+
+func TestPasswordResetTokenRepository(t *testing.T) {
+	suite.Run(t, new(TestSuitePasswordResetTokenRepository))
+}
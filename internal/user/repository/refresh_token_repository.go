@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"context"
+	"rewrite/pkg/entity"
+)
+
+type RefreshTokenRepository interface {
+	CreateRefreshToken(token *entity.RefreshToken, ctx context.Context) error
+	FindByTokenHash(hash string, ctx context.Context) (*entity.RefreshToken, error)
+	MarkAsUsed(id uint, ctx context.Context) error
+	RevokeFamily(familyID string, ctx context.Context) error
+	RevokeByUserID(userID uint, ctx context.Context) error
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"rewrite/pkg/entity"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRefreshTokenAlreadyUsed = errors.New("refresh token already used")
+)
+
+type RefreshTokenRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewRefreshTokenRepositoryImpl(db *gorm.DB) RefreshTokenRepository {
+	return &RefreshTokenRepositoryImpl{db}
+}
+
+func (r *RefreshTokenRepositoryImpl) CreateRefreshToken(token *entity.RefreshToken, ctx context.Context) error {
+	return r.db.WithContext(ctx).Create(token).Error
+}
+
+func (r *RefreshTokenRepositoryImpl) FindByTokenHash(hash string, ctx context.Context) (*entity.RefreshToken, error) {
+	var token entity.RefreshToken
+
+	err := r.db.WithContext(ctx).Where("token_hash = ?", hash).First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// MarkAsUsed flags the token as consumed. The update only matches a token that
+// has not been used yet, so two concurrent refreshes with the same token can
+// not both succeed.
+func (r *RefreshTokenRepositoryImpl) MarkAsUsed(id uint, ctx context.Context) error {
+	result := r.db.WithContext(ctx).
+		Model(&entity.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrRefreshTokenAlreadyUsed
+	}
+
+	return nil
+}
+
+func (r *RefreshTokenRepositoryImpl) RevokeFamily(familyID string, ctx context.Context) error {
+	return r.db.WithContext(ctx).
+		Model(&entity.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r *RefreshTokenRepositoryImpl) RevokeByUserID(userID uint, ctx context.Context) error {
+	return r.db.WithContext(ctx).
+		Model(&entity.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
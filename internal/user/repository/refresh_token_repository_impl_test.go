@@ -0,0 +1,247 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"rewrite/pkg/entity"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type TestSuiteRefreshTokenRepository struct {
+	suite.Suite
+	Mock                   sqlmock.Sqlmock
+	refreshTokenRepository RefreshTokenRepository
+	ctx                    context.Context
+}
+
+func (s *TestSuiteRefreshTokenRepository) SetupTest() {
+	dbMock, mock, err := sqlmock.New()
+	s.NoError(err)
+
+	DB, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      dbMock,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	s.NoError(err)
+
+	s.Mock = mock
+	s.refreshTokenRepository = NewRefreshTokenRepositoryImpl(DB)
+	s.ctx = context.Background()
+}
+
+func (s *TestSuiteRefreshTokenRepository) TeardownTest() {
+	s.Mock = nil
+	s.refreshTokenRepository = nil
+	s.ctx = nil
+}
+
+func (s *TestSuiteRefreshTokenRepository) TestCreateRefreshToken() {
+	for _, tt := range []struct {
+		Name        string
+		Query       string
+		Err         error
+		ExpectedErr error
+	}{
+		{
+			Name:  "Success",
+			Query: "INSERT INTO `refresh_tokens` (`created_at`,`updated_at`,`deleted_at`,`user_id`,`family_id`,`token_hash`,`expires_at`,`used_at`,`revoked_at`) VALUES (?,?,?,?,?,?,?,?,?)",
+		},
+		{
+			Name:        "Generic Error from DB",
+			Query:       "INSERT INTO `refresh_tokens` (`created_at`,`updated_at`,`deleted_at`,`user_id`,`family_id`,`token_hash`,`expires_at`,`used_at`,`revoked_at`) VALUES (?,?,?,?,?,?,?,?,?)",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.Mock.ExpectBegin()
+			if tt.Err != nil {
+				s.Mock.ExpectExec(regexp.QuoteMeta(tt.Query)).WillReturnError(tt.Err)
+				s.Mock.ExpectRollback()
+			} else {
+				s.Mock.ExpectExec(regexp.QuoteMeta(tt.Query)).WillReturnResult(sqlmock.NewResult(1, 1))
+				s.Mock.ExpectCommit()
+			}
+
+			err := s.refreshTokenRepository.CreateRefreshToken(&entity.RefreshToken{}, s.ctx)
+
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TeardownTest()
+	}
+}
+
+func (s *TestSuiteRefreshTokenRepository) TestFindByTokenHash() {
+	for _, tt := range []struct {
+		Name           string
+		Query          string
+		Rows           *sqlmock.Rows
+		Err            error
+		ExpectedReturn *entity.RefreshToken
+		ExpectedErr    error
+	}{
+		{
+			Name:  "Success",
+			Query: "SELECT * FROM `refresh_tokens` WHERE token_hash = ? AND `refresh_tokens`.`deleted_at` IS NULL ORDER BY `refresh_tokens`.`id` LIMIT 1",
+			Rows: sqlmock.NewRows([]string{"user_id", "family_id", "token_hash"}).
+				AddRow(1, "family", "hash"),
+			ExpectedReturn: &entity.RefreshToken{
+				UserID:    1,
+				FamilyID:  "family",
+				TokenHash: "hash",
+			},
+		},
+		{
+			Name:        "Generic Error from DB",
+			Query:       "SELECT * FROM `refresh_tokens` WHERE token_hash = ? AND `refresh_tokens`.`deleted_at` IS NULL ORDER BY `refresh_tokens`.`id` LIMIT 1",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			if tt.Err != nil {
+				s.Mock.ExpectQuery(regexp.QuoteMeta(tt.Query)).WillReturnError(tt.Err)
+			} else {
+				s.Mock.ExpectQuery(regexp.QuoteMeta(tt.Query)).WillReturnRows(tt.Rows)
+			}
+
+			result, err := s.refreshTokenRepository.FindByTokenHash("hash", s.ctx)
+
+			s.Equal(tt.ExpectedReturn, result)
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TeardownTest()
+	}
+}
+
+func (s *TestSuiteRefreshTokenRepository) TestMarkAsUsed() {
+	for _, tt := range []struct {
+		Name         string
+		Query        string
+		RowsAffected int64
+		Err          error
+		ExpectedErr  error
+	}{
+		{
+			Name:         "Success",
+			Query:        "UPDATE `refresh_tokens` SET `used_at`=?,`updated_at`=? WHERE (id = ? AND used_at IS NULL) AND `refresh_tokens`.`deleted_at` IS NULL",
+			RowsAffected: 1,
+		},
+		{
+			Name:         "Token already used",
+			Query:        "UPDATE `refresh_tokens` SET `used_at`=?,`updated_at`=? WHERE (id = ? AND used_at IS NULL) AND `refresh_tokens`.`deleted_at` IS NULL",
+			RowsAffected: 0,
+			ExpectedErr:  ErrRefreshTokenAlreadyUsed,
+		},
+		{
+			Name:        "Generic Error from DB",
+			Query:       "UPDATE `refresh_tokens` SET `used_at`=?,`updated_at`=? WHERE (id = ? AND used_at IS NULL) AND `refresh_tokens`.`deleted_at` IS NULL",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.Mock.ExpectBegin()
+			if tt.Err != nil {
+				s.Mock.ExpectExec(regexp.QuoteMeta(tt.Query)).WillReturnError(tt.Err)
+				s.Mock.ExpectRollback()
+			} else {
+				s.Mock.ExpectExec(regexp.QuoteMeta(tt.Query)).WillReturnResult(sqlmock.NewResult(0, tt.RowsAffected))
+				s.Mock.ExpectCommit()
+			}
+
+			err := s.refreshTokenRepository.MarkAsUsed(1, s.ctx)
+
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TeardownTest()
+	}
+}
+
+func (s *TestSuiteRefreshTokenRepository) TestRevokeFamily() {
+	for _, tt := range []struct {
+		Name        string
+		Query       string
+		Err         error
+		ExpectedErr error
+	}{
+		{
+			Name:  "Success",
+			Query: "UPDATE `refresh_tokens` SET `revoked_at`=?,`updated_at`=? WHERE (family_id = ? AND revoked_at IS NULL) AND `refresh_tokens`.`deleted_at` IS NULL",
+		},
+		{
+			Name:        "Generic Error from DB",
+			Query:       "UPDATE `refresh_tokens` SET `revoked_at`=?,`updated_at`=? WHERE (family_id = ? AND revoked_at IS NULL) AND `refresh_tokens`.`deleted_at` IS NULL",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.Mock.ExpectBegin()
+			if tt.Err != nil {
+				s.Mock.ExpectExec(regexp.QuoteMeta(tt.Query)).WillReturnError(tt.Err)
+				s.Mock.ExpectRollback()
+			} else {
+				s.Mock.ExpectExec(regexp.QuoteMeta(tt.Query)).WillReturnResult(sqlmock.NewResult(0, 2))
+				s.Mock.ExpectCommit()
+			}
+
+			err := s.refreshTokenRepository.RevokeFamily("family", s.ctx)
+
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TeardownTest()
+	}
+}
+
+func (s *TestSuiteRefreshTokenRepository) TestRevokeByUserID() {
+	for _, tt := range []struct {
+		Name        string
+		Query       string
+		Err         error
+		ExpectedErr error
+	}{
+		{
+			Name:  "Success",
+			Query: "UPDATE `refresh_tokens` SET `revoked_at`=?,`updated_at`=? WHERE (user_id = ? AND revoked_at IS NULL) AND `refresh_tokens`.`deleted_at` IS NULL",
+		},
+		{
+			Name:        "Generic Error from DB",
+			Query:       "UPDATE `refresh_tokens` SET `revoked_at`=?,`updated_at`=? WHERE (user_id = ? AND revoked_at IS NULL) AND `refresh_tokens`.`deleted_at` IS NULL",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.Mock.ExpectBegin()
+			if tt.Err != nil {
+				s.Mock.ExpectExec(regexp.QuoteMeta(tt.Query)).WillReturnError(tt.Err)
+				s.Mock.ExpectRollback()
+			} else {
+				s.Mock.ExpectExec(regexp.QuoteMeta(tt.Query)).WillReturnResult(sqlmock.NewResult(0, 2))
+				s.Mock.ExpectCommit()
+			}
+
+			err := s.refreshTokenRepository.RevokeByUserID(1, s.ctx)
+
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TeardownTest()
+	}
+}
+
+func TestRefreshTokenRepository(t *testing.T) {
+	suite.Run(t, new(TestSuiteRefreshTokenRepository))
+}
@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"context"
+	"rewrite/pkg/entity"
+	"time"
+)
+
+type RevokedTokenRepository interface {
+	CreateRevokedToken(token *entity.RevokedToken, ctx context.Context) error
+	IsRevoked(jti string, userID uint, issuedAt time.Time, ctx context.Context) (bool, error)
+	DeleteExpired(ctx context.Context) (int64, error)
+}
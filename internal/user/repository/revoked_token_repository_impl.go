@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"rewrite/pkg/entity"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type RevokedTokenRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewRevokedTokenRepositoryImpl(db *gorm.DB) RevokedTokenRepository {
+	return &RevokedTokenRepositoryImpl{db}
+}
+
+func (r *RevokedTokenRepositoryImpl) CreateRevokedToken(token *entity.RevokedToken, ctx context.Context) error {
+	return r.db.WithContext(ctx).Create(token).Error
+}
+
+// IsRevoked compares the revocations of every token of the user with
+// issuedAt, the iat claim, at its whole second precision: only tokens issued
+// in a second before the revocation are revoked. Tokens issued in the same
+// second can not be told apart from the ones issued just after, such as the
+// token of the next login, so they are kept.
+func (r *RevokedTokenRepositoryImpl) IsRevoked(jti string, userID uint, issuedAt time.Time, ctx context.Context) (bool, error) {
+	var count int64
+
+	nextSecond := issuedAt.Truncate(time.Second).Add(time.Second)
+	err := r.db.WithContext(ctx).
+		Model(&entity.RevokedToken{}).
+		Where("(jti <> '' AND jti = ?) OR (jti = '' AND user_id = ? AND created_at >= ?)", jti, userID, nextSecond).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (r *RevokedTokenRepositoryImpl) DeleteExpired(ctx context.Context) (int64, error) {
+	result := r.db.WithContext(ctx).Where("expires_at < ?", time.Now()).Delete(&entity.RevokedToken{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	return result.RowsAffected, nil
+}
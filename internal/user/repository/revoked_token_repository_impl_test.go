@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"rewrite/pkg/entity"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type TestSuiteRevokedTokenRepository struct {
+	suite.Suite
+	Mock                   sqlmock.Sqlmock
+	revokedTokenRepository RevokedTokenRepository
+	ctx                    context.Context
+}
+
+func (s *TestSuiteRevokedTokenRepository) SetupTest() {
+	dbMock, mock, err := sqlmock.New()
+	s.NoError(err)
+
+	DB, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      dbMock,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	s.NoError(err)
+
+	s.Mock = mock
+	s.revokedTokenRepository = NewRevokedTokenRepositoryImpl(DB)
+	s.ctx = context.Background()
+}
+
+func (s *TestSuiteRevokedTokenRepository) TeardownTest() {
+	s.Mock = nil
+	s.revokedTokenRepository = nil
+	s.ctx = nil
+}
+
+func (s *TestSuiteRevokedTokenRepository) TestCreateRevokedToken() {
+	for _, tt := range []struct {
+		Name        string
+		Query       string
+		Err         error
+		ExpectedErr error
+	}{
+		{
+			Name:  "Success",
+			Query: "INSERT INTO `revoked_tokens` (`created_at`,`jti`,`user_id`,`expires_at`) VALUES (?,?,?,?)",
+		},
+		{
+			Name:        "Generic Error from DB",
+			Query:       "INSERT INTO `revoked_tokens` (`created_at`,`jti`,`user_id`,`expires_at`) VALUES (?,?,?,?)",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.Mock.ExpectBegin()
+			if tt.Err != nil {
+				s.Mock.ExpectExec(regexp.QuoteMeta(tt.Query)).WillReturnError(tt.Err)
+				s.Mock.ExpectRollback()
+			} else {
+				s.Mock.ExpectExec(regexp.QuoteMeta(tt.Query)).WillReturnResult(sqlmock.NewResult(1, 1))
+				s.Mock.ExpectCommit()
+			}
+
+			err := s.revokedTokenRepository.CreateRevokedToken(&entity.RevokedToken{
+				JTI:       "jti",
+				UserID:    1,
+				ExpiresAt: time.Now().Add(time.Hour),
+			}, s.ctx)
+
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TeardownTest()
+	}
+}
+
+func (s *TestSuiteRevokedTokenRepository) TestIsRevoked() {
+	for _, tt := range []struct {
+		Name           string
+		Query          string
+		Rows           *sqlmock.Rows
+		Err            error
+		ExpectedReturn bool
+		ExpectedErr    error
+	}{
+		{
+			Name:           "Token revoked",
+			Query:          "SELECT count(*) FROM `revoked_tokens` WHERE (jti <> '' AND jti = ?) OR (jti = '' AND user_id = ? AND created_at >= ?)",
+			Rows:           sqlmock.NewRows([]string{"count"}).AddRow(1),
+			ExpectedReturn: true,
+		},
+		{
+			Name:           "Token not revoked",
+			Query:          "SELECT count(*) FROM `revoked_tokens` WHERE (jti <> '' AND jti = ?) OR (jti = '' AND user_id = ? AND created_at >= ?)",
+			Rows:           sqlmock.NewRows([]string{"count"}).AddRow(0),
+			ExpectedReturn: false,
+		},
+		{
+			Name:        "Generic Error from DB",
+			Query:       "SELECT count(*) FROM `revoked_tokens` WHERE (jti <> '' AND jti = ?) OR (jti = '' AND user_id = ? AND created_at >= ?)",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			issuedAt := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+			query := s.Mock.ExpectQuery(regexp.QuoteMeta(tt.Query)).WithArgs("jti", 1, issuedAt.Add(time.Second))
+			if tt.Err != nil {
+				query.WillReturnError(tt.Err)
+			} else {
+				query.WillReturnRows(tt.Rows)
+			}
+
+			result, err := s.revokedTokenRepository.IsRevoked("jti", 1, issuedAt, s.ctx)
+
+			s.Equal(tt.ExpectedReturn, result)
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TeardownTest()
+	}
+}
+
+func (s *TestSuiteRevokedTokenRepository) TestDeleteExpired() {
+	for _, tt := range []struct {
+		Name           string
+		Query          string
+		Err            error
+		ExpectedReturn int64
+		ExpectedErr    error
+	}{
+		{
+			Name:           "Success",
+			Query:          "DELETE FROM `revoked_tokens` WHERE expires_at < ?",
+			ExpectedReturn: 2,
+		},
+		{
+			Name:        "Generic Error from DB",
+			Query:       "DELETE FROM `revoked_tokens` WHERE expires_at < ?",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.Mock.ExpectBegin()
+			if tt.Err != nil {
+				s.Mock.ExpectExec(regexp.QuoteMeta(tt.Query)).WillReturnError(tt.Err)
+				s.Mock.ExpectRollback()
+			} else {
+				s.Mock.ExpectExec(regexp.QuoteMeta(tt.Query)).WillReturnResult(sqlmock.NewResult(0, tt.ExpectedReturn))
+				s.Mock.ExpectCommit()
+			}
+
+			result, err := s.revokedTokenRepository.DeleteExpired(s.ctx)
+
+			s.Equal(tt.ExpectedReturn, result)
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TeardownTest()
+	}
+}
+
+func TestRevokedTokenRepository(t *testing.T) {
+	suite.Run(t, new(TestSuiteRevokedTokenRepository))
+}
@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"context"
+	"rewrite/pkg/entity"
+)
+
+type RoleRepository interface {
+	FindAllRoles(ctx context.Context) (entity.Roles, error)
+	FindRoleByName(name string, ctx context.Context) (*entity.Role, error)
+	FindAllPermissions(ctx context.Context) ([]entity.Permission, error)
+	FindPermissionsByName(names []string, ctx context.Context) ([]entity.Permission, error)
+	CreateRole(role *entity.Role, ctx context.Context) error
+	UpdateRole(role *entity.Role, ctx context.Context) error
+	DeleteRole(role *entity.Role, ctx context.Context) error
+	AssignRole(userID uint, roleID uint, ctx context.Context) error
+	UnassignRole(userID uint, roleID uint, ctx context.Context) error
+	HasPermission(roles []string, permission string, ctx context.Context) (bool, error)
+}
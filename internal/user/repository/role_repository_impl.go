@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"rewrite/pkg/entity"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrRoleAlreadyExist = errors.New("role already exist")
+)
+
+type RoleRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewRoleRepositoryImpl(db *gorm.DB) RoleRepository {
+	return &RoleRepositoryImpl{db}
+}
+
+func (r *RoleRepositoryImpl) FindAllRoles(ctx context.Context) (entity.Roles, error) {
+	var roles entity.Roles
+
+	err := r.db.WithContext(ctx).Preload("Permissions").Order("name").Find(&roles).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+func (r *RoleRepositoryImpl) FindRoleByName(name string, ctx context.Context) (*entity.Role, error) {
+	var role entity.Role
+
+	err := r.db.WithContext(ctx).Preload("Permissions").Where("name = ?", name).First(&role).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &role, nil
+}
+
+func (r *RoleRepositoryImpl) FindAllPermissions(ctx context.Context) ([]entity.Permission, error) {
+	var permissions []entity.Permission
+
+	err := r.db.WithContext(ctx).Order("name").Find(&permissions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+func (r *RoleRepositoryImpl) FindPermissionsByName(names []string, ctx context.Context) ([]entity.Permission, error) {
+	var permissions []entity.Permission
+
+	err := r.db.WithContext(ctx).Where("name IN ?", names).Find(&permissions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+func (r *RoleRepositoryImpl) CreateRole(role *entity.Role, ctx context.Context) error {
+	err := r.db.WithContext(ctx).Omit("Permissions.*").Create(role).Error
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrRoleAlreadyExist
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// UpdateRole saves the description and replaces the permission set of the
+// role.
+func (r *RoleRepositoryImpl) UpdateRole(role *entity.Role, ctx context.Context) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(role).Omit("Permissions").Update("description", role.Description).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Exec("DELETE FROM role_permissions WHERE role_id = ?", role.ID).Error
+		if err != nil {
+			return err
+		}
+
+		if len(role.Permissions) == 0 {
+			return nil
+		}
+
+		links := make([]map[string]interface{}, 0, len(role.Permissions))
+		for _, permission := range role.Permissions {
+			links = append(links, map[string]interface{}{"role_id": role.ID, "permission_id": permission.ID})
+		}
+
+		return tx.Table("role_permissions").Create(links).Error
+	})
+}
+
+// DeleteRole removes the role together with its permission and user links.
+func (r *RoleRepositoryImpl) DeleteRole(role *entity.Role, ctx context.Context) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec("DELETE FROM user_roles WHERE role_id = ?", role.ID).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Exec("DELETE FROM role_permissions WHERE role_id = ?", role.ID).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Delete(role).Error
+	})
+}
+
+// AssignRole is idempotent, assigning a role the user already has is a no-op.
+func (r *RoleRepositoryImpl) AssignRole(userID uint, roleID uint, ctx context.Context) error {
+	return r.db.WithContext(ctx).
+		Table("user_roles").
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "role_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"user_id"}),
+		}).
+		Create(map[string]interface{}{"user_id": userID, "role_id": roleID}).Error
+}
+
+func (r *RoleRepositoryImpl) UnassignRole(userID uint, roleID uint, ctx context.Context) error {
+	return r.db.WithContext(ctx).
+		Exec("DELETE FROM user_roles WHERE user_id = ? AND role_id = ?", userID, roleID).Error
+}
+
+// HasPermission reports whether any of the named roles grants the permission.
+func (r *RoleRepositoryImpl) HasPermission(roles []string, permission string, ctx context.Context) (bool, error) {
+	var count int64
+
+	err := r.db.WithContext(ctx).
+		Model(&entity.Role{}).
+		Joins("JOIN role_permissions ON role_permissions.role_id = roles.id").
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id").
+		Where("roles.name IN ? AND permissions.name = ?", roles, permission).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
@@ -0,0 +1,461 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"rewrite/pkg/entity"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	mysqlerr "github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type TestSuiteRoleRepository struct {
+	suite.Suite
+	Mock           sqlmock.Sqlmock
+	roleRepository RoleRepository
+	ctx            context.Context
+}
+
+func (s *TestSuiteRoleRepository) SetupTest() {
+	dbMock, mock, err := sqlmock.New()
+	s.NoError(err)
+
+	DB, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      dbMock,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	s.NoError(err)
+
+	s.Mock = mock
+	s.roleRepository = NewRoleRepositoryImpl(DB)
+	s.ctx = context.Background()
+}
+
+func (s *TestSuiteRoleRepository) TeardownTest() {
+	s.Mock = nil
+	s.roleRepository = nil
+	s.ctx = nil
+}
+
+func (s *TestSuiteRoleRepository) TestFindAllRoles() {
+	for _, tt := range []struct {
+		Name           string
+		Err            error
+		ExpectedReturn entity.Roles
+		ExpectedErr    error
+	}{
+		{
+			Name: "Success",
+			ExpectedReturn: entity.Roles{
+				{ID: 1, Name: "admin", Permissions: []entity.Permission{{ID: 3, Name: "users:list"}}},
+				{ID: 2, Name: "support", Permissions: []entity.Permission{}},
+			},
+		},
+		{
+			Name:        "Generic Error from DB",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			query := s.Mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `roles` ORDER BY name"))
+			if tt.Err != nil {
+				query.WillReturnError(tt.Err)
+			} else {
+				query.WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "admin").AddRow(2, "support"))
+				s.Mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `role_permissions` WHERE `role_permissions`.`role_id` IN (?,?)")).
+					WillReturnRows(sqlmock.NewRows([]string{"role_id", "permission_id"}).AddRow(1, 3))
+				s.Mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `permissions` WHERE `permissions`.`id` = ?")).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(3, "users:list"))
+			}
+
+			result, err := s.roleRepository.FindAllRoles(s.ctx)
+
+			s.Equal(tt.ExpectedReturn, result)
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TeardownTest()
+	}
+}
+
+func (s *TestSuiteRoleRepository) TestFindRoleByName() {
+	for _, tt := range []struct {
+		Name           string
+		Rows           *sqlmock.Rows
+		Err            error
+		ExpectedReturn *entity.Role
+		ExpectedErr    error
+	}{
+		{
+			Name: "Success",
+			Rows: sqlmock.NewRows([]string{"id", "name", "description"}).AddRow(1, "admin", "Administrator"),
+			ExpectedReturn: &entity.Role{
+				ID:          1,
+				Name:        "admin",
+				Description: "Administrator",
+				Permissions: []entity.Permission{},
+			},
+		},
+		{
+			Name:        "Not found",
+			Rows:        sqlmock.NewRows([]string{"id", "name", "description"}),
+			ExpectedErr: gorm.ErrRecordNotFound,
+		},
+		{
+			Name:        "Generic Error from DB",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			query := s.Mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `roles` WHERE name = ? ORDER BY `roles`.`id` LIMIT 1"))
+			if tt.Err != nil {
+				query.WillReturnError(tt.Err)
+			} else {
+				query.WillReturnRows(tt.Rows)
+				s.Mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `role_permissions` WHERE `role_permissions`.`role_id` = ?")).
+					WillReturnRows(sqlmock.NewRows([]string{"role_id", "permission_id"}))
+			}
+
+			result, err := s.roleRepository.FindRoleByName("admin", s.ctx)
+
+			s.Equal(tt.ExpectedReturn, result)
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TeardownTest()
+	}
+}
+
+func (s *TestSuiteRoleRepository) TestFindAllPermissions() {
+	for _, tt := range []struct {
+		Name           string
+		Err            error
+		ExpectedReturn []entity.Permission
+		ExpectedErr    error
+	}{
+		{
+			Name: "Success",
+			ExpectedReturn: []entity.Permission{
+				{ID: 2, Name: "roles:manage"},
+				{ID: 1, Name: "users:list"},
+			},
+		},
+		{
+			Name:        "Generic Error from DB",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			query := s.Mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `permissions` ORDER BY name"))
+			if tt.Err != nil {
+				query.WillReturnError(tt.Err)
+			} else {
+				query.WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(2, "roles:manage").AddRow(1, "users:list"))
+			}
+
+			result, err := s.roleRepository.FindAllPermissions(s.ctx)
+
+			s.Equal(tt.ExpectedReturn, result)
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TeardownTest()
+	}
+}
+
+func (s *TestSuiteRoleRepository) TestFindPermissionsByName() {
+	for _, tt := range []struct {
+		Name           string
+		Err            error
+		ExpectedReturn []entity.Permission
+		ExpectedErr    error
+	}{
+		{
+			Name:           "Success",
+			ExpectedReturn: []entity.Permission{{ID: 1, Name: "users:list"}},
+		},
+		{
+			Name:        "Generic Error from DB",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			query := s.Mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `permissions` WHERE name IN (?,?)")).
+				WithArgs("users:list", "unknown")
+			if tt.Err != nil {
+				query.WillReturnError(tt.Err)
+			} else {
+				query.WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "users:list"))
+			}
+
+			result, err := s.roleRepository.FindPermissionsByName([]string{"users:list", "unknown"}, s.ctx)
+
+			s.Equal(tt.ExpectedReturn, result)
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TeardownTest()
+	}
+}
+
+func (s *TestSuiteRoleRepository) TestCreateRole() {
+	for _, tt := range []struct {
+		Name        string
+		Err         error
+		ExpectedErr error
+	}{
+		{
+			Name: "Success",
+		},
+		{
+			Name:        "Duplicate name",
+			Err:         &mysqlerr.MySQLError{Number: 1062, Message: "Duplicate entry 'support' for key 'name'"},
+			ExpectedErr: ErrRoleAlreadyExist,
+		},
+		{
+			Name:        "Generic Error from DB",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.Mock.ExpectBegin()
+			insert := s.Mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `roles` (`created_at`,`updated_at`,`name`,`description`) VALUES (?,?,?,?)"))
+			if tt.Err != nil {
+				insert.WillReturnError(tt.Err)
+				s.Mock.ExpectRollback()
+			} else {
+				insert.WillReturnResult(sqlmock.NewResult(5, 1))
+				s.Mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `role_permissions` (`role_id`,`permission_id`) VALUES (?,?) ON DUPLICATE KEY UPDATE `role_id`=`role_id`")).
+					WithArgs(5, 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				s.Mock.ExpectCommit()
+			}
+
+			err := s.roleRepository.CreateRole(&entity.Role{
+				Name:        "support",
+				Permissions: []entity.Permission{{ID: 1, Name: "users:list"}},
+			}, s.ctx)
+
+			s.Equal(tt.ExpectedErr, err)
+			s.NoError(s.Mock.ExpectationsWereMet())
+		})
+		s.TeardownTest()
+	}
+}
+
+func (s *TestSuiteRoleRepository) TestUpdateRole() {
+	for _, tt := range []struct {
+		Name        string
+		Err         error
+		ExpectedErr error
+	}{
+		{
+			Name: "Success",
+		},
+		{
+			Name:        "Generic Error from DB",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.Mock.ExpectBegin()
+			s.Mock.ExpectExec(regexp.QuoteMeta("UPDATE `roles` SET `description`=?,`updated_at`=? WHERE `id` = ?")).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			s.Mock.ExpectExec(regexp.QuoteMeta("DELETE FROM role_permissions WHERE role_id = ?")).
+				WithArgs(1).
+				WillReturnResult(sqlmock.NewResult(0, 2))
+			insert := s.Mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `role_permissions` (`permission_id`,`role_id`) VALUES (?,?),(?,?)")).
+				WithArgs(2, 1, 3, 1)
+			if tt.Err != nil {
+				insert.WillReturnError(tt.Err)
+				s.Mock.ExpectRollback()
+			} else {
+				insert.WillReturnResult(sqlmock.NewResult(0, 2))
+				s.Mock.ExpectCommit()
+			}
+
+			err := s.roleRepository.UpdateRole(&entity.Role{
+				ID:          1,
+				Name:        "support",
+				Description: "Support staff",
+				Permissions: []entity.Permission{{ID: 2, Name: "users:list"}, {ID: 3, Name: "roles:manage"}},
+			}, s.ctx)
+
+			s.Equal(tt.ExpectedErr, err)
+			s.NoError(s.Mock.ExpectationsWereMet())
+		})
+		s.TeardownTest()
+	}
+}
+
+func (s *TestSuiteRoleRepository) TestDeleteRole() {
+	for _, tt := range []struct {
+		Name        string
+		Err         error
+		ExpectedErr error
+	}{
+		{
+			Name: "Success",
+		},
+		{
+			Name:        "Generic Error from DB",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.Mock.ExpectBegin()
+			s.Mock.ExpectExec(regexp.QuoteMeta("DELETE FROM user_roles WHERE role_id = ?")).
+				WithArgs(1).
+				WillReturnResult(sqlmock.NewResult(0, 3))
+			s.Mock.ExpectExec(regexp.QuoteMeta("DELETE FROM role_permissions WHERE role_id = ?")).
+				WithArgs(1).
+				WillReturnResult(sqlmock.NewResult(0, 2))
+			remove := s.Mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `roles` WHERE `roles`.`id` = ?"))
+			if tt.Err != nil {
+				remove.WillReturnError(tt.Err)
+				s.Mock.ExpectRollback()
+			} else {
+				remove.WillReturnResult(sqlmock.NewResult(0, 1))
+				s.Mock.ExpectCommit()
+			}
+
+			err := s.roleRepository.DeleteRole(&entity.Role{ID: 1, Name: "support"}, s.ctx)
+
+			s.Equal(tt.ExpectedErr, err)
+			s.NoError(s.Mock.ExpectationsWereMet())
+		})
+		s.TeardownTest()
+	}
+}
+
+func (s *TestSuiteRoleRepository) TestAssignRole() {
+	for _, tt := range []struct {
+		Name        string
+		Err         error
+		ExpectedErr error
+	}{
+		{
+			Name: "Success",
+		},
+		{
+			Name:        "Generic Error from DB",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.Mock.ExpectBegin()
+			insert := s.Mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `user_roles` (`role_id`,`user_id`) VALUES (?,?) ON DUPLICATE KEY UPDATE `user_id`=VALUES(`user_id`)")).
+				WithArgs(2, 1)
+			if tt.Err != nil {
+				insert.WillReturnError(tt.Err)
+				s.Mock.ExpectRollback()
+			} else {
+				insert.WillReturnResult(sqlmock.NewResult(0, 1))
+				s.Mock.ExpectCommit()
+			}
+
+			err := s.roleRepository.AssignRole(1, 2, s.ctx)
+
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TeardownTest()
+	}
+}
+
+func (s *TestSuiteRoleRepository) TestUnassignRole() {
+	for _, tt := range []struct {
+		Name        string
+		Err         error
+		ExpectedErr error
+	}{
+		{
+			Name: "Success",
+		},
+		{
+			Name:        "Generic Error from DB",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			remove := s.Mock.ExpectExec(regexp.QuoteMeta("DELETE FROM user_roles WHERE user_id = ? AND role_id = ?")).
+				WithArgs(1, 2)
+			if tt.Err != nil {
+				remove.WillReturnError(tt.Err)
+			} else {
+				remove.WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			err := s.roleRepository.UnassignRole(1, 2, s.ctx)
+
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TeardownTest()
+	}
+}
+
+func (s *TestSuiteRoleRepository) TestHasPermission() {
+	for _, tt := range []struct {
+		Name           string
+		Count          int
+		Err            error
+		ExpectedReturn bool
+		ExpectedErr    error
+	}{
+		{
+			Name:           "Granted",
+			Count:          1,
+			ExpectedReturn: true,
+		},
+		{
+			Name:           "Not granted",
+			Count:          0,
+			ExpectedReturn: false,
+		},
+		{
+			Name:        "Generic Error from DB",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			query := s.Mock.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM `roles` JOIN role_permissions ON role_permissions.role_id = roles.id JOIN permissions ON permissions.id = role_permissions.permission_id WHERE roles.name IN (?,?) AND permissions.name = ?")).
+				WithArgs("admin", "support", "users:list")
+			if tt.Err != nil {
+				query.WillReturnError(tt.Err)
+			} else {
+				query.WillReturnRows(sqlmock.NewRows([]string{"count(*)"}).AddRow(tt.Count))
+			}
+
+			result, err := s.roleRepository.HasPermission([]string{"admin", "support"}, "users:list", s.ctx)
+
+			s.Equal(tt.ExpectedReturn, result)
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TeardownTest()
+	}
+}
+
+func TestRoleRepository(t *testing.T) {
+	suite.Run(t, new(TestSuiteRoleRepository))
+}
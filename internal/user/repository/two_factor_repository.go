@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"context"
+	"rewrite/pkg/entity"
+)
+
+type TwoFactorRepository interface {
+	FindByUserID(userID uint, ctx context.Context) (*entity.TwoFactor, error)
+	SaveTwoFactor(twoFactor *entity.TwoFactor, ctx context.Context) error
+	EnableTwoFactor(twoFactor *entity.TwoFactor, recoveryCodes []entity.RecoveryCode, ctx context.Context) error
+	DisableTwoFactor(userID uint, ctx context.Context) error
+	UpdateLastUsedStep(id uint, step int64, ctx context.Context) error
+	UseRecoveryCode(userID uint, codeHash string, ctx context.Context) error
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"rewrite/pkg/entity"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTOTPStepAlreadyUsed  = errors.New("totp code already used")
+	ErrRecoveryCodeNotFound = errors.New("recovery code not found")
+)
+
+type TwoFactorRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewTwoFactorRepositoryImpl(db *gorm.DB) TwoFactorRepository {
+	return &TwoFactorRepositoryImpl{db}
+}
+
+func (t *TwoFactorRepositoryImpl) FindByUserID(userID uint, ctx context.Context) (*entity.TwoFactor, error) {
+	var twoFactor entity.TwoFactor
+
+	err := t.db.WithContext(ctx).Where("user_id = ?", userID).First(&twoFactor).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &twoFactor, nil
+}
+
+func (t *TwoFactorRepositoryImpl) SaveTwoFactor(twoFactor *entity.TwoFactor, ctx context.Context) error {
+	return t.db.WithContext(ctx).Save(twoFactor).Error
+}
+
+// EnableTwoFactor marks the enrollment as confirmed and replaces any previous
+// recovery codes in a single transaction.
+func (t *TwoFactorRepositoryImpl) EnableTwoFactor(twoFactor *entity.TwoFactor, recoveryCodes []entity.RecoveryCode, ctx context.Context) error {
+	return t.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(twoFactor).Updates(map[string]interface{}{
+			"enabled_at":     twoFactor.EnabledAt,
+			"last_used_step": twoFactor.LastUsedStep,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Unscoped().Where("user_id = ?", twoFactor.UserID).Delete(&entity.RecoveryCode{}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&recoveryCodes).Error
+	})
+}
+
+// DisableTwoFactor removes the secret and the recovery codes for good so the
+// user can enroll again later.
+func (t *TwoFactorRepositoryImpl) DisableTwoFactor(userID uint, ctx context.Context) error {
+	return t.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Where("user_id = ?", userID).Delete(&entity.RecoveryCode{}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Where("user_id = ?", userID).Delete(&entity.TwoFactor{}).Error
+	})
+}
+
+// UpdateLastUsedStep only moves the step forward, so the same TOTP code can
+// not be accepted twice even by concurrent requests.
+func (t *TwoFactorRepositoryImpl) UpdateLastUsedStep(id uint, step int64, ctx context.Context) error {
+	result := t.db.WithContext(ctx).
+		Model(&entity.TwoFactor{}).
+		Where("id = ? AND last_used_step < ?", id, step).
+		Update("last_used_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrTOTPStepAlreadyUsed
+	}
+
+	return nil
+}
+
+func (t *TwoFactorRepositoryImpl) UseRecoveryCode(userID uint, codeHash string, ctx context.Context) error {
+	result := t.db.WithContext(ctx).
+		Model(&entity.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrRecoveryCodeNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,306 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"rewrite/pkg/entity"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type TestSuiteTwoFactorRepository struct {
+	suite.Suite
+	Mock                sqlmock.Sqlmock
+	twoFactorRepository TwoFactorRepository
+	ctx                 context.Context
+}
+
+func (s *TestSuiteTwoFactorRepository) SetupTest() {
+	dbMock, mock, err := sqlmock.New()
+	s.NoError(err)
+
+	DB, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      dbMock,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	s.NoError(err)
+
+	s.Mock = mock
+	s.twoFactorRepository = NewTwoFactorRepositoryImpl(DB)
+	s.ctx = context.Background()
+}
+
+func (s *TestSuiteTwoFactorRepository) TeardownTest() {
+	s.Mock = nil
+	s.twoFactorRepository = nil
+	s.ctx = nil
+}
+
+func (s *TestSuiteTwoFactorRepository) TestFindByUserID() {
+	for _, tt := range []struct {
+		Name           string
+		Query          string
+		Rows           *sqlmock.Rows
+		Err            error
+		ExpectedReturn *entity.TwoFactor
+		ExpectedErr    error
+	}{
+		{
+			Name:  "Success",
+			Query: "SELECT * FROM `two_factors` WHERE user_id = ? AND `two_factors`.`deleted_at` IS NULL ORDER BY `two_factors`.`id` LIMIT 1",
+			Rows: sqlmock.NewRows([]string{"user_id", "secret"}).
+				AddRow(1, "SECRET"),
+			ExpectedReturn: &entity.TwoFactor{
+				UserID: 1,
+				Secret: "SECRET",
+			},
+		},
+		{
+			Name:        "Not enrolled",
+			Query:       "SELECT * FROM `two_factors` WHERE user_id = ? AND `two_factors`.`deleted_at` IS NULL ORDER BY `two_factors`.`id` LIMIT 1",
+			Rows:        sqlmock.NewRows([]string{"user_id", "secret"}),
+			ExpectedErr: gorm.ErrRecordNotFound,
+		},
+		{
+			Name:        "Generic Error from DB",
+			Query:       "SELECT * FROM `two_factors` WHERE user_id = ? AND `two_factors`.`deleted_at` IS NULL ORDER BY `two_factors`.`id` LIMIT 1",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			if tt.Err != nil {
+				s.Mock.ExpectQuery(regexp.QuoteMeta(tt.Query)).WillReturnError(tt.Err)
+			} else {
+				s.Mock.ExpectQuery(regexp.QuoteMeta(tt.Query)).WillReturnRows(tt.Rows)
+			}
+
+			result, err := s.twoFactorRepository.FindByUserID(1, s.ctx)
+
+			s.Equal(tt.ExpectedReturn, result)
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TeardownTest()
+	}
+}
+
+func (s *TestSuiteTwoFactorRepository) TestSaveTwoFactor() {
+	for _, tt := range []struct {
+		Name        string
+		Query       string
+		Err         error
+		ExpectedErr error
+	}{
+		{
+			Name:  "Success",
+			Query: "INSERT INTO `two_factors` (`created_at`,`updated_at`,`deleted_at`,`user_id`,`secret`,`enabled_at`,`last_used_step`) VALUES (?,?,?,?,?,?,?)",
+		},
+		{
+			Name:        "Generic Error from DB",
+			Query:       "INSERT INTO `two_factors` (`created_at`,`updated_at`,`deleted_at`,`user_id`,`secret`,`enabled_at`,`last_used_step`) VALUES (?,?,?,?,?,?,?)",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.Mock.ExpectBegin()
+			if tt.Err != nil {
+				s.Mock.ExpectExec(regexp.QuoteMeta(tt.Query)).WillReturnError(tt.Err)
+				s.Mock.ExpectRollback()
+			} else {
+				s.Mock.ExpectExec(regexp.QuoteMeta(tt.Query)).WillReturnResult(sqlmock.NewResult(1, 1))
+				s.Mock.ExpectCommit()
+			}
+
+			err := s.twoFactorRepository.SaveTwoFactor(&entity.TwoFactor{UserID: 1, Secret: "SECRET"}, s.ctx)
+
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TeardownTest()
+	}
+}
+
+func (s *TestSuiteTwoFactorRepository) TestEnableTwoFactor() {
+	enabledAt := time.Now()
+
+	for _, tt := range []struct {
+		Name        string
+		Err         error
+		ExpectedErr error
+	}{
+		{
+			Name: "Success",
+		},
+		{
+			Name:        "Generic Error from DB",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.Mock.ExpectBegin()
+			s.Mock.ExpectExec(regexp.QuoteMeta("UPDATE `two_factors` SET `enabled_at`=?,`last_used_step`=?,`updated_at`=? WHERE `two_factors`.`deleted_at` IS NULL AND `id` = ?")).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			s.Mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `recovery_codes` WHERE user_id = ?")).
+				WillReturnResult(sqlmock.NewResult(0, 10))
+			if tt.Err != nil {
+				s.Mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `recovery_codes`")).WillReturnError(tt.Err)
+				s.Mock.ExpectRollback()
+			} else {
+				s.Mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `recovery_codes`")).WillReturnResult(sqlmock.NewResult(1, 2))
+				s.Mock.ExpectCommit()
+			}
+
+			err := s.twoFactorRepository.EnableTwoFactor(
+				&entity.TwoFactor{Model: gorm.Model{ID: 1}, UserID: 1, EnabledAt: &enabledAt, LastUsedStep: 1},
+				[]entity.RecoveryCode{{UserID: 1, CodeHash: "a"}, {UserID: 1, CodeHash: "b"}},
+				s.ctx,
+			)
+
+			s.Equal(tt.ExpectedErr, err)
+			s.NoError(s.Mock.ExpectationsWereMet())
+		})
+		s.TeardownTest()
+	}
+}
+
+func (s *TestSuiteTwoFactorRepository) TestDisableTwoFactor() {
+	for _, tt := range []struct {
+		Name        string
+		Err         error
+		ExpectedErr error
+	}{
+		{
+			Name: "Success",
+		},
+		{
+			Name:        "Generic Error from DB",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.Mock.ExpectBegin()
+			s.Mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `recovery_codes` WHERE user_id = ?")).
+				WillReturnResult(sqlmock.NewResult(0, 10))
+			if tt.Err != nil {
+				s.Mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `two_factors` WHERE user_id = ?")).WillReturnError(tt.Err)
+				s.Mock.ExpectRollback()
+			} else {
+				s.Mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `two_factors` WHERE user_id = ?")).WillReturnResult(sqlmock.NewResult(0, 1))
+				s.Mock.ExpectCommit()
+			}
+
+			err := s.twoFactorRepository.DisableTwoFactor(1, s.ctx)
+
+			s.Equal(tt.ExpectedErr, err)
+			s.NoError(s.Mock.ExpectationsWereMet())
+		})
+		s.TeardownTest()
+	}
+}
+
+func (s *TestSuiteTwoFactorRepository) TestUpdateLastUsedStep() {
+	for _, tt := range []struct {
+		Name         string
+		Query        string
+		RowsAffected int64
+		Err          error
+		ExpectedErr  error
+	}{
+		{
+			Name:         "Success",
+			Query:        "UPDATE `two_factors` SET `last_used_step`=?,`updated_at`=? WHERE (id = ? AND last_used_step < ?) AND `two_factors`.`deleted_at` IS NULL",
+			RowsAffected: 1,
+		},
+		{
+			Name:         "Step already used",
+			Query:        "UPDATE `two_factors` SET `last_used_step`=?,`updated_at`=? WHERE (id = ? AND last_used_step < ?) AND `two_factors`.`deleted_at` IS NULL",
+			RowsAffected: 0,
+			ExpectedErr:  ErrTOTPStepAlreadyUsed,
+		},
+		{
+			Name:        "Generic Error from DB",
+			Query:       "UPDATE `two_factors` SET `last_used_step`=?,`updated_at`=? WHERE (id = ? AND last_used_step < ?) AND `two_factors`.`deleted_at` IS NULL",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.Mock.ExpectBegin()
+			if tt.Err != nil {
+				s.Mock.ExpectExec(regexp.QuoteMeta(tt.Query)).WillReturnError(tt.Err)
+				s.Mock.ExpectRollback()
+			} else {
+				s.Mock.ExpectExec(regexp.QuoteMeta(tt.Query)).WillReturnResult(sqlmock.NewResult(0, tt.RowsAffected))
+				s.Mock.ExpectCommit()
+			}
+
+			err := s.twoFactorRepository.UpdateLastUsedStep(1, 100, s.ctx)
+
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TeardownTest()
+	}
+}
+
+func (s *TestSuiteTwoFactorRepository) TestUseRecoveryCode() {
+	for _, tt := range []struct {
+		Name         string
+		Query        string
+		RowsAffected int64
+		Err          error
+		ExpectedErr  error
+	}{
+		{
+			Name:         "Success",
+			Query:        "UPDATE `recovery_codes` SET `used_at`=?,`updated_at`=? WHERE (user_id = ? AND code_hash = ? AND used_at IS NULL) AND `recovery_codes`.`deleted_at` IS NULL",
+			RowsAffected: 1,
+		},
+		{
+			Name:         "Code unknown or already used",
+			Query:        "UPDATE `recovery_codes` SET `used_at`=?,`updated_at`=? WHERE (user_id = ? AND code_hash = ? AND used_at IS NULL) AND `recovery_codes`.`deleted_at` IS NULL",
+			RowsAffected: 0,
+			ExpectedErr:  ErrRecoveryCodeNotFound,
+		},
+		{
+			Name:        "Generic Error from DB",
+			Query:       "UPDATE `recovery_codes` SET `used_at`=?,`updated_at`=? WHERE (user_id = ? AND code_hash = ? AND used_at IS NULL) AND `recovery_codes`.`deleted_at` IS NULL",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.Mock.ExpectBegin()
+			if tt.Err != nil {
+				s.Mock.ExpectExec(regexp.QuoteMeta(tt.Query)).WillReturnError(tt.Err)
+				s.Mock.ExpectRollback()
+			} else {
+				s.Mock.ExpectExec(regexp.QuoteMeta(tt.Query)).WillReturnResult(sqlmock.NewResult(0, tt.RowsAffected))
+				s.Mock.ExpectCommit()
+			}
+
+			err := s.twoFactorRepository.UseRecoveryCode(1, "hash", s.ctx)
+
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TeardownTest()
+	}
+}
+
+func TestTwoFactorRepository(t *testing.T) {
+	suite.Run(t, new(TestSuiteTwoFactorRepository))
+}
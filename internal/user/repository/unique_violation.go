@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"errors"
+
+	sqlite "github.com/glebarez/go-sqlite"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Error codes of unique constraint violations on each supported database.
+const (
+	mysqlDuplicateEntry     = 1062
+	postgresUniqueViolation = "23505"
+)
+
+// isUniqueViolation reports whether err was caused by a unique constraint, on
+// any of the supported databases.
+func isUniqueViolation(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == mysqlDuplicateEntry
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == postgresUniqueViolation
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	}
+
+	return false
+}
@@ -3,10 +3,37 @@ package repository
 import (
 	"context"
 	"rewrite/pkg/entity"
+	"time"
 )
 
+// UserFilter selects a page of users. SortField must be a column name the
+// caller checked against its whitelist. After continues a keyset pagination
+// behind the given row, Offset skips rows the classic way.
+type UserFilter struct {
+	Email       string
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	SortField   string
+	SortDesc    bool
+	After       *UserCursor
+	Offset      int
+	Limit       int
+}
+
+// UserCursor is the position of the last row of the previous page: its value
+// in the sort column and its ID to break ties.
+type UserCursor struct {
+	Value interface{}
+	ID    uint
+}
+
 type UserRepository interface {
-	FindAll(ctx context.Context) (entity.Users, error)
+	FindAll(filter UserFilter, ctx context.Context) (entity.Users, int64, error)
 	CreateUser(user *entity.User, ctx context.Context) error
 	FindByEmail(email string, ctx context.Context) (*entity.User, error)
+	FindByID(id uint, ctx context.Context) (*entity.User, error)
+	UpdatePassword(id uint, password string, ctx context.Context) error
+	MarkAsVerified(id uint, ctx context.Context) error
+	UpdateCredentials(id uint, email string, password string, ctx context.Context) error
+	DeleteUser(id uint, ctx context.Context) error
 }
@@ -5,8 +5,10 @@ import (
 	"errors"
 	"rewrite/pkg/entity"
 	"strings"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var (
@@ -21,21 +23,88 @@ func NewUserRepositoryImpl(db *gorm.DB) UserRepository {
 	return &UserRepositoryImpl{db}
 }
 
-func (u *UserRepositoryImpl) FindAll(ctx context.Context) (entity.Users, error) {
-	var users entity.Users
+// FindAll returns one page of the users matching the filter along with the
+// number of matching users in total.
+func (u *UserRepositoryImpl) FindAll(filter UserFilter, ctx context.Context) (entity.Users, int64, error) {
+	var total int64
 
-	err := u.db.WithContext(ctx).Find(&users).Error
+	err := u.filterUsers(filter, ctx).Count(&total).Error
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+
+	sort := clause.Column{Name: filter.SortField}
+	id := clause.Column{Name: "id"}
+
+	query := u.filterUsers(filter, ctx)
+	if filter.After != nil {
+		if filter.SortField == "id" {
+			query = query.Where(keysetAfter(id, filter.After.ID, filter.SortDesc))
+		} else {
+			query = query.Where(clause.Or(
+				keysetAfter(sort, filter.After.Value, filter.SortDesc),
+				clause.And(
+					clause.Eq{Column: sort, Value: filter.After.Value},
+					keysetAfter(id, filter.After.ID, filter.SortDesc),
+				),
+			))
+		}
+	}
+
+	query = query.Order(clause.OrderByColumn{Column: sort, Desc: filter.SortDesc})
+	if filter.SortField != "id" {
+		query = query.Order(clause.OrderByColumn{Column: id, Desc: filter.SortDesc})
 	}
 
-	return users, nil
+	var users entity.Users
+	err = query.
+		Preload("Roles").
+		Offset(filter.Offset).
+		Limit(filter.Limit).
+		Find(&users).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+func (u *UserRepositoryImpl) filterUsers(filter UserFilter, ctx context.Context) *gorm.DB {
+	query := u.db.WithContext(ctx).Model(&entity.User{})
+
+	if filter.Email != "" {
+		pattern := "%" + likeEscaper.Replace(strings.ToLower(filter.Email)) + "%"
+		query = query.Where("LOWER(email) LIKE ? ESCAPE '!'", pattern)
+	}
+
+	if filter.CreatedFrom != nil {
+		query = query.Where("created_at >= ?", *filter.CreatedFrom)
+	}
+
+	if filter.CreatedTo != nil {
+		query = query.Where("created_at <= ?", *filter.CreatedTo)
+	}
+
+	return query
+}
+
+// likeEscaper makes wildcards in user input match literally. The escape
+// character is spelled out in the query since SQLite has no default one, and
+// it is not a backslash, which MySQL would read as escaping the closing quote.
+var likeEscaper = strings.NewReplacer(`!`, `!!`, `%`, `!%`, `_`, `!_`)
+
+func keysetAfter(column clause.Column, value interface{}, desc bool) clause.Expression {
+	if desc {
+		return clause.Lt{Column: column, Value: value}
+	}
+
+	return clause.Gt{Column: column, Value: value}
 }
 
 func (u *UserRepositoryImpl) CreateUser(user *entity.User, ctx context.Context) error {
 	err := u.db.WithContext(ctx).Create(user).Error
 	if err != nil {
-		if strings.Contains(err.Error(), "Error 1062: Duplicate entry") {
+		if isUniqueViolation(err) {
 			return ErrEmailAlreadyExist
 		}
 
@@ -48,10 +117,81 @@ func (u *UserRepositoryImpl) CreateUser(user *entity.User, ctx context.Context)
 func (u *UserRepositoryImpl) FindByEmail(email string, ctx context.Context) (*entity.User, error) {
 	var user entity.User
 
-	err := u.db.WithContext(ctx).Where("email = ?", email).First(&user).Error
+	err := u.db.WithContext(ctx).Preload("Roles").Where("email = ?", email).First(&user).Error
 	if err != nil {
 		return nil, err
 	}
 
 	return &user, nil
 }
+
+func (u *UserRepositoryImpl) FindByID(id uint, ctx context.Context) (*entity.User, error) {
+	var user entity.User
+
+	err := u.db.WithContext(ctx).Preload("Roles").First(&user, id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (u *UserRepositoryImpl) UpdatePassword(id uint, password string, ctx context.Context) error {
+	return u.db.WithContext(ctx).
+		Model(&entity.User{}).
+		Where("id = ?", id).
+		Update("password", password).Error
+}
+
+func (u *UserRepositoryImpl) MarkAsVerified(id uint, ctx context.Context) error {
+	return u.db.WithContext(ctx).
+		Model(&entity.User{}).
+		Where("id = ? AND verified_at IS NULL", id).
+		Update("verified_at", time.Now()).Error
+}
+
+// UpdateCredentials changes the email and/or the password of a user in one
+// transaction, empty values are left unchanged. A new email is marked as not
+// verified again.
+func (u *UserRepositoryImpl) UpdateCredentials(id uint, email string, password string, ctx context.Context) error {
+	return u.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if email != "" {
+			err := tx.Model(&entity.User{}).
+				Where("id = ?", id).
+				Updates(map[string]interface{}{
+					"email":       email,
+					"verified_at": nil,
+				}).Error
+			if err != nil {
+				if isUniqueViolation(err) {
+					return ErrEmailAlreadyExist
+				}
+
+				return err
+			}
+		}
+
+		if password != "" {
+			return tx.Model(&entity.User{}).
+				Where("id = ?", id).
+				Update("password", password).Error
+		}
+
+		return nil
+	})
+}
+
+// DeleteUser soft deletes the user. It returns gorm.ErrRecordNotFound when
+// there is no such user left.
+func (u *UserRepositoryImpl) DeleteUser(id uint, ctx context.Context) error {
+	result := u.db.WithContext(ctx).Delete(&entity.User{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
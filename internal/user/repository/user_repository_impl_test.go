@@ -6,8 +6,10 @@ import (
 	"regexp"
 	"rewrite/pkg/entity"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	mysqlerr "github.com/go-sql-driver/mysql"
 	"github.com/stretchr/testify/suite"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
@@ -43,52 +45,102 @@ func (s *TestSuiteUserRepository) TeardownTest() {
 }
 
 func (s *TestSuiteUserRepository) TestFindAll() {
+	createdFrom := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
 	for _, tt := range []struct {
 		Name           string
+		Filter         UserFilter
+		CountQuery     string
 		Query          string
 		Rows           *sqlmock.Rows
 		Err            error
 		ExpectedReturn entity.Users
+		ExpectedTotal  int64
 		ExpectedErr    error
 	}{
 		{
-			Name:  "Success",
-			Query: "SELECT * FROM `users` WHERE `users`.`deleted_at` IS NULL",
-			Rows: sqlmock.NewRows([]string{"email", "password"}).
-				AddRow("123@123.com", "123").
-				AddRow("456@456.com", "456"),
+			Name:       "Success",
+			Filter:     UserFilter{SortField: "id", Limit: 2},
+			CountQuery: "SELECT count(*) FROM `users` WHERE `users`.`deleted_at` IS NULL",
+			Query:      "SELECT * FROM `users` WHERE `users`.`deleted_at` IS NULL ORDER BY `id` LIMIT 2",
+			Rows: sqlmock.NewRows([]string{"id", "email", "password"}).
+				AddRow(1, "123@123.com", "123").
+				AddRow(2, "456@456.com", "456"),
 			ExpectedReturn: entity.Users{
 				{
+					Model:    gorm.Model{ID: 1},
 					Email:    "123@123.com",
 					Password: "123",
+					Roles:    []entity.Role{},
 				},
 				{
+					Model:    gorm.Model{ID: 2},
 					Email:    "456@456.com",
 					Password: "456",
+					Roles:    []entity.Role{},
 				},
 			},
+			ExpectedTotal: 2,
 		},
 		{
-			Name:           "Generic Error from DB",
-			Query:          "SELECT * FROM `users` WHERE `users`.`deleted_at` IS NULL",
-			Rows:           nil,
-			Err:            errors.New("generic error"),
-			ExpectedReturn: nil,
-			ExpectedErr:    errors.New("generic error"),
+			Name:       "Success with filters and offset",
+			Filter:     UserFilter{Email: "50%_", CreatedFrom: &createdFrom, SortField: "email", SortDesc: true, Offset: 10, Limit: 2},
+			CountQuery: "SELECT count(*) FROM `users` WHERE LOWER(email) LIKE ? ESCAPE '!' AND created_at >= ? AND `users`.`deleted_at` IS NULL",
+			Query:      "SELECT * FROM `users` WHERE LOWER(email) LIKE ? ESCAPE '!' AND created_at >= ? AND `users`.`deleted_at` IS NULL ORDER BY `email` DESC,`id` DESC LIMIT 2 OFFSET 10",
+			Rows: sqlmock.NewRows([]string{"id", "email", "password"}).
+				AddRow(1, "50%_@123.com", "123"),
+			ExpectedReturn: entity.Users{
+				{
+					Model:    gorm.Model{ID: 1},
+					Email:    "50%_@123.com",
+					Password: "123",
+					Roles:    []entity.Role{},
+				},
+			},
+			ExpectedTotal: 2,
+		},
+		{
+			Name:       "Success after cursor",
+			Filter:     UserFilter{SortField: "email", After: &UserCursor{Value: "123@123.com", ID: 1}, Limit: 2},
+			CountQuery: "SELECT count(*) FROM `users` WHERE `users`.`deleted_at` IS NULL",
+			Query:      "SELECT * FROM `users` WHERE (`email` > ? OR (`email` = ? AND `id` > ?)) AND `users`.`deleted_at` IS NULL ORDER BY `email`,`id` LIMIT 2",
+			Rows: sqlmock.NewRows([]string{"id", "email", "password"}).
+				AddRow(2, "456@456.com", "456"),
+			ExpectedReturn: entity.Users{
+				{
+					Model:    gorm.Model{ID: 2},
+					Email:    "456@456.com",
+					Password: "456",
+					Roles:    []entity.Role{},
+				},
+			},
+			ExpectedTotal: 2,
+		},
+		{
+			Name:        "Generic Error from DB",
+			Filter:      UserFilter{SortField: "id", Limit: 2},
+			CountQuery:  "SELECT count(*) FROM `users` WHERE `users`.`deleted_at` IS NULL",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
 		},
 	} {
 		s.SetupTest()
 		s.Run(tt.Name, func() {
 			if tt.Err != nil {
-				s.Mock.ExpectQuery(regexp.QuoteMeta(tt.Query)).WillReturnError(tt.Err)
+				s.Mock.ExpectQuery(regexp.QuoteMeta(tt.CountQuery)).WillReturnError(tt.Err)
 			} else {
+				s.Mock.ExpectQuery(regexp.QuoteMeta(tt.CountQuery)).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
 				s.Mock.ExpectQuery(regexp.QuoteMeta(tt.Query)).WillReturnRows(tt.Rows)
+				s.Mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `user_roles` WHERE `user_roles`.`user_id`")).
+					WillReturnRows(sqlmock.NewRows([]string{"user_id", "role_id"}))
 			}
 
-			result, err := s.userRepository.FindAll(s.ctx)
+			result, total, err := s.userRepository.FindAll(tt.Filter, s.ctx)
 
 			s.Equal(tt.ExpectedReturn, result)
+			s.Equal(tt.ExpectedTotal, total)
 			s.Equal(tt.ExpectedErr, err)
+			s.NoError(s.Mock.ExpectationsWereMet())
 		})
 		s.TeardownTest()
 	}
@@ -103,14 +155,20 @@ func (s *TestSuiteUserRepository) TestCreateUser() {
 	}{
 		{
 			Name:  "Success",
-			Query: "INSERT INTO `users` (`created_at`,`updated_at`,`deleted_at`,`email`,`password`) VALUES (?,?,?,?,?)",
+			Query: "INSERT INTO `users` (`created_at`,`updated_at`,`deleted_at`,`email`,`password`,`verified_at`) VALUES (?,?,?,?,?,?)",
 		},
 		{
 			Name:        "Generic Error from DB",
-			Query:       "INSERT INTO `users` (`created_at`,`updated_at`,`deleted_at`,`email`,`password`) VALUES (?,?,?,?,?)",
+			Query:       "INSERT INTO `users` (`created_at`,`updated_at`,`deleted_at`,`email`,`password`,`verified_at`) VALUES (?,?,?,?,?,?)",
 			Err:         errors.New("generic error"),
 			ExpectedErr: errors.New("generic error"),
 		},
+		{
+			Name:        "Duplicate email",
+			Query:       "INSERT INTO `users` (`created_at`,`updated_at`,`deleted_at`,`email`,`password`,`verified_at`) VALUES (?,?,?,?,?,?)",
+			Err:         &mysqlerr.MySQLError{Number: 1062, Message: "Duplicate entry '' for key 'email'"},
+			ExpectedErr: ErrEmailAlreadyExist,
+		},
 	} {
 		s.SetupTest()
 		s.Run(tt.Name, func() {
@@ -183,6 +241,243 @@ func (s *TestSuiteUserRepository) TestFindByEmail() {
 	}
 }
 
+func (s *TestSuiteUserRepository) TestFindByID() {
+	for _, tt := range []struct {
+		Name           string
+		ID             uint
+		Query          string
+		Rows           *sqlmock.Rows
+		Err            error
+		ExpectedReturn *entity.User
+		ExpectedErr    error
+	}{
+		{
+			Name:  "Success",
+			ID:    1,
+			Query: "SELECT * FROM `users` WHERE `users`.`id` = ? AND `users`.`deleted_at` IS NULL ORDER BY `users`.`id` LIMIT 1",
+			Rows: sqlmock.NewRows([]string{"id", "email", "password"}).
+				AddRow(1, "123@123.com", "123"),
+			ExpectedReturn: &entity.User{
+				Model:    gorm.Model{ID: 1},
+				Email:    "123@123.com",
+				Password: "123",
+				Roles:    []entity.Role{{ID: 2, Name: "admin"}},
+			},
+		},
+		{
+			Name:           "Generic Error from DB",
+			ID:             1,
+			Query:          "SELECT * FROM `users` WHERE `users`.`id` = ? AND `users`.`deleted_at` IS NULL ORDER BY `users`.`id` LIMIT 1",
+			Rows:           nil,
+			Err:            errors.New("generic error"),
+			ExpectedReturn: nil,
+			ExpectedErr:    errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			if tt.Err != nil {
+				s.Mock.ExpectQuery(regexp.QuoteMeta(tt.Query)).WillReturnError(tt.Err)
+			} else {
+				s.Mock.ExpectQuery(regexp.QuoteMeta(tt.Query)).WillReturnRows(tt.Rows)
+				s.Mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `user_roles` WHERE `user_roles`.`user_id` = ?")).
+					WillReturnRows(sqlmock.NewRows([]string{"user_id", "role_id"}).AddRow(1, 2))
+				s.Mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `roles` WHERE `roles`.`id` = ?")).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(2, "admin"))
+			}
+
+			result, err := s.userRepository.FindByID(tt.ID, s.ctx)
+
+			s.Equal(tt.ExpectedReturn, result)
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TeardownTest()
+	}
+}
+
+func (s *TestSuiteUserRepository) TestUpdatePassword() {
+	for _, tt := range []struct {
+		Name        string
+		Query       string
+		Err         error
+		ExpectedErr error
+	}{
+		{
+			Name:  "Success",
+			Query: "UPDATE `users` SET `password`=?,`updated_at`=? WHERE id = ? AND `users`.`deleted_at` IS NULL",
+		},
+		{
+			Name:        "Generic Error from DB",
+			Query:       "UPDATE `users` SET `password`=?,`updated_at`=? WHERE id = ? AND `users`.`deleted_at` IS NULL",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.Mock.ExpectBegin()
+			if tt.Err != nil {
+				s.Mock.ExpectExec(regexp.QuoteMeta(tt.Query)).WillReturnError(tt.Err)
+				s.Mock.ExpectRollback()
+			} else {
+				s.Mock.ExpectExec(regexp.QuoteMeta(tt.Query)).WillReturnResult(sqlmock.NewResult(0, 1))
+				s.Mock.ExpectCommit()
+			}
+
+			err := s.userRepository.UpdatePassword(1, "hash", s.ctx)
+
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TeardownTest()
+	}
+}
+
+func (s *TestSuiteUserRepository) TestMarkAsVerified() {
+	for _, tt := range []struct {
+		Name        string
+		Query       string
+		Err         error
+		ExpectedErr error
+	}{
+		{
+			Name:  "Success",
+			Query: "UPDATE `users` SET `verified_at`=?,`updated_at`=? WHERE (id = ? AND verified_at IS NULL) AND `users`.`deleted_at` IS NULL",
+		},
+		{
+			Name:        "Generic Error from DB",
+			Query:       "UPDATE `users` SET `verified_at`=?,`updated_at`=? WHERE (id = ? AND verified_at IS NULL) AND `users`.`deleted_at` IS NULL",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.Mock.ExpectBegin()
+			if tt.Err != nil {
+				s.Mock.ExpectExec(regexp.QuoteMeta(tt.Query)).WillReturnError(tt.Err)
+				s.Mock.ExpectRollback()
+			} else {
+				s.Mock.ExpectExec(regexp.QuoteMeta(tt.Query)).WillReturnResult(sqlmock.NewResult(0, 1))
+				s.Mock.ExpectCommit()
+			}
+
+			err := s.userRepository.MarkAsVerified(1, s.ctx)
+
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TeardownTest()
+	}
+}
+
+func (s *TestSuiteUserRepository) TestUpdateCredentials() {
+	emailQuery := "UPDATE `users` SET `email`=?,`verified_at`=?,`updated_at`=? WHERE id = ? AND `users`.`deleted_at` IS NULL"
+	passwordQuery := "UPDATE `users` SET `password`=?,`updated_at`=? WHERE id = ? AND `users`.`deleted_at` IS NULL"
+
+	for _, tt := range []struct {
+		Name        string
+		Email       string
+		Password    string
+		EmailErr    error
+		PasswordErr error
+		ExpectedErr error
+	}{
+		{Name: "Email and password", Email: "456@456.com", Password: "hash"},
+		{Name: "Email only", Email: "456@456.com"},
+		{Name: "Password only", Password: "hash"},
+		{
+			Name:        "Email already exist",
+			Email:       "456@456.com",
+			Password:    "hash",
+			EmailErr:    &mysqlerr.MySQLError{Number: 1062, Message: "Duplicate entry '456@456.com' for key 'email'"},
+			ExpectedErr: ErrEmailAlreadyExist,
+		},
+		{
+			Name:        "Generic Error from DB on the password",
+			Email:       "456@456.com",
+			Password:    "hash",
+			PasswordErr: errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.Mock.ExpectBegin()
+			if tt.Email != "" {
+				exec := s.Mock.ExpectExec(regexp.QuoteMeta(emailQuery)).WithArgs(tt.Email, nil, sqlmock.AnyArg(), 1)
+				if tt.EmailErr != nil {
+					exec.WillReturnError(tt.EmailErr)
+				} else {
+					exec.WillReturnResult(sqlmock.NewResult(0, 1))
+				}
+			}
+			if tt.Password != "" && tt.EmailErr == nil {
+				exec := s.Mock.ExpectExec(regexp.QuoteMeta(passwordQuery)).WithArgs(tt.Password, sqlmock.AnyArg(), 1)
+				if tt.PasswordErr != nil {
+					exec.WillReturnError(tt.PasswordErr)
+				} else {
+					exec.WillReturnResult(sqlmock.NewResult(0, 1))
+				}
+			}
+			if tt.ExpectedErr != nil {
+				s.Mock.ExpectRollback()
+			} else {
+				s.Mock.ExpectCommit()
+			}
+
+			err := s.userRepository.UpdateCredentials(1, tt.Email, tt.Password, s.ctx)
+
+			s.Equal(tt.ExpectedErr, err)
+			s.NoError(s.Mock.ExpectationsWereMet())
+		})
+		s.TeardownTest()
+	}
+}
+
+func (s *TestSuiteUserRepository) TestDeleteUser() {
+	for _, tt := range []struct {
+		Name         string
+		Query        string
+		RowsAffected int64
+		Err          error
+		ExpectedErr  error
+	}{
+		{
+			Name:         "Success",
+			Query:        "UPDATE `users` SET `deleted_at`=? WHERE `users`.`id` = ? AND `users`.`deleted_at` IS NULL",
+			RowsAffected: 1,
+		},
+		{
+			Name:         "User not found",
+			Query:        "UPDATE `users` SET `deleted_at`=? WHERE `users`.`id` = ? AND `users`.`deleted_at` IS NULL",
+			RowsAffected: 0,
+			ExpectedErr:  gorm.ErrRecordNotFound,
+		},
+		{
+			Name:        "Generic Error from DB",
+			Query:       "UPDATE `users` SET `deleted_at`=? WHERE `users`.`id` = ? AND `users`.`deleted_at` IS NULL",
+			Err:         errors.New("generic error"),
+			ExpectedErr: errors.New("generic error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.Mock.ExpectBegin()
+			if tt.Err != nil {
+				s.Mock.ExpectExec(regexp.QuoteMeta(tt.Query)).WillReturnError(tt.Err)
+				s.Mock.ExpectRollback()
+			} else {
+				s.Mock.ExpectExec(regexp.QuoteMeta(tt.Query)).WillReturnResult(sqlmock.NewResult(0, tt.RowsAffected))
+				s.Mock.ExpectCommit()
+			}
+
+			err := s.userRepository.DeleteUser(1, s.ctx)
+
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TeardownTest()
+	}
+}
+
 func TestUserRepository(t *testing.T) {
 	suite.Run(t, new(TestSuiteUserRepository))
 }
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"rewrite/pkg/logging"
+	"rewrite/pkg/metrics"
+	"rewrite/pkg/tracing"
+	"strings"
+	"time"
+)
+
+// Failed logins are counted per account, keyed by email whether it is
+// registered or not, and per client IP.
+const (
+	accountKeyPrefix  = "email:"
+	clientIPKeyPrefix = "ip:"
+)
+
+type clientIPKey struct{}
+
+// WithClientIP attaches the IP of the client to ctx, so its failed logins are
+// counted too.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIP returns the IP attached to ctx by WithClientIP, empty if there is
+// none.
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+func loginAttemptKeys(email string, ctx context.Context) []string {
+	keys := []string{accountKey(email)}
+	if ip := ClientIP(ctx); ip != "" {
+		keys = append(keys, clientIPKeyPrefix+ip)
+	}
+
+	return keys
+}
+
+// accountKey ignores the case of email, matching accounts registered before
+// emails were normalized.
+func accountKey(email string) string {
+	return accountKeyPrefix + strings.ToLower(email)
+}
+
+// checkLoginAttempts refuses the login while the account or the client IP is
+// blocked. The error is the same for both, and for unregistered emails.
+func (u *UserServiceImpl) checkLoginAttempts(keys []string, now time.Time, ctx context.Context) error {
+	attempts, err := u.loginAttemptRepository.FindByKeys(keys, ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, attempt := range attempts {
+		if attempt.BlockedUntil != nil && now.Before(*attempt.BlockedUntil) {
+			metrics.LoginsTotal.WithLabelValues(metrics.LoginThrottled).Inc()
+			return ErrTooManyLoginAttempts
+		}
+	}
+
+	return nil
+}
+
+// recordLoginFailure counts a failed login of every key and blocks the keys
+// failing too often.
+func (u *UserServiceImpl) recordLoginFailure(keys []string, now time.Time, ctx context.Context) error {
+	lockout := u.config.Lockout
+	for _, key := range keys {
+		attempt, err := u.loginAttemptRepository.RecordFailure(key, now, lockout.Window, ctx)
+		if err != nil {
+			return err
+		}
+
+		blockFor := u.blockDuration(key, attempt.Failures)
+		if blockFor == 0 {
+			continue
+		}
+
+		err = u.loginAttemptRepository.Block(key, now.Add(blockFor), ctx)
+		if err != nil {
+			return err
+		}
+
+		if blockFor == lockout.Duration {
+			keyType := "account"
+			if strings.HasPrefix(key, clientIPKeyPrefix) {
+				keyType = "client_ip"
+			}
+
+			logging.FromContext(ctx).Warn("locked out after failed logins", "key_type", keyType, "failures", attempt.Failures, "duration", blockFor.String())
+		}
+	}
+
+	return nil
+}
+
+// blockDuration is how long logins are blocked after the failures-th failure
+// of key. Accounts are delayed progressively before being locked. Client IPs
+// may be shared by many users, so they are only blocked once they reach the
+// much higher IPFailures.
+func (u *UserServiceImpl) blockDuration(key string, failures int) time.Duration {
+	lockout := u.config.Lockout
+	if strings.HasPrefix(key, clientIPKeyPrefix) {
+		if failures >= lockout.IPFailures {
+			return lockout.Duration
+		}
+
+		return 0
+	}
+
+	if failures >= lockout.AccountFailures {
+		return lockout.Duration
+	}
+
+	if failures < lockout.DelayAfter {
+		return 0
+	}
+
+	delay := lockout.Delay
+	for i := lockout.DelayAfter; i < failures && delay < lockout.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > lockout.MaxDelay {
+		delay = lockout.MaxDelay
+	}
+
+	return delay
+}
+
+// UnlockUser forgets the failed logins of a user, lifting a lockout.
+func (u *UserServiceImpl) UnlockUser(id uint, ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "UserService.UnlockUser")
+	defer span.End()
+
+	userEntity, err := u.findUser(id, ctx)
+	if err != nil {
+		return err
+	}
+
+	err = u.loginAttemptRepository.DeleteByKeys([]string{accountKey(userEntity.Email)}, ctx)
+	if err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Info("failed logins cleared", "user_id", id)
+	return nil
+}
+
+func (u *UserServiceImpl) PruneLoginAttempts(ctx context.Context) (int64, error) {
+	ctx, span := tracing.Start(ctx, "UserService.PruneLoginAttempts")
+	defer span.End()
+
+	return u.loginAttemptRepository.DeleteStale(time.Now(), u.config.Lockout.Window, ctx)
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"rewrite/pkg/entity"
+	"rewrite/pkg/logging"
+	"rewrite/pkg/tracing"
+	"rewrite/pkg/utils"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// dummyPassword is hashed once per service. Logins with an email no user has
+// are compared against its hash, so they take as long as logins with a
+// registered email.
+const dummyPassword = "dummy password"
+
+// legacyHasher hashes like the accounts created before hashing was
+// configurable did, with bcrypt at its default cost. Their hashes are only
+// replaced when their owner logs in again.
+var legacyHasher utils.PasswordHasher = &utils.BcryptHasher{Cost: bcrypt.DefaultCost}
+
+// dummyHash is the hash of dummyPassword slowest to verify among the current
+// hasher and legacyHasher, so unknown emails cost as much as the slowest hash
+// still stored. Picking it takes a few hashes, it is done on the first login
+// with an unknown email rather than when the service is created.
+type dummyHash struct {
+	once   sync.Once
+	hasher utils.PasswordHasher
+	hash   string
+}
+
+func (d *dummyHash) get() string {
+	d.once.Do(func() {
+		var slowest time.Duration
+		for _, hasher := range []utils.PasswordHasher{d.hasher, legacyHasher} {
+			// Hashing only fails when the system runs out of randomness.
+			hash, err := hasher.Hash(dummyPassword)
+			if err != nil {
+				continue
+			}
+
+			start := time.Now()
+			d.hasher.Verify(hash, dummyPassword)
+			if elapsed := time.Since(start); elapsed > slowest {
+				d.hash, slowest = hash, elapsed
+			}
+		}
+	})
+
+	return d.hash
+}
+
+// hashPassword and comparePassword are traced, password hashing being by
+// design the slowest step of the requests handling passwords.
+func (u *UserServiceImpl) hashPassword(password string, ctx context.Context) (string, error) {
+	_, span := tracing.Start(ctx, "PasswordHasher.Hash")
+	defer span.End()
+
+	return u.passwordHasher.Hash(password)
+}
+
+// comparePassword returns utils.ErrPasswordMismatch when password does not
+// match hashedPassword, and whether a matching hash is outdated.
+func (u *UserServiceImpl) comparePassword(hashedPassword string, password string, ctx context.Context) (bool, error) {
+	_, span := tracing.Start(ctx, "PasswordHasher.Verify")
+	defer span.End()
+
+	return u.passwordHasher.Verify(hashedPassword, password)
+}
+
+// rehashPassword replaces an outdated hash once the password is known to
+// match it. The login goes on when this fails, the hash is replaced at a
+// later login.
+func (u *UserServiceImpl) rehashPassword(user *entity.User, password string, ctx context.Context) {
+	hashedPassword, err := u.hashPassword(password, ctx)
+	if err == nil {
+		err = u.userRepository.UpdatePassword(user.ID, hashedPassword, ctx)
+	}
+
+	if err != nil {
+		logging.FromContext(ctx).Warn("rehashing outdated password hash", "user_id", user.ID, "error", err)
+		return
+	}
+
+	user.Password = hashedPassword
+	logging.FromContext(ctx).Info("outdated password hash replaced", "user_id", user.ID)
+}
@@ -0,0 +1,17 @@
+package service
+
+import (
+	"context"
+	"rewrite/internal/user/dto"
+)
+
+type RoleService interface {
+	FindAllRoles(ctx context.Context) (dto.RolesResponse, error)
+	FindAllPermissions(ctx context.Context) ([]string, error)
+	CreateRole(request dto.RoleRequest, ctx context.Context) (*dto.RoleResponse, error)
+	UpdateRole(name string, request dto.RoleRequest, ctx context.Context) (*dto.RoleResponse, error)
+	DeleteRole(name string, ctx context.Context) error
+	AssignRole(userID uint, name string, ctx context.Context) error
+	UnassignRole(userID uint, name string, ctx context.Context) error
+	HasPermission(roles []string, permission string, ctx context.Context) (bool, error)
+}
@@ -0,0 +1,235 @@
+package service
+
+import (
+	"context"
+	"rewrite/internal/user/dto"
+	"rewrite/internal/user/repository"
+	"rewrite/pkg/apperror"
+	"rewrite/pkg/entity"
+	"rewrite/pkg/tracing"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRoleExists        = apperror.New(apperror.CodeRoleExists, apperror.Conflict, "role already exists")
+	ErrRoleNotFound      = apperror.New(apperror.CodeRoleNotFound, apperror.NotFound, "role not found")
+	ErrInvalidRoleName   = apperror.New(apperror.CodeInvalidRoleName, apperror.Invalid, "role name is required")
+	ErrUnknownPermission = apperror.New(apperror.CodeUnknownPermission, apperror.Invalid, "unknown permission")
+	ErrBuiltInRole       = apperror.New(apperror.CodeBuiltInRole, apperror.Conflict, "built-in role can not be changed")
+)
+
+type RoleServiceImpl struct {
+	roleRepository repository.RoleRepository
+	userRepository repository.UserRepository
+}
+
+func NewRoleServiceImpl(roleRepository repository.RoleRepository, userRepository repository.UserRepository) RoleService {
+	return &RoleServiceImpl{roleRepository, userRepository}
+}
+
+func (r *RoleServiceImpl) FindAllRoles(ctx context.Context) (dto.RolesResponse, error) {
+	ctx, span := tracing.Start(ctx, "RoleService.FindAllRoles")
+	defer span.End()
+
+	roles, err := r.roleRepository.FindAllRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var dtoRoles dto.RolesResponse
+	dtoRoles.FromEntity(roles)
+	return dtoRoles, nil
+}
+
+func (r *RoleServiceImpl) FindAllPermissions(ctx context.Context) ([]string, error) {
+	ctx, span := tracing.Start(ctx, "RoleService.FindAllPermissions")
+	defer span.End()
+
+	permissions, err := r.roleRepository.FindAllPermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(permissions))
+	for _, permission := range permissions {
+		names = append(names, permission.Name)
+	}
+
+	return names, nil
+}
+
+func (r *RoleServiceImpl) CreateRole(request dto.RoleRequest, ctx context.Context) (*dto.RoleResponse, error) {
+	ctx, span := tracing.Start(ctx, "RoleService.CreateRole")
+	defer span.End()
+
+	name := strings.TrimSpace(request.Name)
+	if name == "" {
+		return nil, ErrInvalidRoleName
+	}
+
+	permissions, err := r.findPermissions(request.Permissions, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	role := &entity.Role{
+		Name:        name,
+		Description: request.Description,
+		Permissions: permissions,
+	}
+
+	err = r.roleRepository.CreateRole(role, ctx)
+	if err != nil {
+		if err == repository.ErrRoleAlreadyExist {
+			return nil, ErrRoleExists
+		}
+
+		return nil, err
+	}
+
+	var response dto.RoleResponse
+	response.FromEntity(role)
+	return &response, nil
+}
+
+// UpdateRole replaces the description and the permissions of a role. The
+// name is the identifier of the role and can not be changed.
+func (r *RoleServiceImpl) UpdateRole(name string, request dto.RoleRequest, ctx context.Context) (*dto.RoleResponse, error) {
+	ctx, span := tracing.Start(ctx, "RoleService.UpdateRole")
+	defer span.End()
+
+	role, err := r.findRole(name, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if role.Name == entity.RoleAdmin {
+		return nil, ErrBuiltInRole
+	}
+
+	permissions, err := r.findPermissions(request.Permissions, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	role.Description = request.Description
+	role.Permissions = permissions
+
+	err = r.roleRepository.UpdateRole(role, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var response dto.RoleResponse
+	response.FromEntity(role)
+	return &response, nil
+}
+
+func (r *RoleServiceImpl) DeleteRole(name string, ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "RoleService.DeleteRole")
+	defer span.End()
+
+	role, err := r.findRole(name, ctx)
+	if err != nil {
+		return err
+	}
+
+	if role.Name == entity.RoleAdmin {
+		return ErrBuiltInRole
+	}
+
+	return r.roleRepository.DeleteRole(role, ctx)
+}
+
+// AssignRole gives the user a role. Access tokens issued before carry the old
+// roles until they are refreshed.
+func (r *RoleServiceImpl) AssignRole(userID uint, name string, ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "RoleService.AssignRole")
+	defer span.End()
+
+	role, err := r.findRoleForUser(userID, name, ctx)
+	if err != nil {
+		return err
+	}
+
+	return r.roleRepository.AssignRole(userID, role.ID, ctx)
+}
+
+func (r *RoleServiceImpl) UnassignRole(userID uint, name string, ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "RoleService.UnassignRole")
+	defer span.End()
+
+	role, err := r.findRoleForUser(userID, name, ctx)
+	if err != nil {
+		return err
+	}
+
+	return r.roleRepository.UnassignRole(userID, role.ID, ctx)
+}
+
+// HasPermission resolves the permission against the current permissions of
+// the roles, so changing a role applies to tokens already issued.
+func (r *RoleServiceImpl) HasPermission(roles []string, permission string, ctx context.Context) (bool, error) {
+	ctx, span := tracing.Start(ctx, "RoleService.HasPermission")
+	defer span.End()
+
+	if len(roles) == 0 {
+		return false, nil
+	}
+
+	return r.roleRepository.HasPermission(roles, permission, ctx)
+}
+
+func (r *RoleServiceImpl) findRole(name string, ctx context.Context) (*entity.Role, error) {
+	role, err := r.roleRepository.FindRoleByName(name, ctx)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrRoleNotFound
+		}
+
+		return nil, err
+	}
+
+	return role, nil
+}
+
+func (r *RoleServiceImpl) findRoleForUser(userID uint, name string, ctx context.Context) (*entity.Role, error) {
+	_, err := r.userRepository.FindByID(userID, ctx)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrUserNotFound
+		}
+
+		return nil, err
+	}
+
+	return r.findRole(name, ctx)
+}
+
+// findPermissions loads the named permissions and fails on any name that is
+// not a known permission.
+func (r *RoleServiceImpl) findPermissions(names []string, ctx context.Context) ([]entity.Permission, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	permissions, err := r.roleRepository.FindPermissionsByName(names, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool, len(permissions))
+	for _, permission := range permissions {
+		found[permission.Name] = true
+	}
+
+	for _, name := range names {
+		if !found[name] {
+			return nil, ErrUnknownPermission
+		}
+	}
+
+	return permissions, nil
+}
@@ -0,0 +1,455 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"rewrite/internal/user/dto"
+	"rewrite/internal/user/repository"
+	"rewrite/pkg/entity"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+type MockRoleRepository struct {
+	mock.Mock
+}
+
+func (m *MockRoleRepository) FindAllRoles(ctx context.Context) (entity.Roles, error) {
+	args := m.Called()
+	return args.Get(0).(entity.Roles), args.Error(1)
+}
+
+func (m *MockRoleRepository) FindRoleByName(name string, ctx context.Context) (*entity.Role, error) {
+	args := m.Called(name)
+	return args.Get(0).(*entity.Role), args.Error(1)
+}
+
+func (m *MockRoleRepository) FindAllPermissions(ctx context.Context) ([]entity.Permission, error) {
+	args := m.Called()
+	return args.Get(0).([]entity.Permission), args.Error(1)
+}
+
+func (m *MockRoleRepository) FindPermissionsByName(names []string, ctx context.Context) ([]entity.Permission, error) {
+	args := m.Called(names)
+	return args.Get(0).([]entity.Permission), args.Error(1)
+}
+
+func (m *MockRoleRepository) CreateRole(role *entity.Role, ctx context.Context) error {
+	args := m.Called(role)
+	return args.Error(0)
+}
+
+func (m *MockRoleRepository) UpdateRole(role *entity.Role, ctx context.Context) error {
+	args := m.Called(role)
+	return args.Error(0)
+}
+
+func (m *MockRoleRepository) DeleteRole(role *entity.Role, ctx context.Context) error {
+	args := m.Called(role)
+	return args.Error(0)
+}
+
+func (m *MockRoleRepository) AssignRole(userID uint, roleID uint, ctx context.Context) error {
+	args := m.Called(userID, roleID)
+	return args.Error(0)
+}
+
+func (m *MockRoleRepository) UnassignRole(userID uint, roleID uint, ctx context.Context) error {
+	args := m.Called(userID, roleID)
+	return args.Error(0)
+}
+
+func (m *MockRoleRepository) HasPermission(roles []string, permission string, ctx context.Context) (bool, error) {
+	args := m.Called(roles, permission)
+	return args.Bool(0), args.Error(1)
+}
+
+type TestSuiteRoleServices struct {
+	suite.Suite
+	mockRoleRepository *MockRoleRepository
+	mockUserRepository *MockUserRepository
+	roleService        RoleService
+	ctx                context.Context
+}
+
+func (s *TestSuiteRoleServices) SetupTest() {
+	s.mockRoleRepository = new(MockRoleRepository)
+	s.mockUserRepository = new(MockUserRepository)
+	s.roleService = NewRoleServiceImpl(s.mockRoleRepository, s.mockUserRepository)
+	s.ctx = context.Background()
+}
+
+func (s *TestSuiteRoleServices) TearDownTest() {
+	s.mockRoleRepository = nil
+	s.mockUserRepository = nil
+	s.roleService = nil
+	s.ctx = nil
+}
+
+func (s *TestSuiteRoleServices) TestFindAllRoles() {
+	for _, tt := range []struct {
+		Name           string
+		FunctionReturn entity.Roles
+		FunctionError  error
+		ExpectedReturn dto.RolesResponse
+		ExpectedErr    error
+	}{
+		{
+			Name: "Success",
+			FunctionReturn: entity.Roles{
+				{ID: 1, Name: "admin", Permissions: []entity.Permission{{Name: "users:list"}}},
+			},
+			ExpectedReturn: dto.RolesResponse{
+				{ID: 1, Name: "admin", Permissions: []string{"users:list"}},
+			},
+		},
+		{
+			Name:          "Generic Error from Repository",
+			FunctionError: errors.New("Generic Error"),
+			ExpectedErr:   errors.New("Generic Error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.mockRoleRepository.On("FindAllRoles").Return(tt.FunctionReturn, tt.FunctionError)
+
+			result, err := s.roleService.FindAllRoles(s.ctx)
+			s.Equal(tt.ExpectedReturn, result)
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TearDownTest()
+	}
+}
+
+func (s *TestSuiteRoleServices) TestFindAllPermissions() {
+	for _, tt := range []struct {
+		Name           string
+		FunctionReturn []entity.Permission
+		FunctionError  error
+		ExpectedReturn []string
+		ExpectedErr    error
+	}{
+		{
+			Name:           "Success",
+			FunctionReturn: []entity.Permission{{ID: 2, Name: "roles:manage"}, {ID: 1, Name: "users:list"}},
+			ExpectedReturn: []string{"roles:manage", "users:list"},
+		},
+		{
+			Name:          "Generic Error from Repository",
+			FunctionError: errors.New("Generic Error"),
+			ExpectedErr:   errors.New("Generic Error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.mockRoleRepository.On("FindAllPermissions").Return(tt.FunctionReturn, tt.FunctionError)
+
+			result, err := s.roleService.FindAllPermissions(s.ctx)
+			s.Equal(tt.ExpectedReturn, result)
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TearDownTest()
+	}
+}
+
+func (s *TestSuiteRoleServices) TestCreateRole() {
+	for _, tt := range []struct {
+		Name              string
+		Request           dto.RoleRequest
+		PermissionsReturn []entity.Permission
+		CreateError       error
+		ExpectedReturn    *dto.RoleResponse
+		ExpectedErr       error
+	}{
+		{
+			Name:              "Success",
+			Request:           dto.RoleRequest{Name: " support ", Description: "Support staff", Permissions: []string{"users:list"}},
+			PermissionsReturn: []entity.Permission{{ID: 1, Name: "users:list"}},
+			ExpectedReturn:    &dto.RoleResponse{Name: "support", Description: "Support staff", Permissions: []string{"users:list"}},
+		},
+		{
+			Name:           "Success without permissions",
+			Request:        dto.RoleRequest{Name: "guest"},
+			ExpectedReturn: &dto.RoleResponse{Name: "guest", Permissions: []string{}},
+		},
+		{
+			Name:        "Empty name",
+			Request:     dto.RoleRequest{Name: "  "},
+			ExpectedErr: ErrInvalidRoleName,
+		},
+		{
+			Name:              "Unknown permission",
+			Request:           dto.RoleRequest{Name: "support", Permissions: []string{"users:list", "users:fly"}},
+			PermissionsReturn: []entity.Permission{{ID: 1, Name: "users:list"}},
+			ExpectedErr:       ErrUnknownPermission,
+		},
+		{
+			Name:        "Role exists",
+			Request:     dto.RoleRequest{Name: "support"},
+			CreateError: repository.ErrRoleAlreadyExist,
+			ExpectedErr: ErrRoleExists,
+		},
+		{
+			Name:        "Generic Error from Repository",
+			Request:     dto.RoleRequest{Name: "support"},
+			CreateError: errors.New("Generic Error"),
+			ExpectedErr: errors.New("Generic Error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.mockRoleRepository.On("FindPermissionsByName", tt.Request.Permissions).Return(tt.PermissionsReturn, nil)
+			s.mockRoleRepository.On("CreateRole", mock.Anything).Return(tt.CreateError)
+
+			result, err := s.roleService.CreateRole(tt.Request, s.ctx)
+			s.Equal(tt.ExpectedReturn, result)
+			s.Equal(tt.ExpectedErr, err)
+
+			if tt.ExpectedErr == ErrInvalidRoleName || tt.ExpectedErr == ErrUnknownPermission {
+				s.mockRoleRepository.AssertNotCalled(s.T(), "CreateRole", mock.Anything)
+			}
+		})
+		s.TearDownTest()
+	}
+}
+
+func (s *TestSuiteRoleServices) TestUpdateRole() {
+	for _, tt := range []struct {
+		Name              string
+		RoleName          string
+		Request           dto.RoleRequest
+		RoleReturn        *entity.Role
+		RoleError         error
+		PermissionsReturn []entity.Permission
+		ExpectedReturn    *dto.RoleResponse
+		ExpectedErr       error
+	}{
+		{
+			Name:              "Success",
+			RoleName:          "support",
+			Request:           dto.RoleRequest{Description: "Support staff", Permissions: []string{"users:list"}},
+			RoleReturn:        &entity.Role{ID: 2, Name: "support"},
+			PermissionsReturn: []entity.Permission{{ID: 1, Name: "users:list"}},
+			ExpectedReturn:    &dto.RoleResponse{ID: 2, Name: "support", Description: "Support staff", Permissions: []string{"users:list"}},
+		},
+		{
+			Name:        "Role not found",
+			RoleName:    "support",
+			RoleError:   gorm.ErrRecordNotFound,
+			ExpectedErr: ErrRoleNotFound,
+		},
+		{
+			Name:        "Admin role",
+			RoleName:    "admin",
+			RoleReturn:  &entity.Role{ID: 1, Name: "admin"},
+			ExpectedErr: ErrBuiltInRole,
+		},
+		{
+			Name:              "Unknown permission",
+			RoleName:          "support",
+			Request:           dto.RoleRequest{Permissions: []string{"users:fly"}},
+			RoleReturn:        &entity.Role{ID: 2, Name: "support"},
+			PermissionsReturn: []entity.Permission{},
+			ExpectedErr:       ErrUnknownPermission,
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.mockRoleRepository.On("FindRoleByName", tt.RoleName).Return(tt.RoleReturn, tt.RoleError)
+			s.mockRoleRepository.On("FindPermissionsByName", tt.Request.Permissions).Return(tt.PermissionsReturn, nil)
+			s.mockRoleRepository.On("UpdateRole", mock.Anything).Return(nil)
+
+			result, err := s.roleService.UpdateRole(tt.RoleName, tt.Request, s.ctx)
+			s.Equal(tt.ExpectedReturn, result)
+			s.Equal(tt.ExpectedErr, err)
+
+			if tt.ExpectedErr == nil {
+				s.mockRoleRepository.AssertCalled(s.T(), "UpdateRole", mock.MatchedBy(func(role *entity.Role) bool {
+					return role.ID == 2 && role.Description == "Support staff" && len(role.Permissions) == 1
+				}))
+			} else {
+				s.mockRoleRepository.AssertNotCalled(s.T(), "UpdateRole", mock.Anything)
+			}
+		})
+		s.TearDownTest()
+	}
+}
+
+func (s *TestSuiteRoleServices) TestDeleteRole() {
+	for _, tt := range []struct {
+		Name        string
+		RoleName    string
+		RoleReturn  *entity.Role
+		RoleError   error
+		DeleteError error
+		ExpectedErr error
+	}{
+		{
+			Name:       "Success",
+			RoleName:   "support",
+			RoleReturn: &entity.Role{ID: 2, Name: "support"},
+		},
+		{
+			Name:        "Role not found",
+			RoleName:    "support",
+			RoleError:   gorm.ErrRecordNotFound,
+			ExpectedErr: ErrRoleNotFound,
+		},
+		{
+			Name:        "Admin role",
+			RoleName:    "admin",
+			RoleReturn:  &entity.Role{ID: 1, Name: "admin"},
+			ExpectedErr: ErrBuiltInRole,
+		},
+		{
+			Name:        "Generic Error from Repository",
+			RoleName:    "support",
+			RoleReturn:  &entity.Role{ID: 2, Name: "support"},
+			DeleteError: errors.New("Generic Error"),
+			ExpectedErr: errors.New("Generic Error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.mockRoleRepository.On("FindRoleByName", tt.RoleName).Return(tt.RoleReturn, tt.RoleError)
+			s.mockRoleRepository.On("DeleteRole", mock.Anything).Return(tt.DeleteError)
+
+			err := s.roleService.DeleteRole(tt.RoleName, s.ctx)
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TearDownTest()
+	}
+}
+
+func (s *TestSuiteRoleServices) TestAssignRole() {
+	for _, tt := range []struct {
+		Name        string
+		UserError   error
+		RoleReturn  *entity.Role
+		RoleError   error
+		ExpectedErr error
+	}{
+		{
+			Name:       "Success",
+			RoleReturn: &entity.Role{ID: 2, Name: "support"},
+		},
+		{
+			Name:        "User not found",
+			UserError:   gorm.ErrRecordNotFound,
+			ExpectedErr: ErrUserNotFound,
+		},
+		{
+			Name:        "Role not found",
+			RoleError:   gorm.ErrRecordNotFound,
+			ExpectedErr: ErrRoleNotFound,
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.mockUserRepository.On("FindByID", uint(1)).Return(&entity.User{}, tt.UserError)
+			s.mockRoleRepository.On("FindRoleByName", "support").Return(tt.RoleReturn, tt.RoleError)
+			s.mockRoleRepository.On("AssignRole", uint(1), uint(2)).Return(nil)
+
+			err := s.roleService.AssignRole(1, "support", s.ctx)
+			s.Equal(tt.ExpectedErr, err)
+
+			if tt.ExpectedErr == nil {
+				s.mockRoleRepository.AssertCalled(s.T(), "AssignRole", uint(1), uint(2))
+			} else {
+				s.mockRoleRepository.AssertNotCalled(s.T(), "AssignRole", mock.Anything, mock.Anything)
+			}
+		})
+		s.TearDownTest()
+	}
+}
+
+func (s *TestSuiteRoleServices) TestUnassignRole() {
+	for _, tt := range []struct {
+		Name        string
+		UserError   error
+		RoleReturn  *entity.Role
+		RoleError   error
+		ExpectedErr error
+	}{
+		{
+			Name:       "Success",
+			RoleReturn: &entity.Role{ID: 2, Name: "support"},
+		},
+		{
+			Name:        "User not found",
+			UserError:   gorm.ErrRecordNotFound,
+			ExpectedErr: ErrUserNotFound,
+		},
+		{
+			Name:        "Role not found",
+			RoleError:   gorm.ErrRecordNotFound,
+			ExpectedErr: ErrRoleNotFound,
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.mockUserRepository.On("FindByID", uint(1)).Return(&entity.User{}, tt.UserError)
+			s.mockRoleRepository.On("FindRoleByName", "support").Return(tt.RoleReturn, tt.RoleError)
+			s.mockRoleRepository.On("UnassignRole", uint(1), uint(2)).Return(nil)
+
+			err := s.roleService.UnassignRole(1, "support", s.ctx)
+			s.Equal(tt.ExpectedErr, err)
+
+			if tt.ExpectedErr == nil {
+				s.mockRoleRepository.AssertCalled(s.T(), "UnassignRole", uint(1), uint(2))
+			} else {
+				s.mockRoleRepository.AssertNotCalled(s.T(), "UnassignRole", mock.Anything, mock.Anything)
+			}
+		})
+		s.TearDownTest()
+	}
+}
+
+func (s *TestSuiteRoleServices) TestHasPermission() {
+	for _, tt := range []struct {
+		Name           string
+		Roles          []string
+		FunctionReturn bool
+		ExpectedReturn bool
+		ExpectLookup   bool
+	}{
+		{
+			Name:           "Granted",
+			Roles:          []string{"admin"},
+			FunctionReturn: true,
+			ExpectedReturn: true,
+			ExpectLookup:   true,
+		},
+		{
+			Name:         "Not granted",
+			Roles:        []string{"support"},
+			ExpectLookup: true,
+		},
+		{
+			Name: "No roles",
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.mockRoleRepository.On("HasPermission", tt.Roles, "users:list").Return(tt.FunctionReturn, nil)
+
+			result, err := s.roleService.HasPermission(tt.Roles, "users:list", s.ctx)
+			s.NoError(err)
+			s.Equal(tt.ExpectedReturn, result)
+
+			if tt.ExpectLookup {
+				s.mockRoleRepository.AssertCalled(s.T(), "HasPermission", tt.Roles, "users:list")
+			} else {
+				s.mockRoleRepository.AssertNotCalled(s.T(), "HasPermission", mock.Anything, mock.Anything)
+			}
+		})
+		s.TearDownTest()
+	}
+}
+
+func TestRoleService(t *testing.T) {
+	suite.Run(t, new(TestSuiteRoleServices))
+}
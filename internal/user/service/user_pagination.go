@@ -0,0 +1,175 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"rewrite/internal/user/dto"
+	"rewrite/internal/user/repository"
+	"rewrite/pkg/entity"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+	defaultUserSort = "id"
+)
+
+// userSortFields whitelists the columns users can be sorted by.
+var userSortFields = map[string]bool{
+	"id":         true,
+	"email":      true,
+	"created_at": true,
+}
+
+// userCursor is the opaque cursor handed to clients, base64url encoded JSON.
+// It carries the sort it was made for so it can not be replayed with another
+// one.
+type userCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v,omitempty"`
+	ID    uint   `json:"id"`
+}
+
+func userFilterFromQuery(query dto.UserListQuery) (repository.UserFilter, error) {
+	filter := repository.UserFilter{
+		Email:  strings.TrimSpace(query.Email),
+		Offset: query.Offset,
+		Limit:  query.Limit,
+	}
+
+	if filter.Offset < 0 || filter.Limit < 0 {
+		return filter, ErrInvalidPagination
+	}
+
+	if filter.Limit == 0 {
+		filter.Limit = defaultPageSize
+	} else if filter.Limit > maxPageSize {
+		filter.Limit = maxPageSize
+	}
+
+	var cursor *userCursor
+	if query.Cursor != "" {
+		if filter.Offset != 0 {
+			return filter, ErrInvalidPagination
+		}
+
+		var err error
+		cursor, err = decodeUserCursor(query.Cursor)
+		if err != nil {
+			return filter, err
+		}
+
+		if query.Sort != "" && query.Sort != cursor.Sort {
+			return filter, ErrInvalidCursor
+		}
+		query.Sort = cursor.Sort
+	}
+
+	if query.Sort == "" {
+		query.Sort = defaultUserSort
+	}
+
+	filter.SortField, filter.SortDesc = parseUserSort(query.Sort)
+	if !userSortFields[filter.SortField] {
+		return filter, ErrInvalidSort
+	}
+
+	if cursor != nil {
+		var err error
+		filter.After, err = cursor.position(filter.SortField)
+		if err != nil {
+			return filter, err
+		}
+	}
+
+	var err error
+	filter.CreatedFrom, err = parseTimeFilter(query.CreatedFrom)
+	if err != nil {
+		return filter, err
+	}
+
+	filter.CreatedTo, err = parseTimeFilter(query.CreatedTo)
+	if err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+func parseUserSort(sort string) (string, bool) {
+	if strings.HasPrefix(sort, "-") {
+		return sort[1:], true
+	}
+
+	return sort, false
+}
+
+func parseTimeFilter(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, ErrInvalidFilter
+	}
+
+	return &t, nil
+}
+
+func encodeUserCursor(sortField string, desc bool, last *entity.User) (string, error) {
+	cursor := userCursor{Sort: sortField, ID: last.ID}
+	if desc {
+		cursor.Sort = "-" + sortField
+	}
+
+	switch sortField {
+	case "email":
+		cursor.Value = last.Email
+	case "created_at":
+		cursor.Value = last.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+
+	payload, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(payload), nil
+}
+
+func decodeUserCursor(value string) (*userCursor, error) {
+	payload, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor userCursor
+	err = json.Unmarshal(payload, &cursor)
+	if err != nil || cursor.ID == 0 {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+// position turns the cursor into the keyset position for the sort column.
+func (c *userCursor) position(sortField string) (*repository.UserCursor, error) {
+	switch sortField {
+	case "id":
+		return &repository.UserCursor{ID: c.ID}, nil
+	case "email":
+		return &repository.UserCursor{Value: c.Value, ID: c.ID}, nil
+	case "created_at":
+		createdAt, err := time.Parse(time.RFC3339Nano, c.Value)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+
+		return &repository.UserCursor{Value: createdAt, ID: c.ID}, nil
+	}
+
+	return nil, ErrInvalidSort
+}
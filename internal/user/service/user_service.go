@@ -3,10 +3,31 @@ package service
 import (
 	"context"
 	"rewrite/internal/user/dto"
+	"rewrite/pkg/utils"
 )
 
 type UserService interface {
-	FindAll(ctx context.Context) (dto.UsersResponse, error)
+	FindAll(query dto.UserListQuery, ctx context.Context) (*dto.UsersPage, error)
+	FindByID(id uint, ctx context.Context) (*dto.UserResponse, error)
+	UpdateUser(actorID uint, id uint, request dto.UpdateUserRequest, ctx context.Context) (*dto.UserResponse, error)
+	DeleteUser(id uint, ctx context.Context) error
 	CreateUser(user dto.UserRequest, ctx context.Context) error
-	Login(user dto.UserRequest, ctx context.Context) (string, error)
+	ProvisionUser(user dto.UserRequest, ctx context.Context) (*dto.UserResponse, error)
+	SetPassword(user dto.UserRequest, ctx context.Context) error
+	Login(user dto.UserRequest, ctx context.Context) (*dto.TokenResponse, error)
+	RefreshToken(request dto.RefreshTokenRequest, ctx context.Context) (*dto.TokenResponse, error)
+	Logout(claims *utils.Claims, ctx context.Context) error
+	LogoutAll(claims *utils.Claims, ctx context.Context) error
+	IsTokenRevoked(claims *utils.Claims, ctx context.Context) (bool, error)
+	PruneRevokedTokens(ctx context.Context) (int64, error)
+	UnlockUser(id uint, ctx context.Context) error
+	PruneLoginAttempts(ctx context.Context) (int64, error)
+	ForgotPassword(request dto.ForgotPasswordRequest, ctx context.Context) error
+	ResetPassword(request dto.ResetPasswordRequest, ctx context.Context) error
+	VerifyEmail(token string, ctx context.Context) error
+	ResendVerification(request dto.ResendVerificationRequest, ctx context.Context) error
+	EnrollTwoFactor(userID uint, ctx context.Context) (*dto.TwoFactorEnrollResponse, error)
+	ConfirmTwoFactor(userID uint, request dto.TwoFactorCodeRequest, ctx context.Context) (*dto.RecoveryCodesResponse, error)
+	DisableTwoFactor(userID uint, request dto.TwoFactorCodeRequest, ctx context.Context) error
+	LoginMFA(request dto.MFALoginRequest, ctx context.Context) (*dto.TokenResponse, error)
 }
@@ -2,76 +2,971 @@ package service
 
 import (
 	"context"
-	"errors"
+	"fmt"
+	"net/url"
 	"rewrite/internal/user/dto"
 	"rewrite/internal/user/repository"
+	"rewrite/pkg/apperror"
+	"rewrite/pkg/config"
+	"rewrite/pkg/entity"
+	"rewrite/pkg/logging"
+	"rewrite/pkg/mailer"
+	"rewrite/pkg/metrics"
+	"rewrite/pkg/tracing"
 	"rewrite/pkg/utils"
+	"rewrite/pkg/validation"
+	"time"
 
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 var (
-	ErrUserExists = errors.New("user already exists")
+	ErrInvalidPagination   = apperror.New(apperror.CodeInvalidPagination, apperror.Invalid, "invalid pagination parameters")
+	ErrInvalidCursor       = apperror.New(apperror.CodeInvalidCursor, apperror.Invalid, "invalid cursor")
+	ErrInvalidSort         = apperror.New(apperror.CodeInvalidSort, apperror.Invalid, "invalid sort field")
+	ErrInvalidFilter       = apperror.New(apperror.CodeInvalidFilter, apperror.Invalid, "invalid filter")
+	ErrUserExists          = apperror.New(apperror.CodeUserExists, apperror.Conflict, "user already exists")
+	ErrUserNotFound        = apperror.New(apperror.CodeUserNotFound, apperror.NotFound, "user not found")
+	ErrInvalidCredentials  = apperror.New(apperror.CodeInvalidCredentials, apperror.Unauthorized, "invalid email or password")
+	ErrWrongPassword       = apperror.New(apperror.CodeWrongPassword, apperror.Forbidden, "current password is incorrect")
+	ErrInvalidRefreshToken = apperror.New(apperror.CodeInvalidRefreshToken, apperror.Unauthorized, "invalid refresh token")
+	ErrRefreshTokenReused  = apperror.New(apperror.CodeRefreshTokenReused, apperror.Unauthorized, "refresh token reuse detected")
+	ErrInvalidResetToken   = apperror.New(apperror.CodeInvalidResetToken, apperror.Invalid, "invalid or expired password reset token")
+	ErrEmailNotVerified    = apperror.New(apperror.CodeEmailNotVerified, apperror.Forbidden, "email is not verified")
+	ErrInvalidVerification = apperror.New(apperror.CodeInvalidVerification, apperror.Invalid, "invalid or expired verification link")
+
+	ErrTooManyLoginAttempts = apperror.New(apperror.CodeTooManyAttempts, apperror.TooManyRequests, "too many failed logins, try again later")
+
+	ErrTwoFactorAlreadyEnabled = apperror.New(apperror.CodeTwoFactorAlreadyEnabled, apperror.Conflict, "two-factor authentication already enabled")
+	ErrTwoFactorNotEnrolled    = apperror.New(apperror.CodeTwoFactorNotEnrolled, apperror.Invalid, "two-factor authentication not enrolled")
+	ErrTwoFactorNotEnabled     = apperror.New(apperror.CodeTwoFactorNotEnabled, apperror.Invalid, "two-factor authentication not enabled")
+	ErrInvalidTwoFactorCode    = apperror.New(apperror.CodeInvalidTwoFactorCode, apperror.Invalid, "invalid two-factor code")
+	ErrInvalidMFAToken         = apperror.New(apperror.CodeInvalidMFAToken, apperror.Unauthorized, "invalid or expired mfa token")
 )
 
+const recoveryCodeCount = 10
+
 type UserServiceImpl struct {
-	userRepository repository.UserRepository
+	userRepository               repository.UserRepository
+	refreshTokenRepository       repository.RefreshTokenRepository
+	revokedTokenRepository       repository.RevokedTokenRepository
+	passwordResetTokenRepository repository.PasswordResetTokenRepository
+	twoFactorRepository          repository.TwoFactorRepository
+	loginAttemptRepository       repository.LoginAttemptRepository
+	keyRing                      *utils.KeyRing
+	mailer                       mailer.Mailer
+	passwordHasher               utils.PasswordHasher
+	passwordChecker              *validation.PasswordChecker
+	dummyHash                    *dummyHash
+	config                       *config.Config
 }
 
-func NewUserServiceImpl(userRepository repository.UserRepository) UserService {
-	return &UserServiceImpl{userRepository}
+func NewUserServiceImpl(
+	userRepository repository.UserRepository,
+	refreshTokenRepository repository.RefreshTokenRepository,
+	revokedTokenRepository repository.RevokedTokenRepository,
+	passwordResetTokenRepository repository.PasswordResetTokenRepository,
+	twoFactorRepository repository.TwoFactorRepository,
+	loginAttemptRepository repository.LoginAttemptRepository,
+	keyRing *utils.KeyRing,
+	mailer mailer.Mailer,
+	passwordHasher utils.PasswordHasher,
+	passwordChecker *validation.PasswordChecker,
+	config *config.Config,
+) UserService {
+	return &UserServiceImpl{
+		userRepository,
+		refreshTokenRepository,
+		revokedTokenRepository,
+		passwordResetTokenRepository,
+		twoFactorRepository,
+		loginAttemptRepository,
+		keyRing,
+		mailer,
+		passwordHasher,
+		passwordChecker,
+		&dummyHash{hasher: passwordHasher},
+		config,
+	}
 }
 
-func (u *UserServiceImpl) FindAll(ctx context.Context) (dto.UsersResponse, error) {
-	users, err := u.userRepository.FindAll(ctx)
+// FindAll returns one page of users. The next cursor is only set when there
+// are more users after the page.
+func (u *UserServiceImpl) FindAll(query dto.UserListQuery, ctx context.Context) (*dto.UsersPage, error) {
+	ctx, span := tracing.Start(ctx, "UserService.FindAll")
+	defer span.End()
+
+	filter, err := userFilterFromQuery(query)
 	if err != nil {
 		return nil, err
 	}
 
-	var dtoUsers dto.UsersResponse
+	limit := filter.Limit
+	filter.Limit++
+
+	users, total, err := u.userRepository.FindAll(filter, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var nextCursor *string
+	if len(users) > limit {
+		users = users[:limit]
+
+		cursor, err := encodeUserCursor(filter.SortField, filter.SortDesc, &users[limit-1])
+		if err != nil {
+			return nil, err
+		}
+		nextCursor = &cursor
+	}
+
+	dtoUsers := dto.UsersResponse{}
 	dtoUsers.FromEntity(users)
-	return dtoUsers, nil
+	return &dto.UsersPage{
+		Users: dtoUsers,
+		Meta: dto.PageMeta{
+			Total:      total,
+			Limit:      limit,
+			Offset:     filter.Offset,
+			NextCursor: nextCursor,
+		},
+	}, nil
+}
+
+func (u *UserServiceImpl) FindByID(id uint, ctx context.Context) (*dto.UserResponse, error) {
+	ctx, span := tracing.Start(ctx, "UserService.FindByID")
+	defer span.End()
+
+	userEntity, err := u.findUser(id, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var user dto.UserResponse
+	user.FromEntity(userEntity)
+	return &user, nil
+}
+
+// UpdateUser changes the email and/or the password of a user. Users changing
+// their own record must confirm it with their current password. A new email
+// has to be verified again, a new password signs the user out everywhere.
+func (u *UserServiceImpl) UpdateUser(actorID uint, id uint, request dto.UpdateUserRequest, ctx context.Context) (*dto.UserResponse, error) {
+	ctx, span := tracing.Start(ctx, "UserService.UpdateUser")
+	defer span.End()
+
+	userEntity, err := u.findUser(id, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	changeEmail := request.Email != nil && *request.Email != userEntity.Email
+	changePassword := request.Password != nil
+
+	if (changeEmail || changePassword) && actorID == id {
+		_, err = u.comparePassword(userEntity.Password, request.CurrentPassword, ctx)
+		if err != nil {
+			return nil, ErrWrongPassword
+		}
+	}
+
+	var email, hashedPassword string
+	if changeEmail {
+		email = *request.Email
+	}
+
+	if changePassword {
+		newEmail := userEntity.Email
+		if changeEmail {
+			newEmail = email
+		}
+
+		err = u.passwordChecker.Check(*request.Password, newEmail)
+		if err != nil {
+			return nil, err
+		}
+
+		// Hashed before writing anything, the email and the password are
+		// updated together in one transaction.
+		hashedPassword, err = u.hashPassword(*request.Password, ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if changeEmail || changePassword {
+		err = u.userRepository.UpdateCredentials(id, email, hashedPassword, ctx)
+		if err != nil {
+			if err == repository.ErrEmailAlreadyExist {
+				return nil, ErrUserExists
+			}
+			return nil, err
+		}
+	}
+
+	if changeEmail {
+		userEntity.Email = email
+		userEntity.VerifiedAt = nil
+	}
+
+	if changePassword {
+		err = u.revokeAllSessions(id, ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if changeEmail {
+		err = u.sendVerificationEmail(userEntity, ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var user dto.UserResponse
+	user.FromEntity(userEntity)
+	return &user, nil
+}
+
+// DeleteUser soft deletes the user and ends all of their sessions.
+func (u *UserServiceImpl) DeleteUser(id uint, ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "UserService.DeleteUser")
+	defer span.End()
+
+	err := u.userRepository.DeleteUser(id, ctx)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	return u.revokeAllSessions(id, ctx)
 }
 
 func (u *UserServiceImpl) CreateUser(user dto.UserRequest, ctx context.Context) error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	ctx, span := tracing.Start(ctx, "UserService.CreateUser")
+	defer span.End()
+
+	err := u.passwordChecker.Check(user.Password, user.Email)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := u.hashPassword(user.Password, ctx)
 	if err != nil {
 		return err
 	}
-	user.Password = string(hashedPassword)
+	user.Password = hashedPassword
 
 	userEntity := user.ToEntity()
 
 	err = u.userRepository.CreateUser(userEntity, ctx)
 	if err != nil {
 		if err == repository.ErrEmailAlreadyExist {
+			if u.config.Auth.HideExistingAccounts {
+				return u.sendAccountExistsEmail(userEntity.Email, ctx)
+			}
 			return ErrUserExists
 		}
 		return err
 	}
+	metrics.RegistrationsTotal.WithLabelValues("signup").Inc()
+
+	return u.sendVerificationEmail(userEntity, ctx)
+}
+
+// ProvisionUser creates a user on behalf of an operator. The email is trusted
+// to be verified, so no verification email is sent.
+func (u *UserServiceImpl) ProvisionUser(user dto.UserRequest, ctx context.Context) (*dto.UserResponse, error) {
+	ctx, span := tracing.Start(ctx, "UserService.ProvisionUser")
+	defer span.End()
+
+	err := u.passwordChecker.Check(user.Password, user.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := u.hashPassword(user.Password, ctx)
+	if err != nil {
+		return nil, err
+	}
+	user.Password = hashedPassword
+
+	verifiedAt := time.Now()
+	userEntity := user.ToEntity()
+	userEntity.VerifiedAt = &verifiedAt
+
+	err = u.userRepository.CreateUser(userEntity, ctx)
+	if err != nil {
+		if err == repository.ErrEmailAlreadyExist {
+			return nil, ErrUserExists
+		}
+		return nil, err
+	}
+	metrics.RegistrationsTotal.WithLabelValues("provisioned").Inc()
 
-	return nil
+	var response dto.UserResponse
+	response.FromEntity(userEntity)
+	return &response, nil
 }
 
-func (u *UserServiceImpl) Login(user dto.UserRequest, ctx context.Context) (string, error) {
+// SetPassword replaces the password of the user with the given email without
+// asking for the current one, and signs the user out of every session.
+func (u *UserServiceImpl) SetPassword(user dto.UserRequest, ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "UserService.SetPassword")
+	defer span.End()
+
 	userEntity, err := u.userRepository.FindByEmail(user.Email, ctx)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return "", nil
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	err = u.passwordChecker.Check(user.Password, userEntity.Email)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := u.hashPassword(user.Password, ctx)
+	if err != nil {
+		return err
+	}
+
+	err = u.userRepository.UpdatePassword(userEntity.ID, hashedPassword, ctx)
+	if err != nil {
+		return err
+	}
+
+	return u.revokeAllSessions(userEntity.ID, ctx)
+}
+
+func (u *UserServiceImpl) Login(user dto.UserRequest, ctx context.Context) (*dto.TokenResponse, error) {
+	ctx, span := tracing.Start(ctx, "UserService.Login")
+	defer span.End()
+
+	now := time.Now()
+	attemptKeys := loginAttemptKeys(user.Email, ctx)
+	err := u.checkLoginAttempts(attemptKeys, now, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var needsRehash bool
+	userEntity, err := u.userRepository.FindByEmail(user.Email, ctx)
+	if err == nil {
+		needsRehash, err = u.comparePassword(userEntity.Password, user.Password, ctx)
+	} else if err == gorm.ErrRecordNotFound {
+		// Spend the time of a real comparison, or response times would tell
+		// which emails are registered.
+		u.comparePassword(u.dummyHash.get(), user.Password, ctx)
+	} else {
+		return nil, err
+	}
+
+	if err != nil {
+		metrics.LoginsTotal.WithLabelValues(metrics.LoginInvalidCredentials).Inc()
+
+		err = u.recordLoginFailure(attemptKeys, now, ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, ErrInvalidCredentials
+	}
+
+	// Only the account is forgiven, see config.LockoutConfig.
+	err = u.loginAttemptRepository.DeleteByKeys([]string{accountKey(user.Email)}, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if needsRehash {
+		u.rehashPassword(userEntity, user.Password, ctx)
+	}
+
+	if u.config.Verification.Required && userEntity.VerifiedAt == nil {
+		metrics.LoginsTotal.WithLabelValues(metrics.LoginUnverified).Inc()
+		return nil, ErrEmailNotVerified
+	}
+
+	twoFactor, err := u.twoFactorRepository.FindByUserID(userEntity.ID, ctx)
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	if twoFactor != nil && twoFactor.EnabledAt != nil {
+		mfaToken, err := utils.GenerateMFAToken(u.keyRing, userEntity, u.config.JWT.MFATokenTTL)
+		if err != nil {
+			return nil, err
+		}
+		metrics.TokensIssuedTotal.WithLabelValues(metrics.TokenMFA).Inc()
+		metrics.LoginsTotal.WithLabelValues(metrics.LoginMFARequired).Inc()
+
+		return &dto.TokenResponse{MFAToken: mfaToken}, nil
+	}
+
+	return u.loginSucceeded(userEntity, ctx)
+}
+
+// LoginMFA finishes a login started with a password by checking a TOTP or
+// recovery code. The MFA token is consumed by the first attempt, right or
+// wrong, so codes can not be brute forced without the password.
+func (u *UserServiceImpl) LoginMFA(request dto.MFALoginRequest, ctx context.Context) (*dto.TokenResponse, error) {
+	ctx, span := tracing.Start(ctx, "UserService.LoginMFA")
+	defer span.End()
+
+	claims, err := utils.ParseTokenWithPurpose(u.keyRing, request.MFAToken, utils.PurposeMFAPending)
+	if err != nil {
+		return nil, ErrInvalidMFAToken
+	}
+
+	revoked, err := u.IsTokenRevoked(claims, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if revoked {
+		return nil, ErrInvalidMFAToken
+	}
+
+	err = u.revokedTokenRepository.CreateRevokedToken(&entity.RevokedToken{
+		JTI:       claims.ID,
+		UserID:    claims.UserID,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	twoFactor, err := u.twoFactorRepository.FindByUserID(claims.UserID, ctx)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrInvalidMFAToken
+		}
+		return nil, err
+	}
+
+	if twoFactor.EnabledAt == nil {
+		return nil, ErrInvalidMFAToken
+	}
+
+	err = u.verifySecondFactor(twoFactor, request.Code, ctx)
+	if err != nil {
+		if err == ErrInvalidTwoFactorCode {
+			metrics.LoginsTotal.WithLabelValues(metrics.LoginMFAFailed).Inc()
+		}
+		return nil, err
+	}
+
+	userEntity, err := u.userRepository.FindByID(claims.UserID, ctx)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrInvalidMFAToken
+		}
+		return nil, err
+	}
+
+	return u.loginSucceeded(userEntity, ctx)
+}
+
+// EnrollTwoFactor generates a new TOTP secret for the user. Enrollment stays
+// pending, and any earlier pending secret is replaced, until it is confirmed.
+func (u *UserServiceImpl) EnrollTwoFactor(userID uint, ctx context.Context) (*dto.TwoFactorEnrollResponse, error) {
+	ctx, span := tracing.Start(ctx, "UserService.EnrollTwoFactor")
+	defer span.End()
+
+	userEntity, err := u.userRepository.FindByID(userID, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	twoFactor, err := u.twoFactorRepository.FindByUserID(userID, ctx)
+	if err != nil {
+		if err != gorm.ErrRecordNotFound {
+			return nil, err
+		}
+		twoFactor = &entity.TwoFactor{UserID: userID}
+	}
+
+	if twoFactor.EnabledAt != nil {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	twoFactor.Secret = secret
+
+	err = u.twoFactorRepository.SaveTwoFactor(twoFactor, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.TwoFactorEnrollResponse{
+		Secret:     secret,
+		OTPAuthURI: utils.TOTPURI(u.config.Auth.TOTPIssuer, userEntity.Email, secret),
+	}, nil
+}
+
+// ConfirmTwoFactor enables a pending enrollment once the user proves their
+// authenticator works, and hands out a fresh set of recovery codes. The codes
+// are only ever shown here.
+func (u *UserServiceImpl) ConfirmTwoFactor(userID uint, request dto.TwoFactorCodeRequest, ctx context.Context) (*dto.RecoveryCodesResponse, error) {
+	ctx, span := tracing.Start(ctx, "UserService.ConfirmTwoFactor")
+	defer span.End()
+
+	twoFactor, err := u.twoFactorRepository.FindByUserID(userID, ctx)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrTwoFactorNotEnrolled
+		}
+		return nil, err
+	}
+
+	if twoFactor.EnabledAt != nil {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	step, ok := utils.ValidateTOTP(twoFactor.Secret, request.Code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	recoveryCodes := make([]entity.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		codes[i], err = utils.GenerateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		recoveryCodes[i] = entity.RecoveryCode{
+			UserID:   userID,
+			CodeHash: utils.HashToken(utils.NormalizeRecoveryCode(codes[i])),
+		}
+	}
+
+	now := time.Now()
+	twoFactor.EnabledAt = &now
+	twoFactor.LastUsedStep = step
+
+	err = u.twoFactorRepository.EnableTwoFactor(twoFactor, recoveryCodes, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// DisableTwoFactor turns two factor authentication off after checking a
+// current TOTP or recovery code.
+func (u *UserServiceImpl) DisableTwoFactor(userID uint, request dto.TwoFactorCodeRequest, ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "UserService.DisableTwoFactor")
+	defer span.End()
+
+	twoFactor, err := u.twoFactorRepository.FindByUserID(userID, ctx)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return ErrTwoFactorNotEnabled
+		}
+		return err
+	}
+
+	if twoFactor.EnabledAt == nil {
+		return ErrTwoFactorNotEnabled
+	}
+
+	err = u.verifySecondFactor(twoFactor, request.Code, ctx)
+	if err != nil {
+		return err
+	}
+
+	return u.twoFactorRepository.DisableTwoFactor(userID, ctx)
+}
+
+// verifySecondFactor accepts either a TOTP code that was not used before or an
+// unused recovery code, which is burnt on success.
+func (u *UserServiceImpl) verifySecondFactor(twoFactor *entity.TwoFactor, code string, ctx context.Context) error {
+	if step, ok := utils.ValidateTOTP(twoFactor.Secret, code, time.Now()); ok {
+		if step <= twoFactor.LastUsedStep {
+			return ErrInvalidTwoFactorCode
+		}
+
+		err := u.twoFactorRepository.UpdateLastUsedStep(twoFactor.ID, step, ctx)
+		if err == repository.ErrTOTPStepAlreadyUsed {
+			return ErrInvalidTwoFactorCode
+		}
+		return err
+	}
+
+	err := u.twoFactorRepository.UseRecoveryCode(twoFactor.UserID, utils.HashToken(utils.NormalizeRecoveryCode(code)), ctx)
+	if err == repository.ErrRecoveryCodeNotFound {
+		return ErrInvalidTwoFactorCode
+	}
+	return err
+}
+
+// RefreshToken exchanges a refresh token for a new access/refresh token pair.
+// Every refresh token can only be used once; presenting one that was already
+// rotated revokes every token descended from the same login.
+func (u *UserServiceImpl) RefreshToken(request dto.RefreshTokenRequest, ctx context.Context) (*dto.TokenResponse, error) {
+	ctx, span := tracing.Start(ctx, "UserService.RefreshToken")
+	defer span.End()
+
+	token, err := u.refreshTokenRepository.FindByTokenHash(utils.HashToken(request.RefreshToken), ctx)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	if token.RevokedAt != nil || time.Now().After(token.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if token.UsedAt != nil {
+		return nil, u.revokeReusedFamily(token.FamilyID, ctx)
+	}
+
+	err = u.refreshTokenRepository.MarkAsUsed(token.ID, ctx)
+	if err != nil {
+		if err == repository.ErrRefreshTokenAlreadyUsed {
+			return nil, u.revokeReusedFamily(token.FamilyID, ctx)
+		}
+		return nil, err
+	}
+
+	userEntity, err := u.userRepository.FindByID(token.UserID, ctx)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	return u.issueTokens(userEntity, token.FamilyID, ctx)
+}
+
+// Logout revokes the access token described by claims together with the
+// refresh token family it was issued with.
+func (u *UserServiceImpl) Logout(claims *utils.Claims, ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "UserService.Logout")
+	defer span.End()
+
+	err := u.revokedTokenRepository.CreateRevokedToken(&entity.RevokedToken{
+		JTI:       claims.ID,
+		UserID:    claims.UserID,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}, ctx)
+	if err != nil {
+		return err
+	}
+
+	if claims.SessionID == "" {
+		return nil
+	}
+
+	return u.refreshTokenRepository.RevokeFamily(claims.SessionID, ctx)
+}
+
+// LogoutAll revokes every access and refresh token issued to the user so far.
+func (u *UserServiceImpl) LogoutAll(claims *utils.Claims, ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "UserService.LogoutAll")
+	defer span.End()
+
+	return u.revokeAllSessions(claims.UserID, ctx)
+}
+
+func (u *UserServiceImpl) IsTokenRevoked(claims *utils.Claims, ctx context.Context) (bool, error) {
+	ctx, span := tracing.Start(ctx, "UserService.IsTokenRevoked")
+	defer span.End()
+
+	var issuedAt time.Time
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+
+	return u.revokedTokenRepository.IsRevoked(claims.ID, claims.UserID, issuedAt, ctx)
+}
+
+func (u *UserServiceImpl) PruneRevokedTokens(ctx context.Context) (int64, error) {
+	ctx, span := tracing.Start(ctx, "UserService.PruneRevokedTokens")
+	defer span.End()
+
+	return u.revokedTokenRepository.DeleteExpired(ctx)
+}
+
+// ForgotPassword mails a password reset link when the email belongs to a user.
+// Unknown emails are silently ignored so the caller can not tell them apart.
+func (u *UserServiceImpl) ForgotPassword(request dto.ForgotPasswordRequest, ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "UserService.ForgotPassword")
+	defer span.End()
+
+	userEntity, err := u.userRepository.FindByEmail(request.Email, ctx)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil
 		}
-		return "", err
+		return err
+	}
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	// Only the link sent last works, links mailed before may have leaked.
+	err = u.passwordResetTokenRepository.RevokeByUserID(userEntity.ID, ctx)
+	if err != nil {
+		return err
+	}
+
+	err = u.passwordResetTokenRepository.CreatePasswordResetToken(&entity.PasswordResetToken{
+		UserID:    userEntity.ID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(u.config.Auth.PasswordResetTTL),
+	}, ctx)
+	if err != nil {
+		return err
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(userEntity.Password), []byte(user.Password))
+	return u.mailer.Send(mailer.Message{
+		To:      userEntity.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Use the link below to choose a new password. It expires in %s.\n\n%s/password/reset?token=%s\n\nIf you did not ask for a password reset you can ignore this email.",
+			u.config.Auth.PasswordResetTTL, u.config.Server.AppURL, url.QueryEscape(token),
+		),
+	}, ctx)
+}
+
+// ResetPassword redeems a reset token, sets the new password and signs the
+// user out of every existing session.
+func (u *UserServiceImpl) ResetPassword(request dto.ResetPasswordRequest, ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "UserService.ResetPassword")
+	defer span.End()
+
+	token, err := u.passwordResetTokenRepository.FindByTokenHash(utils.HashToken(request.Token), ctx)
 	if err != nil {
-		return "", nil
+		if err == gorm.ErrRecordNotFound {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	if token.UsedAt != nil || time.Now().After(token.ExpiresAt) {
+		return ErrInvalidResetToken
 	}
 
-	token, err := utils.GenerateToken(userEntity)
+	// Checked before the token is used up, so the user can pick another
+	// password with the same link.
+	userEntity, err := u.userRepository.FindByID(token.UserID, ctx)
 	if err != nil {
-		return "", err
+		if err == gorm.ErrRecordNotFound {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	err = u.passwordChecker.Check(request.Password, userEntity.Email)
+	if err != nil {
+		return err
+	}
+
+	err = u.passwordResetTokenRepository.MarkAsUsed(token.ID, ctx)
+	if err != nil {
+		if err == repository.ErrPasswordResetTokenAlreadyUsed {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	hashedPassword, err := u.hashPassword(request.Password, ctx)
+	if err != nil {
+		return err
+	}
+
+	err = u.userRepository.UpdatePassword(token.UserID, hashedPassword, ctx)
+	if err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("password reset, revoking every session", "user_id", token.UserID)
+
+	// Other links of the user must not reset the new password.
+	err = u.passwordResetTokenRepository.RevokeByUserID(token.UserID, ctx)
+	if err != nil {
+		return err
+	}
+
+	return u.revokeAllSessions(token.UserID, ctx)
+}
+
+// VerifyEmail marks the user's email as verified. The link is only honoured
+// while the user still has the email it was sent to.
+func (u *UserServiceImpl) VerifyEmail(token string, ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "UserService.VerifyEmail")
+	defer span.End()
+
+	claims, err := utils.ParseTokenWithPurpose(u.keyRing, token, utils.PurposeEmailVerification)
+	if err != nil {
+		return ErrInvalidVerification
+	}
+
+	userEntity, err := u.userRepository.FindByID(claims.UserID, ctx)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return ErrInvalidVerification
+		}
+		return err
+	}
+
+	if userEntity.Email != claims.Email {
+		return ErrInvalidVerification
+	}
+
+	if userEntity.VerifiedAt != nil {
+		return nil
+	}
+
+	return u.userRepository.MarkAsVerified(userEntity.ID, ctx)
+}
+
+// ResendVerification mails a new verification link to an unverified user.
+// Unknown and already verified emails are ignored without telling the caller.
+func (u *UserServiceImpl) ResendVerification(request dto.ResendVerificationRequest, ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "UserService.ResendVerification")
+	defer span.End()
+
+	userEntity, err := u.userRepository.FindByEmail(request.Email, ctx)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		return err
+	}
+
+	if userEntity.VerifiedAt != nil {
+		return nil
+	}
+
+	return u.sendVerificationEmail(userEntity, ctx)
+}
+
+func (u *UserServiceImpl) sendVerificationEmail(user *entity.User, ctx context.Context) error {
+	token, err := utils.GenerateVerificationToken(u.keyRing, user, u.config.Verification.TTL)
+	if err != nil {
+		return err
+	}
+
+	return u.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf(
+			"Confirm your email address by opening the link below. It expires in %s.\n\n%s/users/verify?token=%s",
+			u.config.Verification.TTL, u.config.Server.AppURL, url.QueryEscape(token),
+		),
+	}, ctx)
+}
+
+// sendAccountExistsEmail answers a signup with a registered email. The owner
+// learns someone tried to sign up with it, and how to get back in if it was
+// them.
+func (u *UserServiceImpl) sendAccountExistsEmail(email string, ctx context.Context) error {
+	return u.mailer.Send(mailer.Message{
+		To:      email,
+		Subject: "You already have an account",
+		Body: fmt.Sprintf(
+			"Someone tried to sign up with this email address, which already has an account. If it was you, log in or reset your password:\n\n%s/password/forgot\n\nIf it was not you, you can ignore this email.",
+			u.config.Server.AppURL,
+		),
+	}, ctx)
+}
+
+func (u *UserServiceImpl) findUser(id uint, ctx context.Context) (*entity.User, error) {
+	userEntity, err := u.userRepository.FindByID(id, ctx)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	return userEntity, nil
+}
+
+func (u *UserServiceImpl) revokeAllSessions(userID uint, ctx context.Context) error {
+	err := u.revokedTokenRepository.CreateRevokedToken(&entity.RevokedToken{
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(u.config.JWT.AccessTokenTTL),
+	}, ctx)
+	if err != nil {
+		return err
+	}
+
+	return u.refreshTokenRepository.RevokeByUserID(userID, ctx)
+}
+
+func (u *UserServiceImpl) revokeReusedFamily(familyID string, ctx context.Context) error {
+	logging.FromContext(ctx).Warn("refresh token reused, revoking its family", "family_id", familyID)
+
+	err := u.refreshTokenRepository.RevokeFamily(familyID, ctx)
+	if err != nil {
+		return err
+	}
+
+	return ErrRefreshTokenReused
+}
+
+// loginSucceeded starts the session of a user who passed every login step.
+func (u *UserServiceImpl) loginSucceeded(userEntity *entity.User, ctx context.Context) (*dto.TokenResponse, error) {
+	tokens, err := u.startSession(userEntity, ctx)
+	if err != nil {
+		return nil, err
+	}
+	metrics.LoginsTotal.WithLabelValues(metrics.LoginSuccess).Inc()
+
+	return tokens, nil
+}
+
+// startSession opens a new refresh token family and issues its first tokens.
+func (u *UserServiceImpl) startSession(userEntity *entity.User, ctx context.Context) (*dto.TokenResponse, error) {
+	familyID, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.issueTokens(userEntity, familyID, ctx)
+}
+
+func (u *UserServiceImpl) issueTokens(user *entity.User, familyID string, ctx context.Context) (*dto.TokenResponse, error) {
+	accessToken, err := utils.GenerateToken(u.keyRing, user, familyID, u.config.JWT.AccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	err = u.refreshTokenRepository.CreateRefreshToken(&entity.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: utils.HashToken(refreshToken),
+		ExpiresAt: time.Now().Add(u.config.JWT.RefreshTokenTTL),
+	}, ctx)
+	if err != nil {
+		return nil, err
 	}
+	metrics.TokensIssuedTotal.WithLabelValues(metrics.TokenAccess).Inc()
+	metrics.TokensIssuedTotal.WithLabelValues(metrics.TokenRefresh).Inc()
 
-	return token, nil
+	return &dto.TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}, nil
 }
@@ -5,11 +5,22 @@ import (
 	"errors"
 	"rewrite/internal/user/dto"
 	"rewrite/internal/user/repository"
+	"rewrite/pkg/apperror"
+	"rewrite/pkg/config"
 	"rewrite/pkg/entity"
+	"rewrite/pkg/mailer"
+	"rewrite/pkg/metrics"
+	"rewrite/pkg/utils"
+	"rewrite/pkg/validation"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
@@ -17,9 +28,9 @@ type MockUserRepository struct {
 	mock.Mock
 }
 
-func (m *MockUserRepository) FindAll(ctx context.Context) (entity.Users, error) {
-	args := m.Called()
-	return args.Get(0).(entity.Users), args.Error(1)
+func (m *MockUserRepository) FindAll(filter repository.UserFilter, ctx context.Context) (entity.Users, int64, error) {
+	args := m.Called(filter)
+	return args.Get(0).(entity.Users), args.Get(1).(int64), args.Error(2)
 }
 
 func (m *MockUserRepository) CreateUser(user *entity.User, ctx context.Context) error {
@@ -32,140 +43,649 @@ func (m *MockUserRepository) FindByEmail(email string, ctx context.Context) (*en
 	return args.Get(0).(*entity.User), args.Error(1)
 }
 
+func (m *MockUserRepository) FindByID(id uint, ctx context.Context) (*entity.User, error) {
+	args := m.Called(id)
+	return args.Get(0).(*entity.User), args.Error(1)
+}
+
+func (m *MockUserRepository) UpdatePassword(id uint, password string, ctx context.Context) error {
+	args := m.Called(id, password)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) MarkAsVerified(id uint, ctx context.Context) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) UpdateCredentials(id uint, email string, password string, ctx context.Context) error {
+	args := m.Called(id, email, password)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) DeleteUser(id uint, ctx context.Context) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+type MockRefreshTokenRepository struct {
+	mock.Mock
+}
+
+func (m *MockRefreshTokenRepository) CreateRefreshToken(token *entity.RefreshToken, ctx context.Context) error {
+	args := m.Called(token)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) FindByTokenHash(hash string, ctx context.Context) (*entity.RefreshToken, error) {
+	args := m.Called(hash)
+	return args.Get(0).(*entity.RefreshToken), args.Error(1)
+}
+
+func (m *MockRefreshTokenRepository) MarkAsUsed(id uint, ctx context.Context) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) RevokeFamily(familyID string, ctx context.Context) error {
+	args := m.Called(familyID)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) RevokeByUserID(userID uint, ctx context.Context) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+type MockRevokedTokenRepository struct {
+	mock.Mock
+}
+
+func (m *MockRevokedTokenRepository) CreateRevokedToken(token *entity.RevokedToken, ctx context.Context) error {
+	args := m.Called(token)
+	return args.Error(0)
+}
+
+func (m *MockRevokedTokenRepository) IsRevoked(jti string, userID uint, issuedAt time.Time, ctx context.Context) (bool, error) {
+	args := m.Called(jti, userID, issuedAt)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRevokedTokenRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	args := m.Called()
+	return args.Get(0).(int64), args.Error(1)
+}
+
+type MockPasswordResetTokenRepository struct {
+	mock.Mock
+}
+
+func (m *MockPasswordResetTokenRepository) CreatePasswordResetToken(token *entity.PasswordResetToken, ctx context.Context) error {
+	args := m.Called(token)
+	return args.Error(0)
+}
+
+func (m *MockPasswordResetTokenRepository) FindByTokenHash(hash string, ctx context.Context) (*entity.PasswordResetToken, error) {
+	args := m.Called(hash)
+	return args.Get(0).(*entity.PasswordResetToken), args.Error(1)
+}
+
+func (m *MockPasswordResetTokenRepository) MarkAsUsed(id uint, ctx context.Context) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockPasswordResetTokenRepository) RevokeByUserID(userID uint, ctx context.Context) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+type MockTwoFactorRepository struct {
+	mock.Mock
+}
+
+func (m *MockTwoFactorRepository) FindByUserID(userID uint, ctx context.Context) (*entity.TwoFactor, error) {
+	args := m.Called(userID)
+	return args.Get(0).(*entity.TwoFactor), args.Error(1)
+}
+
+func (m *MockTwoFactorRepository) SaveTwoFactor(twoFactor *entity.TwoFactor, ctx context.Context) error {
+	args := m.Called(twoFactor)
+	return args.Error(0)
+}
+
+func (m *MockTwoFactorRepository) EnableTwoFactor(twoFactor *entity.TwoFactor, recoveryCodes []entity.RecoveryCode, ctx context.Context) error {
+	args := m.Called(twoFactor, recoveryCodes)
+	return args.Error(0)
+}
+
+func (m *MockTwoFactorRepository) DisableTwoFactor(userID uint, ctx context.Context) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+func (m *MockTwoFactorRepository) UpdateLastUsedStep(id uint, step int64, ctx context.Context) error {
+	args := m.Called(id, step)
+	return args.Error(0)
+}
+
+func (m *MockTwoFactorRepository) UseRecoveryCode(userID uint, codeHash string, ctx context.Context) error {
+	args := m.Called(userID, codeHash)
+	return args.Error(0)
+}
+
+type MockMailer struct {
+	mock.Mock
+}
+
+func (m *MockMailer) Send(message mailer.Message, ctx context.Context) error {
+	args := m.Called(message)
+	return args.Error(0)
+}
+
 type TestSuiteUserServices struct {
 	suite.Suite
-	mockUserRepository *MockUserRepository
-	userService        UserService
-	ctx                context.Context
+	mockUserRepository               *MockUserRepository
+	mockRefreshTokenRepository       *MockRefreshTokenRepository
+	mockRevokedTokenRepository       *MockRevokedTokenRepository
+	mockPasswordResetTokenRepository *MockPasswordResetTokenRepository
+	mockTwoFactorRepository          *MockTwoFactorRepository
+	loginAttemptRepository           repository.LoginAttemptRepository
+	mockMailer                       *MockMailer
+	keyRing                          *utils.KeyRing
+	config                           *config.Config
+	userService                      UserService
+	ctx                              context.Context
 }
 
 func (s *TestSuiteUserServices) SetupTest() {
 	s.mockUserRepository = new(MockUserRepository)
-	s.userService = NewUserServiceImpl(s.mockUserRepository)
+	s.mockRefreshTokenRepository = new(MockRefreshTokenRepository)
+	s.mockRevokedTokenRepository = new(MockRevokedTokenRepository)
+	s.mockPasswordResetTokenRepository = new(MockPasswordResetTokenRepository)
+	s.mockTwoFactorRepository = new(MockTwoFactorRepository)
+	s.loginAttemptRepository = repository.NewMemoryLoginAttemptRepository()
+	s.mockMailer = new(MockMailer)
+	s.keyRing = utils.NewHMACKeyRing([]byte("secret"))
+	s.config = config.Default()
+	s.userService = NewUserServiceImpl(
+		s.mockUserRepository,
+		s.mockRefreshTokenRepository,
+		s.mockRevokedTokenRepository,
+		s.mockPasswordResetTokenRepository,
+		s.mockTwoFactorRepository,
+		s.loginAttemptRepository,
+		s.keyRing,
+		s.mockMailer,
+		&utils.BcryptHasher{Cost: bcrypt.MinCost},
+		validation.NewPasswordChecker(s.config.Password, validation.BundledBreachedList()),
+		s.config,
+	)
 	s.ctx = context.Background()
 }
 
 func (s *TestSuiteUserServices) TearDownTest() {
 	s.mockUserRepository = nil
+	s.mockRefreshTokenRepository = nil
+	s.mockRevokedTokenRepository = nil
+	s.mockPasswordResetTokenRepository = nil
+	s.mockTwoFactorRepository = nil
+	s.loginAttemptRepository = nil
+	s.mockMailer = nil
+	s.keyRing = nil
 	s.userService = nil
 	s.ctx = nil
 }
 
 func (s *TestSuiteUserServices) TestFindAll() {
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	users := entity.Users{
+		{Model: gorm.Model{ID: 1, CreatedAt: createdAt}, Email: "123@123.com", Password: "123"},
+		{Model: gorm.Model{ID: 2, CreatedAt: createdAt}, Email: "456@456.com", Password: "456"},
+		{Model: gorm.Model{ID: 3, CreatedAt: createdAt}, Email: "789@789.com", Password: "789"},
+	}
+
 	for _, tt := range []struct {
 		Name           string
+		Query          dto.UserListQuery
 		FunctionReturn entity.Users
 		FunctionError  error
-		ExpectedReturn dto.UsersResponse
+		ExpectedFilter repository.UserFilter
+		ExpectedReturn *dto.UsersPage
+		ExpectedCursor bool
 		ExpectedErr    error
 	}{
 		{
-			Name: "Success",
-			FunctionReturn: entity.Users{
-				entity.User{
-					Email:    "123@123.com",
-					Password: "123",
-				},
-				entity.User{
-					Email:    "456@456.com",
-					Password: "456",
+			Name:           "Last page",
+			Query:          dto.UserListQuery{},
+			FunctionReturn: users[:2],
+			ExpectedFilter: repository.UserFilter{SortField: "id", Limit: 21},
+			ExpectedReturn: &dto.UsersPage{
+				Users: dto.UsersResponse{
+					{ID: 1, Email: "123@123.com"},
+					{ID: 2, Email: "456@456.com"},
 				},
+				Meta: dto.PageMeta{Total: 3, Limit: 20},
 			},
-			FunctionError: nil,
-			ExpectedReturn: dto.UsersResponse{
-				dto.UserResponse{
-					Email: "123@123.com",
-				},
-				dto.UserResponse{
-					Email: "456@456.com",
+		},
+		{
+			Name:           "More users after the page",
+			Query:          dto.UserListQuery{Limit: 2, Sort: "-created_at", Email: " 123 "},
+			FunctionReturn: users,
+			ExpectedFilter: repository.UserFilter{Email: "123", SortField: "created_at", SortDesc: true, Limit: 3},
+			ExpectedReturn: &dto.UsersPage{
+				Users: dto.UsersResponse{
+					{ID: 1, Email: "123@123.com"},
+					{ID: 2, Email: "456@456.com"},
 				},
+				Meta: dto.PageMeta{Total: 3, Limit: 2},
 			},
-			ExpectedErr: nil,
+			ExpectedCursor: true,
+		},
+		{
+			Name:           "Offset and created range",
+			Query:          dto.UserListQuery{Offset: 2, CreatedFrom: "2024-01-01T00:00:00Z", CreatedTo: "2024-02-01T00:00:00+07:00"},
+			FunctionReturn: entity.Users{},
+			ExpectedFilter: repository.UserFilter{
+				SortField:   "id",
+				Offset:      2,
+				Limit:       21,
+				CreatedFrom: timePtr(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)),
+				CreatedTo:   timePtr(time.Date(2024, 2, 1, 0, 0, 0, 0, time.FixedZone("", 7*60*60))),
+			},
+			ExpectedReturn: &dto.UsersPage{
+				Users: dto.UsersResponse{},
+				Meta:  dto.PageMeta{Total: 3, Limit: 20, Offset: 2},
+			},
+		},
+		{
+			Name:           "Limit is capped",
+			Query:          dto.UserListQuery{Limit: 1000},
+			FunctionReturn: entity.Users{},
+			ExpectedFilter: repository.UserFilter{SortField: "id", Limit: 101},
+			ExpectedReturn: &dto.UsersPage{
+				Users: dto.UsersResponse{},
+				Meta:  dto.PageMeta{Total: 3, Limit: 100},
+			},
+		},
+		{
+			Name:        "Sort field not whitelisted",
+			Query:       dto.UserListQuery{Sort: "password"},
+			ExpectedErr: ErrInvalidSort,
+		},
+		{
+			Name:        "Negative limit",
+			Query:       dto.UserListQuery{Limit: -1},
+			ExpectedErr: ErrInvalidPagination,
+		},
+		{
+			Name:        "Malformed created range",
+			Query:       dto.UserListQuery{CreatedFrom: "yesterday"},
+			ExpectedErr: ErrInvalidFilter,
+		},
+		{
+			Name:        "Malformed cursor",
+			Query:       dto.UserListQuery{Cursor: "not a cursor"},
+			ExpectedErr: ErrInvalidCursor,
+		},
+		{
+			Name:        "Cursor combined with offset",
+			Query:       dto.UserListQuery{Cursor: "eyJzIjoiaWQiLCJpZCI6MX0", Offset: 1},
+			ExpectedErr: ErrInvalidPagination,
 		},
 		{
 			Name:           "Generic Error from Repository",
 			FunctionReturn: entity.Users{},
+			ExpectedFilter: repository.UserFilter{SortField: "id", Limit: 21},
 			FunctionError:  errors.New("Generic Error"),
-			ExpectedReturn: nil,
 			ExpectedErr:    errors.New("Generic Error"),
 		},
 	} {
 		s.SetupTest()
 		s.Run(tt.Name, func() {
-			s.mockUserRepository.On("FindAll").Return(tt.FunctionReturn, tt.FunctionError)
-			result, err := s.userService.FindAll(s.ctx)
-			s.Equal(tt.ExpectedReturn, result)
+			s.mockUserRepository.On("FindAll", tt.ExpectedFilter).Return(tt.FunctionReturn, int64(3), tt.FunctionError)
+
+			result, err := s.userService.FindAll(tt.Query, s.ctx)
 			s.Equal(tt.ExpectedErr, err)
+
+			if tt.ExpectedErr != nil {
+				s.Nil(result)
+				return
+			}
+
+			if tt.ExpectedCursor {
+				s.NotNil(result.Meta.NextCursor)
+				result.Meta.NextCursor = nil
+			}
+			s.Equal(tt.ExpectedReturn, result)
+		})
+		s.TearDownTest()
+	}
+}
+
+func (s *TestSuiteUserServices) TestFindAllWithCursor() {
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 6000000, time.UTC)
+
+	for _, sort := range []string{"id", "-id", "email", "created_at", "-created_at"} {
+		s.SetupTest()
+		s.Run(sort, func() {
+			s.mockUserRepository.On("FindAll", mock.Anything).Return(entity.Users{
+				{Model: gorm.Model{ID: 1, CreatedAt: createdAt}, Email: "123@123.com"},
+				{Model: gorm.Model{ID: 2, CreatedAt: createdAt}, Email: "456@456.com"},
+			}, int64(5), nil).Once()
+
+			page, err := s.userService.FindAll(dto.UserListQuery{Limit: 1, Sort: sort}, s.ctx)
+			s.NoError(err)
+			s.Require().NotNil(page.Meta.NextCursor)
+
+			s.mockUserRepository.On("FindAll", mock.Anything).Return(entity.Users{}, int64(5), nil).Once()
+
+			_, err = s.userService.FindAll(dto.UserListQuery{Limit: 1, Cursor: *page.Meta.NextCursor}, s.ctx)
+			s.NoError(err)
+
+			field, desc := parseUserSort(sort)
+			expected := &repository.UserCursor{ID: 1}
+			switch field {
+			case "email":
+				expected.Value = "123@123.com"
+			case "created_at":
+				expected.Value = createdAt
+			}
+
+			s.mockUserRepository.AssertCalled(s.T(), "FindAll", repository.UserFilter{
+				SortField: field,
+				SortDesc:  desc,
+				After:     expected,
+				Limit:     2,
+			})
+
+			_, err = s.userService.FindAll(dto.UserListQuery{Sort: "email,", Cursor: *page.Meta.NextCursor}, s.ctx)
+			s.Equal(ErrInvalidCursor, err)
 		})
 		s.TearDownTest()
 	}
 }
 
+// strongPassword passes every check of the default password policy.
+const strongPassword = "Correct-horse-battery-1"
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
 func (s *TestSuiteUserServices) TestCreateUser() {
 	for _, tt := range []struct {
-		Name          string
-		FunctionError error
-		UserRequest   dto.UserRequest
-		ExpectedErr   error
+		Name                 string
+		HideExistingAccounts bool
+		FunctionError        error
+		UserRequest          dto.UserRequest
+		ExpectedErr          error
+		ExpectedMail         string
 	}{
 		{
 			Name:          "Success",
 			FunctionError: nil,
 			UserRequest: dto.UserRequest{
 				Email:    "123@13.com",
-				Password: "123",
+				Password: strongPassword,
 			},
 			ExpectedErr: nil,
 		},
 		{
 			Name:          "User email already exists",
 			FunctionError: repository.ErrEmailAlreadyExist,
-			UserRequest:   dto.UserRequest{},
+			UserRequest:   dto.UserRequest{Password: strongPassword},
 			ExpectedErr:   ErrUserExists,
 		},
 		{
 			Name:          "Generic Error from Repository",
 			FunctionError: errors.New("Generic Error"),
-			UserRequest:   dto.UserRequest{},
+			UserRequest:   dto.UserRequest{Password: strongPassword},
 			ExpectedErr:   errors.New("Generic Error"),
 		},
+		{
+			Name: "Weak password",
+			UserRequest: dto.UserRequest{
+				Email:    "123@13.com",
+				Password: "123",
+			},
+			ExpectedErr: apperror.Validation(
+				apperror.FieldError{Field: "password", Rule: "email", Message: "must not contain your email address"},
+				apperror.FieldError{Field: "password", Rule: "entropy", Message: "is too easy to guess, use a longer password"},
+			),
+		},
+		{
+			Name:                 "User email already exists with existing accounts hidden",
+			HideExistingAccounts: true,
+			FunctionError:        repository.ErrEmailAlreadyExist,
+			UserRequest: dto.UserRequest{
+				Email:    "123@13.com",
+				Password: strongPassword,
+			},
+			ExpectedErr:  nil,
+			ExpectedMail: "/password/forgot",
+		},
 	} {
 		s.SetupTest()
 		s.Run(tt.Name, func() {
+			s.config.Auth.HideExistingAccounts = tt.HideExistingAccounts
 			s.mockUserRepository.On("CreateUser", mock.Anything).Return(tt.FunctionError)
+			s.mockMailer.On("Send", mock.Anything).Return(nil)
+			signups := testutil.ToFloat64(metrics.RegistrationsTotal.WithLabelValues("signup"))
+
 			err := s.userService.CreateUser(tt.UserRequest, s.ctx)
 			s.Equal(tt.ExpectedErr, err)
+
+			counted := testutil.ToFloat64(metrics.RegistrationsTotal.WithLabelValues("signup")) - signups
+			if tt.ExpectedErr == nil && tt.FunctionError == nil {
+				s.Equal(float64(1), counted)
+			} else {
+				s.Zero(counted)
+			}
+
+			if tt.ExpectedErr == nil {
+				if tt.ExpectedMail == "" {
+					tt.ExpectedMail = "/users/verify?token="
+				}
+				s.mockMailer.AssertCalled(s.T(), "Send", mock.MatchedBy(func(m mailer.Message) bool {
+					return m.To == tt.UserRequest.Email && strings.Contains(m.Body, tt.ExpectedMail)
+				}))
+			} else {
+				s.mockMailer.AssertNotCalled(s.T(), "Send", mock.Anything)
+			}
+		})
+		s.TearDownTest()
+	}
+}
+
+func (s *TestSuiteUserServices) TestProvisionUser() {
+	for _, tt := range []struct {
+		Name           string
+		FunctionError  error
+		ExpectedReturn *dto.UserResponse
+		ExpectedErr    error
+	}{
+		{
+			Name:           "Success",
+			ExpectedReturn: &dto.UserResponse{ID: 1, Email: "123@123.com"},
+		},
+		{
+			Name:          "User email already exists",
+			FunctionError: repository.ErrEmailAlreadyExist,
+			ExpectedErr:   ErrUserExists,
+		},
+		{
+			Name:          "Generic Error from Repository",
+			FunctionError: errors.New("Generic Error"),
+			ExpectedErr:   errors.New("Generic Error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.mockUserRepository.On("CreateUser", mock.MatchedBy(func(u *entity.User) bool {
+				return u.Email == "123@123.com" && u.VerifiedAt != nil &&
+					bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(strongPassword)) == nil
+			})).Run(func(args mock.Arguments) {
+				args.Get(0).(*entity.User).ID = 1
+			}).Return(tt.FunctionError)
+
+			provisioned := testutil.ToFloat64(metrics.RegistrationsTotal.WithLabelValues("provisioned"))
+
+			result, err := s.userService.ProvisionUser(dto.UserRequest{Email: "123@123.com", Password: strongPassword}, s.ctx)
+			s.Equal(tt.ExpectedErr, err)
+			s.Equal(tt.ExpectedReturn, result)
+			if tt.ExpectedErr == nil {
+				s.Equal(provisioned+1, testutil.ToFloat64(metrics.RegistrationsTotal.WithLabelValues("provisioned")))
+			} else {
+				s.Equal(provisioned, testutil.ToFloat64(metrics.RegistrationsTotal.WithLabelValues("provisioned")))
+			}
+			s.mockMailer.AssertNotCalled(s.T(), "Send", mock.Anything)
+		})
+		s.TearDownTest()
+	}
+}
+
+func (s *TestSuiteUserServices) TestSetPassword() {
+	for _, tt := range []struct {
+		Name          string
+		FindError     error
+		UpdateError   error
+		ExpectedErr   error
+		ExpectRevoked bool
+	}{
+		{
+			Name:          "Success",
+			ExpectRevoked: true,
+		},
+		{
+			Name:        "User not found",
+			FindError:   gorm.ErrRecordNotFound,
+			ExpectedErr: ErrUserNotFound,
+		},
+		{
+			Name:        "Generic Error from Repository",
+			UpdateError: errors.New("Generic Error"),
+			ExpectedErr: errors.New("Generic Error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.mockUserRepository.On("FindByEmail", "123@123.com").Return(&entity.User{Model: gorm.Model{ID: 1}, Email: "123@123.com"}, tt.FindError)
+			s.mockUserRepository.On("UpdatePassword", uint(1), mock.MatchedBy(func(password string) bool {
+				return bcrypt.CompareHashAndPassword([]byte(password), []byte(strongPassword)) == nil
+			})).Return(tt.UpdateError)
+			s.mockRevokedTokenRepository.On("CreateRevokedToken", mock.Anything).Return(nil)
+			s.mockRefreshTokenRepository.On("RevokeByUserID", uint(1)).Return(nil)
+
+			err := s.userService.SetPassword(dto.UserRequest{Email: "123@123.com", Password: strongPassword}, s.ctx)
+			s.Equal(tt.ExpectedErr, err)
+
+			if tt.ExpectRevoked {
+				s.mockRefreshTokenRepository.AssertCalled(s.T(), "RevokeByUserID", uint(1))
+			} else {
+				s.mockRefreshTokenRepository.AssertNotCalled(s.T(), "RevokeByUserID", mock.Anything)
+			}
 		})
 		s.TearDownTest()
 	}
 }
 
 func (s *TestSuiteUserServices) TestLogin() {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("123"), bcrypt.MinCost)
+	s.NoError(err)
+	verifiedAt := time.Now()
+
 	for _, tt := range []struct {
 		Name           string
 		FunctionReturn *entity.User
 		FunctionError  error
+		CreateError    error
+		RequireVerify  bool
+		TwoFactor      *entity.TwoFactor
 		UserRequest    dto.UserRequest
+		ExpectedToken  bool
+		ExpectedMFA    bool
 		ExpectedErr    error
+		ExpectedResult string
 	}{
 		{
 			Name: "Success",
 			FunctionReturn: &entity.User{
 				Email:    "123@123.com",
-				Password: "123",
+				Password: string(hashedPassword),
 			},
 			FunctionError: nil,
 			UserRequest: dto.UserRequest{
 				Email:    "123@123.com",
 				Password: "123",
 			},
-			ExpectedErr: nil,
+			ExpectedToken:  true,
+			ExpectedErr:    nil,
+			ExpectedResult: metrics.LoginSuccess,
+		},
+		{
+			Name: "Success with roles",
+			FunctionReturn: &entity.User{
+				Email:    "123@123.com",
+				Password: string(hashedPassword),
+				Roles:    []entity.Role{{Name: "admin"}, {Name: "support"}},
+			},
+			UserRequest: dto.UserRequest{
+				Email:    "123@123.com",
+				Password: "123",
+			},
+			ExpectedToken:  true,
+			ExpectedResult: metrics.LoginSuccess,
+		},
+		{
+			Name: "Wrong password",
+			FunctionReturn: &entity.User{
+				Email:    "123@123.com",
+				Password: string(hashedPassword),
+			},
+			UserRequest: dto.UserRequest{
+				Email:    "123@123.com",
+				Password: "456",
+			},
+			ExpectedErr:    ErrInvalidCredentials,
+			ExpectedResult: metrics.LoginInvalidCredentials,
 		},
 		{
 			Name:           "User not found",
 			FunctionReturn: nil,
 			FunctionError:  gorm.ErrRecordNotFound,
 			UserRequest:    dto.UserRequest{},
+			ExpectedErr:    ErrInvalidCredentials,
+			ExpectedResult: metrics.LoginInvalidCredentials,
+		},
+		{
+			Name: "Unverified user when verification is required",
+			FunctionReturn: &entity.User{
+				Email:    "123@123.com",
+				Password: string(hashedPassword),
+			},
+			RequireVerify: true,
+			UserRequest: dto.UserRequest{
+				Email:    "123@123.com",
+				Password: "123",
+			},
+			ExpectedErr:    ErrEmailNotVerified,
+			ExpectedResult: metrics.LoginUnverified,
+		},
+		{
+			Name: "Verified user when verification is required",
+			FunctionReturn: &entity.User{
+				Email:      "123@123.com",
+				Password:   string(hashedPassword),
+				VerifiedAt: &verifiedAt,
+			},
+			RequireVerify: true,
+			UserRequest: dto.UserRequest{
+				Email:    "123@123.com",
+				Password: "123",
+			},
+			ExpectedToken:  true,
+			ExpectedResult: metrics.LoginSuccess,
 		},
 		{
 			Name:           "Generic Error from Repository",
@@ -174,12 +694,1562 @@ func (s *TestSuiteUserServices) TestLogin() {
 			UserRequest:    dto.UserRequest{},
 			ExpectedErr:    errors.New("Generic Error"),
 		},
-	} {
-		s.SetupTest()
-		s.Run(tt.Name, func() {
-			s.mockUserRepository.On("FindByEmail", mock.Anything).Return(tt.FunctionReturn, tt.FunctionError)
-			_, err := s.userService.Login(tt.UserRequest, s.ctx)
-			s.Equal(tt.ExpectedErr, err)
+		{
+			Name: "Two-factor authentication enabled",
+			FunctionReturn: &entity.User{
+				Model:    gorm.Model{ID: 1},
+				Email:    "123@123.com",
+				Password: string(hashedPassword),
+			},
+			TwoFactor: &entity.TwoFactor{UserID: 1, EnabledAt: &verifiedAt},
+			UserRequest: dto.UserRequest{
+				Email:    "123@123.com",
+				Password: "123",
+			},
+			ExpectedMFA:    true,
+			ExpectedResult: metrics.LoginMFARequired,
+		},
+		{
+			Name: "Pending two-factor enrollment is ignored",
+			FunctionReturn: &entity.User{
+				Model:    gorm.Model{ID: 1},
+				Email:    "123@123.com",
+				Password: string(hashedPassword),
+			},
+			TwoFactor: &entity.TwoFactor{UserID: 1},
+			UserRequest: dto.UserRequest{
+				Email:    "123@123.com",
+				Password: "123",
+			},
+			ExpectedToken:  true,
+			ExpectedResult: metrics.LoginSuccess,
+		},
+		{
+			Name: "Error storing refresh token",
+			FunctionReturn: &entity.User{
+				Email:    "123@123.com",
+				Password: string(hashedPassword),
+			},
+			CreateError: errors.New("Generic Error"),
+			UserRequest: dto.UserRequest{
+				Email:    "123@123.com",
+				Password: "123",
+			},
+			ExpectedErr: errors.New("Generic Error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.mockUserRepository.On("FindByEmail", mock.Anything).Return(tt.FunctionReturn, tt.FunctionError)
+			s.mockRefreshTokenRepository.On("CreateRefreshToken", mock.Anything).Return(tt.CreateError)
+			if tt.TwoFactor != nil {
+				s.mockTwoFactorRepository.On("FindByUserID", mock.Anything).Return(tt.TwoFactor, nil)
+			} else {
+				s.mockTwoFactorRepository.On("FindByUserID", mock.Anything).Return((*entity.TwoFactor)(nil), gorm.ErrRecordNotFound)
+			}
+			s.config.Verification.Required = tt.RequireVerify
+			logins := map[string]float64{}
+			for _, result := range []string{metrics.LoginSuccess, metrics.LoginInvalidCredentials, metrics.LoginUnverified, metrics.LoginMFARequired} {
+				logins[result] = testutil.ToFloat64(metrics.LoginsTotal.WithLabelValues(result))
+			}
+			tokens := map[string]float64{}
+			for _, kind := range []string{metrics.TokenAccess, metrics.TokenRefresh, metrics.TokenMFA} {
+				tokens[kind] = testutil.ToFloat64(metrics.TokensIssuedTotal.WithLabelValues(kind))
+			}
+
+			token, err := s.userService.Login(tt.UserRequest, s.ctx)
+			s.Equal(tt.ExpectedErr, err)
+			for result, before := range logins {
+				counted := testutil.ToFloat64(metrics.LoginsTotal.WithLabelValues(result)) - before
+				if result == tt.ExpectedResult {
+					s.Equal(float64(1), counted, result)
+				} else {
+					s.Zero(counted, result)
+				}
+			}
+			expectedTokens := map[string]float64{
+				metrics.TokenAccess:  0,
+				metrics.TokenRefresh: 0,
+				metrics.TokenMFA:     0,
+			}
+			if tt.ExpectedMFA {
+				expectedTokens[metrics.TokenMFA] = 1
+			} else if tt.ExpectedToken {
+				expectedTokens[metrics.TokenAccess] = 1
+				expectedTokens[metrics.TokenRefresh] = 1
+			}
+			for kind, before := range tokens {
+				s.Equal(expectedTokens[kind], testutil.ToFloat64(metrics.TokensIssuedTotal.WithLabelValues(kind))-before, kind)
+			}
+			if tt.ExpectedMFA {
+				s.Empty(token.AccessToken)
+				s.Empty(token.RefreshToken)
+				claims, err := utils.ParseTokenWithPurpose(s.keyRing, token.MFAToken, utils.PurposeMFAPending)
+				s.NoError(err)
+				s.Equal(uint(1), claims.UserID)
+
+				_, err = utils.ParseToken(s.keyRing, token.MFAToken)
+				s.Error(err)
+			} else if tt.ExpectedToken {
+				claims, err := utils.ParseToken(s.keyRing, token.AccessToken)
+				s.NoError(err)
+				s.NotEmpty(claims.ID)
+				s.NotEmpty(claims.SessionID)
+				s.NotEmpty(token.RefreshToken)
+
+				var roles []string
+				for _, role := range tt.FunctionReturn.Roles {
+					roles = append(roles, role.Name)
+				}
+				s.Equal(roles, claims.Roles)
+			} else {
+				s.Nil(token)
+			}
+		})
+		s.TearDownTest()
+	}
+}
+
+func (s *TestSuiteUserServices) TestLoginLockout() {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("123"), bcrypt.MinCost)
+	s.NoError(err)
+	registered := &entity.User{Model: gorm.Model{ID: 1}, Email: "123@123.com", Password: string(hashedPassword)}
+
+	for _, tt := range []struct {
+		Name string
+		User *entity.User
+	}{
+		{Name: "Registered email", User: registered},
+		{Name: "Unknown email"},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.config.Lockout.DelayAfter = 2
+			s.config.Lockout.AccountFailures = 3
+			if tt.User != nil {
+				s.mockUserRepository.On("FindByEmail", "123@123.com").Return(tt.User, nil)
+			} else {
+				s.mockUserRepository.On("FindByEmail", "123@123.com").Return((*entity.User)(nil), gorm.ErrRecordNotFound)
+			}
+			wrongPassword := dto.UserRequest{Email: "123@123.com", Password: "456"}
+			ctx := WithClientIP(s.ctx, "192.0.2.1")
+			throttled := testutil.ToFloat64(metrics.LoginsTotal.WithLabelValues(metrics.LoginThrottled))
+
+			_, err := s.userService.Login(wrongPassword, ctx)
+			s.Equal(ErrInvalidCredentials, err)
+
+			// The second failure delays the next attempt.
+			_, err = s.userService.Login(wrongPassword, ctx)
+			s.Equal(ErrInvalidCredentials, err)
+			_, err = s.userService.Login(wrongPassword, ctx)
+			s.Equal(ErrTooManyLoginAttempts, err)
+
+			// The third failure, once the delay is over, locks the account.
+			s.NoError(s.loginAttemptRepository.Block("email:123@123.com", time.Now(), s.ctx))
+			_, err = s.userService.Login(wrongPassword, ctx)
+			s.Equal(ErrInvalidCredentials, err)
+
+			attempts, err := s.loginAttemptRepository.FindByKeys([]string{"email:123@123.com", "ip:192.0.2.1"}, s.ctx)
+			s.NoError(err)
+			s.Require().Len(attempts, 2)
+			s.Equal(3, attempts[0].Failures)
+			s.Require().NotNil(attempts[0].BlockedUntil)
+			s.WithinDuration(time.Now().Add(s.config.Lockout.Duration), *attempts[0].BlockedUntil, time.Minute)
+			s.Equal(3, attempts[1].Failures)
+			s.Nil(attempts[1].BlockedUntil)
+
+			// Locked accounts are refused even with the right password.
+			_, err = s.userService.Login(dto.UserRequest{Email: "123@123.com", Password: "123"}, ctx)
+			s.Equal(ErrTooManyLoginAttempts, err)
+			s.Equal(throttled+2, testutil.ToFloat64(metrics.LoginsTotal.WithLabelValues(metrics.LoginThrottled)))
+		})
+		s.TearDownTest()
+	}
+}
+
+func (s *TestSuiteUserServices) TestLoginResetsAttempts() {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("123"), bcrypt.MinCost)
+	s.NoError(err)
+
+	s.SetupTest()
+	s.mockUserRepository.On("FindByEmail", "123@123.com").Return(&entity.User{Model: gorm.Model{ID: 1}, Email: "123@123.com", Password: string(hashedPassword)}, nil)
+	s.mockTwoFactorRepository.On("FindByUserID", uint(1)).Return((*entity.TwoFactor)(nil), gorm.ErrRecordNotFound)
+	s.mockRefreshTokenRepository.On("CreateRefreshToken", mock.Anything).Return(nil)
+	ctx := WithClientIP(s.ctx, "192.0.2.1")
+
+	_, err = s.userService.Login(dto.UserRequest{Email: "123@123.com", Password: "456"}, ctx)
+	s.Equal(ErrInvalidCredentials, err)
+
+	_, err = s.userService.Login(dto.UserRequest{Email: "123@123.com", Password: "123"}, ctx)
+	s.NoError(err)
+
+	attempts, err := s.loginAttemptRepository.FindByKeys([]string{"email:123@123.com", "ip:192.0.2.1"}, s.ctx)
+	s.NoError(err)
+	s.Len(attempts, 1, "failures of the client IP are kept")
+	s.Equal("ip:192.0.2.1", attempts[0].Key)
+	s.Equal(1, attempts[0].Failures)
+	s.TearDownTest()
+}
+
+func (s *TestSuiteUserServices) TestLoginBlocksClientIPDespiteSuccessfulLogins() {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("123"), bcrypt.MinCost)
+	s.NoError(err)
+
+	s.SetupTest()
+	s.config.Lockout.IPFailures = 3
+	s.mockUserRepository.On("FindByEmail", "own@123.com").Return(&entity.User{Model: gorm.Model{ID: 1}, Email: "own@123.com", Password: string(hashedPassword)}, nil)
+	s.mockUserRepository.On("FindByEmail", mock.Anything).Return((*entity.User)(nil), gorm.ErrRecordNotFound)
+	s.mockTwoFactorRepository.On("FindByUserID", uint(1)).Return((*entity.TwoFactor)(nil), gorm.ErrRecordNotFound)
+	s.mockRefreshTokenRepository.On("CreateRefreshToken", mock.Anything).Return(nil)
+	ctx := WithClientIP(s.ctx, "192.0.2.1")
+
+	for _, email := range []string{"1@123.com", "2@123.com", "3@123.com"} {
+		_, err = s.userService.Login(dto.UserRequest{Email: email, Password: "456"}, ctx)
+		s.Equal(ErrInvalidCredentials, err)
+
+		_, err = s.userService.Login(dto.UserRequest{Email: "own@123.com", Password: "123"}, ctx)
+		if email != "3@123.com" {
+			s.NoError(err)
+		}
+	}
+
+	s.Equal(ErrTooManyLoginAttempts, err)
+	s.TearDownTest()
+}
+
+func (s *TestSuiteUserServices) TestLoginBlocksClientIP() {
+	s.SetupTest()
+	s.config.Lockout.IPFailures = 3
+	s.mockUserRepository.On("FindByEmail", mock.Anything).Return((*entity.User)(nil), gorm.ErrRecordNotFound)
+	ctx := WithClientIP(s.ctx, "192.0.2.1")
+
+	for _, email := range []string{"1@123.com", "2@123.com", "3@123.com"} {
+		_, err := s.userService.Login(dto.UserRequest{Email: email, Password: "456"}, ctx)
+		s.Equal(ErrInvalidCredentials, err)
+	}
+
+	_, err := s.userService.Login(dto.UserRequest{Email: "4@123.com", Password: "456"}, ctx)
+	s.Equal(ErrTooManyLoginAttempts, err)
+
+	_, err = s.userService.Login(dto.UserRequest{Email: "4@123.com", Password: "456"}, WithClientIP(s.ctx, "192.0.2.2"))
+	s.Equal(ErrInvalidCredentials, err)
+	s.TearDownTest()
+}
+
+func (s *TestSuiteUserServices) TestDummyPasswordHash() {
+	legacyHash, err := bcrypt.GenerateFromPassword([]byte("123"), bcrypt.DefaultCost)
+	s.Require().NoError(err)
+
+	for _, tt := range []struct {
+		Name         string
+		Hasher       utils.PasswordHasher
+		ExpectedCost int
+	}{
+		{Name: "Current hashes cheaper than legacy ones", Hasher: &utils.BcryptHasher{Cost: bcrypt.MinCost}, ExpectedCost: bcrypt.DefaultCost},
+		{Name: "Current hashes costlier than legacy ones", Hasher: &utils.BcryptHasher{Cost: bcrypt.DefaultCost + 1}, ExpectedCost: bcrypt.DefaultCost + 1},
+	} {
+		s.Run(tt.Name, func() {
+			dummy := (&dummyHash{hasher: tt.Hasher}).get()
+
+			cost, err := bcrypt.Cost([]byte(dummy))
+			s.NoError(err)
+			s.Equal(tt.ExpectedCost, cost)
+
+			// Unknown emails cost at least as much as accounts still holding
+			// a legacy hash, give or take the noise of the measure.
+			start := time.Now()
+			tt.Hasher.Verify(dummy, "123")
+			dummyTime := time.Since(start)
+
+			start = time.Now()
+			tt.Hasher.Verify(string(legacyHash), "456")
+			legacyTime := time.Since(start)
+
+			s.Greater(dummyTime, legacyTime/2)
+		})
+	}
+
+	s.SetupTest()
+	s.mockUserRepository.On("FindByEmail", "123@123.com").Return((*entity.User)(nil), gorm.ErrRecordNotFound)
+	_, err = s.userService.Login(dto.UserRequest{Email: "123@123.com", Password: "123"}, s.ctx)
+	s.Equal(ErrInvalidCredentials, err)
+
+	cost, err := bcrypt.Cost([]byte(s.userService.(*UserServiceImpl).dummyHash.hash))
+	s.NoError(err)
+	s.Equal(bcrypt.DefaultCost, cost, "logins with an unknown email are compared against the slowest hash")
+	s.TearDownTest()
+}
+
+func (s *TestSuiteUserServices) TestLoginRehashesOutdatedPassword() {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("123"), bcrypt.MinCost)
+	s.NoError(err)
+
+	for _, tt := range []struct {
+		Name          string
+		Hasher        utils.PasswordHasher
+		UpdateError   error
+		ExpectedHash  string
+		ExpectRehash  bool
+		ExpectedToken bool
+	}{
+		{
+			Name:          "Current hash is kept",
+			Hasher:        &utils.BcryptHasher{Cost: bcrypt.MinCost},
+			ExpectedToken: true,
+		},
+		{
+			Name:          "Hash of another algorithm",
+			Hasher:        &utils.Argon2idHasher{Memory: 64, Iterations: 1, Parallelism: 1},
+			ExpectedHash:  "$argon2id$v=19$m=64,t=1,p=1$",
+			ExpectRehash:  true,
+			ExpectedToken: true,
+		},
+		{
+			Name:          "Hash with another cost",
+			Hasher:        &utils.BcryptHasher{Cost: bcrypt.MinCost + 1},
+			ExpectedHash:  "$2a$05$",
+			ExpectRehash:  true,
+			ExpectedToken: true,
+		},
+		{
+			Name:          "Login goes on when the hash can not be saved",
+			Hasher:        &utils.Argon2idHasher{Memory: 64, Iterations: 1, Parallelism: 1},
+			UpdateError:   errors.New("Generic Error"),
+			ExpectedHash:  "$argon2id$",
+			ExpectRehash:  true,
+			ExpectedToken: true,
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.userService = NewUserServiceImpl(
+				s.mockUserRepository,
+				s.mockRefreshTokenRepository,
+				s.mockRevokedTokenRepository,
+				s.mockPasswordResetTokenRepository,
+				s.mockTwoFactorRepository,
+				s.loginAttemptRepository,
+				s.keyRing,
+				s.mockMailer,
+				tt.Hasher,
+				validation.NewPasswordChecker(s.config.Password, validation.BundledBreachedList()),
+				s.config,
+			)
+			s.mockUserRepository.On("FindByEmail", mock.Anything).Return(&entity.User{
+				Model:    gorm.Model{ID: 1},
+				Email:    "123@123.com",
+				Password: string(hashedPassword),
+			}, nil)
+			s.mockUserRepository.On("UpdatePassword", uint(1), mock.Anything).Return(tt.UpdateError)
+			s.mockTwoFactorRepository.On("FindByUserID", mock.Anything).Return((*entity.TwoFactor)(nil), gorm.ErrRecordNotFound)
+			s.mockRefreshTokenRepository.On("CreateRefreshToken", mock.Anything).Return(nil)
+
+			token, err := s.userService.Login(dto.UserRequest{Email: "123@123.com", Password: "123"}, s.ctx)
+			s.NoError(err)
+			s.Equal(tt.ExpectedToken, token != nil)
+
+			if tt.ExpectRehash {
+				s.mockUserRepository.AssertCalled(s.T(), "UpdatePassword", uint(1), mock.MatchedBy(func(hash string) bool {
+					_, err := tt.Hasher.Verify(hash, "123")
+					return strings.HasPrefix(hash, tt.ExpectedHash) && err == nil
+				}))
+			} else {
+				s.mockUserRepository.AssertNotCalled(s.T(), "UpdatePassword", mock.Anything, mock.Anything)
+			}
+		})
+		s.TearDownTest()
+	}
+}
+
+func (s *TestSuiteUserServices) TestBlockDuration() {
+	s.SetupTest()
+	s.config.Lockout.DelayAfter = 3
+	s.config.Lockout.Delay = time.Second
+	s.config.Lockout.MaxDelay = 5 * time.Second
+	s.config.Lockout.AccountFailures = 10
+	s.config.Lockout.IPFailures = 20
+	s.config.Lockout.Duration = time.Hour
+	userService := s.userService.(*UserServiceImpl)
+
+	for _, tt := range []struct {
+		Key      string
+		Failures int
+		Expected time.Duration
+	}{
+		{Key: "email:123@123.com", Failures: 2, Expected: 0},
+		{Key: "email:123@123.com", Failures: 3, Expected: time.Second},
+		{Key: "email:123@123.com", Failures: 4, Expected: 2 * time.Second},
+		{Key: "email:123@123.com", Failures: 5, Expected: 4 * time.Second},
+		{Key: "email:123@123.com", Failures: 6, Expected: 5 * time.Second},
+		{Key: "email:123@123.com", Failures: 10, Expected: time.Hour},
+		{Key: "ip:192.0.2.1", Failures: 10, Expected: 0},
+		{Key: "ip:192.0.2.1", Failures: 20, Expected: time.Hour},
+	} {
+		s.Equal(tt.Expected, userService.blockDuration(tt.Key, tt.Failures), "%s after %d failures", tt.Key, tt.Failures)
+	}
+	s.TearDownTest()
+}
+
+func (s *TestSuiteUserServices) TestUnlockUser() {
+	for _, tt := range []struct {
+		Name        string
+		FindError   error
+		ExpectedErr error
+	}{
+		{
+			Name: "Success",
+		},
+		{
+			Name:        "User not found",
+			FindError:   gorm.ErrRecordNotFound,
+			ExpectedErr: ErrUserNotFound,
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.mockUserRepository.On("FindByID", uint(1)).Return(&entity.User{Model: gorm.Model{ID: 1}, Email: "Mixed@123.com"}, tt.FindError)
+			_, err := s.loginAttemptRepository.RecordFailure("email:mixed@123.com", time.Now(), time.Hour, s.ctx)
+			s.NoError(err)
+
+			err = s.userService.UnlockUser(1, s.ctx)
+			s.Equal(tt.ExpectedErr, err)
+
+			attempts, err := s.loginAttemptRepository.FindByKeys([]string{"email:mixed@123.com"}, s.ctx)
+			s.NoError(err)
+			if tt.ExpectedErr == nil {
+				s.Empty(attempts)
+			} else {
+				s.Len(attempts, 1)
+			}
+		})
+		s.TearDownTest()
+	}
+}
+
+func (s *TestSuiteUserServices) TestRefreshToken() {
+	usedAt := time.Now().Add(-time.Minute)
+
+	for _, tt := range []struct {
+		Name          string
+		StoredToken   *entity.RefreshToken
+		FindError     error
+		MarkUsedError error
+		User          *entity.User
+		UserError     error
+		ExpectRevoke  bool
+		ExpectedToken bool
+		ExpectedErr   error
+	}{
+		{
+			Name: "Success",
+			StoredToken: &entity.RefreshToken{
+				UserID:    1,
+				FamilyID:  "family",
+				ExpiresAt: time.Now().Add(time.Hour),
+			},
+			User:          &entity.User{Email: "123@123.com"},
+			ExpectedToken: true,
+		},
+		{
+			Name:        "Unknown token",
+			FindError:   gorm.ErrRecordNotFound,
+			ExpectedErr: ErrInvalidRefreshToken,
+		},
+		{
+			Name: "Expired token",
+			StoredToken: &entity.RefreshToken{
+				FamilyID:  "family",
+				ExpiresAt: time.Now().Add(-time.Hour),
+			},
+			ExpectedErr: ErrInvalidRefreshToken,
+		},
+		{
+			Name: "Revoked token",
+			StoredToken: &entity.RefreshToken{
+				FamilyID:  "family",
+				ExpiresAt: time.Now().Add(time.Hour),
+				RevokedAt: &usedAt,
+			},
+			ExpectedErr: ErrInvalidRefreshToken,
+		},
+		{
+			Name: "Reused token revokes family",
+			StoredToken: &entity.RefreshToken{
+				FamilyID:  "family",
+				ExpiresAt: time.Now().Add(time.Hour),
+				UsedAt:    &usedAt,
+			},
+			ExpectRevoke: true,
+			ExpectedErr:  ErrRefreshTokenReused,
+		},
+		{
+			Name: "Concurrent reuse revokes family",
+			StoredToken: &entity.RefreshToken{
+				FamilyID:  "family",
+				ExpiresAt: time.Now().Add(time.Hour),
+			},
+			MarkUsedError: repository.ErrRefreshTokenAlreadyUsed,
+			ExpectRevoke:  true,
+			ExpectedErr:   ErrRefreshTokenReused,
+		},
+		{
+			Name: "User no longer exists",
+			StoredToken: &entity.RefreshToken{
+				FamilyID:  "family",
+				ExpiresAt: time.Now().Add(time.Hour),
+			},
+			UserError:   gorm.ErrRecordNotFound,
+			ExpectedErr: ErrInvalidRefreshToken,
+		},
+		{
+			Name:        "Generic Error from Repository",
+			FindError:   errors.New("Generic Error"),
+			ExpectedErr: errors.New("Generic Error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.mockRefreshTokenRepository.On("FindByTokenHash", mock.Anything).Return(tt.StoredToken, tt.FindError)
+			s.mockRefreshTokenRepository.On("MarkAsUsed", mock.Anything).Return(tt.MarkUsedError)
+			s.mockRefreshTokenRepository.On("RevokeFamily", "family").Return(nil)
+			s.mockRefreshTokenRepository.On("CreateRefreshToken", mock.Anything).Return(nil)
+			s.mockUserRepository.On("FindByID", mock.Anything).Return(tt.User, tt.UserError)
+
+			token, err := s.userService.RefreshToken(dto.RefreshTokenRequest{RefreshToken: "refresh"}, s.ctx)
+			s.Equal(tt.ExpectedErr, err)
+			if tt.ExpectedToken {
+				s.NotEmpty(token.AccessToken)
+				s.NotEmpty(token.RefreshToken)
+				s.mockRefreshTokenRepository.AssertCalled(s.T(), "CreateRefreshToken", mock.MatchedBy(func(t *entity.RefreshToken) bool {
+					return t.FamilyID == "family" && t.TokenHash != ""
+				}))
+			} else {
+				s.Nil(token)
+			}
+
+			if tt.ExpectRevoke {
+				s.mockRefreshTokenRepository.AssertCalled(s.T(), "RevokeFamily", "family")
+			} else {
+				s.mockRefreshTokenRepository.AssertNotCalled(s.T(), "RevokeFamily", "family")
+			}
+		})
+		s.TearDownTest()
+	}
+}
+
+func (s *TestSuiteUserServices) TestLogout() {
+	expiresAt := time.Now().Add(time.Hour)
+
+	for _, tt := range []struct {
+		Name         string
+		Claims       *utils.Claims
+		RevokeError  error
+		FamilyError  error
+		ExpectFamily bool
+		ExpectedErr  error
+	}{
+		{
+			Name: "Success",
+			Claims: &utils.Claims{
+				UserID:    1,
+				SessionID: "family",
+				RegisteredClaims: jwt.RegisteredClaims{
+					ID:        "jti",
+					ExpiresAt: jwt.NewNumericDate(expiresAt),
+				},
+			},
+			ExpectFamily: true,
+		},
+		{
+			Name: "Token without session",
+			Claims: &utils.Claims{
+				UserID: 1,
+				RegisteredClaims: jwt.RegisteredClaims{
+					ID:        "jti",
+					ExpiresAt: jwt.NewNumericDate(expiresAt),
+				},
+			},
+		},
+		{
+			Name: "Error revoking access token",
+			Claims: &utils.Claims{
+				UserID:    1,
+				SessionID: "family",
+				RegisteredClaims: jwt.RegisteredClaims{
+					ID:        "jti",
+					ExpiresAt: jwt.NewNumericDate(expiresAt),
+				},
+			},
+			RevokeError: errors.New("Generic Error"),
+			ExpectedErr: errors.New("Generic Error"),
+		},
+		{
+			Name: "Error revoking refresh tokens",
+			Claims: &utils.Claims{
+				UserID:    1,
+				SessionID: "family",
+				RegisteredClaims: jwt.RegisteredClaims{
+					ID:        "jti",
+					ExpiresAt: jwt.NewNumericDate(expiresAt),
+				},
+			},
+			FamilyError:  errors.New("Generic Error"),
+			ExpectFamily: true,
+			ExpectedErr:  errors.New("Generic Error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.mockRevokedTokenRepository.On("CreateRevokedToken", mock.Anything).Return(tt.RevokeError)
+			s.mockRefreshTokenRepository.On("RevokeFamily", "family").Return(tt.FamilyError)
+
+			err := s.userService.Logout(tt.Claims, s.ctx)
+			s.Equal(tt.ExpectedErr, err)
+
+			if tt.RevokeError == nil {
+				s.mockRevokedTokenRepository.AssertCalled(s.T(), "CreateRevokedToken", &entity.RevokedToken{
+					JTI:       "jti",
+					UserID:    1,
+					ExpiresAt: jwt.NewNumericDate(expiresAt).Time,
+				})
+			}
+
+			if tt.ExpectFamily {
+				s.mockRefreshTokenRepository.AssertCalled(s.T(), "RevokeFamily", "family")
+			} else {
+				s.mockRefreshTokenRepository.AssertNotCalled(s.T(), "RevokeFamily", "family")
+			}
+		})
+		s.TearDownTest()
+	}
+}
+
+func (s *TestSuiteUserServices) TestLogoutAll() {
+	for _, tt := range []struct {
+		Name        string
+		RevokeError error
+		UserError   error
+		ExpectedErr error
+	}{
+		{
+			Name: "Success",
+		},
+		{
+			Name:        "Error revoking access tokens",
+			RevokeError: errors.New("Generic Error"),
+			ExpectedErr: errors.New("Generic Error"),
+		},
+		{
+			Name:        "Error revoking refresh tokens",
+			UserError:   errors.New("Generic Error"),
+			ExpectedErr: errors.New("Generic Error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.mockRevokedTokenRepository.On("CreateRevokedToken", mock.MatchedBy(func(t *entity.RevokedToken) bool {
+				return t.JTI == "" && t.UserID == 1 && t.ExpiresAt.After(time.Now())
+			})).Return(tt.RevokeError)
+			s.mockRefreshTokenRepository.On("RevokeByUserID", uint(1)).Return(tt.UserError)
+
+			err := s.userService.LogoutAll(&utils.Claims{UserID: 1}, s.ctx)
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TearDownTest()
+	}
+}
+
+func (s *TestSuiteUserServices) TestIsTokenRevoked() {
+	issuedAt := time.Now().Add(-time.Minute)
+
+	for _, tt := range []struct {
+		Name           string
+		Claims         *utils.Claims
+		IssuedAt       time.Time
+		FunctionReturn bool
+		FunctionError  error
+		ExpectedReturn bool
+		ExpectedErr    error
+	}{
+		{
+			Name: "Token revoked",
+			Claims: &utils.Claims{
+				UserID: 1,
+				RegisteredClaims: jwt.RegisteredClaims{
+					ID:       "jti",
+					IssuedAt: jwt.NewNumericDate(issuedAt),
+				},
+			},
+			IssuedAt:       jwt.NewNumericDate(issuedAt).Time,
+			FunctionReturn: true,
+			ExpectedReturn: true,
+		},
+		{
+			Name: "Token without issued at",
+			Claims: &utils.Claims{
+				UserID: 1,
+				RegisteredClaims: jwt.RegisteredClaims{
+					ID: "jti",
+				},
+			},
+			IssuedAt: time.Time{},
+		},
+		{
+			Name: "Generic Error from Repository",
+			Claims: &utils.Claims{
+				UserID: 1,
+				RegisteredClaims: jwt.RegisteredClaims{
+					ID: "jti",
+				},
+			},
+			FunctionError: errors.New("Generic Error"),
+			ExpectedErr:   errors.New("Generic Error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.mockRevokedTokenRepository.On("IsRevoked", "jti", uint(1), tt.IssuedAt).Return(tt.FunctionReturn, tt.FunctionError)
+
+			result, err := s.userService.IsTokenRevoked(tt.Claims, s.ctx)
+			s.Equal(tt.ExpectedReturn, result)
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TearDownTest()
+	}
+}
+
+func (s *TestSuiteUserServices) TestPruneRevokedTokens() {
+	s.mockRevokedTokenRepository.On("DeleteExpired").Return(int64(3), nil)
+
+	result, err := s.userService.PruneRevokedTokens(s.ctx)
+	s.Equal(int64(3), result)
+	s.NoError(err)
+}
+
+func (s *TestSuiteUserServices) TestForgotPassword() {
+	for _, tt := range []struct {
+		Name         string
+		User         *entity.User
+		FindError    error
+		RevokeError  error
+		CreateError  error
+		MailError    error
+		ExpectCreate bool
+		ExpectMail   bool
+		ExpectedErr  error
+	}{
+		{
+			Name:         "Success",
+			User:         &entity.User{Model: gorm.Model{ID: 1}, Email: "123@123.com"},
+			ExpectCreate: true,
+			ExpectMail:   true,
+		},
+		{
+			Name:      "Unknown email is ignored",
+			FindError: gorm.ErrRecordNotFound,
+		},
+		{
+			Name:        "Generic Error from Repository",
+			FindError:   errors.New("Generic Error"),
+			ExpectedErr: errors.New("Generic Error"),
+		},
+		{
+			Name:        "Error revoking earlier tokens",
+			User:        &entity.User{Model: gorm.Model{ID: 1}, Email: "123@123.com"},
+			RevokeError: errors.New("Generic Error"),
+			ExpectedErr: errors.New("Generic Error"),
+		},
+		{
+			Name:         "Error storing reset token",
+			User:         &entity.User{Model: gorm.Model{ID: 1}, Email: "123@123.com"},
+			CreateError:  errors.New("Generic Error"),
+			ExpectCreate: true,
+			ExpectedErr:  errors.New("Generic Error"),
+		},
+		{
+			Name:         "Error sending email",
+			User:         &entity.User{Model: gorm.Model{ID: 1}, Email: "123@123.com"},
+			MailError:    errors.New("Generic Error"),
+			ExpectCreate: true,
+			ExpectMail:   true,
+			ExpectedErr:  errors.New("Generic Error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.mockUserRepository.On("FindByEmail", "123@123.com").Return(tt.User, tt.FindError)
+			s.mockPasswordResetTokenRepository.On("RevokeByUserID", uint(1)).Return(tt.RevokeError)
+			s.mockPasswordResetTokenRepository.On("CreatePasswordResetToken", mock.Anything).Return(tt.CreateError)
+			s.mockMailer.On("Send", mock.Anything).Return(tt.MailError)
+
+			err := s.userService.ForgotPassword(dto.ForgotPasswordRequest{Email: "123@123.com"}, s.ctx)
+			s.Equal(tt.ExpectedErr, err)
+
+			if tt.ExpectCreate {
+				s.mockPasswordResetTokenRepository.AssertCalled(s.T(), "CreatePasswordResetToken", mock.MatchedBy(func(t *entity.PasswordResetToken) bool {
+					return t.UserID == 1 && len(t.TokenHash) == 64 && t.ExpiresAt.After(time.Now())
+				}))
+
+				// Earlier links are revoked before the new one is stored.
+				calls := s.mockPasswordResetTokenRepository.Calls
+				s.Require().Len(calls, 2)
+				s.Equal("RevokeByUserID", calls[0].Method)
+				s.Equal("CreatePasswordResetToken", calls[1].Method)
+			} else {
+				s.mockPasswordResetTokenRepository.AssertNotCalled(s.T(), "CreatePasswordResetToken", mock.Anything)
+			}
+
+			if tt.ExpectMail {
+				s.mockMailer.AssertCalled(s.T(), "Send", mock.MatchedBy(func(m mailer.Message) bool {
+					return m.To == "123@123.com" && strings.Contains(m.Body, "/password/reset?token=")
+				}))
+			} else {
+				s.mockMailer.AssertNotCalled(s.T(), "Send", mock.Anything)
+			}
+		})
+		s.TearDownTest()
+	}
+}
+
+func (s *TestSuiteUserServices) TestResetPassword() {
+	usedAt := time.Now().Add(-time.Minute)
+
+	for _, tt := range []struct {
+		Name          string
+		Password      string
+		StoredToken   *entity.PasswordResetToken
+		FindError     error
+		MarkUsedError error
+		UpdateError   error
+		ExpectUpdate  bool
+		ExpectedErr   error
+	}{
+		{
+			Name: "Success",
+			StoredToken: &entity.PasswordResetToken{
+				UserID:    1,
+				ExpiresAt: time.Now().Add(time.Hour),
+			},
+			ExpectUpdate: true,
+		},
+		{
+			Name:        "Unknown token",
+			FindError:   gorm.ErrRecordNotFound,
+			ExpectedErr: ErrInvalidResetToken,
+		},
+		{
+			Name: "Expired token",
+			StoredToken: &entity.PasswordResetToken{
+				UserID:    1,
+				ExpiresAt: time.Now().Add(-time.Hour),
+			},
+			ExpectedErr: ErrInvalidResetToken,
+		},
+		{
+			Name: "Used token",
+			StoredToken: &entity.PasswordResetToken{
+				UserID:    1,
+				ExpiresAt: time.Now().Add(time.Hour),
+				UsedAt:    &usedAt,
+			},
+			ExpectedErr: ErrInvalidResetToken,
+		},
+		{
+			Name: "Token used concurrently",
+			StoredToken: &entity.PasswordResetToken{
+				UserID:    1,
+				ExpiresAt: time.Now().Add(time.Hour),
+			},
+			MarkUsedError: repository.ErrPasswordResetTokenAlreadyUsed,
+			ExpectedErr:   ErrInvalidResetToken,
+		},
+		{
+			Name: "Error updating password",
+			StoredToken: &entity.PasswordResetToken{
+				UserID:    1,
+				ExpiresAt: time.Now().Add(time.Hour),
+			},
+			UpdateError:  errors.New("Generic Error"),
+			ExpectUpdate: true,
+			ExpectedErr:  errors.New("Generic Error"),
+		},
+		{
+			Name:     "Breached password keeps the token usable",
+			Password: "password1",
+			StoredToken: &entity.PasswordResetToken{
+				UserID:    1,
+				ExpiresAt: time.Now().Add(time.Hour),
+			},
+			ExpectedErr: apperror.Validation(
+				apperror.FieldError{Field: "password", Rule: "breached", Message: "has appeared in a data breach, choose another one"},
+			),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			if tt.Password == "" {
+				tt.Password = strongPassword
+			}
+			s.mockPasswordResetTokenRepository.On("FindByTokenHash", utils.HashToken("token")).Return(tt.StoredToken, tt.FindError)
+			s.mockUserRepository.On("FindByID", uint(1)).Return(&entity.User{Model: gorm.Model{ID: 1}, Email: "123@123.com"}, nil)
+			s.mockPasswordResetTokenRepository.On("MarkAsUsed", mock.Anything).Return(tt.MarkUsedError)
+			s.mockUserRepository.On("UpdatePassword", uint(1), mock.Anything).Return(tt.UpdateError)
+			s.mockRevokedTokenRepository.On("CreateRevokedToken", mock.Anything).Return(nil)
+			s.mockRefreshTokenRepository.On("RevokeByUserID", uint(1)).Return(nil)
+			s.mockPasswordResetTokenRepository.On("RevokeByUserID", uint(1)).Return(nil)
+
+			err := s.userService.ResetPassword(dto.ResetPasswordRequest{Token: "token", Password: tt.Password}, s.ctx)
+			s.Equal(tt.ExpectedErr, err)
+
+			if tt.Password != strongPassword {
+				s.mockPasswordResetTokenRepository.AssertNotCalled(s.T(), "MarkAsUsed", mock.Anything)
+			}
+
+			if tt.ExpectUpdate {
+				s.mockUserRepository.AssertCalled(s.T(), "UpdatePassword", uint(1), mock.MatchedBy(func(hash string) bool {
+					return bcrypt.CompareHashAndPassword([]byte(hash), []byte(tt.Password)) == nil
+				}))
+			} else {
+				s.mockUserRepository.AssertNotCalled(s.T(), "UpdatePassword", mock.Anything, mock.Anything)
+			}
+
+			if tt.ExpectedErr == nil {
+				s.mockRevokedTokenRepository.AssertCalled(s.T(), "CreateRevokedToken", mock.Anything)
+				s.mockRefreshTokenRepository.AssertCalled(s.T(), "RevokeByUserID", uint(1))
+				s.mockPasswordResetTokenRepository.AssertCalled(s.T(), "RevokeByUserID", uint(1))
+			} else {
+				s.mockPasswordResetTokenRepository.AssertNotCalled(s.T(), "RevokeByUserID", mock.Anything)
+			}
+		})
+		s.TearDownTest()
+	}
+}
+
+func (s *TestSuiteUserServices) TestVerifyEmail() {
+	verifiedAt := time.Now()
+	user := &entity.User{Model: gorm.Model{ID: 1}, Email: "123@123.com"}
+
+	validToken, err := utils.GenerateVerificationToken(s.keyRing, user, time.Hour)
+	s.NoError(err)
+	accessToken, err := utils.GenerateToken(s.keyRing, user, "", time.Minute)
+	s.NoError(err)
+
+	for _, tt := range []struct {
+		Name         string
+		Token        string
+		User         *entity.User
+		FindError    error
+		ExpectVerify bool
+		ExpectedErr  error
+	}{
+		{
+			Name:         "Success",
+			Token:        validToken,
+			User:         &entity.User{Model: gorm.Model{ID: 1}, Email: "123@123.com"},
+			ExpectVerify: true,
+		},
+		{
+			Name:  "Already verified",
+			Token: validToken,
+			User:  &entity.User{Model: gorm.Model{ID: 1}, Email: "123@123.com", VerifiedAt: &verifiedAt},
+		},
+		{
+			Name:        "Malformed token",
+			Token:       "token",
+			ExpectedErr: ErrInvalidVerification,
+		},
+		{
+			Name:        "Access token used as verification token",
+			Token:       accessToken,
+			ExpectedErr: ErrInvalidVerification,
+		},
+		{
+			Name:        "Email changed since the link was sent",
+			Token:       validToken,
+			User:        &entity.User{Model: gorm.Model{ID: 1}, Email: "456@456.com"},
+			ExpectedErr: ErrInvalidVerification,
+		},
+		{
+			Name:        "User no longer exists",
+			Token:       validToken,
+			FindError:   gorm.ErrRecordNotFound,
+			ExpectedErr: ErrInvalidVerification,
+		},
+		{
+			Name:        "Generic Error from Repository",
+			Token:       validToken,
+			FindError:   errors.New("Generic Error"),
+			ExpectedErr: errors.New("Generic Error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.mockUserRepository.On("FindByID", uint(1)).Return(tt.User, tt.FindError)
+			s.mockUserRepository.On("MarkAsVerified", uint(1)).Return(nil)
+
+			err := s.userService.VerifyEmail(tt.Token, s.ctx)
+			s.Equal(tt.ExpectedErr, err)
+
+			if tt.ExpectVerify {
+				s.mockUserRepository.AssertCalled(s.T(), "MarkAsVerified", uint(1))
+			} else {
+				s.mockUserRepository.AssertNotCalled(s.T(), "MarkAsVerified", uint(1))
+			}
+		})
+		s.TearDownTest()
+	}
+}
+
+func (s *TestSuiteUserServices) TestResendVerification() {
+	verifiedAt := time.Now()
+
+	for _, tt := range []struct {
+		Name        string
+		User        *entity.User
+		FindError   error
+		ExpectMail  bool
+		ExpectedErr error
+	}{
+		{
+			Name:       "Success",
+			User:       &entity.User{Email: "123@123.com"},
+			ExpectMail: true,
+		},
+		{
+			Name: "Already verified",
+			User: &entity.User{Email: "123@123.com", VerifiedAt: &verifiedAt},
+		},
+		{
+			Name:      "Unknown email is ignored",
+			FindError: gorm.ErrRecordNotFound,
+		},
+		{
+			Name:        "Generic Error from Repository",
+			FindError:   errors.New("Generic Error"),
+			ExpectedErr: errors.New("Generic Error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.mockUserRepository.On("FindByEmail", "123@123.com").Return(tt.User, tt.FindError)
+			s.mockMailer.On("Send", mock.Anything).Return(nil)
+
+			err := s.userService.ResendVerification(dto.ResendVerificationRequest{Email: "123@123.com"}, s.ctx)
+			s.Equal(tt.ExpectedErr, err)
+
+			if tt.ExpectMail {
+				s.mockMailer.AssertCalled(s.T(), "Send", mock.Anything)
+			} else {
+				s.mockMailer.AssertNotCalled(s.T(), "Send", mock.Anything)
+			}
+		})
+		s.TearDownTest()
+	}
+}
+
+func (s *TestSuiteUserServices) TestFindByID() {
+	for _, tt := range []struct {
+		Name           string
+		FunctionReturn *entity.User
+		FunctionError  error
+		ExpectedReturn *dto.UserResponse
+		ExpectedErr    error
+	}{
+		{
+			Name: "Success",
+			FunctionReturn: &entity.User{
+				Model: gorm.Model{ID: 1},
+				Email: "123@123.com",
+				Roles: []entity.Role{{Name: "admin"}},
+			},
+			ExpectedReturn: &dto.UserResponse{
+				ID:    1,
+				Email: "123@123.com",
+				Roles: []string{"admin"},
+			},
+		},
+		{
+			Name:          "User not found",
+			FunctionError: gorm.ErrRecordNotFound,
+			ExpectedErr:   ErrUserNotFound,
+		},
+		{
+			Name:          "Generic Error from Repository",
+			FunctionError: errors.New("Generic Error"),
+			ExpectedErr:   errors.New("Generic Error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.mockUserRepository.On("FindByID", uint(1)).Return(tt.FunctionReturn, tt.FunctionError)
+
+			result, err := s.userService.FindByID(1, s.ctx)
+			s.Equal(tt.ExpectedReturn, result)
+			s.Equal(tt.ExpectedErr, err)
+		})
+		s.TearDownTest()
+	}
+}
+
+func (s *TestSuiteUserServices) TestUpdateUser() {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("123"), bcrypt.MinCost)
+	s.NoError(err)
+	verifiedAt := time.Now()
+	newEmail := "456@456.com"
+	sameEmail := "123@123.com"
+	newPassword := strongPassword
+	emailPassword := "Battery-456@456.com"
+
+	for _, tt := range []struct {
+		Name           string
+		ActorID        uint
+		Request        dto.UpdateUserRequest
+		FindError      error
+		EmailError     error
+		ExpectEmail    bool
+		ExpectPassword bool
+		ExpectedReturn *dto.UserResponse
+		ExpectedErr    error
+	}{
+		{
+			Name:           "Change own email",
+			ActorID:        1,
+			Request:        dto.UpdateUserRequest{Email: &newEmail, CurrentPassword: "123"},
+			ExpectEmail:    true,
+			ExpectedReturn: &dto.UserResponse{ID: 1, Email: "456@456.com"},
+		},
+		{
+			Name:           "Change own password",
+			ActorID:        1,
+			Request:        dto.UpdateUserRequest{Password: &newPassword, CurrentPassword: "123"},
+			ExpectPassword: true,
+			ExpectedReturn: &dto.UserResponse{ID: 1, Email: "123@123.com"},
+		},
+		{
+			Name:        "Wrong current password",
+			ActorID:     1,
+			Request:     dto.UpdateUserRequest{Password: &newPassword, CurrentPassword: "456"},
+			ExpectedErr: ErrWrongPassword,
+		},
+		{
+			Name:           "Admin changes someone else without current password",
+			ActorID:        2,
+			Request:        dto.UpdateUserRequest{Email: &newEmail, Password: &newPassword},
+			ExpectEmail:    true,
+			ExpectPassword: true,
+			ExpectedReturn: &dto.UserResponse{ID: 1, Email: "456@456.com"},
+		},
+		{
+			Name:    "Password derived from the new email",
+			ActorID: 2,
+			Request: dto.UpdateUserRequest{Email: &newEmail, Password: &emailPassword},
+			ExpectedErr: apperror.Validation(
+				apperror.FieldError{Field: "password", Rule: "email", Message: "must not contain your email address"},
+			),
+		},
+		{
+			Name:           "Same email is not a change",
+			ActorID:        1,
+			Request:        dto.UpdateUserRequest{Email: &sameEmail},
+			ExpectedReturn: &dto.UserResponse{ID: 1, Email: "123@123.com"},
+		},
+		{
+			Name:        "Email taken",
+			ActorID:     1,
+			Request:     dto.UpdateUserRequest{Email: &newEmail, CurrentPassword: "123"},
+			EmailError:  repository.ErrEmailAlreadyExist,
+			ExpectedErr: ErrUserExists,
+		},
+		{
+			Name:        "User not found",
+			ActorID:     2,
+			Request:     dto.UpdateUserRequest{Email: &newEmail},
+			FindError:   gorm.ErrRecordNotFound,
+			ExpectedErr: ErrUserNotFound,
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			var user *entity.User
+			if tt.FindError == nil {
+				user = &entity.User{
+					Model:      gorm.Model{ID: 1},
+					Email:      "123@123.com",
+					Password:   string(hashedPassword),
+					VerifiedAt: &verifiedAt,
+				}
+			}
+
+			s.mockUserRepository.On("FindByID", uint(1)).Return(user, tt.FindError)
+			s.mockUserRepository.On("UpdateCredentials", uint(1), mock.Anything, mock.Anything).Return(tt.EmailError)
+			s.mockRevokedTokenRepository.On("CreateRevokedToken", mock.Anything).Return(nil)
+			s.mockRefreshTokenRepository.On("RevokeByUserID", uint(1)).Return(nil)
+			s.mockMailer.On("Send", mock.Anything).Return(nil)
+
+			result, err := s.userService.UpdateUser(tt.ActorID, 1, tt.Request, s.ctx)
+			s.Equal(tt.ExpectedReturn, result)
+			s.Equal(tt.ExpectedErr, err)
+
+			if tt.ExpectEmail {
+				s.mockMailer.AssertCalled(s.T(), "Send", mock.MatchedBy(func(m mailer.Message) bool {
+					return m.To == newEmail
+				}))
+			} else {
+				s.mockMailer.AssertNotCalled(s.T(), "Send", mock.Anything)
+			}
+
+			if tt.ExpectEmail || tt.ExpectPassword {
+				expectedEmail := ""
+				if tt.ExpectEmail {
+					expectedEmail = newEmail
+				}
+
+				s.mockUserRepository.AssertCalled(s.T(), "UpdateCredentials", uint(1), expectedEmail, mock.MatchedBy(func(hash string) bool {
+					if !tt.ExpectPassword {
+						return hash == ""
+					}
+					return bcrypt.CompareHashAndPassword([]byte(hash), []byte(newPassword)) == nil
+				}))
+				s.mockUserRepository.AssertNumberOfCalls(s.T(), "UpdateCredentials", 1)
+			} else if tt.EmailError == nil {
+				s.mockUserRepository.AssertNotCalled(s.T(), "UpdateCredentials", mock.Anything, mock.Anything, mock.Anything)
+			}
+
+			if tt.ExpectPassword {
+				s.mockRefreshTokenRepository.AssertCalled(s.T(), "RevokeByUserID", uint(1))
+			} else {
+				s.mockRefreshTokenRepository.AssertNotCalled(s.T(), "RevokeByUserID", mock.Anything)
+			}
+		})
+		s.TearDownTest()
+	}
+}
+
+func (s *TestSuiteUserServices) TestDeleteUser() {
+	for _, tt := range []struct {
+		Name          string
+		FunctionError error
+		ExpectRevoke  bool
+		ExpectedErr   error
+	}{
+		{
+			Name:         "Success",
+			ExpectRevoke: true,
+		},
+		{
+			Name:          "User not found",
+			FunctionError: gorm.ErrRecordNotFound,
+			ExpectedErr:   ErrUserNotFound,
+		},
+		{
+			Name:          "Generic Error from Repository",
+			FunctionError: errors.New("Generic Error"),
+			ExpectedErr:   errors.New("Generic Error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.mockUserRepository.On("DeleteUser", uint(1)).Return(tt.FunctionError)
+			s.mockRevokedTokenRepository.On("CreateRevokedToken", mock.Anything).Return(nil)
+			s.mockRefreshTokenRepository.On("RevokeByUserID", uint(1)).Return(nil)
+
+			err := s.userService.DeleteUser(1, s.ctx)
+			s.Equal(tt.ExpectedErr, err)
+
+			if tt.ExpectRevoke {
+				s.mockRevokedTokenRepository.AssertCalled(s.T(), "CreateRevokedToken", mock.MatchedBy(func(t *entity.RevokedToken) bool {
+					return t.UserID == 1 && t.JTI == ""
+				}))
+				s.mockRefreshTokenRepository.AssertCalled(s.T(), "RevokeByUserID", uint(1))
+			} else {
+				s.mockRefreshTokenRepository.AssertNotCalled(s.T(), "RevokeByUserID", mock.Anything)
+			}
+		})
+		s.TearDownTest()
+	}
+}
+
+func (s *TestSuiteUserServices) TestLoginMFA() {
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	now := time.Now()
+	currentStep := now.Unix() / 30
+	code, err := utils.GenerateTOTPCode(secret, now)
+	s.NoError(err)
+
+	user := &entity.User{Model: gorm.Model{ID: 1}, Email: "123@123.com"}
+	mfaToken, err := utils.GenerateMFAToken(s.keyRing, user, time.Minute)
+	s.NoError(err)
+	accessToken, err := utils.GenerateToken(s.keyRing, user, "", time.Minute)
+	s.NoError(err)
+
+	for _, tt := range []struct {
+		Name           string
+		Request        dto.MFALoginRequest
+		Revoked        bool
+		TwoFactor      *entity.TwoFactor
+		TwoFactorError error
+		StepError      error
+		RecoveryError  error
+		ExpectedToken  bool
+		ExpectedErr    error
+	}{
+		{
+			Name:          "Success with TOTP code",
+			Request:       dto.MFALoginRequest{MFAToken: mfaToken, Code: code},
+			TwoFactor:     &entity.TwoFactor{Model: gorm.Model{ID: 2}, UserID: 1, Secret: secret, EnabledAt: &now},
+			ExpectedToken: true,
+		},
+		{
+			Name:          "Success with recovery code",
+			Request:       dto.MFALoginRequest{MFAToken: mfaToken, Code: "AAAAA-BBBBB"},
+			TwoFactor:     &entity.TwoFactor{Model: gorm.Model{ID: 2}, UserID: 1, Secret: secret, EnabledAt: &now},
+			ExpectedToken: true,
+		},
+		{
+			Name:        "Access token used as mfa token",
+			Request:     dto.MFALoginRequest{MFAToken: accessToken, Code: code},
+			ExpectedErr: ErrInvalidMFAToken,
+		},
+		{
+			Name:        "Mfa token already consumed",
+			Request:     dto.MFALoginRequest{MFAToken: mfaToken, Code: code},
+			Revoked:     true,
+			ExpectedErr: ErrInvalidMFAToken,
+		},
+		{
+			Name:          "Wrong code",
+			Request:       dto.MFALoginRequest{MFAToken: mfaToken, Code: "000000"},
+			TwoFactor:     &entity.TwoFactor{Model: gorm.Model{ID: 2}, UserID: 1, Secret: secret, EnabledAt: &now},
+			RecoveryError: repository.ErrRecoveryCodeNotFound,
+			ExpectedErr:   ErrInvalidTwoFactorCode,
+		},
+		{
+			Name:        "Replayed TOTP code",
+			Request:     dto.MFALoginRequest{MFAToken: mfaToken, Code: code},
+			TwoFactor:   &entity.TwoFactor{Model: gorm.Model{ID: 2}, UserID: 1, Secret: secret, EnabledAt: &now, LastUsedStep: currentStep + 1},
+			ExpectedErr: ErrInvalidTwoFactorCode,
+		},
+		{
+			Name:        "TOTP code used concurrently",
+			Request:     dto.MFALoginRequest{MFAToken: mfaToken, Code: code},
+			TwoFactor:   &entity.TwoFactor{Model: gorm.Model{ID: 2}, UserID: 1, Secret: secret, EnabledAt: &now},
+			StepError:   repository.ErrTOTPStepAlreadyUsed,
+			ExpectedErr: ErrInvalidTwoFactorCode,
+		},
+		{
+			Name:           "Two-factor authentication disabled meanwhile",
+			Request:        dto.MFALoginRequest{MFAToken: mfaToken, Code: code},
+			TwoFactorError: gorm.ErrRecordNotFound,
+			ExpectedErr:    ErrInvalidMFAToken,
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.mockRevokedTokenRepository.On("IsRevoked", mock.Anything, uint(1), mock.Anything).Return(tt.Revoked, nil)
+			s.mockRevokedTokenRepository.On("CreateRevokedToken", mock.Anything).Return(nil)
+			s.mockTwoFactorRepository.On("FindByUserID", uint(1)).Return(tt.TwoFactor, tt.TwoFactorError)
+			s.mockTwoFactorRepository.On("UpdateLastUsedStep", uint(2), mock.Anything).Return(tt.StepError)
+			s.mockTwoFactorRepository.On("UseRecoveryCode", uint(1), mock.Anything).Return(tt.RecoveryError)
+			s.mockUserRepository.On("FindByID", uint(1)).Return(user, nil)
+			s.mockRefreshTokenRepository.On("CreateRefreshToken", mock.Anything).Return(nil)
+
+			token, err := s.userService.LoginMFA(tt.Request, s.ctx)
+			s.Equal(tt.ExpectedErr, err)
+
+			if tt.ExpectedToken {
+				_, err := utils.ParseToken(s.keyRing, token.AccessToken)
+				s.NoError(err)
+				s.NotEmpty(token.RefreshToken)
+			} else {
+				s.Nil(token)
+			}
+
+			if tt.Request.Code == "AAAAA-BBBBB" {
+				s.mockTwoFactorRepository.AssertCalled(s.T(), "UseRecoveryCode", uint(1), utils.HashToken("aaaaabbbbb"))
+			}
+
+			if tt.Request.MFAToken == mfaToken && !tt.Revoked {
+				s.mockRevokedTokenRepository.AssertCalled(s.T(), "CreateRevokedToken", mock.Anything)
+			}
+		})
+		s.TearDownTest()
+	}
+}
+
+func (s *TestSuiteUserServices) TestEnrollTwoFactor() {
+	enabledAt := time.Now()
+
+	for _, tt := range []struct {
+		Name           string
+		TwoFactor      *entity.TwoFactor
+		TwoFactorError error
+		SaveError      error
+		ExpectedErr    error
+	}{
+		{
+			Name:           "Success",
+			TwoFactorError: gorm.ErrRecordNotFound,
+		},
+		{
+			Name:      "Replace pending enrollment",
+			TwoFactor: &entity.TwoFactor{Model: gorm.Model{ID: 2}, UserID: 1, Secret: "OLD"},
+		},
+		{
+			Name:        "Already enabled",
+			TwoFactor:   &entity.TwoFactor{Model: gorm.Model{ID: 2}, UserID: 1, Secret: "OLD", EnabledAt: &enabledAt},
+			ExpectedErr: ErrTwoFactorAlreadyEnabled,
+		},
+		{
+			Name:           "Generic Error from Repository",
+			TwoFactorError: gorm.ErrRecordNotFound,
+			SaveError:      errors.New("Generic Error"),
+			ExpectedErr:    errors.New("Generic Error"),
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.mockUserRepository.On("FindByID", uint(1)).Return(&entity.User{Email: "123@123.com"}, nil)
+			s.mockTwoFactorRepository.On("FindByUserID", uint(1)).Return(tt.TwoFactor, tt.TwoFactorError)
+			s.mockTwoFactorRepository.On("SaveTwoFactor", mock.Anything).Return(tt.SaveError)
+
+			result, err := s.userService.EnrollTwoFactor(1, s.ctx)
+			s.Equal(tt.ExpectedErr, err)
+
+			if tt.ExpectedErr == nil {
+				s.NotEqual("OLD", result.Secret)
+				s.Contains(result.OTPAuthURI, "otpauth://totp/")
+				s.Contains(result.OTPAuthURI, "secret="+result.Secret)
+				s.mockTwoFactorRepository.AssertCalled(s.T(), "SaveTwoFactor", mock.MatchedBy(func(t *entity.TwoFactor) bool {
+					return t.UserID == 1 && t.Secret == result.Secret && t.EnabledAt == nil
+				}))
+			} else {
+				s.Nil(result)
+			}
+		})
+		s.TearDownTest()
+	}
+}
+
+func (s *TestSuiteUserServices) TestConfirmTwoFactor() {
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	enabledAt := time.Now()
+	code, err := utils.GenerateTOTPCode(secret, time.Now())
+	s.NoError(err)
+
+	for _, tt := range []struct {
+		Name           string
+		Code           string
+		TwoFactor      *entity.TwoFactor
+		TwoFactorError error
+		ExpectedErr    error
+	}{
+		{
+			Name:      "Success",
+			Code:      code,
+			TwoFactor: &entity.TwoFactor{Model: gorm.Model{ID: 2}, UserID: 1, Secret: secret},
+		},
+		{
+			Name:        "Wrong code",
+			Code:        "000000",
+			TwoFactor:   &entity.TwoFactor{Model: gorm.Model{ID: 2}, UserID: 1, Secret: secret},
+			ExpectedErr: ErrInvalidTwoFactorCode,
+		},
+		{
+			Name:           "Not enrolled",
+			Code:           code,
+			TwoFactorError: gorm.ErrRecordNotFound,
+			ExpectedErr:    ErrTwoFactorNotEnrolled,
+		},
+		{
+			Name:        "Already enabled",
+			Code:        code,
+			TwoFactor:   &entity.TwoFactor{Model: gorm.Model{ID: 2}, UserID: 1, Secret: secret, EnabledAt: &enabledAt},
+			ExpectedErr: ErrTwoFactorAlreadyEnabled,
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.mockTwoFactorRepository.On("FindByUserID", uint(1)).Return(tt.TwoFactor, tt.TwoFactorError)
+			s.mockTwoFactorRepository.On("EnableTwoFactor", mock.Anything, mock.Anything).Return(nil)
+
+			result, err := s.userService.ConfirmTwoFactor(1, dto.TwoFactorCodeRequest{Code: tt.Code}, s.ctx)
+			s.Equal(tt.ExpectedErr, err)
+
+			if tt.ExpectedErr == nil {
+				s.Len(result.RecoveryCodes, 10)
+				s.mockTwoFactorRepository.AssertCalled(s.T(), "EnableTwoFactor",
+					mock.MatchedBy(func(t *entity.TwoFactor) bool {
+						return t.EnabledAt != nil && t.LastUsedStep > 0
+					}),
+					mock.MatchedBy(func(codes []entity.RecoveryCode) bool {
+						return len(codes) == 10 &&
+							codes[0].UserID == 1 &&
+							codes[0].CodeHash == utils.HashToken(utils.NormalizeRecoveryCode(result.RecoveryCodes[0]))
+					}),
+				)
+			} else {
+				s.Nil(result)
+				s.mockTwoFactorRepository.AssertNotCalled(s.T(), "EnableTwoFactor", mock.Anything, mock.Anything)
+			}
+		})
+		s.TearDownTest()
+	}
+}
+
+func (s *TestSuiteUserServices) TestDisableTwoFactor() {
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	enabledAt := time.Now()
+	code, err := utils.GenerateTOTPCode(secret, time.Now())
+	s.NoError(err)
+
+	for _, tt := range []struct {
+		Name           string
+		Code           string
+		TwoFactor      *entity.TwoFactor
+		TwoFactorError error
+		ExpectDisable  bool
+		ExpectedErr    error
+	}{
+		{
+			Name:          "Success",
+			Code:          code,
+			TwoFactor:     &entity.TwoFactor{Model: gorm.Model{ID: 2}, UserID: 1, Secret: secret, EnabledAt: &enabledAt},
+			ExpectDisable: true,
+		},
+		{
+			Name:        "Wrong code",
+			Code:        "000000",
+			TwoFactor:   &entity.TwoFactor{Model: gorm.Model{ID: 2}, UserID: 1, Secret: secret, EnabledAt: &enabledAt},
+			ExpectedErr: ErrInvalidTwoFactorCode,
+		},
+		{
+			Name:        "Pending enrollment",
+			Code:        code,
+			TwoFactor:   &entity.TwoFactor{Model: gorm.Model{ID: 2}, UserID: 1, Secret: secret},
+			ExpectedErr: ErrTwoFactorNotEnabled,
+		},
+		{
+			Name:           "Not enrolled",
+			Code:           code,
+			TwoFactorError: gorm.ErrRecordNotFound,
+			ExpectedErr:    ErrTwoFactorNotEnabled,
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			s.mockTwoFactorRepository.On("FindByUserID", uint(1)).Return(tt.TwoFactor, tt.TwoFactorError)
+			s.mockTwoFactorRepository.On("UpdateLastUsedStep", uint(2), mock.Anything).Return(nil)
+			s.mockTwoFactorRepository.On("UseRecoveryCode", uint(1), mock.Anything).Return(repository.ErrRecoveryCodeNotFound)
+			s.mockTwoFactorRepository.On("DisableTwoFactor", uint(1)).Return(nil)
+
+			err := s.userService.DisableTwoFactor(1, dto.TwoFactorCodeRequest{Code: tt.Code}, s.ctx)
+			s.Equal(tt.ExpectedErr, err)
+
+			if tt.ExpectDisable {
+				s.mockTwoFactorRepository.AssertCalled(s.T(), "DisableTwoFactor", uint(1))
+			} else {
+				s.mockTwoFactorRepository.AssertNotCalled(s.T(), "DisableTwoFactor", uint(1))
+			}
 		})
 		s.TearDownTest()
 	}
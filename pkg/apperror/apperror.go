@@ -0,0 +1,99 @@
+package apperror
+
+// Kind classifies errors by what the caller can do about them. Transports map
+// kinds to their own statuses.
+type Kind int
+
+const (
+	Internal Kind = iota
+	Invalid
+	Unauthorized
+	Forbidden
+	NotFound
+	Conflict
+	Unprocessable
+	TooManyRequests
+)
+
+// Code identifies an error for machines. Codes are part of the API, once
+// published they must not change meaning.
+type Code string
+
+const (
+	CodeInternal   Code = "internal"
+	CodeValidation Code = "validation.failed"
+
+	CodeMalformedBody  Code = "request.malformed_body"
+	CodeMalformedQuery Code = "request.malformed_query"
+	CodeInvalidUserID  Code = "request.invalid_user_id"
+	CodeRateLimited    Code = "request.rate_limited"
+
+	CodeInvalidPagination Code = "list.invalid_pagination"
+	CodeInvalidCursor     Code = "list.invalid_cursor"
+	CodeInvalidSort       Code = "list.invalid_sort"
+	CodeInvalidFilter     Code = "list.invalid_filter"
+
+	CodeUserExists   Code = "user.exists"
+	CodeUserNotFound Code = "user.not_found"
+
+	CodeInvalidCredentials  Code = "auth.invalid_credentials"
+	CodeWrongPassword       Code = "auth.wrong_password"
+	CodeEmailNotVerified    Code = "auth.email_not_verified"
+	CodeMissingToken        Code = "auth.missing_token"
+	CodeInvalidToken        Code = "auth.invalid_token"
+	CodeForbidden           Code = "auth.forbidden"
+	CodeInvalidRefreshToken Code = "auth.invalid_refresh_token"
+	CodeRefreshTokenReused  Code = "auth.refresh_token_reused"
+	CodeInvalidResetToken   Code = "auth.invalid_reset_token"
+	CodeInvalidVerification Code = "auth.invalid_verification"
+	CodeInvalidMFAToken     Code = "auth.invalid_mfa_token"
+	CodeTooManyAttempts     Code = "auth.too_many_attempts"
+
+	CodeTwoFactorAlreadyEnabled Code = "two_factor.already_enabled"
+	CodeTwoFactorNotEnrolled    Code = "two_factor.not_enrolled"
+	CodeTwoFactorNotEnabled     Code = "two_factor.not_enabled"
+	CodeInvalidTwoFactorCode    Code = "two_factor.invalid_code"
+
+	CodeRoleExists        Code = "role.exists"
+	CodeRoleNotFound      Code = "role.not_found"
+	CodeInvalidRoleName   Code = "role.invalid_name"
+	CodeUnknownPermission Code = "role.unknown_permission"
+	CodeBuiltInRole       Code = "role.built_in"
+)
+
+// Error is an error whose message is safe to show to clients.
+type Error struct {
+	Code    Code
+	Kind    Kind
+	Message string
+	// Fields lists the invalid fields of a validation error.
+	Fields []FieldError
+}
+
+// FieldError tells which rule a field broke.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func New(code Code, kind Kind, message string) *Error {
+	return &Error{Code: code, Kind: kind, Message: message}
+}
+
+// Validation returns a validation.failed error listing the invalid fields.
+func Validation(fields ...FieldError) *Error {
+	return &Error{Code: CodeValidation, Kind: Unprocessable, Message: "request validation failed", Fields: fields}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// WithKind returns a copy of e of another kind, for the few errors whose
+// meaning depends on where they happen.
+func (e *Error) WithKind(kind Kind) *Error {
+	copied := *e
+	copied.Kind = kind
+	return &copied
+}
@@ -0,0 +1,128 @@
+package apperror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"rewrite/pkg/logging"
+
+	"github.com/labstack/echo/v4"
+)
+
+const problemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details document. Code is the stable, machine
+// readable identifier of the error and CorrelationID the request ID under
+// which the error was logged.
+type Problem struct {
+	Type          string       `json:"type"`
+	Title         string       `json:"title"`
+	Status        int          `json:"status"`
+	Detail        string       `json:"detail,omitempty"`
+	Instance      string       `json:"instance,omitempty"`
+	Code          Code         `json:"code"`
+	CorrelationID string       `json:"correlation_id,omitempty"`
+	Errors        []FieldError `json:"errors,omitempty"`
+}
+
+var kindStatuses = map[Kind]int{
+	Internal:        http.StatusInternalServerError,
+	Invalid:         http.StatusBadRequest,
+	Unauthorized:    http.StatusUnauthorized,
+	Forbidden:       http.StatusForbidden,
+	NotFound:        http.StatusNotFound,
+	Conflict:        http.StatusConflict,
+	Unprocessable:   http.StatusUnprocessableEntity,
+	TooManyRequests: http.StatusTooManyRequests,
+}
+
+// Codes of the errors returned by Echo itself, by status.
+var httpCodes = map[int]Code{
+	http.StatusBadRequest:            "request.invalid",
+	http.StatusUnauthorized:          CodeInvalidToken,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusNotFound:              "route.not_found",
+	http.StatusMethodNotAllowed:      "route.method_not_allowed",
+	http.StatusRequestEntityTooLarge: "request.too_large",
+	http.StatusUnsupportedMediaType:  "request.unsupported_media_type",
+	http.StatusTooManyRequests:       "rate_limit.exceeded",
+}
+
+// Status returns the HTTP status err is answered with.
+func Status(err error) int {
+	return ToProblem(err, "").Status
+}
+
+// ToProblem describes err to clients. Internal errors, including server errors
+// raised by Echo, are answered with a generic detail, their message never
+// leaves the server.
+func ToProblem(err error, correlationID string) Problem {
+	var appErr *Error
+	var httpErr *echo.HTTPError
+
+	var problem Problem
+	switch {
+	case errors.As(err, &appErr) && appErr.Kind != Internal:
+		problem = Problem{
+			Status: kindStatuses[appErr.Kind],
+			Detail: appErr.Message,
+			Code:   appErr.Code,
+			Errors: appErr.Fields,
+		}
+	case errors.As(err, &httpErr) && httpErr.Code < http.StatusInternalServerError:
+		code, ok := httpCodes[httpErr.Code]
+		if !ok {
+			code = Code(fmt.Sprintf("http.%d", httpErr.Code))
+		}
+
+		problem = Problem{Status: httpErr.Code, Code: code}
+		if message, ok := httpErr.Message.(string); ok {
+			problem.Detail = message
+		}
+	default:
+		problem = Problem{
+			Status: http.StatusInternalServerError,
+			Detail: "An unexpected error occurred, report the correlation ID if it persists.",
+			Code:   CodeInternal,
+		}
+
+		if errors.As(err, &httpErr) {
+			problem.Status = httpErr.Code
+		}
+	}
+
+	if problem.Status == 0 {
+		problem.Status = http.StatusInternalServerError
+	}
+
+	problem.Type = "about:blank"
+	problem.Title = http.StatusText(problem.Status)
+	problem.CorrelationID = correlationID
+	return problem
+}
+
+// HTTPErrorHandler answers every error returned by handlers and middlewares
+// with an application/problem+json document. The correlation ID is the request
+// ID, under which the access log records the error itself.
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	requestID, _ := c.Get(logging.RequestIDKey).(string)
+	problem := ToProblem(err, requestID)
+	problem.Instance = c.Request().URL.Path
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(problem.Status)
+	} else {
+		c.Response().Header().Set(echo.HeaderContentType, problemContentType)
+		c.Response().WriteHeader(problem.Status)
+		err = json.NewEncoder(c.Response()).Encode(problem)
+	}
+
+	if err != nil {
+		logging.FromContext(c.Request().Context()).Error("writing error response", "error", err)
+	}
+}
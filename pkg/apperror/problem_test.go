@@ -0,0 +1,111 @@
+package apperror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"rewrite/pkg/logging"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/suite"
+)
+
+type TestSuiteProblem struct {
+	suite.Suite
+	echoApp *echo.Echo
+}
+
+func (s *TestSuiteProblem) SetupTest() {
+	s.echoApp = echo.New()
+	s.echoApp.HTTPErrorHandler = HTTPErrorHandler
+}
+
+func (s *TestSuiteProblem) TestHTTPErrorHandler() {
+	for _, tt := range []struct {
+		Name            string
+		Err             error
+		ExpectedProblem Problem
+	}{
+		{
+			Name: "Domain error",
+			Err:  New(CodeUserExists, Conflict, "user already exists"),
+			ExpectedProblem: Problem{
+				Type:          "about:blank",
+				Title:         "Conflict",
+				Status:        http.StatusConflict,
+				Detail:        "user already exists",
+				Instance:      "/users",
+				Code:          CodeUserExists,
+				CorrelationID: "abc-123",
+			},
+		},
+		{
+			Name: "Validation error",
+			Err:  Validation(FieldError{Field: "email", Rule: "email", Message: "must be a valid email address"}),
+			ExpectedProblem: Problem{
+				Type:          "about:blank",
+				Title:         "Unprocessable Entity",
+				Status:        http.StatusUnprocessableEntity,
+				Detail:        "request validation failed",
+				Instance:      "/users",
+				Code:          CodeValidation,
+				CorrelationID: "abc-123",
+				Errors:        []FieldError{{Field: "email", Rule: "email", Message: "must be a valid email address"}},
+			},
+		},
+		{
+			Name: "Echo error",
+			Err:  echo.ErrNotFound,
+			ExpectedProblem: Problem{
+				Type:          "about:blank",
+				Title:         "Not Found",
+				Status:        http.StatusNotFound,
+				Detail:        "Not Found",
+				Instance:      "/users",
+				Code:          "route.not_found",
+				CorrelationID: "abc-123",
+			},
+		},
+		{
+			Name: "Internal error",
+			Err:  errors.New("dial tcp 10.0.0.1:3306: connection refused"),
+			ExpectedProblem: Problem{
+				Type:          "about:blank",
+				Title:         "Internal Server Error",
+				Status:        http.StatusInternalServerError,
+				Detail:        "An unexpected error occurred, report the correlation ID if it persists.",
+				Instance:      "/users",
+				Code:          CodeInternal,
+				CorrelationID: "abc-123",
+			},
+		},
+	} {
+		s.Run(tt.Name, func() {
+			r := httptest.NewRequest(http.MethodPost, "/users", nil)
+			w := httptest.NewRecorder()
+			c := s.echoApp.NewContext(r, w)
+			c.Set(logging.RequestIDKey, "abc-123")
+
+			s.echoApp.HTTPErrorHandler(tt.Err, c)
+
+			s.Equal(tt.ExpectedProblem.Status, w.Code)
+			s.Equal("application/problem+json", w.Header().Get(echo.HeaderContentType))
+
+			var problem Problem
+			s.NoError(json.Unmarshal(w.Body.Bytes(), &problem))
+			s.Equal(tt.ExpectedProblem, problem)
+		})
+	}
+}
+
+func (s *TestSuiteProblem) TestStatus() {
+	s.Equal(http.StatusUnauthorized, Status(New(CodeInvalidCredentials, Unauthorized, "invalid email or password")))
+	s.Equal(http.StatusInternalServerError, Status(New(CodeInternal, Internal, "secret detail")))
+	s.Equal(http.StatusServiceUnavailable, Status(echo.NewHTTPError(http.StatusServiceUnavailable, "secret detail")))
+}
+
+func TestProblem(t *testing.T) {
+	suite.Run(t, new(TestSuiteProblem))
+}
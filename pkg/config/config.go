@@ -1,23 +1,837 @@
 package config
 
-import "os"
-
-// var (
-// 	DB_USER    = "root"
-// 	DB_PASS    = "root"
-// 	DB_HOST    = "localhost"
-// 	DB_PORT    = "3307"
-// 	DB_NAME    = "training_mk2"
-// 	PORT       = ":8000"
-// 	JWT_SECRET = "secret"
-// )
-
-var (
-	DB_USER    = os.Getenv("DB_USER")
-	DB_PASS    = os.Getenv("DB_PASS")
-	DB_HOST    = os.Getenv("DB_HOST")
-	DB_PORT    = os.Getenv("DB_PORT")
-	DB_NAME    = os.Getenv("DB_NAME")
-	PORT       = os.Getenv("PORT")
-	JWT_SECRET = os.Getenv("JWT_SECRET")
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxBcryptPasswordBytes is the longest password bcrypt hashes without
+// truncating. maxPasswordBytes bounds the work of hashing a password with
+// Argon2id.
+const (
+	maxBcryptPasswordBytes = 72
+	maxPasswordBytes       = 1024
+)
+
+// Bounds of the bcrypt cost.
+const (
+	minBcryptCost = 4
+	maxBcryptCost = 31
+)
+
+// minSecretLength is the shortest JWT_SECRET accepted, 256 bits as required
+// for HS256 keys.
+const minSecretLength = 32
+
+// weakSecrets are placeholder secrets that must never reach production even
+// when they happen to be long enough.
+var weakSecrets = []string{
+	"secret",
+	"changeme",
+	"change-me",
+	"password",
+	"jwt-secret",
+}
+
+// Config is the whole configuration of the server. It is built by Load from,
+// in increasing order of precedence, the defaults, a YAML file, the
+// environment and the command line flags.
+type Config struct {
+	Server       ServerConfig       `yaml:"server"`
+	Database     DatabaseConfig     `yaml:"database"`
+	JWT          JWTConfig          `yaml:"jwt"`
+	Auth         AuthConfig         `yaml:"auth"`
+	Password     PasswordConfig     `yaml:"password"`
+	Hashing      HashingConfig      `yaml:"hashing"`
+	Lockout      LockoutConfig      `yaml:"lockout"`
+	RateLimit    RateLimitConfig    `yaml:"rate_limit"`
+	Verification VerificationConfig `yaml:"verification"`
+	Mail         MailConfig         `yaml:"mail"`
+	Tracing      TracingConfig      `yaml:"tracing"`
+	Log          LogConfig          `yaml:"log"`
+}
+
+type ServerConfig struct {
+	Port string `yaml:"port"`
+	// MetricsPort is the address /metrics is served on. It is kept apart from
+	// Port so the metrics are not exposed along with the API.
+	MetricsPort string `yaml:"metrics_port"`
+	// AppURL is the public base URL used to build links sent by email.
+	AppURL string `yaml:"app_url"`
+	// ShutdownTimeout bounds how long in-flight requests are drained, and then
+	// how long the shutdown hooks may take, once a stop signal is received.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// ShutdownDelay is how long /readyz fails before the server stops
+	// accepting connections, so load balancers notice and route elsewhere.
+	ShutdownDelay time.Duration `yaml:"shutdown_delay"`
+	// HealthCheckTimeout bounds every check behind /healthz and /readyz, and
+	// HealthCacheTTL is how long their results are reused.
+	HealthCheckTimeout time.Duration `yaml:"health_check_timeout"`
+	HealthCacheTTL     time.Duration `yaml:"health_cache_ttl"`
+	// TrustedProxies are the IPs and CIDR ranges of the proxies in front of
+	// the server. The client IP is taken from X-Forwarded-For only when the
+	// request comes through one of them, it is the peer address otherwise.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// Supported database drivers. SQLite is meant for local development and
+// tests, its Name is the path of the database file.
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
 )
+
+type DatabaseConfig struct {
+	Driver   string `yaml:"driver"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Host     string `yaml:"host"`
+	// Port defaults to the standard port of the driver.
+	Port string `yaml:"port"`
+	Name string `yaml:"name"`
+	// SSLMode is the sslmode of PostgreSQL connections.
+	SSLMode string `yaml:"sslmode"`
+	// AutoMigrate applies pending migrations on startup. When disabled the
+	// server refuses to start until the migrations have been applied.
+	AutoMigrate bool `yaml:"auto_migrate"`
+	// AdminEmails are the users who are granted the admin role on startup.
+	AdminEmails []string `yaml:"admin_emails"`
+}
+
+type JWTConfig struct {
+	// Secret signs tokens with HS256 when no KeyFiles are configured.
+	Secret string `yaml:"secret"`
+	// KeyFiles are PEM key files. The first one signs new tokens, the rest
+	// are only used to verify tokens.
+	KeyFiles        []string      `yaml:"key_files"`
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl"`
+	MFATokenTTL     time.Duration `yaml:"mfa_token_ttl"`
+
+	RevokedTokenPruneInterval time.Duration `yaml:"revoked_token_prune_interval"`
+}
+
+type AuthConfig struct {
+	PasswordResetTTL time.Duration `yaml:"password_reset_ttl"`
+	// TOTPIssuer is the account issuer shown by authenticator apps.
+	TOTPIssuer string `yaml:"totp_issuer"`
+	// HideExistingAccounts answers signups with a registered email like any
+	// other signup and emails the owner of the account instead, so signups do
+	// not reveal which emails are registered.
+	HideExistingAccounts bool `yaml:"hide_existing_accounts"`
+}
+
+// PasswordConfig is the policy new passwords must satisfy. Passwords set
+// before the policy changed keep working.
+type PasswordConfig struct {
+	MinLength int `yaml:"min_length"`
+	// MaxLength is in bytes. With bcrypt it may not exceed the 72 bytes
+	// bcrypt hashes.
+	MaxLength     int  `yaml:"max_length"`
+	RequireUpper  bool `yaml:"require_upper"`
+	RequireLower  bool `yaml:"require_lower"`
+	RequireDigit  bool `yaml:"require_digit"`
+	RequireSymbol bool `yaml:"require_symbol"`
+	// CheckBreached rejects the passwords of a breached password list:
+	// BreachedPath, a directory of Pwned Passwords range files, or the bundled
+	// list of common passwords when empty.
+	CheckBreached bool   `yaml:"check_breached"`
+	BreachedPath  string `yaml:"breached_path"`
+	// RejectEmail rejects passwords containing the email of their user.
+	RejectEmail bool `yaml:"reject_email"`
+	// MinEntropy is the lowest estimated entropy of new passwords in bits,
+	// zero disables the check.
+	MinEntropy float64 `yaml:"min_entropy"`
+}
+
+// Password hashing algorithms.
+const (
+	HashBcrypt   = "bcrypt"
+	HashArgon2id = "argon2id"
+)
+
+// HashingConfig is how new passwords are hashed. Hashes made with another
+// algorithm or other parameters keep working, and are replaced when their
+// user next logs in.
+type HashingConfig struct {
+	Algorithm  string `yaml:"algorithm"`
+	BcryptCost int    `yaml:"bcrypt_cost"`
+	// Argon2Memory is in KiB.
+	Argon2Memory      int `yaml:"argon2_memory"`
+	Argon2Iterations  int `yaml:"argon2_iterations"`
+	Argon2Parallelism int `yaml:"argon2_parallelism"`
+}
+
+// Stores of the login attempt counters.
+const (
+	StoreSQL    = "sql"
+	StoreMemory = "memory"
+)
+
+// LockoutConfig throttles logins failing too often for an account or a client
+// IP. Failures are counted for emails whether they are registered or not, so
+// lockouts do not reveal which ones are. A successful login clears the
+// failures of its account only. Those of the client IP run until the Window
+// expires, or anyone could spray passwords from one IP and keep its counter
+// down by logging into their own account between attempts.
+type LockoutConfig struct {
+	// Store is sql, shared by every instance, or memory.
+	Store string `yaml:"store"`
+	// Failures are forgotten Window after the last one.
+	Window time.Duration `yaml:"window"`
+	// From the DelayAfter-th failure of an account on, every failure blocks
+	// its logins for Delay, doubling with each failure up to MaxDelay.
+	DelayAfter int           `yaml:"delay_after"`
+	Delay      time.Duration `yaml:"delay"`
+	MaxDelay   time.Duration `yaml:"max_delay"`
+	// AccountFailures failures lock an account, and IPFailures failures block
+	// a client IP, for Duration.
+	AccountFailures int           `yaml:"account_failures"`
+	IPFailures      int           `yaml:"ip_failures"`
+	Duration        time.Duration `yaml:"duration"`
+	PruneInterval   time.Duration `yaml:"prune_interval"`
+}
+
+// Stores of the rate limit counters.
+const (
+	RateLimitStoreMemory = "memory"
+	RateLimitStoreRedis  = "redis"
+)
+
+// What requests are counted by, the Key of a RateLimitRule. Requests without
+// a user or an API key are counted by client IP.
+const (
+	RateLimitByIP     = "ip"
+	RateLimitByUser   = "user"
+	RateLimitByAPIKey = "api_key"
+)
+
+// RateLimitConfig limits how often the routes of every group may be called.
+type RateLimitConfig struct {
+	// Store is memory, counting per instance, or redis, shared by every
+	// instance.
+	Store    string `yaml:"store"`
+	RedisURL string `yaml:"redis_url"`
+	// APIKeyHeader is the header holding the API key of the api_key rules.
+	APIKeyHeader string `yaml:"api_key_header"`
+	// Signup covers account creation, Auth the public login, token and
+	// password routes, and API the routes needing a token.
+	Signup RateLimitRule `yaml:"signup"`
+	Auth   RateLimitRule `yaml:"auth"`
+	API    RateLimitRule `yaml:"api"`
+}
+
+// RateLimitRule allows Requests requests per sliding Window for every key.
+// Zero Requests disables the limit.
+type RateLimitRule struct {
+	Requests int           `yaml:"requests"`
+	Window   time.Duration `yaml:"window"`
+	// Key is ip, user or api_key.
+	Key string `yaml:"key"`
+}
+
+type VerificationConfig struct {
+	// Required refuses logins of users who did not verify their email yet.
+	Required bool          `yaml:"required"`
+	TTL      time.Duration `yaml:"ttl"`
+	// Every client IP may ask for ResendLimit verification emails per
+	// ResendWindow.
+	ResendLimit  int           `yaml:"resend_limit"`
+	ResendWindow time.Duration `yaml:"resend_window"`
+}
+
+type MailConfig struct {
+	SMTPHost     string `yaml:"smtp_host"`
+	SMTPPort     string `yaml:"smtp_port"`
+	SMTPUser     string `yaml:"smtp_user"`
+	SMTPPassword string `yaml:"smtp_password"`
+	From         string `yaml:"from"`
+}
+
+// Trace exporters.
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+type TracingConfig struct {
+	Exporter string `yaml:"exporter"`
+	// Endpoint is the base URL of the OTLP/HTTP collector, such as
+	// http://localhost:4318.
+	Endpoint    string  `yaml:"endpoint"`
+	ServiceName string  `yaml:"service_name"`
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+type LogConfig struct {
+	// Level is debug, info, warn or error.
+	Level string `yaml:"level"`
+}
+
+// Default returns the configuration used for everything that is not set
+// explicitly.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:               ":8000",
+			MetricsPort:        ":9090",
+			AppURL:             "http://localhost:8000",
+			ShutdownTimeout:    15 * time.Second,
+			HealthCheckTimeout: 2 * time.Second,
+			HealthCacheTTL:     5 * time.Second,
+		},
+		Database: DatabaseConfig{
+			Driver:      DriverMySQL,
+			SSLMode:     "disable",
+			AutoMigrate: true,
+		},
+		JWT: JWTConfig{
+			AccessTokenTTL:            15 * time.Minute,
+			RefreshTokenTTL:           7 * 24 * time.Hour,
+			MFATokenTTL:               5 * time.Minute,
+			RevokedTokenPruneInterval: time.Hour,
+		},
+		Auth: AuthConfig{
+			PasswordResetTTL: time.Hour,
+			TOTPIssuer:       "rewrite",
+		},
+		Password: PasswordConfig{
+			MinLength:     8,
+			MaxLength:     128,
+			CheckBreached: true,
+			RejectEmail:   true,
+			MinEntropy:    30,
+		},
+		// The parameters recommended by OWASP.
+		Hashing: HashingConfig{
+			Algorithm:         HashArgon2id,
+			BcryptCost:        10,
+			Argon2Memory:      19 * 1024,
+			Argon2Iterations:  2,
+			Argon2Parallelism: 1,
+		},
+		Lockout: LockoutConfig{
+			Store:           StoreSQL,
+			Window:          15 * time.Minute,
+			DelayAfter:      3,
+			Delay:           time.Second,
+			MaxDelay:        30 * time.Second,
+			AccountFailures: 10,
+			IPFailures:      100,
+			Duration:        15 * time.Minute,
+			PruneInterval:   10 * time.Minute,
+		},
+		RateLimit: RateLimitConfig{
+			Store:        RateLimitStoreMemory,
+			APIKeyHeader: "X-API-Key",
+			Signup:       RateLimitRule{Requests: 10, Window: time.Hour, Key: RateLimitByIP},
+			Auth:         RateLimitRule{Requests: 30, Window: time.Minute, Key: RateLimitByIP},
+			API:          RateLimitRule{Requests: 300, Window: time.Minute, Key: RateLimitByUser},
+		},
+		Verification: VerificationConfig{
+			TTL:          24 * time.Hour,
+			ResendLimit:  3,
+			ResendWindow: time.Hour,
+		},
+		Mail: MailConfig{
+			SMTPPort: "587",
+			From:     "no-reply@localhost",
+		},
+		Tracing: TracingConfig{
+			Exporter:    ExporterNone,
+			ServiceName: "rewrite",
+			SampleRatio: 1,
+		},
+		Log: LogConfig{
+			Level: "info",
+		},
+	}
+}
+
+// binding ties a setting to its environment variable and command line flag.
+// Secrets can also be read from the file named by <env>_FILE, and are not
+// settable by flag.
+type binding struct {
+	env    string
+	flag   string
+	usage  string
+	value  interface{}
+	secret bool
+}
+
+func (c *Config) bindings() []binding {
+	return []binding{
+		{"PORT", "port", "address the HTTP server listens on", &c.Server.Port, false},
+		{"METRICS_PORT", "metrics-port", "address the Prometheus metrics are served on, apart from the API", &c.Server.MetricsPort, false},
+		{"APP_URL", "app-url", "public base URL used in emailed links", &c.Server.AppURL, false},
+		{"SHUTDOWN_TIMEOUT", "shutdown-timeout", "time to drain requests and run shutdown hooks on stop", &c.Server.ShutdownTimeout, false},
+		{"SHUTDOWN_DELAY", "shutdown-delay", "time /readyz fails before the server stops accepting connections", &c.Server.ShutdownDelay, false},
+		{"HEALTH_CHECK_TIMEOUT", "health-check-timeout", "timeout of every health check", &c.Server.HealthCheckTimeout, false},
+		{"HEALTH_CACHE_TTL", "health-cache-ttl", "time health check results are reused", &c.Server.HealthCacheTTL, false},
+		{"TRUSTED_PROXIES", "trusted-proxies", "comma separated IPs and CIDR ranges of proxies trusted to set X-Forwarded-For", &c.Server.TrustedProxies, false},
+
+		{"DB_DRIVER", "db-driver", "database driver: mysql, postgres or sqlite", &c.Database.Driver, false},
+		{"DB_USER", "db-user", "database user", &c.Database.User, false},
+		{"DB_PASS", "", "database password", &c.Database.Password, true},
+		{"DB_HOST", "db-host", "database host", &c.Database.Host, false},
+		{"DB_PORT", "db-port", "database port", &c.Database.Port, false},
+		{"DB_NAME", "db-name", "database name, the file path for sqlite", &c.Database.Name, false},
+		{"DB_SSLMODE", "db-sslmode", "sslmode of postgres connections", &c.Database.SSLMode, false},
+		{"DB_AUTO_MIGRATE", "db-auto-migrate", "apply pending migrations on startup", &c.Database.AutoMigrate, false},
+		{"ADMIN_EMAILS", "admin-emails", "comma separated users granted the admin role on startup", &c.Database.AdminEmails, false},
+
+		{"JWT_SECRET", "", "HS256 signing secret, at least 32 bytes", &c.JWT.Secret, true},
+		{"JWT_KEY_FILES", "jwt-key-files", "comma separated PEM key files, the first one signs", &c.JWT.KeyFiles, false},
+		{"ACCESS_TOKEN_TTL", "access-token-ttl", "lifetime of access tokens", &c.JWT.AccessTokenTTL, false},
+		{"REFRESH_TOKEN_TTL", "refresh-token-ttl", "lifetime of refresh tokens", &c.JWT.RefreshTokenTTL, false},
+		{"MFA_TOKEN_TTL", "mfa-token-ttl", "time to present the second factor after the password", &c.JWT.MFATokenTTL, false},
+		{"REVOKED_TOKEN_PRUNE_INTERVAL", "revoked-token-prune-interval", "interval between prunes of the token denylist", &c.JWT.RevokedTokenPruneInterval, false},
+
+		{"PASSWORD_RESET_TTL", "password-reset-ttl", "lifetime of password reset links", &c.Auth.PasswordResetTTL, false},
+		{"TOTP_ISSUER", "totp-issuer", "issuer shown by authenticator apps", &c.Auth.TOTPIssuer, false},
+		{"HIDE_EXISTING_ACCOUNTS", "hide-existing-accounts", "answer signups with a registered email like new ones and email the owner", &c.Auth.HideExistingAccounts, false},
+
+		{"PASSWORD_MIN_LENGTH", "password-min-length", "minimum length of new passwords in characters", &c.Password.MinLength, false},
+		{"PASSWORD_MAX_LENGTH", "password-max-length", "maximum length of new passwords in bytes, at most 72 with bcrypt", &c.Password.MaxLength, false},
+		{"PASSWORD_REQUIRE_UPPER", "password-require-upper", "new passwords need an upper case letter", &c.Password.RequireUpper, false},
+		{"PASSWORD_REQUIRE_LOWER", "password-require-lower", "new passwords need a lower case letter", &c.Password.RequireLower, false},
+		{"PASSWORD_REQUIRE_DIGIT", "password-require-digit", "new passwords need a digit", &c.Password.RequireDigit, false},
+		{"PASSWORD_REQUIRE_SYMBOL", "password-require-symbol", "new passwords need a symbol", &c.Password.RequireSymbol, false},
+		{"PASSWORD_CHECK_BREACHED", "password-check-breached", "reject new passwords found in the breached password list", &c.Password.CheckBreached, false},
+		{"PASSWORD_BREACHED_PATH", "password-breached-path", "directory of Pwned Passwords range files, the bundled list when empty", &c.Password.BreachedPath, false},
+		{"PASSWORD_REJECT_EMAIL", "password-reject-email", "reject new passwords containing the email of their user", &c.Password.RejectEmail, false},
+		{"PASSWORD_MIN_ENTROPY", "password-min-entropy", "lowest estimated entropy of new passwords in bits, 0 to disable", &c.Password.MinEntropy, false},
+
+		{"PASSWORD_HASH_ALGORITHM", "password-hash-algorithm", "algorithm hashing new passwords: argon2id or bcrypt", &c.Hashing.Algorithm, false},
+		{"BCRYPT_COST", "bcrypt-cost", "cost of bcrypt hashes", &c.Hashing.BcryptCost, false},
+		{"ARGON2_MEMORY", "argon2-memory", "memory used by Argon2id hashes in KiB", &c.Hashing.Argon2Memory, false},
+		{"ARGON2_ITERATIONS", "argon2-iterations", "iterations of Argon2id hashes", &c.Hashing.Argon2Iterations, false},
+		{"ARGON2_PARALLELISM", "argon2-parallelism", "threads used by Argon2id hashes", &c.Hashing.Argon2Parallelism, false},
+
+		{"LOCKOUT_STORE", "lockout-store", "store of failed login counters: sql or memory", &c.Lockout.Store, false},
+		{"LOCKOUT_WINDOW", "lockout-window", "time after the last failed login its failures are forgotten", &c.Lockout.Window, false},
+		{"LOCKOUT_DELAY_AFTER", "lockout-delay-after", "failed logins of an account before logins are delayed", &c.Lockout.DelayAfter, false},
+		{"LOCKOUT_DELAY", "lockout-delay", "first delay after a failed login, doubling with each failure", &c.Lockout.Delay, false},
+		{"LOCKOUT_MAX_DELAY", "lockout-max-delay", "longest delay after a failed login", &c.Lockout.MaxDelay, false},
+		{"LOCKOUT_ACCOUNT_FAILURES", "lockout-account-failures", "failed logins locking an account", &c.Lockout.AccountFailures, false},
+		{"LOCKOUT_IP_FAILURES", "lockout-ip-failures", "failed logins blocking a client IP", &c.Lockout.IPFailures, false},
+		{"LOCKOUT_DURATION", "lockout-duration", "time an account or client IP stays locked", &c.Lockout.Duration, false},
+		{"LOCKOUT_PRUNE_INTERVAL", "lockout-prune-interval", "interval between prunes of stale failed login counters", &c.Lockout.PruneInterval, false},
+
+		{"RATE_LIMIT_STORE", "rate-limit-store", "store of rate limit counters: memory or redis", &c.RateLimit.Store, false},
+		{"RATE_LIMIT_REDIS_URL", "", "URL of the redis rate limit store, such as redis://localhost:6379/0", &c.RateLimit.RedisURL, true},
+		{"RATE_LIMIT_API_KEY_HEADER", "rate-limit-api-key-header", "header holding the API key of api_key rate limits", &c.RateLimit.APIKeyHeader, false},
+		{"RATE_LIMIT_SIGNUP_REQUESTS", "rate-limit-signup-requests", "signups allowed per window, 0 for no limit", &c.RateLimit.Signup.Requests, false},
+		{"RATE_LIMIT_SIGNUP_WINDOW", "rate-limit-signup-window", "window of the signup rate limit", &c.RateLimit.Signup.Window, false},
+		{"RATE_LIMIT_SIGNUP_KEY", "rate-limit-signup-key", "what signups are counted by: ip, user or api_key", &c.RateLimit.Signup.Key, false},
+		{"RATE_LIMIT_AUTH_REQUESTS", "rate-limit-auth-requests", "login, token and password requests allowed per window, 0 for no limit", &c.RateLimit.Auth.Requests, false},
+		{"RATE_LIMIT_AUTH_WINDOW", "rate-limit-auth-window", "window of the login, token and password rate limit", &c.RateLimit.Auth.Window, false},
+		{"RATE_LIMIT_AUTH_KEY", "rate-limit-auth-key", "what login, token and password requests are counted by: ip, user or api_key", &c.RateLimit.Auth.Key, false},
+		{"RATE_LIMIT_API_REQUESTS", "rate-limit-api-requests", "authenticated requests allowed per window, 0 for no limit", &c.RateLimit.API.Requests, false},
+		{"RATE_LIMIT_API_WINDOW", "rate-limit-api-window", "window of the authenticated rate limit", &c.RateLimit.API.Window, false},
+		{"RATE_LIMIT_API_KEY", "rate-limit-api-key", "what authenticated requests are counted by: ip, user or api_key", &c.RateLimit.API.Key, false},
+
+		{"REQUIRE_EMAIL_VERIFICATION", "require-email-verification", "refuse logins of unverified users", &c.Verification.Required, false},
+		{"EMAIL_VERIFICATION_TTL", "email-verification-ttl", "lifetime of email verification links", &c.Verification.TTL, false},
+		{"RESEND_VERIFICATION_LIMIT", "resend-verification-limit", "verification emails a client IP may ask for per window", &c.Verification.ResendLimit, false},
+		{"RESEND_VERIFICATION_WINDOW", "resend-verification-window", "window of the verification email limit", &c.Verification.ResendWindow, false},
+
+		{"SMTP_HOST", "smtp-host", "SMTP host, emails are printed to stdout when empty", &c.Mail.SMTPHost, false},
+		{"SMTP_PORT", "smtp-port", "SMTP port", &c.Mail.SMTPPort, false},
+		{"SMTP_USER", "smtp-user", "SMTP user", &c.Mail.SMTPUser, false},
+		{"SMTP_PASS", "", "SMTP password", &c.Mail.SMTPPassword, true},
+		{"MAIL_FROM", "mail-from", "sender of emails", &c.Mail.From, false},
+
+		{"TRACING_EXPORTER", "tracing-exporter", "trace exporter: none, stdout or otlp", &c.Tracing.Exporter, false},
+		{"TRACING_ENDPOINT", "tracing-endpoint", "base URL of the OTLP/HTTP collector", &c.Tracing.Endpoint, false},
+		{"TRACING_SERVICE_NAME", "tracing-service-name", "service name attached to spans", &c.Tracing.ServiceName, false},
+		{"TRACING_SAMPLE_RATIO", "tracing-sample-ratio", "share of new traces sampled, from 0 to 1", &c.Tracing.SampleRatio, false},
+
+		{"LOG_LEVEL", "log-level", "minimum level logged: debug, info, warn or error", &c.Log.Level, false},
+	}
+}
+
+// Load builds the configuration from the defaults, the YAML file named by the
+// -config flag or CONFIG_FILE, the environment and the flags registered on
+// flags, in that order, and validates it. flags is parsed with args.
+func Load(flags *flag.FlagSet, args []string) (*Config, error) {
+	cfg := Default()
+	bindings := cfg.bindings()
+
+	// Flags are parsed into their own values first and applied last so they
+	// override the file and the environment. Secrets have no flag, they would
+	// show up in the process list.
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "YAML configuration file")
+	flagValues := map[string]*string{}
+	for _, b := range bindings {
+		if !b.secret {
+			flagValues[b.flag] = flags.String(b.flag, "", b.usage)
+		}
+	}
+
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if *configFile != "" {
+		err = cfg.loadFile(*configFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, b := range bindings {
+		value, ok, err := lookupEnv(b)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			err = setValue(b.value, value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", b.env, err)
+			}
+		}
+	}
+
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	for _, b := range bindings {
+		if b.secret || !set[b.flag] {
+			continue
+		}
+
+		err = setValue(b.value, *flagValues[b.flag])
+		if err != nil {
+			return nil, fmt.Errorf("-%s: %w", b.flag, err)
+		}
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+
+	// An empty file, or one holding only comments, keeps the defaults.
+	err = decoder.Decode(c)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// lookupEnv reads a setting from the environment. Empty variables count as
+// unset. Secrets are read from the file named by <env>_FILE when the variable
+// itself is unset, with the trailing newline trimmed.
+func lookupEnv(b binding) (string, bool, error) {
+	if value := os.Getenv(b.env); value != "" {
+		return value, true, nil
+	}
+
+	if !b.secret {
+		return "", false, nil
+	}
+
+	path := os.Getenv(b.env + "_FILE")
+	if path == "" {
+		return "", false, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("%s_FILE: %w", b.env, err)
+	}
+
+	return strings.TrimRight(string(content), "\r\n"), true, nil
+}
+
+func setValue(target interface{}, value string) error {
+	switch target := target.(type) {
+	case *string:
+		*target = value
+	case *bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*target = parsed
+	case *int:
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*target = parsed
+	case *float64:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		*target = parsed
+	case *time.Duration:
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*target = parsed
+	case *[]string:
+		*target = splitList(value)
+	default:
+		return fmt.Errorf("unsupported setting type %T", target)
+	}
+
+	return nil
+}
+
+// splitList splits a comma separated list, dropping empty items.
+func splitList(value string) []string {
+	var values []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+
+	return values
+}
+
+// ValidationError lists every problem found in a configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (v *ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(v.Problems, "; ")
+}
+
+// Validate checks the configuration is complete and safe to run with. It
+// reports every problem at once rather than the first one.
+func (c *Config) Validate() error {
+	var problems []string
+	fail := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if _, _, err := net.SplitHostPort(c.Server.Port); err != nil {
+		fail("PORT must be an address such as :8000, got %q", c.Server.Port)
+	}
+
+	if _, _, err := net.SplitHostPort(c.Server.MetricsPort); err != nil {
+		fail("METRICS_PORT must be an address such as :9090, got %q", c.Server.MetricsPort)
+	} else if c.Server.MetricsPort == c.Server.Port {
+		fail("METRICS_PORT must differ from PORT")
+	}
+
+	if appURL, err := url.Parse(c.Server.AppURL); err != nil || appURL.Scheme == "" || appURL.Host == "" {
+		fail("APP_URL must be an absolute URL, got %q", c.Server.AppURL)
+	}
+
+	for _, proxy := range c.Server.TrustedProxies {
+		if _, err := ParseIPRange(proxy); err != nil {
+			fail("TRUSTED_PROXIES must hold IPs or CIDR ranges, got %q", proxy)
+		}
+	}
+
+	switch c.Database.Driver {
+	case DriverMySQL, DriverPostgres:
+		if c.Database.Host == "" {
+			fail("DB_HOST is required")
+		}
+		if c.Database.User == "" {
+			fail("DB_USER is required")
+		}
+	case DriverSQLite:
+	default:
+		fail("DB_DRIVER must be mysql, postgres or sqlite, got %q", c.Database.Driver)
+	}
+	if c.Database.Name == "" {
+		fail("DB_NAME is required")
+	}
+
+	if len(c.JWT.KeyFiles) == 0 {
+		switch {
+		case c.JWT.Secret == "":
+			fail("JWT_SECRET or JWT_KEY_FILES is required")
+		case len(c.JWT.Secret) < minSecretLength:
+			fail("JWT_SECRET must be at least %d bytes", minSecretLength)
+		case isWeakSecret(c.JWT.Secret):
+			fail("JWT_SECRET is a placeholder, generate a random one")
+		}
+	}
+
+	for _, b := range c.bindings() {
+		ttl, ok := b.value.(*time.Duration)
+		switch {
+		case !ok:
+		case ttl == &c.Server.ShutdownDelay:
+			if *ttl < 0 {
+				fail("%s must not be negative", b.env)
+			}
+		case *ttl <= 0:
+			fail("%s must be positive", b.env)
+		}
+	}
+
+	if c.Password.MinLength <= 0 {
+		fail("PASSWORD_MIN_LENGTH must be positive")
+	}
+
+	if c.Password.MinEntropy < 0 {
+		fail("PASSWORD_MIN_ENTROPY must not be negative")
+	}
+
+	maxLength := maxPasswordBytes
+	if c.Hashing.Algorithm == HashBcrypt {
+		maxLength = maxBcryptPasswordBytes
+	}
+
+	if c.Password.MaxLength < c.Password.MinLength || c.Password.MaxLength > maxLength {
+		fail("PASSWORD_MAX_LENGTH must be between PASSWORD_MIN_LENGTH and %d with %s", maxLength, c.Hashing.Algorithm)
+	}
+
+	switch c.Hashing.Algorithm {
+	case HashBcrypt:
+		if c.Hashing.BcryptCost < minBcryptCost || c.Hashing.BcryptCost > maxBcryptCost {
+			fail("BCRYPT_COST must be between %d and %d", minBcryptCost, maxBcryptCost)
+		}
+	case HashArgon2id:
+		if c.Hashing.Argon2Memory < 8*c.Hashing.Argon2Parallelism || c.Hashing.Argon2Iterations <= 0 || c.Hashing.Argon2Parallelism <= 0 || c.Hashing.Argon2Parallelism > 255 {
+			fail("ARGON2_ITERATIONS must be positive, ARGON2_PARALLELISM between 1 and 255 and ARGON2_MEMORY at least 8 KiB per thread")
+		}
+	default:
+		fail("PASSWORD_HASH_ALGORITHM must be argon2id or bcrypt, got %q", c.Hashing.Algorithm)
+	}
+
+	if c.Lockout.Store != StoreSQL && c.Lockout.Store != StoreMemory {
+		fail("LOCKOUT_STORE must be sql or memory, got %q", c.Lockout.Store)
+	}
+
+	if c.Lockout.DelayAfter <= 0 || c.Lockout.AccountFailures <= 0 || c.Lockout.IPFailures <= 0 {
+		fail("LOCKOUT_DELAY_AFTER, LOCKOUT_ACCOUNT_FAILURES and LOCKOUT_IP_FAILURES must be positive")
+	}
+
+	switch c.RateLimit.Store {
+	case RateLimitStoreMemory:
+	case RateLimitStoreRedis:
+		if redisURL, err := url.Parse(c.RateLimit.RedisURL); err != nil || (redisURL.Scheme != "redis" && redisURL.Scheme != "rediss") || redisURL.Host == "" {
+			fail("RATE_LIMIT_REDIS_URL must be a redis:// or rediss:// URL with the redis store")
+		}
+	default:
+		fail("RATE_LIMIT_STORE must be memory or redis, got %q", c.RateLimit.Store)
+	}
+
+	if c.RateLimit.APIKeyHeader == "" {
+		fail("RATE_LIMIT_API_KEY_HEADER is required")
+	}
+
+	for _, group := range []struct {
+		name string
+		rule RateLimitRule
+	}{
+		{"SIGNUP", c.RateLimit.Signup},
+		{"AUTH", c.RateLimit.Auth},
+		{"API", c.RateLimit.API},
+	} {
+		if group.rule.Requests < 0 {
+			fail("RATE_LIMIT_%s_REQUESTS must not be negative", group.name)
+		}
+
+		switch group.rule.Key {
+		case RateLimitByIP, RateLimitByUser, RateLimitByAPIKey:
+		default:
+			fail("RATE_LIMIT_%s_KEY must be ip, user or api_key, got %q", group.name, group.rule.Key)
+		}
+	}
+
+	if c.Verification.ResendLimit <= 0 {
+		fail("RESEND_VERIFICATION_LIMIT must be positive")
+	}
+
+	if c.Mail.SMTPHost != "" && c.Mail.SMTPUser != "" && c.Mail.SMTPPassword == "" {
+		fail("SMTP_PASS is required when SMTP_USER is set")
+	}
+
+	switch c.Tracing.Exporter {
+	case ExporterNone, ExporterStdout:
+	case ExporterOTLP:
+		if endpoint, err := url.Parse(c.Tracing.Endpoint); err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+			fail("TRACING_ENDPOINT must be an absolute URL with the otlp exporter, got %q", c.Tracing.Endpoint)
+		}
+	default:
+		fail("TRACING_EXPORTER must be none, stdout or otlp, got %q", c.Tracing.Exporter)
+	}
+
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		fail("TRACING_SAMPLE_RATIO must be between 0 and 1")
+	}
+
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		fail("LOG_LEVEL must be debug, info, warn or error, got %q", c.Log.Level)
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	return &ValidationError{problems}
+}
+
+// ParseIPRange parses a CIDR range, or a single IP as the range holding only
+// it.
+func ParseIPRange(value string) (*net.IPNet, error) {
+	if ip := net.ParseIP(value); ip != nil {
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, ipRange, err := net.ParseCIDR(value)
+	return ipRange, err
+}
+
+// isWeakSecret reports secrets that are a placeholder repeated or padded to
+// pass the length check, or made of a single repeated character.
+func isWeakSecret(secret string) bool {
+	lower := strings.ToLower(secret)
+	for _, weak := range weakSecrets {
+		if strings.Trim(strings.ReplaceAll(lower, weak, ""), "0123456789-_ ") == "" {
+			return true
+		}
+	}
+
+	return strings.Count(secret, secret[:1]) == len(secret)
+}
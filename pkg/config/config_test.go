@@ -0,0 +1,405 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+const validSecret = "k7Qp2vX9mB4nR8sT1wY6zC3fH5jL0dGa"
+
+type TestSuiteConfig struct {
+	suite.Suite
+}
+
+// SetupTest unsets every variable Load reads, empty variables count as unset.
+func (s *TestSuiteConfig) SetupTest() {
+	s.T().Setenv("CONFIG_FILE", "")
+	for _, b := range Default().bindings() {
+		s.T().Setenv(b.env, "")
+		if b.secret {
+			s.T().Setenv(b.env+"_FILE", "")
+		}
+	}
+}
+
+func (s *TestSuiteConfig) load(args ...string) (*Config, error) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	return Load(flags, args)
+}
+
+func (s *TestSuiteConfig) writeFile(name string, content string) string {
+	path := filepath.Join(s.T().TempDir(), name)
+	s.Require().NoError(os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func (s *TestSuiteConfig) setMinimalEnv() {
+	s.T().Setenv("DB_DRIVER", "sqlite")
+	s.T().Setenv("DB_NAME", "test.db")
+	s.T().Setenv("JWT_SECRET", validSecret)
+}
+
+func (s *TestSuiteConfig) TestDefaults() {
+	s.setMinimalEnv()
+
+	cfg, err := s.load()
+	s.Require().NoError(err)
+
+	expected := Default()
+	expected.Database.Driver = DriverSQLite
+	expected.Database.Name = "test.db"
+	expected.JWT.Secret = validSecret
+	s.Equal(expected, cfg)
+}
+
+func (s *TestSuiteConfig) TestPrecedence() {
+	s.setMinimalEnv()
+	file := s.writeFile("config.yaml", `
+server:
+  port: ":8001"
+  app_url: "https://file.example.com"
+  shutdown_timeout: 20s
+database:
+  admin_emails: ["file@example.com"]
+log:
+  level: warn
+`)
+
+	for _, tt := range []struct {
+		Name                    string
+		Env                     map[string]string
+		Args                    []string
+		ExpectedPort            string
+		ExpectedAppURL          string
+		ExpectedShutdownTimeout time.Duration
+		ExpectedAdminEmails     []string
+		ExpectedLevel           string
+	}{
+		{
+			Name:                    "File over defaults",
+			Args:                    []string{"-config", file},
+			ExpectedPort:            ":8001",
+			ExpectedAppURL:          "https://file.example.com",
+			ExpectedShutdownTimeout: 20 * time.Second,
+			ExpectedAdminEmails:     []string{"file@example.com"},
+			ExpectedLevel:           "warn",
+		},
+		{
+			Name:                    "File named by CONFIG_FILE",
+			Env:                     map[string]string{"CONFIG_FILE": file},
+			ExpectedPort:            ":8001",
+			ExpectedAppURL:          "https://file.example.com",
+			ExpectedShutdownTimeout: 20 * time.Second,
+			ExpectedAdminEmails:     []string{"file@example.com"},
+			ExpectedLevel:           "warn",
+		},
+		{
+			Name: "Environment over file",
+			Env: map[string]string{
+				"PORT":         ":8002",
+				"ADMIN_EMAILS": "a@example.com, ,b@example.com",
+				"LOG_LEVEL":    "error",
+			},
+			Args:                    []string{"-config", file},
+			ExpectedPort:            ":8002",
+			ExpectedAppURL:          "https://file.example.com",
+			ExpectedShutdownTimeout: 20 * time.Second,
+			ExpectedAdminEmails:     []string{"a@example.com", "b@example.com"},
+			ExpectedLevel:           "error",
+		},
+		{
+			Name: "Flags over environment",
+			Env: map[string]string{
+				"PORT":             ":8002",
+				"SHUTDOWN_TIMEOUT": "30s",
+				"LOG_LEVEL":        "error",
+			},
+			Args:                    []string{"-config", file, "-port", ":8003", "-shutdown-timeout", "40s"},
+			ExpectedPort:            ":8003",
+			ExpectedAppURL:          "https://file.example.com",
+			ExpectedShutdownTimeout: 40 * time.Second,
+			ExpectedAdminEmails:     []string{"file@example.com"},
+			ExpectedLevel:           "error",
+		},
+		{
+			Name:                    "Flag set to its default",
+			Env:                     map[string]string{"LOG_LEVEL": "error"},
+			Args:                    []string{"-log-level", "info"},
+			ExpectedPort:            ":8000",
+			ExpectedAppURL:          "http://localhost:8000",
+			ExpectedShutdownTimeout: 15 * time.Second,
+			ExpectedLevel:           "info",
+		},
+	} {
+		s.Run(tt.Name, func() {
+			for key, value := range tt.Env {
+				s.T().Setenv(key, value)
+			}
+
+			cfg, err := s.load(tt.Args...)
+			s.Require().NoError(err)
+			s.Equal(tt.ExpectedPort, cfg.Server.Port)
+			s.Equal(tt.ExpectedAppURL, cfg.Server.AppURL)
+			s.Equal(tt.ExpectedShutdownTimeout, cfg.Server.ShutdownTimeout)
+			s.Equal(tt.ExpectedAdminEmails, cfg.Database.AdminEmails)
+			s.Equal(tt.ExpectedLevel, cfg.Log.Level)
+		})
+	}
+}
+
+func (s *TestSuiteConfig) TestSecretFile() {
+	s.setMinimalEnv()
+	s.T().Setenv("JWT_SECRET", "")
+
+	for _, tt := range []struct {
+		Name           string
+		Secret         string
+		Content        string
+		ExpectedSecret string
+	}{
+		{Name: "Trailing newline trimmed", Content: validSecret + "\n", ExpectedSecret: validSecret},
+		{Name: "Windows newline trimmed", Content: validSecret + "\r\n", ExpectedSecret: validSecret},
+		{Name: "Variable over file", Secret: "m3Wq8xZ1cV6bN9kL2pR5tY7uI0oA4sDf", Content: validSecret, ExpectedSecret: "m3Wq8xZ1cV6bN9kL2pR5tY7uI0oA4sDf"},
+	} {
+		s.Run(tt.Name, func() {
+			s.T().Setenv("JWT_SECRET", tt.Secret)
+			s.T().Setenv("JWT_SECRET_FILE", s.writeFile("secret", tt.Content))
+
+			cfg, err := s.load()
+			s.Require().NoError(err)
+			s.Equal(tt.ExpectedSecret, cfg.JWT.Secret)
+		})
+	}
+}
+
+func (s *TestSuiteConfig) TestSecretFileMissing() {
+	s.setMinimalEnv()
+	s.T().Setenv("JWT_SECRET", "")
+	s.T().Setenv("JWT_SECRET_FILE", filepath.Join(s.T().TempDir(), "missing"))
+
+	_, err := s.load()
+	s.ErrorIs(err, os.ErrNotExist)
+	s.ErrorContains(err, "JWT_SECRET_FILE")
+}
+
+func (s *TestSuiteConfig) TestSecretsHaveNoFlag() {
+	s.setMinimalEnv()
+
+	_, err := s.load("-jwt-secret", validSecret)
+	s.ErrorContains(err, "flag provided but not defined: -jwt-secret")
+}
+
+func (s *TestSuiteConfig) TestFileErrors() {
+	s.setMinimalEnv()
+
+	for _, tt := range []struct {
+		Name          string
+		Content       string
+		ExpectedError string
+	}{
+		{Name: "Unknown key", Content: "server:\n  prot: \":8001\"\n", ExpectedError: "field prot not found"},
+		{Name: "Wrong type", Content: "server:\n  shutdown_timeout: soon\n", ExpectedError: "config file"},
+	} {
+		s.Run(tt.Name, func() {
+			_, err := s.load("-config", s.writeFile("config.yaml", tt.Content))
+			s.ErrorContains(err, tt.ExpectedError)
+		})
+	}
+
+	_, err := s.load("-config", filepath.Join(s.T().TempDir(), "missing.yaml"))
+	s.ErrorIs(err, os.ErrNotExist)
+}
+
+func (s *TestSuiteConfig) TestEmptyFile() {
+	s.setMinimalEnv()
+
+	for _, content := range []string{"", "# nothing configured yet\n"} {
+		cfg, err := s.load("-config", s.writeFile("config.yaml", content))
+		s.Require().NoError(err)
+		s.Equal(Default().Server, cfg.Server)
+	}
+}
+
+func (s *TestSuiteConfig) TestInvalidValues() {
+	s.setMinimalEnv()
+
+	for _, tt := range []struct {
+		Name          string
+		Env           map[string]string
+		Args          []string
+		ExpectedError string
+	}{
+		{Name: "Environment", Env: map[string]string{"BCRYPT_COST": "ten"}, ExpectedError: "BCRYPT_COST: "},
+		{Name: "Flag", Args: []string{"-access-token-ttl", "forever"}, ExpectedError: "-access-token-ttl: "},
+		{Name: "Boolean", Env: map[string]string{"DB_AUTO_MIGRATE": "maybe"}, ExpectedError: "DB_AUTO_MIGRATE: "},
+	} {
+		s.Run(tt.Name, func() {
+			for key, value := range tt.Env {
+				s.T().Setenv(key, value)
+			}
+
+			_, err := s.load(tt.Args...)
+			s.ErrorContains(err, tt.ExpectedError)
+		})
+	}
+}
+
+func (s *TestSuiteConfig) TestValidate() {
+	valid := func() *Config {
+		cfg := Default()
+		cfg.Database.Driver = DriverSQLite
+		cfg.Database.Name = "test.db"
+		cfg.JWT.Secret = validSecret
+		return cfg
+	}
+
+	for _, tt := range []struct {
+		Name            string
+		Mutate          func(*Config)
+		ExpectedProblem string
+	}{
+		{Name: "Port", Mutate: func(c *Config) { c.Server.Port = "8000" }, ExpectedProblem: `PORT must be an address such as :8000, got "8000"`},
+		{Name: "Metrics port", Mutate: func(c *Config) { c.Server.MetricsPort = "" }, ExpectedProblem: `METRICS_PORT must be an address such as :9090, got ""`},
+		{Name: "Metrics port shared with the API", Mutate: func(c *Config) { c.Server.MetricsPort = ":8000" }, ExpectedProblem: "METRICS_PORT must differ from PORT"},
+		{Name: "Relative app URL", Mutate: func(c *Config) { c.Server.AppURL = "/app" }, ExpectedProblem: `APP_URL must be an absolute URL, got "/app"`},
+		{Name: "Trusted proxy", Mutate: func(c *Config) { c.Server.TrustedProxies = []string{"10.0.0.0/33"} }, ExpectedProblem: `TRUSTED_PROXIES must hold IPs or CIDR ranges, got "10.0.0.0/33"`},
+		{Name: "Driver", Mutate: func(c *Config) { c.Database.Driver = "oracle" }, ExpectedProblem: `DB_DRIVER must be mysql, postgres or sqlite, got "oracle"`},
+		{Name: "Database host", Mutate: func(c *Config) { c.Database.Driver, c.Database.User = DriverPostgres, "app" }, ExpectedProblem: "DB_HOST is required"},
+		{Name: "Database user", Mutate: func(c *Config) { c.Database.Driver, c.Database.Host = DriverMySQL, "localhost" }, ExpectedProblem: "DB_USER is required"},
+		{Name: "Database name", Mutate: func(c *Config) { c.Database.Name = "" }, ExpectedProblem: "DB_NAME is required"},
+		{Name: "No signing key", Mutate: func(c *Config) { c.JWT.Secret = "" }, ExpectedProblem: "JWT_SECRET or JWT_KEY_FILES is required"},
+		{Name: "Short secret", Mutate: func(c *Config) { c.JWT.Secret = "k7Qp2vX9mB4nR8sT" }, ExpectedProblem: "JWT_SECRET must be at least 32 bytes"},
+		{Name: "Placeholder secret", Mutate: func(c *Config) { c.JWT.Secret = "changeme-changeme-changeme-changeme" }, ExpectedProblem: "JWT_SECRET is a placeholder, generate a random one"},
+		{Name: "Padded placeholder secret", Mutate: func(c *Config) { c.JWT.Secret = "SECRET_0123456789_0123456789_0123" }, ExpectedProblem: "JWT_SECRET is a placeholder, generate a random one"},
+		{Name: "Repeated character secret", Mutate: func(c *Config) { c.JWT.Secret = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" }, ExpectedProblem: "JWT_SECRET is a placeholder, generate a random one"},
+		{Name: "Zero duration", Mutate: func(c *Config) { c.JWT.AccessTokenTTL = 0 }, ExpectedProblem: "ACCESS_TOKEN_TTL must be positive"},
+		{Name: "Negative duration", Mutate: func(c *Config) { c.Lockout.Window = -time.Minute }, ExpectedProblem: "LOCKOUT_WINDOW must be positive"},
+		{Name: "Zero rate limit window", Mutate: func(c *Config) { c.RateLimit.API.Window = 0 }, ExpectedProblem: "RATE_LIMIT_API_WINDOW must be positive"},
+		{Name: "Negative shutdown delay", Mutate: func(c *Config) { c.Server.ShutdownDelay = -time.Second }, ExpectedProblem: "SHUTDOWN_DELAY must not be negative"},
+		{Name: "Password min length", Mutate: func(c *Config) { c.Password.MinLength = 0 }, ExpectedProblem: "PASSWORD_MIN_LENGTH must be positive"},
+		{Name: "Password min entropy", Mutate: func(c *Config) { c.Password.MinEntropy = -1 }, ExpectedProblem: "PASSWORD_MIN_ENTROPY must not be negative"},
+		{Name: "Password max length below min", Mutate: func(c *Config) { c.Password.MaxLength = 4 }, ExpectedProblem: "PASSWORD_MAX_LENGTH must be between PASSWORD_MIN_LENGTH and 1024 with argon2id"},
+		{Name: "Password max length over bcrypt", Mutate: func(c *Config) { c.Hashing.Algorithm = HashBcrypt }, ExpectedProblem: "PASSWORD_MAX_LENGTH must be between PASSWORD_MIN_LENGTH and 72 with bcrypt"},
+		{Name: "Bcrypt cost", Mutate: func(c *Config) { c.Hashing.Algorithm, c.Password.MaxLength, c.Hashing.BcryptCost = HashBcrypt, 72, 3 }, ExpectedProblem: "BCRYPT_COST must be between 4 and 31"},
+		{Name: "Argon2 parameters", Mutate: func(c *Config) { c.Hashing.Argon2Iterations = 0 }, ExpectedProblem: "ARGON2_ITERATIONS must be positive, ARGON2_PARALLELISM between 1 and 255 and ARGON2_MEMORY at least 8 KiB per thread"},
+		{Name: "Argon2 memory", Mutate: func(c *Config) { c.Hashing.Argon2Memory, c.Hashing.Argon2Parallelism = 15, 2 }, ExpectedProblem: "ARGON2_ITERATIONS must be positive, ARGON2_PARALLELISM between 1 and 255 and ARGON2_MEMORY at least 8 KiB per thread"},
+		{Name: "Hash algorithm", Mutate: func(c *Config) { c.Hashing.Algorithm = "md5" }, ExpectedProblem: `PASSWORD_HASH_ALGORITHM must be argon2id or bcrypt, got "md5"`},
+		{Name: "Lockout store", Mutate: func(c *Config) { c.Lockout.Store = "redis" }, ExpectedProblem: `LOCKOUT_STORE must be sql or memory, got "redis"`},
+		{Name: "Lockout thresholds", Mutate: func(c *Config) { c.Lockout.IPFailures = 0 }, ExpectedProblem: "LOCKOUT_DELAY_AFTER, LOCKOUT_ACCOUNT_FAILURES and LOCKOUT_IP_FAILURES must be positive"},
+		{Name: "Redis URL", Mutate: func(c *Config) {
+			c.RateLimit.Store, c.RateLimit.RedisURL = RateLimitStoreRedis, "http://localhost:6379"
+		}, ExpectedProblem: "RATE_LIMIT_REDIS_URL must be a redis:// or rediss:// URL with the redis store"},
+		{Name: "Rate limit store", Mutate: func(c *Config) { c.RateLimit.Store = "sql" }, ExpectedProblem: `RATE_LIMIT_STORE must be memory or redis, got "sql"`},
+		{Name: "API key header", Mutate: func(c *Config) { c.RateLimit.APIKeyHeader = "" }, ExpectedProblem: "RATE_LIMIT_API_KEY_HEADER is required"},
+		{Name: "Rate limit requests", Mutate: func(c *Config) { c.RateLimit.Signup.Requests = -1 }, ExpectedProblem: "RATE_LIMIT_SIGNUP_REQUESTS must not be negative"},
+		{Name: "Rate limit key", Mutate: func(c *Config) { c.RateLimit.Auth.Key = "email" }, ExpectedProblem: `RATE_LIMIT_AUTH_KEY must be ip, user or api_key, got "email"`},
+		{Name: "Resend limit", Mutate: func(c *Config) { c.Verification.ResendLimit = 0 }, ExpectedProblem: "RESEND_VERIFICATION_LIMIT must be positive"},
+		{Name: "SMTP password", Mutate: func(c *Config) { c.Mail.SMTPHost, c.Mail.SMTPUser = "smtp.example.com", "app" }, ExpectedProblem: "SMTP_PASS is required when SMTP_USER is set"},
+		{Name: "Tracing endpoint", Mutate: func(c *Config) { c.Tracing.Exporter = ExporterOTLP }, ExpectedProblem: `TRACING_ENDPOINT must be an absolute URL with the otlp exporter, got ""`},
+		{Name: "Tracing exporter", Mutate: func(c *Config) { c.Tracing.Exporter = "jaeger" }, ExpectedProblem: `TRACING_EXPORTER must be none, stdout or otlp, got "jaeger"`},
+		{Name: "Tracing sample ratio", Mutate: func(c *Config) { c.Tracing.SampleRatio = 1.5 }, ExpectedProblem: "TRACING_SAMPLE_RATIO must be between 0 and 1"},
+		{Name: "Log level", Mutate: func(c *Config) { c.Log.Level = "trace" }, ExpectedProblem: `LOG_LEVEL must be debug, info, warn or error, got "trace"`},
+	} {
+		s.Run(tt.Name, func() {
+			cfg := valid()
+			tt.Mutate(cfg)
+
+			var validationErr *ValidationError
+			s.Require().True(errors.As(cfg.Validate(), &validationErr))
+			s.Contains(validationErr.Problems, tt.ExpectedProblem)
+		})
+	}
+}
+
+func (s *TestSuiteConfig) TestValidateAccepts() {
+	for _, tt := range []struct {
+		Name   string
+		Mutate func(*Config)
+	}{
+		{Name: "Defaults", Mutate: func(c *Config) {}},
+		{Name: "Key files instead of a secret", Mutate: func(c *Config) { c.JWT.Secret, c.JWT.KeyFiles = "", []string{"signing.pem"} }},
+		{Name: "Postgres", Mutate: func(c *Config) {
+			c.Database.Driver, c.Database.Host, c.Database.User = DriverPostgres, "localhost", "app"
+		}},
+		{Name: "Trusted proxies", Mutate: func(c *Config) { c.Server.TrustedProxies = []string{"10.0.0.1", "172.16.0.0/12", "::1"} }},
+		{Name: "Redis store", Mutate: func(c *Config) {
+			c.RateLimit.Store, c.RateLimit.RedisURL = RateLimitStoreRedis, "rediss://redis:6380/1"
+		}},
+		{Name: "Upper case log level", Mutate: func(c *Config) { c.Log.Level = "DEBUG" }},
+		{Name: "No shutdown delay", Mutate: func(c *Config) { c.Server.ShutdownDelay = 0 }},
+	} {
+		s.Run(tt.Name, func() {
+			cfg := Default()
+			cfg.Database.Driver = DriverSQLite
+			cfg.Database.Name = "test.db"
+			cfg.JWT.Secret = validSecret
+			tt.Mutate(cfg)
+
+			s.NoError(cfg.Validate())
+		})
+	}
+}
+
+func (s *TestSuiteConfig) TestValidateReportsEveryProblem() {
+	cfg := Default()
+	cfg.Server.Port = "8000"
+
+	var validationErr *ValidationError
+	s.Require().True(errors.As(cfg.Validate(), &validationErr))
+	s.Equal([]string{
+		`PORT must be an address such as :8000, got "8000"`,
+		"DB_HOST is required",
+		"DB_USER is required",
+		"DB_NAME is required",
+		"JWT_SECRET or JWT_KEY_FILES is required",
+	}, validationErr.Problems)
+	s.EqualError(validationErr, `invalid configuration: PORT must be an address such as :8000, got "8000"; DB_HOST is required; DB_USER is required; DB_NAME is required; JWT_SECRET or JWT_KEY_FILES is required`)
+}
+
+func (s *TestSuiteConfig) TestLoadValidates() {
+	s.setMinimalEnv()
+	s.T().Setenv("JWT_SECRET", "secretsecretsecretsecretsecret12")
+
+	_, err := s.load()
+
+	var validationErr *ValidationError
+	s.Require().True(errors.As(err, &validationErr))
+	s.Equal([]string{"JWT_SECRET is a placeholder, generate a random one"}, validationErr.Problems)
+}
+
+func (s *TestSuiteConfig) TestParseIPRange() {
+	for _, tt := range []struct {
+		Name          string
+		Value         string
+		ExpectedRange string
+		ExpectedError bool
+	}{
+		{Name: "IPv4", Value: "10.0.0.1", ExpectedRange: "10.0.0.1/32"},
+		{Name: "IPv6", Value: "::1", ExpectedRange: "::1/128"},
+		{Name: "CIDR", Value: "10.1.2.3/8", ExpectedRange: "10.0.0.0/8"},
+		{Name: "Invalid", Value: "proxy.local", ExpectedError: true},
+	} {
+		s.Run(tt.Name, func() {
+			ipRange, err := ParseIPRange(tt.Value)
+			if tt.ExpectedError {
+				s.Error(err)
+				return
+			}
+
+			s.Require().NoError(err)
+			s.Equal(tt.ExpectedRange, ipRange.String())
+		})
+	}
+}
+
+func TestConfig(t *testing.T) {
+	suite.Run(t, new(TestSuiteConfig))
+}
@@ -1,8 +1,23 @@
 package controller
 
 import (
+	"context"
+	"rewrite/pkg/apperror"
+	"rewrite/pkg/config"
+	"rewrite/pkg/health"
+	"rewrite/pkg/instrumentation"
+	"rewrite/pkg/lifecycle"
+	"rewrite/pkg/logging"
+	"rewrite/pkg/mailer"
+	"rewrite/pkg/metrics"
+	"rewrite/pkg/ratelimit"
+	"rewrite/pkg/tracing"
+	"rewrite/pkg/utils"
+	"rewrite/pkg/validation"
+
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"golang.org/x/exp/slog"
 	"gorm.io/gorm"
 
 	userControllerPkg "rewrite/internal/user/controller"
@@ -10,13 +25,68 @@ import (
 	userServicePkg "rewrite/internal/user/service"
 )
 
-func InitControllers(e *echo.Echo, db *gorm.DB) {
+func InitControllers(e *echo.Echo, db *gorm.DB, cfg *config.Config, keyRing *utils.KeyRing, mailer mailer.Mailer, rateLimitStore ratelimit.Store, passwordChecker *validation.PasswordChecker, lc *lifecycle.Lifecycle, registry *health.Registry) {
+	e.HTTPErrorHandler = apperror.HTTPErrorHandler
+	e.Binder = &validation.Binder{}
+	e.JSONSerializer = validation.JSONSerializer{}
+	e.Validator = validation.New(cfg.Password)
+	e.IPExtractor = IPExtractor(cfg.Server.TrustedProxies)
+
+	// Outside of Recover, so requests ending in a recovered panic are traced,
+	// logged and measured too. RespondErrors writes error responses before
+	// the middlewares above read the status.
+	e.Use(tracing.Middleware())
+	e.Use(logging.RequestID(slog.Default()))
+	e.Use(logging.AccessLog())
+	e.Use(metrics.Middleware())
+	e.Use(instrumentation.RespondErrors())
 	e.Use(middleware.Recover())
 
 	e.GET("/ping", Ping)
+	e.GET("/healthz", Healthz(registry))
+	e.GET("/readyz", Readyz(registry))
+	e.GET("/.well-known/jwks.json", JWKS(keyRing))
 
 	userRepository := userRepositoryPkg.NewUserRepositoryImpl(db)
-	userService := userServicePkg.NewUserServiceImpl(userRepository)
-	userController := userControllerPkg.NewUserController(userService)
+	refreshTokenRepository := userRepositoryPkg.NewRefreshTokenRepositoryImpl(db)
+	revokedTokenRepository := userRepositoryPkg.NewRevokedTokenRepositoryImpl(db)
+	passwordResetTokenRepository := userRepositoryPkg.NewPasswordResetTokenRepositoryImpl(db)
+	twoFactorRepository := userRepositoryPkg.NewTwoFactorRepositoryImpl(db)
+	roleRepository := userRepositoryPkg.NewRoleRepositoryImpl(db)
+	loginAttemptRepository := userRepositoryPkg.NewLoginAttemptRepositoryImpl(db)
+	if cfg.Lockout.Store == config.StoreMemory {
+		loginAttemptRepository = userRepositoryPkg.NewMemoryLoginAttemptRepository()
+	}
+	userService := userServicePkg.NewUserServiceImpl(
+		userRepository,
+		refreshTokenRepository,
+		revokedTokenRepository,
+		passwordResetTokenRepository,
+		twoFactorRepository,
+		loginAttemptRepository,
+		keyRing,
+		mailer,
+		utils.NewPasswordHasher(cfg.Hashing),
+		passwordChecker,
+		cfg,
+	)
+	roleService := userServicePkg.NewRoleServiceImpl(roleRepository, userRepository)
+	userController := userControllerPkg.NewUserController(userService, roleService, keyRing, rateLimitStore, cfg)
 	userController.InitRoutes(e)
+
+	lc.Go("revoked token pruner", func(ctx context.Context) {
+		utils.RunEvery(ctx, cfg.JWT.RevokedTokenPruneInterval, func(ctx context.Context) {
+			if _, err := userService.PruneRevokedTokens(ctx); err != nil {
+				logging.FromContext(ctx).Error("pruning revoked tokens", "error", err)
+			}
+		})
+	})
+
+	lc.Go("login attempt pruner", func(ctx context.Context) {
+		utils.RunEvery(ctx, cfg.Lockout.PruneInterval, func(ctx context.Context) {
+			if _, err := userService.PruneLoginAttempts(ctx); err != nil {
+				logging.FromContext(ctx).Error("pruning login attempts", "error", err)
+			}
+		})
+	})
 }
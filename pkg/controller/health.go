@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"net/http"
+	"rewrite/pkg/health"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Healthz is the liveness probe, failing only when restarting the process
+// would help.
+func Healthz(registry *health.Registry) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return probe(c, registry.Liveness())
+	}
+}
+
+// Readyz is the readiness probe, failing while a dependency is unusable or the
+// server is shutting down.
+func Readyz(registry *health.Registry) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return probe(c, registry.Readiness())
+	}
+}
+
+func probe(c echo.Context, report health.Report) error {
+	c.Response().Header().Set("Cache-Control", "no-store")
+
+	status := http.StatusOK
+	if report.Status != health.StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+
+	return c.JSON(status, report)
+}
@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"rewrite/pkg/health"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProbes(t *testing.T) {
+	for _, tt := range []struct {
+		Name           string
+		CheckErr       error
+		ShutDown       bool
+		ExpectedStatus int
+		ExpectedReport string
+	}{
+		{Name: "Ready", ExpectedStatus: http.StatusOK, ExpectedReport: health.StatusOK},
+		{Name: "Dependency failing", CheckErr: errors.New("connection refused"), ExpectedStatus: http.StatusServiceUnavailable, ExpectedReport: health.StatusUnavailable},
+		{Name: "Shutting down", ShutDown: true, ExpectedStatus: http.StatusServiceUnavailable, ExpectedReport: health.StatusShutdown},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			var failures []string
+			registry := health.NewRegistry(time.Minute, func(name string, err error) {
+				failures = append(failures, name+": "+err.Error())
+			})
+			registry.RegisterReadiness("database", time.Second, func(ctx context.Context) error {
+				return tt.CheckErr
+			})
+			if tt.ShutDown {
+				registry.ShutDown()
+			}
+
+			e := echo.New()
+			e.GET("/healthz", Healthz(registry))
+			e.GET("/readyz", Readyz(registry))
+
+			w := httptest.NewRecorder()
+			e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			var report health.Report
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+			assert.Equal(t, tt.ExpectedStatus, w.Code)
+			assert.Equal(t, tt.ExpectedReport, report.Status)
+			assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+			if tt.CheckErr != nil {
+				assert.NotContains(t, w.Body.String(), tt.CheckErr.Error(), "dependency errors stay server-side")
+				assert.Equal(t, []string{"database: " + tt.CheckErr.Error()}, failures)
+			}
+
+			w = httptest.NewRecorder()
+			e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			assert.Equal(t, http.StatusOK, w.Code, "liveness has no checks")
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"rewrite/pkg/config"
+
+	"github.com/labstack/echo/v4"
+)
+
+// IPExtractor finds the client IP of requests. Without trusted proxies it is
+// the peer address, as X-Forwarded-For is set by the client and anyone could
+// pick a new IP on every request to escape lockouts and rate limits. With
+// them it is the nearest X-Forwarded-For entry that is not a trusted proxy.
+// trustedProxies are checked by config.Validate.
+func IPExtractor(trustedProxies []string) echo.IPExtractor {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, proxy := range trustedProxies {
+		ipRange, err := config.ParseIPRange(proxy)
+		if err != nil {
+			continue
+		}
+
+		options = append(options, echo.TrustIPRange(ipRange))
+	}
+
+	return echo.ExtractIPFromXFFHeader(options...)
+}
@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIPExtractor(t *testing.T) {
+	for _, tt := range []struct {
+		Name           string
+		TrustedProxies []string
+		RemoteAddr     string
+		ForwardedFor   string
+		Expected       string
+	}{
+		{Name: "Peer address without proxies", RemoteAddr: "203.0.113.7:4000", Expected: "203.0.113.7"},
+		{Name: "Spoofed header without proxies", RemoteAddr: "203.0.113.7:4000", ForwardedFor: "198.51.100.1", Expected: "203.0.113.7"},
+		{Name: "Private peer is not trusted by default", RemoteAddr: "10.0.0.2:4000", ForwardedFor: "198.51.100.1", Expected: "10.0.0.2"},
+		{
+			Name:           "Header of a trusted proxy",
+			TrustedProxies: []string{"10.0.0.0/8"},
+			RemoteAddr:     "10.0.0.2:4000",
+			ForwardedFor:   "198.51.100.1",
+			Expected:       "198.51.100.1",
+		},
+		{
+			Name:           "Entries spoofed before the trusted proxy are skipped",
+			TrustedProxies: []string{"10.0.0.2"},
+			RemoteAddr:     "10.0.0.2:4000",
+			ForwardedFor:   "198.51.100.9, 198.51.100.1",
+			Expected:       "198.51.100.1",
+		},
+		{
+			Name:           "Header of an untrusted peer",
+			TrustedProxies: []string{"10.0.0.0/8"},
+			RemoteAddr:     "203.0.113.7:4000",
+			ForwardedFor:   "198.51.100.1",
+			Expected:       "203.0.113.7",
+		},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.RemoteAddr
+			if tt.ForwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", tt.ForwardedFor)
+			}
+
+			assert.Equal(t, tt.Expected, IPExtractor(tt.TrustedProxies)(r))
+		})
+	}
+}
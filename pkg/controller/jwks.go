@@ -0,0 +1,17 @@
+package controller
+
+import (
+	"net/http"
+	"rewrite/pkg/utils"
+
+	"github.com/labstack/echo/v4"
+)
+
+// JWKS publishes the public keys of the key ring so other services can verify
+// our tokens without holding any secret.
+func JWKS(keyRing *utils.KeyRing) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Response().Header().Set("Cache-Control", "public, max-age=300")
+		return c.JSON(http.StatusOK, keyRing.JWKS())
+	}
+}
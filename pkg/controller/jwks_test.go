@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"rewrite/pkg/utils"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWKS(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+	key, err := utils.LoadKeyFile(path)
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		Name         string
+		KeyRing      *utils.KeyRing
+		ExpectedKids []string
+	}{
+		{Name: "Asymmetric key", KeyRing: utils.NewKeyRing(key), ExpectedKids: []string{key.ID}},
+		{Name: "Shared secret", KeyRing: utils.NewHMACKeyRing([]byte("secret")), ExpectedKids: []string{}},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			e := echo.New()
+			e.GET("/.well-known/jwks.json", JWKS(tt.KeyRing))
+
+			w := httptest.NewRecorder()
+			e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, echo.MIMEApplicationJSONCharsetUTF8, w.Header().Get(echo.HeaderContentType))
+			assert.Equal(t, "public, max-age=300", w.Header().Get("Cache-Control"))
+
+			var set utils.JWKSet
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &set))
+			kids := []string{}
+			for _, jwk := range set.Keys {
+				kids = append(kids, jwk.Kid)
+				assert.Equal(t, "OKP", jwk.Kty)
+				assert.Equal(t, "EdDSA", jwk.Alg)
+			}
+			assert.Equal(t, tt.ExpectedKids, kids)
+		})
+	}
+}
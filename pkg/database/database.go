@@ -1,18 +1,40 @@
 package database
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"net/url"
 	"rewrite/pkg/config"
 	"rewrite/pkg/entity"
+	"rewrite/pkg/logging"
+	"strings"
 
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-func ConnectDB() (*gorm.DB, error) {
-	// mysql
-	conString := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local", config.DB_USER, config.DB_PASS, config.DB_HOST, config.DB_PORT, config.DB_NAME)
-	db, err := gorm.Open(mysql.Open(conString), &gorm.Config{})
+var defaultPorts = map[string]string{
+	config.DriverMySQL:    "3306",
+	config.DriverPostgres: "5432",
+}
+
+func ConnectDB(cfg config.DatabaseConfig) (*gorm.DB, error) {
+	dialector, err := Dialector(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger: logging.GormLogger{},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Use(logging.GormPlugin{})
 	if err != nil {
 		return nil, err
 	}
@@ -20,8 +42,136 @@ func ConnectDB() (*gorm.DB, error) {
 	return db, nil
 }
 
+// Dialector returns the GORM dialector of the configured driver.
+func Dialector(cfg config.DatabaseConfig) (gorm.Dialector, error) {
+	port := cfg.Port
+	if port == "" {
+		port = defaultPorts[cfg.Driver]
+	}
+
+	switch cfg.Driver {
+	case config.DriverMySQL:
+		conString := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local", cfg.User, cfg.Password, cfg.Host, port, cfg.Name)
+		return mysql.Open(conString), nil
+	case config.DriverPostgres:
+		conURL := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(cfg.User, cfg.Password),
+			Host:     net.JoinHostPort(cfg.Host, port),
+			Path:     cfg.Name,
+			RawQuery: url.Values{"sslmode": {cfg.SSLMode}}.Encode(),
+		}
+		return postgres.Open(conURL.String()), nil
+	case config.DriverSQLite:
+		// Foreign keys are off by default in SQLite, the busy timeout lets
+		// concurrent writers wait for each other instead of failing.
+		return sqlite.Open(cfg.Name + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"), nil
+	}
+
+	return nil, fmt.Errorf("unsupported database driver %q", cfg.Driver)
+}
+
+// MigrateDB applies the pending migrations embedded in the binary.
 func MigrateDB(db *gorm.DB) error {
-	return db.AutoMigrate(
-		entity.User{},
-	)
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	_, err = migrator.Up()
+	return err
+}
+
+// CheckSchema fails when the database schema is not at the version the binary
+// expects, so the server does not start against a schema it does not know.
+func CheckSchema(db *gorm.DB) error {
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	return migrator.Check()
+}
+
+// EmailCollisions returns the lowercased emails shared by several accounts.
+// Those accounts were registered before emails were lowercased, and only the
+// one already in lower case, if any, can log in until an operator merges or
+// renames them.
+func EmailCollisions(db *gorm.DB) ([]string, error) {
+	var emails []string
+	err := db.Model(&entity.User{}).
+		Unscoped().
+		Select("LOWER(email)").
+		Group("LOWER(email)").
+		Having("COUNT(*) > 1").
+		Order("LOWER(email)").
+		Scan(&emails).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return emails, nil
+}
+
+// PingDB checks that a connection to the database can be established.
+func PingDB(db *gorm.DB, ctx context.Context) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	return sqlDB.PingContext(ctx)
+}
+
+// SeedDB makes sure the built-in permissions and the admin role holding all of
+// them exist, and grants the admin role to the users with adminEmails.
+func SeedDB(db *gorm.DB, adminEmails []string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var permissions []entity.Permission
+		for _, name := range entity.BuiltInPermissions {
+			permission := entity.Permission{Name: name}
+			err := tx.Where(permission).FirstOrCreate(&permission).Error
+			if err != nil {
+				return err
+			}
+
+			permissions = append(permissions, permission)
+		}
+
+		admin := entity.Role{Name: entity.RoleAdmin}
+		err := tx.Where(admin).Attrs(entity.Role{Description: "Administrator"}).FirstOrCreate(&admin).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&admin).Association("Permissions").Append(permissions)
+		if err != nil {
+			return err
+		}
+
+		if len(adminEmails) == 0 {
+			return nil
+		}
+
+		// Stored emails are lower case.
+		emails := make([]string, len(adminEmails))
+		for i, email := range adminEmails {
+			emails[i] = strings.ToLower(strings.TrimSpace(email))
+		}
+
+		var users entity.Users
+		err = tx.Where("email IN ?", emails).Find(&users).Error
+		if err != nil {
+			return err
+		}
+
+		for i := range users {
+			err = tx.Model(&users[i]).Association("Roles").Append(&admin)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
 }
@@ -0,0 +1,473 @@
+package database
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Every dialect has its own migrations directory, named after the dialect.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+var (
+	ErrSchemaBehind    = errors.New("database schema is behind, pending migrations must be applied")
+	ErrSchemaAhead     = errors.New("database schema is ahead of this binary")
+	ErrMigrationLocked = errors.New("another instance is migrating the database")
+	ErrNothingToRevert = errors.New("no migration to revert")
+)
+
+// migrationLockName identifies the lock held while migrating, so concurrent
+// instances wait for each other instead of applying the same migrations twice.
+// PostgreSQL advisory locks are identified by a number instead.
+const (
+	migrationLockName = "schema_migrations"
+	migrationLockKey  = 7348519201
+)
+
+// Migration is a versioned schema change read from the migrations directory.
+// Files are named <version>_<name>.up.sql and <version>_<name>.down.sql.
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus tells whether a migration known to the binary or recorded in
+// the database has been applied.
+type MigrationStatus struct {
+	Version   uint
+	Name      string
+	AppliedAt *time.Time
+	// Unknown is set for migrations recorded in the database that the binary
+	// does not ship, meaning the schema is ahead.
+	Unknown bool
+}
+
+// schemaMigration is a row of the schema_migrations table, one per applied
+// migration.
+type schemaMigration struct {
+	Version   uint   `gorm:"primarykey;autoIncrement:false"`
+	Name      string `gorm:"size:255"`
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+type Migrator struct {
+	db          *gorm.DB
+	migrations  []Migration
+	lockTimeout time.Duration
+}
+
+// NewMigrator returns a migrator for the migrations embedded in the binary for
+// the dialect of db.
+func NewMigrator(db *gorm.DB) (*Migrator, error) {
+	return newMigrator(db, migrationFiles, "migrations/"+db.Dialector.Name())
+}
+
+func newMigrator(db *gorm.DB, fsys fs.FS, dir string) (*Migrator, error) {
+	migrations, err := LoadMigrations(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db:          db,
+		migrations:  migrations,
+		lockTimeout: time.Minute,
+	}, nil
+}
+
+// LoadMigrations reads the migrations of dir, sorted by version. Every version
+// needs both an up and a down file.
+func LoadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[uint]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		version, name, direction, err := parseMigrationFilename(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := fs.ReadFile(fsys, dir+"/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		} else if migration.Name != name {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, name)
+		}
+
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+func parseMigrationFilename(filename string) (uint, string, string, error) {
+	base := strings.TrimSuffix(filename, ".sql")
+	dot := strings.LastIndex(base, ".")
+	underscore := strings.Index(base, "_")
+	if base == filename || dot == -1 || underscore == -1 || underscore > dot {
+		return 0, "", "", fmt.Errorf("malformed migration filename %q", filename)
+	}
+
+	direction := base[dot+1:]
+	if direction != "up" && direction != "down" {
+		return 0, "", "", fmt.Errorf("malformed migration filename %q", filename)
+	}
+
+	version, err := strconv.ParseUint(base[:underscore], 10, 32)
+	if err != nil || version == 0 {
+		return 0, "", "", fmt.Errorf("malformed migration filename %q", filename)
+	}
+
+	return uint(version), base[underscore+1 : dot], direction, nil
+}
+
+// Up applies every pending migration in order and returns how many were
+// applied. It refuses to run against a schema that is ahead of the binary.
+func (m *Migrator) Up() (int, error) {
+	applied := 0
+	err := m.withLock(func(db *gorm.DB) error {
+		pending, err := m.pending(db)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range pending {
+			err = m.apply(db, migration.Version, migration.Name, migration.Up, true)
+			if err != nil {
+				return err
+			}
+
+			applied++
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down reverts the latest applied migration and returns it.
+func (m *Migrator) Down() (*Migration, error) {
+	var reverted *Migration
+	err := m.withLock(func(db *gorm.DB) error {
+		versions, err := m.appliedVersions(db)
+		if err != nil {
+			return err
+		}
+
+		if len(versions) == 0 {
+			return ErrNothingToRevert
+		}
+
+		latest := versions[len(versions)-1]
+		migration := m.find(latest.Version)
+		if migration == nil {
+			return ErrSchemaAhead
+		}
+
+		err = m.apply(db, migration.Version, migration.Name, migration.Down, false)
+		if err != nil {
+			return err
+		}
+
+		reverted = migration
+		return nil
+	})
+
+	return reverted, err
+}
+
+// Status lists every migration with the time it was applied, including the
+// ones recorded in the database that the binary does not know about.
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	err := m.ensureTable(m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := m.appliedVersions(m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	appliedAt := map[uint]time.Time{}
+	for _, version := range versions {
+		appliedAt[version.Version] = version.AppliedAt
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if at, ok := appliedAt[migration.Version]; ok {
+			status.AppliedAt = &at
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	for _, version := range versions {
+		if m.find(version.Version) == nil {
+			at := version.AppliedAt
+			statuses = append(statuses, MigrationStatus{Version: version.Version, Name: version.Name, AppliedAt: &at, Unknown: true})
+		}
+	}
+
+	return statuses, nil
+}
+
+// Check makes sure the database schema is exactly at the version the binary
+// expects, returning ErrSchemaBehind or ErrSchemaAhead otherwise.
+func (m *Migrator) Check() error {
+	statuses, err := m.Status()
+	if err != nil {
+		return err
+	}
+
+	for _, status := range statuses {
+		if status.Unknown {
+			return fmt.Errorf("%w: migration %d_%s is not known", ErrSchemaAhead, status.Version, status.Name)
+		}
+	}
+
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			return fmt.Errorf("%w: migration %d_%s is pending", ErrSchemaBehind, status.Version, status.Name)
+		}
+	}
+
+	return nil
+}
+
+// Version returns the latest migration the binary ships.
+func (m *Migrator) Version() uint {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+func (m *Migrator) pending(db *gorm.DB) ([]Migration, error) {
+	versions, err := m.appliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := map[uint]bool{}
+	for _, version := range versions {
+		if m.find(version.Version) == nil {
+			return nil, fmt.Errorf("%w: migration %d_%s is not known", ErrSchemaAhead, version.Version, version.Name)
+		}
+
+		applied[version.Version] = true
+	}
+
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if !applied[migration.Version] {
+			pending = append(pending, migration)
+		}
+	}
+
+	return pending, nil
+}
+
+func (m *Migrator) find(version uint) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+
+	return nil
+}
+
+func (m *Migrator) appliedVersions(db *gorm.DB) ([]schemaMigration, error) {
+	var versions []schemaMigration
+	err := db.Order("version").Find(&versions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+// apply runs the statements of a migration and records it in, or removes it
+// from, schema_migrations. Note that MySQL commits DDL statements implicitly,
+// so there a migration failing halfway is not rolled back entirely.
+func (m *Migrator) apply(db *gorm.DB, version uint, name string, script string, up bool) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range splitStatements(script) {
+			err := tx.Exec(statement).Error
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", version, name, err)
+			}
+		}
+
+		if up {
+			return tx.Create(&schemaMigration{Version: version, Name: name, AppliedAt: time.Now()}).Error
+		}
+
+		return tx.Delete(&schemaMigration{Version: version}).Error
+	})
+}
+
+func (m *Migrator) ensureTable(db *gorm.DB) error {
+	if db.Migrator().HasTable(&schemaMigration{}) {
+		return nil
+	}
+
+	return db.Migrator().CreateTable(&schemaMigration{})
+}
+
+// withLock runs fc on a single connection holding the migration lock.
+func (m *Migrator) withLock(fc func(db *gorm.DB) error) error {
+	return m.db.Connection(func(db *gorm.DB) error {
+		unlock, err := m.lock(db)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		err = m.ensureTable(db)
+		if err != nil {
+			return err
+		}
+
+		return fc(db)
+	})
+}
+
+// lock takes the migration lock of the dialect, waiting up to lockTimeout.
+// SQLite databases are only used by a single process in development and tests,
+// so they are not locked.
+func (m *Migrator) lock(db *gorm.DB) (func(), error) {
+	switch db.Dialector.Name() {
+	case "mysql":
+		var acquired int
+		err := db.Raw("SELECT GET_LOCK(?, ?)", migrationLockName, int(m.lockTimeout.Seconds())).Scan(&acquired).Error
+		if err != nil {
+			return nil, err
+		}
+
+		if acquired != 1 {
+			return nil, ErrMigrationLocked
+		}
+
+		return func() {
+			db.Exec("SELECT RELEASE_LOCK(?)", migrationLockName)
+		}, nil
+	case "postgres":
+		deadline := time.Now().Add(m.lockTimeout)
+		for {
+			var acquired bool
+			err := db.Raw("SELECT pg_try_advisory_lock(?)", migrationLockKey).Scan(&acquired).Error
+			if err != nil {
+				return nil, err
+			}
+
+			if acquired {
+				return func() {
+					db.Exec("SELECT pg_advisory_unlock(?)", migrationLockKey)
+				}, nil
+			}
+
+			if time.Now().After(deadline) {
+				return nil, ErrMigrationLocked
+			}
+
+			time.Sleep(500 * time.Millisecond)
+		}
+	case "sqlite":
+		return func() {}, nil
+	}
+
+	return nil, fmt.Errorf("migrations are not supported on %s", db.Dialector.Name())
+}
+
+// splitStatements splits a script into statements on the semicolons outside
+// of quotes. -- comments are dropped.
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	var quote rune
+
+	runes := []rune(script)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			// A doubled quote escapes itself, it closes and reopens.
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			current.WriteRune('\n')
+			continue
+		case r == ';':
+			if statement := strings.TrimSpace(current.String()); statement != "" {
+				statements = append(statements, statement)
+			}
+			current.Reset()
+			continue
+		}
+
+		current.WriteRune(r)
+	}
+
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+
+	return statements
+}
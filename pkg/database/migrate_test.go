@@ -0,0 +1,345 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"rewrite/pkg/entity"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// baselineUser is the user of the databases set up by AutoMigrate before
+// versioned migrations existed.
+type baselineUser struct {
+	gorm.Model
+	Email    string `gorm:"unique"`
+	Password string
+}
+
+func (baselineUser) TableName() string {
+	return "users"
+}
+
+var testMigrations = fstest.MapFS{
+	"migrations/0001_create_notes.up.sql": {Data: []byte(`-- Notes; with a semicolon in a comment.
+CREATE TABLE notes (
+  id integer PRIMARY KEY,
+  body text
+);`)},
+	"migrations/0001_create_notes.down.sql": {Data: []byte("DROP TABLE notes;\n")},
+	"migrations/0002_seed_notes.up.sql": {Data: []byte(`INSERT INTO notes (body) VALUES ('first; and
+still first;');
+INSERT INTO notes (body) VALUES ('it''s second');
+`)},
+	"migrations/0002_seed_notes.down.sql": {Data: []byte("DELETE FROM notes;\n")},
+}
+
+type TestSuiteMigrator struct {
+	suite.Suite
+	db *gorm.DB
+}
+
+func (s *TestSuiteMigrator) SetupTest() {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	s.Require().NoError(err)
+
+	// Every connection to an in-memory database gets a database of its own.
+	sqlDB, err := db.DB()
+	s.Require().NoError(err)
+	sqlDB.SetMaxOpenConns(1)
+
+	s.db = db
+}
+
+func (s *TestSuiteMigrator) migrator(fsys fstest.MapFS) *Migrator {
+	migrator, err := newMigrator(s.db, fsys, "migrations")
+	s.Require().NoError(err)
+	return migrator
+}
+
+func (s *TestSuiteMigrator) notes() []string {
+	var bodies []string
+	s.Require().NoError(s.db.Raw("SELECT body FROM notes ORDER BY id").Scan(&bodies).Error)
+	return bodies
+}
+
+func (s *TestSuiteMigrator) TestRoundTrip() {
+	migrator := s.migrator(testMigrations)
+	s.Equal(uint(2), migrator.Version())
+	s.ErrorIs(migrator.Check(), ErrSchemaBehind)
+
+	applied, err := migrator.Up()
+	s.Require().NoError(err)
+	s.Equal(2, applied)
+	s.NoError(migrator.Check())
+	s.Equal([]string{"first; and\nstill first;", "it's second"}, s.notes())
+
+	applied, err = migrator.Up()
+	s.NoError(err)
+	s.Zero(applied, "applied migrations are not applied twice")
+
+	reverted, err := migrator.Down()
+	s.Require().NoError(err)
+	s.Equal(uint(2), reverted.Version)
+	s.Empty(s.notes())
+	s.ErrorIs(migrator.Check(), ErrSchemaBehind)
+
+	reverted, err = migrator.Down()
+	s.Require().NoError(err)
+	s.Equal(uint(1), reverted.Version)
+	s.False(s.db.Migrator().HasTable("notes"))
+
+	_, err = migrator.Down()
+	s.ErrorIs(err, ErrNothingToRevert)
+
+	applied, err = migrator.Up()
+	s.Require().NoError(err)
+	s.Equal(2, applied)
+	s.Len(s.notes(), 2)
+
+	statuses, err := migrator.Status()
+	s.NoError(err)
+	s.Require().Len(statuses, 2)
+	for _, status := range statuses {
+		s.NotNil(status.AppliedAt)
+		s.False(status.Unknown)
+	}
+}
+
+func (s *TestSuiteMigrator) TestSchemaAhead() {
+	_, err := s.migrator(testMigrations).Up()
+	s.Require().NoError(err)
+
+	older := s.migrator(fstest.MapFS{
+		"migrations/0001_create_notes.up.sql":   testMigrations["migrations/0001_create_notes.up.sql"],
+		"migrations/0001_create_notes.down.sql": testMigrations["migrations/0001_create_notes.down.sql"],
+	})
+
+	s.ErrorIs(older.Check(), ErrSchemaAhead)
+
+	_, err = older.Up()
+	s.ErrorIs(err, ErrSchemaAhead)
+
+	_, err = older.Down()
+	s.ErrorIs(err, ErrSchemaAhead)
+	s.Len(s.notes(), 2, "unknown migrations are not reverted")
+
+	statuses, err := older.Status()
+	s.NoError(err)
+	s.Require().Len(statuses, 2)
+	s.Equal(MigrationStatus{Version: 2, Name: "seed_notes", AppliedAt: statuses[1].AppliedAt, Unknown: true}, statuses[1])
+}
+
+func (s *TestSuiteMigrator) TestFailedMigrationIsRolledBack() {
+	migrator := s.migrator(fstest.MapFS{
+		"migrations/0001_create_notes.up.sql":   testMigrations["migrations/0001_create_notes.up.sql"],
+		"migrations/0001_create_notes.down.sql": testMigrations["migrations/0001_create_notes.down.sql"],
+		"migrations/0002_broken.up.sql":         {Data: []byte("INSERT INTO notes (body) VALUES ('kept?');\nINSERT INTO missing VALUES (1);\n")},
+		"migrations/0002_broken.down.sql":       {Data: []byte("SELECT 1;\n")},
+	})
+
+	applied, err := migrator.Up()
+	s.Error(err)
+	s.Contains(err.Error(), "migration 2_broken")
+	s.Equal(1, applied)
+	s.Empty(s.notes())
+	s.ErrorIs(migrator.Check(), ErrSchemaBehind)
+}
+
+func (s *TestSuiteMigrator) TestLoadMigrationsErrors() {
+	up := &fstest.MapFile{Data: []byte("SELECT 1;")}
+
+	for _, tt := range []struct {
+		Name     string
+		Files    fstest.MapFS
+		Expected string
+	}{
+		{Name: "Without version", Files: fstest.MapFS{"migrations/create_notes.up.sql": up}, Expected: `malformed migration filename "create_notes.up.sql"`},
+		{Name: "Version zero", Files: fstest.MapFS{"migrations/0_notes.up.sql": up}, Expected: `malformed migration filename "0_notes.up.sql"`},
+		{Name: "Version not a number", Files: fstest.MapFS{"migrations/v1_notes.up.sql": up}, Expected: `malformed migration filename "v1_notes.up.sql"`},
+		{Name: "Unknown direction", Files: fstest.MapFS{"migrations/0001_notes.sideways.sql": up}, Expected: `malformed migration filename "0001_notes.sideways.sql"`},
+		{Name: "Without direction", Files: fstest.MapFS{"migrations/0001_notes.sql": up}, Expected: `malformed migration filename "0001_notes.sql"`},
+		{Name: "Not SQL", Files: fstest.MapFS{"migrations/0001_notes.up.txt": up}, Expected: `malformed migration filename "0001_notes.up.txt"`},
+		{
+			Name:     "Duplicate version",
+			Files:    fstest.MapFS{"migrations/0001_notes.up.sql": up, "migrations/0001_other.down.sql": up},
+			Expected: "migration 1 has two names: notes and other",
+		},
+		{Name: "Without down", Files: fstest.MapFS{"migrations/0001_notes.up.sql": up}, Expected: "migration 1_notes needs both an up and a down file"},
+	} {
+		s.Run(tt.Name, func() {
+			_, err := LoadMigrations(tt.Files, "migrations")
+			s.EqualError(err, tt.Expected)
+		})
+	}
+
+	_, err := LoadMigrations(fstest.MapFS{}, "migrations")
+	s.True(errors.Is(err, fs.ErrNotExist))
+}
+
+func (s *TestSuiteMigrator) TestSplitStatements() {
+	for _, tt := range []struct {
+		Name     string
+		Script   string
+		Expected []string
+	}{
+		{Name: "Statements on their own lines", Script: "SELECT 1;\nSELECT 2;\n", Expected: []string{"SELECT 1", "SELECT 2"}},
+		{Name: "Statements on one line", Script: "SELECT 1; SELECT 2;", Expected: []string{"SELECT 1", "SELECT 2"}},
+		{Name: "Last statement without semicolon", Script: "SELECT 1;\nSELECT 2", Expected: []string{"SELECT 1", "SELECT 2"}},
+		{Name: "Semicolon in single quotes", Script: "INSERT INTO t VALUES ('a;\nb;');", Expected: []string{"INSERT INTO t VALUES ('a;\nb;')"}},
+		{Name: "Escaped single quote", Script: "INSERT INTO t VALUES ('it''s; fine');", Expected: []string{"INSERT INTO t VALUES ('it''s; fine')"}},
+		{Name: "Semicolon in identifiers", Script: "CREATE TABLE \"a;b\" (`c;d` text);", Expected: []string{"CREATE TABLE \"a;b\" (`c;d` text)"}},
+		{Name: "Comments are dropped", Script: "-- first; comment\nSELECT 1; -- trailing; comment\n-- last", Expected: []string{"SELECT 1"}},
+		{Name: "Dashes in quotes", Script: "SELECT '--;';", Expected: []string{"SELECT '--;'"}},
+		{Name: "Empty statements", Script: ";\n  ;\n", Expected: nil},
+	} {
+		s.Run(tt.Name, func() {
+			s.Equal(tt.Expected, splitStatements(tt.Script))
+		})
+	}
+}
+
+// TestEmbeddedMigrations makes sure every dialect ships the same migrations.
+func (s *TestSuiteMigrator) TestEmbeddedMigrations() {
+	names := map[string][]string{}
+	for _, dialect := range []string{"mysql", "postgres", "sqlite"} {
+		migrations, err := LoadMigrations(migrationFiles, "migrations/"+dialect)
+		s.Require().NoError(err, dialect)
+
+		for _, migration := range migrations {
+			names[dialect] = append(names[dialect], fmt.Sprintf("%d_%s", migration.Version, migration.Name))
+		}
+	}
+
+	s.NotEmpty(names["sqlite"])
+	s.Equal(names["sqlite"], names["mysql"])
+	s.Equal(names["sqlite"], names["postgres"])
+}
+
+// embeddedMigrationsUpTo returns the embedded migrations of dialect up to
+// version, to set up the data a later migration changes.
+func (s *TestSuiteMigrator) embeddedMigrationsUpTo(dialect string, version uint) fstest.MapFS {
+	migrations, err := LoadMigrations(migrationFiles, "migrations/"+dialect)
+	s.Require().NoError(err)
+
+	files := fstest.MapFS{}
+	for _, migration := range migrations {
+		if migration.Version <= version {
+			name := fmt.Sprintf("migrations/%04d_%s", migration.Version, migration.Name)
+			files[name+".up.sql"] = &fstest.MapFile{Data: []byte(migration.Up)}
+			files[name+".down.sql"] = &fstest.MapFile{Data: []byte(migration.Down)}
+		}
+	}
+
+	return files
+}
+
+func (s *TestSuiteMigrator) TestAdoptBaselineDatabase() {
+	s.Require().NoError(s.db.AutoMigrate(&baselineUser{}))
+	s.Require().NoError(s.db.Create(&baselineUser{Email: "old@example.com", Password: "hash"}).Error)
+	s.Require().False(s.db.Migrator().HasColumn("users", "verified_at"))
+
+	s.Require().NoError(MigrateDB(s.db))
+	s.NoError(CheckSchema(s.db))
+	s.True(s.db.Migrator().HasColumn("users", "verified_at"))
+
+	var user entity.User
+	s.Require().NoError(s.db.Where("email = ?", "old@example.com").First(&user).Error)
+	s.Equal("hash", user.Password)
+
+	s.NoError(s.db.Create(&entity.User{Email: "new@example.com", Password: "hash"}).Error)
+}
+
+func (s *TestSuiteMigrator) TestLowercaseEmails() {
+	_, err := s.migrator(s.embeddedMigrationsUpTo("sqlite", 2)).Up()
+	s.Require().NoError(err)
+
+	for _, email := range []string{"Mixed@Example.com", "lower@example.com", "Shared@example.com", "shared@example.com", "SHARED@EXAMPLE.COM"} {
+		s.Require().NoError(s.db.Exec("INSERT INTO users (email, password) VALUES (?, '')", email).Error)
+	}
+
+	migrator, err := NewMigrator(s.db)
+	s.Require().NoError(err)
+	_, err = migrator.Up()
+	s.Require().NoError(err)
+
+	var emails []string
+	s.Require().NoError(s.db.Raw("SELECT email FROM users ORDER BY id").Scan(&emails).Error)
+	s.Equal([]string{"mixed@example.com", "lower@example.com", "Shared@example.com", "shared@example.com", "SHARED@EXAMPLE.COM"}, emails)
+
+	collisions, err := EmailCollisions(s.db)
+	s.NoError(err)
+	s.Equal([]string{"shared@example.com"}, collisions)
+}
+
+func (s *TestSuiteMigrator) TestBuiltInRoles() {
+	for _, tt := range []struct {
+		Name   string
+		Seeded bool
+	}{
+		{Name: "Fresh database"},
+		{Name: "Seeded by an earlier startup", Seeded: true},
+	} {
+		s.Run(tt.Name, func() {
+			s.SetupTest()
+
+			_, err := s.migrator(s.embeddedMigrationsUpTo("sqlite", 3)).Up()
+			s.Require().NoError(err)
+			if tt.Seeded {
+				s.Require().NoError(SeedDB(s.db, nil))
+			}
+
+			migrator, err := NewMigrator(s.db)
+			s.Require().NoError(err)
+			_, err = migrator.Up()
+			s.Require().NoError(err)
+
+			var roles entity.Roles
+			s.Require().NoError(s.db.Preload("Permissions").Find(&roles).Error)
+			s.Require().Len(roles, 1)
+			s.Equal(entity.RoleAdmin, roles[0].Name)
+			s.False(roles[0].CreatedAt.IsZero())
+
+			var permissions []string
+			for _, permission := range roles[0].Permissions {
+				permissions = append(permissions, permission.Name)
+			}
+			s.ElementsMatch([]string{entity.PermissionUsersList, entity.PermissionUsersManage, entity.PermissionRolesManage}, permissions)
+
+			s.Require().NoError(SeedDB(s.db, nil))
+			var count int64
+			s.Require().NoError(s.db.Table("role_permissions").Count(&count).Error)
+			s.Equal(int64(len(entity.BuiltInPermissions)), count)
+		})
+	}
+}
+
+func (s *TestSuiteMigrator) TestVerifyExistingUsers() {
+	createdAt := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.Require().NoError(s.db.AutoMigrate(&baselineUser{}))
+	s.Require().NoError(s.db.Create(&baselineUser{Model: gorm.Model{CreatedAt: createdAt}, Email: "old@example.com"}).Error)
+	s.Require().NoError(s.db.Exec("INSERT INTO users (email, password) VALUES ('undated@example.com', '')").Error)
+
+	s.Require().NoError(MigrateDB(s.db))
+	s.Require().NoError(s.db.Create(&entity.User{Email: "pending@example.com"}).Error)
+	s.Require().NoError(MigrateDB(s.db))
+
+	var users []entity.User
+	s.Require().NoError(s.db.Order("id").Find(&users).Error)
+	s.Require().Len(users, 3)
+	s.Require().NotNil(users[0].VerifiedAt)
+	s.True(createdAt.Equal(*users[0].VerifiedAt), "verified as of their creation")
+	s.NotNil(users[1].VerifiedAt)
+	s.Nil(users[2].VerifiedAt, "accounts signing up after the migration are not verified")
+}
+
+func TestMigrator(t *testing.T) {
+	suite.Run(t, new(TestSuiteMigrator))
+}
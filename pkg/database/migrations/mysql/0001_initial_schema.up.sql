@@ -0,0 +1,116 @@
+-- The schema as it was created by AutoMigrate. Tables are only created when
+-- missing so databases set up before versioned migrations can adopt them. The
+-- users table is the one of those databases, the columns added since come with
+-- the migrations after this one.
+
+CREATE TABLE IF NOT EXISTS `permissions` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `name` varchar(64) UNIQUE,
+  PRIMARY KEY (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `roles` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  `name` varchar(64) UNIQUE,
+  `description` longtext,
+  PRIMARY KEY (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `role_permissions` (
+  `role_id` bigint unsigned,
+  `permission_id` bigint unsigned,
+  PRIMARY KEY (`role_id`, `permission_id`),
+  CONSTRAINT `fk_role_permissions_role` FOREIGN KEY (`role_id`) REFERENCES `roles` (`id`),
+  CONSTRAINT `fk_role_permissions_permission` FOREIGN KEY (`permission_id`) REFERENCES `permissions` (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `users` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  `deleted_at` datetime(3) NULL,
+  `email` varchar(191) UNIQUE,
+  `password` longtext,
+  PRIMARY KEY (`id`),
+  INDEX `idx_users_deleted_at` (`deleted_at`)
+);
+
+CREATE TABLE IF NOT EXISTS `user_roles` (
+  `user_id` bigint unsigned,
+  `role_id` bigint unsigned,
+  PRIMARY KEY (`user_id`, `role_id`),
+  CONSTRAINT `fk_user_roles_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`),
+  CONSTRAINT `fk_user_roles_role` FOREIGN KEY (`role_id`) REFERENCES `roles` (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `refresh_tokens` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  `deleted_at` datetime(3) NULL,
+  `user_id` bigint unsigned,
+  `family_id` varchar(64),
+  `token_hash` varchar(64) UNIQUE,
+  `expires_at` datetime(3) NULL,
+  `used_at` datetime(3) NULL,
+  `revoked_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_refresh_tokens_deleted_at` (`deleted_at`),
+  INDEX `idx_refresh_tokens_user_id` (`user_id`),
+  INDEX `idx_refresh_tokens_family_id` (`family_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `revoked_tokens` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `created_at` datetime(3) NULL,
+  `jti` varchar(64),
+  `user_id` bigint unsigned,
+  `expires_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_revoked_tokens_jti` (`jti`),
+  INDEX `idx_revoked_tokens_user_id` (`user_id`),
+  INDEX `idx_revoked_tokens_expires_at` (`expires_at`)
+);
+
+CREATE TABLE IF NOT EXISTS `password_reset_tokens` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  `deleted_at` datetime(3) NULL,
+  `user_id` bigint unsigned,
+  `token_hash` varchar(64) UNIQUE,
+  `expires_at` datetime(3) NULL,
+  `used_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_password_reset_tokens_deleted_at` (`deleted_at`),
+  INDEX `idx_password_reset_tokens_user_id` (`user_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `two_factors` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  `deleted_at` datetime(3) NULL,
+  `user_id` bigint unsigned UNIQUE,
+  `secret` varchar(64),
+  `enabled_at` datetime(3) NULL,
+  `last_used_step` bigint,
+  PRIMARY KEY (`id`),
+  INDEX `idx_two_factors_deleted_at` (`deleted_at`)
+);
+
+CREATE TABLE IF NOT EXISTS `recovery_codes` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  `deleted_at` datetime(3) NULL,
+  `user_id` bigint unsigned,
+  `code_hash` varchar(64),
+  `used_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_recovery_codes_deleted_at` (`deleted_at`),
+  INDEX `idx_recovery_codes_user_id` (`user_id`),
+  INDEX `idx_recovery_codes_code_hash` (`code_hash`)
+);
@@ -0,0 +1,8 @@
+CREATE TABLE `login_attempts` (
+  `attempt_key` varchar(320),
+  `failures` bigint,
+  `last_failure_at` datetime(3) NULL,
+  `blocked_until` datetime(3) NULL,
+  PRIMARY KEY (`attempt_key`),
+  INDEX `idx_login_attempts_last_failure_at` (`last_failure_at`)
+);
@@ -0,0 +1,15 @@
+-- Emails are lowercased before every lookup, accounts registered with a
+-- mixed case email could not log in anymore. Emails whose lowercased form is
+-- shared by another account are left alone, the server warns about them on
+-- startup for an operator to merge or rename the accounts.
+
+-- The derived table is materialized, MySQL refuses to update a table read by a
+-- subquery of the same statement otherwise. Emails are compared as binary
+-- strings, the collation of the column ignores case.
+UPDATE `users` SET `email` = LOWER(`email`)
+WHERE CAST(`email` AS BINARY) <> CAST(LOWER(`email`) AS BINARY)
+  AND LOWER(`email`) NOT IN (
+    SELECT `folded` FROM (
+      SELECT LOWER(`email`) AS `folded` FROM `users` GROUP BY LOWER(`email`) HAVING COUNT(*) > 1
+    ) AS `collisions`
+  );
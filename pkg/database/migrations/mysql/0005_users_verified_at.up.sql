@@ -0,0 +1,9 @@
+-- Databases created by AutoMigrate before versioned migrations have no
+-- verified_at column, the initial migration leaves their users table alone.
+-- Their accounts were never sent a verification link and would be locked out
+-- once verification is required, so they are marked verified as of their
+-- creation. Only the rows there when the column is added are backfilled,
+-- accounts signing up later go through verification.
+ALTER TABLE `users` ADD COLUMN `verified_at` datetime(3) NULL;
+
+UPDATE `users` SET `verified_at` = COALESCE(`created_at`, CURRENT_TIMESTAMP(3));
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS "recovery_codes";
+DROP TABLE IF EXISTS "two_factors";
+DROP TABLE IF EXISTS "password_reset_tokens";
+DROP TABLE IF EXISTS "revoked_tokens";
+DROP TABLE IF EXISTS "refresh_tokens";
+DROP TABLE IF EXISTS "user_roles";
+DROP TABLE IF EXISTS "users";
+DROP TABLE IF EXISTS "role_permissions";
+DROP TABLE IF EXISTS "roles";
+DROP TABLE IF EXISTS "permissions";
@@ -0,0 +1,116 @@
+-- The schema as it was created by AutoMigrate. Tables are only created when
+-- missing so databases set up before versioned migrations can adopt them. The
+-- users table is the one of those databases, the columns added since come with
+-- the migrations after this one.
+
+CREATE TABLE IF NOT EXISTS "permissions" (
+  "id" bigserial,
+  "name" varchar(64) UNIQUE,
+  PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "roles" (
+  "id" bigserial,
+  "created_at" timestamptz,
+  "updated_at" timestamptz,
+  "name" varchar(64) UNIQUE,
+  "description" text,
+  PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "role_permissions" (
+  "role_id" bigint,
+  "permission_id" bigint,
+  PRIMARY KEY ("role_id", "permission_id"),
+  CONSTRAINT "fk_role_permissions_role" FOREIGN KEY ("role_id") REFERENCES "roles" ("id"),
+  CONSTRAINT "fk_role_permissions_permission" FOREIGN KEY ("permission_id") REFERENCES "permissions" ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "users" (
+  "id" bigserial,
+  "created_at" timestamptz,
+  "updated_at" timestamptz,
+  "deleted_at" timestamptz,
+  "email" text UNIQUE,
+  "password" text,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_users_deleted_at" ON "users" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "user_roles" (
+  "user_id" bigint,
+  "role_id" bigint,
+  PRIMARY KEY ("user_id", "role_id"),
+  CONSTRAINT "fk_user_roles_user" FOREIGN KEY ("user_id") REFERENCES "users" ("id"),
+  CONSTRAINT "fk_user_roles_role" FOREIGN KEY ("role_id") REFERENCES "roles" ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "refresh_tokens" (
+  "id" bigserial,
+  "created_at" timestamptz,
+  "updated_at" timestamptz,
+  "deleted_at" timestamptz,
+  "user_id" bigint,
+  "family_id" varchar(64),
+  "token_hash" varchar(64) UNIQUE,
+  "expires_at" timestamptz,
+  "used_at" timestamptz,
+  "revoked_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_refresh_tokens_family_id" ON "refresh_tokens" ("family_id");
+CREATE INDEX IF NOT EXISTS "idx_refresh_tokens_user_id" ON "refresh_tokens" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_refresh_tokens_deleted_at" ON "refresh_tokens" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "revoked_tokens" (
+  "id" bigserial,
+  "created_at" timestamptz,
+  "jti" varchar(64),
+  "user_id" bigint,
+  "expires_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_revoked_tokens_expires_at" ON "revoked_tokens" ("expires_at");
+CREATE INDEX IF NOT EXISTS "idx_revoked_tokens_user_id" ON "revoked_tokens" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_revoked_tokens_jti" ON "revoked_tokens" ("jti");
+
+CREATE TABLE IF NOT EXISTS "password_reset_tokens" (
+  "id" bigserial,
+  "created_at" timestamptz,
+  "updated_at" timestamptz,
+  "deleted_at" timestamptz,
+  "user_id" bigint,
+  "token_hash" varchar(64) UNIQUE,
+  "expires_at" timestamptz,
+  "used_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_password_reset_tokens_user_id" ON "password_reset_tokens" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_password_reset_tokens_deleted_at" ON "password_reset_tokens" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "two_factors" (
+  "id" bigserial,
+  "created_at" timestamptz,
+  "updated_at" timestamptz,
+  "deleted_at" timestamptz,
+  "user_id" bigint UNIQUE,
+  "secret" varchar(64),
+  "enabled_at" timestamptz,
+  "last_used_step" bigint,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_two_factors_deleted_at" ON "two_factors" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "recovery_codes" (
+  "id" bigserial,
+  "created_at" timestamptz,
+  "updated_at" timestamptz,
+  "deleted_at" timestamptz,
+  "user_id" bigint,
+  "code_hash" varchar(64),
+  "used_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_recovery_codes_code_hash" ON "recovery_codes" ("code_hash");
+CREATE INDEX IF NOT EXISTS "idx_recovery_codes_user_id" ON "recovery_codes" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_recovery_codes_deleted_at" ON "recovery_codes" ("deleted_at");
@@ -0,0 +1,8 @@
+CREATE TABLE "login_attempts" (
+  "attempt_key" varchar(320),
+  "failures" bigint,
+  "last_failure_at" timestamptz,
+  "blocked_until" timestamptz,
+  PRIMARY KEY ("attempt_key")
+);
+CREATE INDEX "idx_login_attempts_last_failure_at" ON "login_attempts" ("last_failure_at");
@@ -0,0 +1 @@
+-- The admin role may be granted to users by now, it is kept.
@@ -0,0 +1,116 @@
+-- The schema as it was created by AutoMigrate. Tables are only created when
+-- missing so databases set up before versioned migrations can adopt them. The
+-- users table is the one of those databases, the columns added since come with
+-- the migrations after this one.
+
+CREATE TABLE IF NOT EXISTS `permissions` (
+  `id` integer,
+  `name` text UNIQUE,
+  PRIMARY KEY (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `roles` (
+  `id` integer,
+  `created_at` datetime,
+  `updated_at` datetime,
+  `name` text UNIQUE,
+  `description` text,
+  PRIMARY KEY (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `role_permissions` (
+  `role_id` integer,
+  `permission_id` integer,
+  PRIMARY KEY (`role_id`, `permission_id`),
+  CONSTRAINT `fk_role_permissions_role` FOREIGN KEY (`role_id`) REFERENCES `roles` (`id`),
+  CONSTRAINT `fk_role_permissions_permission` FOREIGN KEY (`permission_id`) REFERENCES `permissions` (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `users` (
+  `id` integer,
+  `created_at` datetime,
+  `updated_at` datetime,
+  `deleted_at` datetime,
+  `email` text UNIQUE,
+  `password` text,
+  PRIMARY KEY (`id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_users_deleted_at` ON `users` (`deleted_at`);
+
+CREATE TABLE IF NOT EXISTS `user_roles` (
+  `user_id` integer,
+  `role_id` integer,
+  PRIMARY KEY (`user_id`, `role_id`),
+  CONSTRAINT `fk_user_roles_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`),
+  CONSTRAINT `fk_user_roles_role` FOREIGN KEY (`role_id`) REFERENCES `roles` (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `refresh_tokens` (
+  `id` integer,
+  `created_at` datetime,
+  `updated_at` datetime,
+  `deleted_at` datetime,
+  `user_id` integer,
+  `family_id` text,
+  `token_hash` text UNIQUE,
+  `expires_at` datetime,
+  `used_at` datetime,
+  `revoked_at` datetime,
+  PRIMARY KEY (`id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_refresh_tokens_family_id` ON `refresh_tokens` (`family_id`);
+CREATE INDEX IF NOT EXISTS `idx_refresh_tokens_user_id` ON `refresh_tokens` (`user_id`);
+CREATE INDEX IF NOT EXISTS `idx_refresh_tokens_deleted_at` ON `refresh_tokens` (`deleted_at`);
+
+CREATE TABLE IF NOT EXISTS `revoked_tokens` (
+  `id` integer,
+  `created_at` datetime,
+  `jti` text,
+  `user_id` integer,
+  `expires_at` datetime,
+  PRIMARY KEY (`id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_revoked_tokens_user_id` ON `revoked_tokens` (`user_id`);
+CREATE INDEX IF NOT EXISTS `idx_revoked_tokens_jti` ON `revoked_tokens` (`jti`);
+CREATE INDEX IF NOT EXISTS `idx_revoked_tokens_expires_at` ON `revoked_tokens` (`expires_at`);
+
+CREATE TABLE IF NOT EXISTS `password_reset_tokens` (
+  `id` integer,
+  `created_at` datetime,
+  `updated_at` datetime,
+  `deleted_at` datetime,
+  `user_id` integer,
+  `token_hash` text UNIQUE,
+  `expires_at` datetime,
+  `used_at` datetime,
+  PRIMARY KEY (`id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_password_reset_tokens_user_id` ON `password_reset_tokens` (`user_id`);
+CREATE INDEX IF NOT EXISTS `idx_password_reset_tokens_deleted_at` ON `password_reset_tokens` (`deleted_at`);
+
+CREATE TABLE IF NOT EXISTS `two_factors` (
+  `id` integer,
+  `created_at` datetime,
+  `updated_at` datetime,
+  `deleted_at` datetime,
+  `user_id` integer UNIQUE,
+  `secret` text,
+  `enabled_at` datetime,
+  `last_used_step` integer,
+  PRIMARY KEY (`id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_two_factors_deleted_at` ON `two_factors` (`deleted_at`);
+
+CREATE TABLE IF NOT EXISTS `recovery_codes` (
+  `id` integer,
+  `created_at` datetime,
+  `updated_at` datetime,
+  `deleted_at` datetime,
+  `user_id` integer,
+  `code_hash` text,
+  `used_at` datetime,
+  PRIMARY KEY (`id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_recovery_codes_code_hash` ON `recovery_codes` (`code_hash`);
+CREATE INDEX IF NOT EXISTS `idx_recovery_codes_user_id` ON `recovery_codes` (`user_id`);
+CREATE INDEX IF NOT EXISTS `idx_recovery_codes_deleted_at` ON `recovery_codes` (`deleted_at`);
@@ -0,0 +1,8 @@
+CREATE TABLE `login_attempts` (
+  `attempt_key` text,
+  `failures` integer,
+  `last_failure_at` datetime,
+  `blocked_until` datetime,
+  PRIMARY KEY (`attempt_key`)
+);
+CREATE INDEX `idx_login_attempts_last_failure_at` ON `login_attempts` (`last_failure_at`);
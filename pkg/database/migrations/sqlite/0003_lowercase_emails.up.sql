@@ -0,0 +1,11 @@
+-- Emails are lowercased before every lookup, accounts registered with a
+-- mixed case email could not log in anymore. Emails whose lowercased form is
+-- shared by another account are left alone, the server warns about them on
+-- startup for an operator to merge or rename the accounts.
+UPDATE `users` SET `email` = LOWER(`email`)
+WHERE `email` <> LOWER(`email`)
+  AND LOWER(`email`) NOT IN (
+    SELECT `folded` FROM (
+      SELECT LOWER(`email`) AS `folded` FROM `users` GROUP BY LOWER(`email`) HAVING COUNT(*) > 1
+    ) AS `collisions`
+  );
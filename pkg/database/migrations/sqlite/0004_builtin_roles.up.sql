@@ -0,0 +1,12 @@
+-- The built-in permissions and the admin role holding them, so the first admin
+-- can be created on a fresh database before the server ever started. The
+-- server seeds them again on startup, which is where permissions added later
+-- are granted to the admin role.
+INSERT OR IGNORE INTO `permissions` (`name`) VALUES ('users:list'), ('users:manage'), ('roles:manage');
+
+INSERT OR IGNORE INTO `roles` (`created_at`, `updated_at`, `name`, `description`)
+VALUES (CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'admin', 'Administrator');
+
+INSERT OR IGNORE INTO `role_permissions` (`role_id`, `permission_id`)
+SELECT `roles`.`id`, `permissions`.`id` FROM `roles`, `permissions`
+WHERE `roles`.`name` = 'admin' AND `permissions`.`name` IN ('users:list', 'users:manage', 'roles:manage');
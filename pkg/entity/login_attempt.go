@@ -0,0 +1,14 @@
+package entity
+
+import "time"
+
+// LoginAttempt counts the failed logins of a key, either an email or a client
+// IP. Logins of the key are refused until BlockedUntil, nil while it was never
+// blocked. Failures are forgotten once the last one is older than the failure
+// window, and the entry is then pruned.
+type LoginAttempt struct {
+	Key           string `gorm:"column:attempt_key;primarykey;size:320"`
+	Failures      int
+	LastFailureAt time.Time `gorm:"index"`
+	BlockedUntil  *time.Time
+}
@@ -0,0 +1,17 @@
+package entity
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PasswordResetToken is a single-use token mailed to a user who forgot their
+// password. Only the SHA-256 hash of the token is stored.
+type PasswordResetToken struct {
+	gorm.Model
+	UserID    uint   `gorm:"index"`
+	TokenHash string `gorm:"size:64;unique"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
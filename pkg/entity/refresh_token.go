@@ -0,0 +1,20 @@
+package entity
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RefreshToken is a single-use refresh token. Only the SHA-256 hash of the
+// token is stored. Tokens issued by rotating one another share a FamilyID so
+// the whole chain can be revoked when reuse is detected.
+type RefreshToken struct {
+	gorm.Model
+	UserID    uint   `gorm:"index"`
+	FamilyID  string `gorm:"size:64;index"`
+	TokenHash string `gorm:"size:64;unique"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
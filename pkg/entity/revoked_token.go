@@ -0,0 +1,15 @@
+package entity
+
+import "time"
+
+// RevokedToken is an entry of the access token denylist. An entry with a JTI
+// revokes that single token. An entry without a JTI revokes every token of
+// UserID issued in a second before CreatedAt, which is how "logout everywhere"
+// is recorded. Entries are useless once ExpiresAt has passed and get pruned.
+type RevokedToken struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	JTI       string    `gorm:"size:64;index"`
+	UserID    uint      `gorm:"index"`
+	ExpiresAt time.Time `gorm:"index"`
+}
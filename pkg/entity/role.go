@@ -0,0 +1,39 @@
+package entity
+
+import "time"
+
+// Built-in role and permissions. They are seeded on startup, the admin role
+// always holds every built-in permission.
+const (
+	RoleAdmin = "admin"
+
+	PermissionUsersList   = "users:list"
+	PermissionUsersManage = "users:manage"
+	PermissionRolesManage = "roles:manage"
+)
+
+var BuiltInPermissions = []string{
+	PermissionUsersList,
+	PermissionUsersManage,
+	PermissionRolesManage,
+}
+
+// Role is a named set of permissions assigned to users. Roles are deleted for
+// good so their name can be reused.
+type Role struct {
+	ID          uint `gorm:"primarykey"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Name        string `gorm:"size:64;unique"`
+	Description string
+	Permissions []Permission `gorm:"many2many:role_permissions"`
+}
+
+type Roles []Role
+
+// Permission is a single capability such as "users:list". Permissions are
+// defined by the code, not by the admin endpoints.
+type Permission struct {
+	ID   uint   `gorm:"primarykey"`
+	Name string `gorm:"size:64;unique"`
+}
@@ -0,0 +1,28 @@
+package entity
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TwoFactor holds a user's TOTP secret. It stays pending until the user
+// confirms enrollment with a first valid code and EnabledAt gets set.
+// LastUsedStep is the TOTP time step of the last accepted code, so a code can
+// not be replayed within its validity window.
+type TwoFactor struct {
+	gorm.Model
+	UserID       uint   `gorm:"unique"`
+	Secret       string `gorm:"size:64"`
+	EnabledAt    *time.Time
+	LastUsedStep int64
+}
+
+// RecoveryCode is a one-time code that replaces a TOTP code when the user lost
+// their authenticator. Only the SHA-256 hash is stored.
+type RecoveryCode struct {
+	gorm.Model
+	UserID   uint   `gorm:"index"`
+	CodeHash string `gorm:"size:64;index"`
+	UsedAt   *time.Time
+}
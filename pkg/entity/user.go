@@ -1,13 +1,17 @@
 package entity
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
 type User struct {
 	gorm.Model
-	Email    string `gorm:"unique"`
-	Password string
+	Email      string `gorm:"unique"`
+	Password   string
+	VerifiedAt *time.Time
+	Roles      []Role `gorm:"many2many:user_roles"`
 }
 
 type Users []User
@@ -0,0 +1,175 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK          = "ok"
+	StatusFailing     = "failing"
+	StatusUnavailable = "unavailable"
+	StatusShutdown    = "shutting down"
+)
+
+// CheckFunc returns an error when the dependency it checks is not usable.
+type CheckFunc func(ctx context.Context) error
+
+// Registry holds the named checks behind the liveness and readiness probes.
+// Liveness checks should only fail when restarting the process helps, so
+// dependencies such as the database belong to readiness.
+type Registry struct {
+	cacheTTL     time.Duration
+	onFailure    func(name string, err error)
+	mu           sync.RWMutex
+	liveness     []*check
+	readiness    []*check
+	shuttingDown atomic.Bool
+}
+
+// check runs fn at most once per cacheTTL. Probes arriving while it runs wait
+// for its result instead of hitting the dependency again.
+type check struct {
+	name    string
+	timeout time.Duration
+	fn      CheckFunc
+
+	mu      sync.Mutex
+	result  CheckResult
+	expiry  time.Time
+	pending chan error
+}
+
+type CheckResult struct {
+	Status    string    `json:"status"`
+	CheckedAt time.Time `json:"checked_at"`
+	Duration  string    `json:"duration"`
+}
+
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// NewRegistry returns a registry whose check results are reused for cacheTTL,
+// so frequent probes do not load the dependencies. The reports only tell
+// which checks fail, as anyone reaching the probes can read them. Why they
+// fail is given to onFailure, once per failed run.
+func NewRegistry(cacheTTL time.Duration, onFailure func(name string, err error)) *Registry {
+	return &Registry{cacheTTL: cacheTTL, onFailure: onFailure}
+}
+
+// RegisterLiveness adds a check to the liveness probe. fn gets a context
+// cancelled after timeout.
+func (r *Registry) RegisterLiveness(name string, timeout time.Duration, fn CheckFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.liveness = append(r.liveness, &check{name: name, timeout: timeout, fn: fn})
+}
+
+// RegisterReadiness adds a check to the readiness probe. fn gets a context
+// cancelled after timeout.
+func (r *Registry) RegisterReadiness(name string, timeout time.Duration, fn CheckFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.readiness = append(r.readiness, &check{name: name, timeout: timeout, fn: fn})
+}
+
+// ShutDown makes the readiness probe fail from now on, so load balancers stop
+// routing requests to an instance that is draining.
+func (r *Registry) ShutDown() {
+	r.shuttingDown.Store(true)
+}
+
+func (r *Registry) Liveness() Report {
+	r.mu.RLock()
+	checks := r.liveness
+	r.mu.RUnlock()
+
+	return r.run(checks)
+}
+
+func (r *Registry) Readiness() Report {
+	if r.shuttingDown.Load() {
+		return Report{Status: StatusShutdown}
+	}
+
+	r.mu.RLock()
+	checks := r.readiness
+	r.mu.RUnlock()
+
+	return r.run(checks)
+}
+
+// run runs the checks concurrently. The report is ok only if all of them are.
+func (r *Registry) run(checks []*check) Report {
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c *check) {
+			defer wg.Done()
+			results[i] = c.run(r.cacheTTL, r.onFailure)
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: map[string]CheckResult{}}
+	for i, c := range checks {
+		report.Checks[c.name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusUnavailable
+		}
+	}
+
+	return report
+}
+
+// run is not bound to the probe request, as its result is shared with the
+// probes that follow. fn runs apart so a check ignoring its context can not
+// hold the probes past the timeout. When a run is still going once the next
+// one is due, it is waited for again instead of starting another.
+func (c *check) run(cacheTTL time.Duration, onFailure func(name string, err error)) CheckResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(c.expiry) {
+		return c.result
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	if c.pending == nil {
+		pending := make(chan error, 1)
+		go func() {
+			pending <- c.fn(ctx)
+		}()
+		c.pending = pending
+	}
+
+	var err error
+	select {
+	case err = <-c.pending:
+		c.pending = nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := CheckResult{Status: StatusOK, CheckedAt: now, Duration: time.Since(now).String()}
+	if err != nil {
+		result.Status = StatusFailing
+		if onFailure != nil {
+			onFailure(c.name, err)
+		}
+	}
+
+	c.result = result
+	c.expiry = now.Add(cacheTTL)
+	return result
+}
@@ -0,0 +1,149 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type TestSuiteHealth struct {
+	suite.Suite
+}
+
+func (s *TestSuiteHealth) TestReport() {
+	for _, tt := range []struct {
+		Name           string
+		Checks         map[string]error
+		ExpectedStatus string
+	}{
+		{Name: "Every check ok", Checks: map[string]error{"database": nil, "redis": nil}, ExpectedStatus: StatusOK},
+		{Name: "A check failing", Checks: map[string]error{"database": nil, "redis": errors.New("connection refused")}, ExpectedStatus: StatusUnavailable},
+		{Name: "No checks", ExpectedStatus: StatusOK},
+	} {
+		s.Run(tt.Name, func() {
+			var mu sync.Mutex
+			failures := map[string]error{}
+			registry := NewRegistry(time.Minute, func(name string, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				failures[name] = err
+			})
+			for name, err := range tt.Checks {
+				err := err
+				registry.RegisterReadiness(name, time.Second, func(ctx context.Context) error {
+					return err
+				})
+			}
+
+			report := registry.Readiness()
+			s.Equal(tt.ExpectedStatus, report.Status)
+			s.Len(report.Checks, len(tt.Checks))
+			for name, err := range tt.Checks {
+				if err != nil {
+					s.Equal(StatusFailing, report.Checks[name].Status)
+					s.Equal(err, failures[name], "the reason is given to onFailure")
+				} else {
+					s.Equal(StatusOK, report.Checks[name].Status)
+					s.NotContains(failures, name)
+				}
+			}
+		})
+	}
+}
+
+func (s *TestSuiteHealth) TestCache() {
+	var calls atomic.Int32
+	registry := NewRegistry(50*time.Millisecond, nil)
+	registry.RegisterLiveness("counter", time.Second, func(ctx context.Context) error {
+		calls.Add(1)
+		return nil
+	})
+
+	first := registry.Liveness()
+	second := registry.Liveness()
+	s.Equal(int32(1), calls.Load(), "results are reused within the TTL")
+	s.Equal(first.Checks["counter"].CheckedAt, second.Checks["counter"].CheckedAt)
+
+	time.Sleep(60 * time.Millisecond)
+	registry.Liveness()
+	s.Equal(int32(2), calls.Load(), "results expire after the TTL")
+}
+
+func (s *TestSuiteHealth) TestTimeout() {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	defer close(release)
+
+	var failure error
+	registry := NewRegistry(time.Millisecond, func(name string, err error) {
+		if name == "stuck" {
+			failure = err
+		}
+	})
+	registry.RegisterReadiness("stuck", 20*time.Millisecond, func(ctx context.Context) error {
+		// Ignores its context.
+		calls.Add(1)
+		<-release
+		return nil
+	})
+	registry.RegisterReadiness("fast", 20*time.Millisecond, func(ctx context.Context) error {
+		return nil
+	})
+
+	start := time.Now()
+	report := registry.Readiness()
+	s.Less(time.Since(start), time.Second)
+	s.Equal(StatusUnavailable, report.Status)
+	s.Equal(StatusFailing, report.Checks["stuck"].Status)
+	s.Equal(context.DeadlineExceeded, failure)
+	s.Equal(StatusOK, report.Checks["fast"].Status)
+
+	time.Sleep(5 * time.Millisecond)
+	report = registry.Readiness()
+	s.Equal(StatusFailing, report.Checks["stuck"].Status)
+	s.Equal(int32(1), calls.Load(), "a check still running is not started again")
+}
+
+func (s *TestSuiteHealth) TestCheckRecovers() {
+	var failing atomic.Bool
+	failing.Store(true)
+
+	registry := NewRegistry(time.Millisecond, nil)
+	registry.RegisterReadiness("database", time.Second, func(ctx context.Context) error {
+		if failing.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+
+	s.Equal(StatusUnavailable, registry.Readiness().Status)
+
+	failing.Store(false)
+	time.Sleep(5 * time.Millisecond)
+	s.Equal(StatusOK, registry.Readiness().Status)
+}
+
+func (s *TestSuiteHealth) TestShutDown() {
+	registry := NewRegistry(time.Minute, nil)
+	registry.RegisterLiveness("process", time.Second, func(ctx context.Context) error {
+		return nil
+	})
+	registry.RegisterReadiness("database", time.Second, func(ctx context.Context) error {
+		return nil
+	})
+
+	s.Equal(StatusOK, registry.Readiness().Status)
+
+	registry.ShutDown()
+	s.Equal(Report{Status: StatusShutdown}, registry.Readiness())
+	s.Equal(StatusOK, registry.Liveness().Status, "a draining process is still alive")
+}
+
+func TestHealth(t *testing.T) {
+	suite.Run(t, new(TestSuiteHealth))
+}
@@ -0,0 +1,81 @@
+// Package instrumentation holds what the logging, metrics and tracing
+// middlewares and GORM plugins have in common.
+package instrumentation
+
+import (
+	"reflect"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// unmatched is the route of requests matching no route.
+const unmatched = "unmatched"
+
+// notFound identifies the handler Echo runs for requests matching no route.
+// Their path is the requested one, which must not become a label.
+var notFound = reflect.ValueOf(echo.NotFoundHandler).Pointer()
+
+// RespondErrors writes the error response of the handlers it wraps, so the
+// middlewares around it see the final status. Install it inside every
+// middleware observing responses. The error is still returned for them to
+// record, Echo does not write a response twice.
+func RespondErrors() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			err := next(c)
+			if err != nil {
+				c.Error(err)
+			}
+
+			return err
+		}
+	}
+}
+
+// Route returns the route template of the request, such as /users/:id, so
+// labels and span names stay bounded. Requests matching no route share a
+// single value.
+func Route(c echo.Context) string {
+	if c.Path() == "" || reflect.ValueOf(c.Handler()).Pointer() == notFound {
+		return unmatched
+	}
+
+	return c.Path()
+}
+
+// Callbacks returns the callbacks a GORM plugin runs before and after the
+// queries of operation: create, query, update, delete, row or raw.
+type Callbacks func(operation string) (before func(*gorm.DB), after func(*gorm.DB))
+
+// RegisterCallbacks registers the callbacks of plugin around every kind of
+// query run through db.
+func RegisterCallbacks(db *gorm.DB, plugin string, callbacks Callbacks) error {
+	hooks := map[string][2]func(*gorm.DB){}
+	for _, operation := range []string{"create", "query", "update", "delete", "row", "raw"} {
+		before, after := callbacks(operation)
+		hooks[operation] = [2]func(*gorm.DB){before, after}
+	}
+
+	callback := db.Callback()
+	for _, err := range []error{
+		callback.Create().Before("gorm:create").Register(plugin+":before_create", hooks["create"][0]),
+		callback.Create().After("gorm:create").Register(plugin+":after_create", hooks["create"][1]),
+		callback.Query().Before("gorm:query").Register(plugin+":before_query", hooks["query"][0]),
+		callback.Query().After("gorm:query").Register(plugin+":after_query", hooks["query"][1]),
+		callback.Update().Before("gorm:update").Register(plugin+":before_update", hooks["update"][0]),
+		callback.Update().After("gorm:update").Register(plugin+":after_update", hooks["update"][1]),
+		callback.Delete().Before("gorm:delete").Register(plugin+":before_delete", hooks["delete"][0]),
+		callback.Delete().After("gorm:delete").Register(plugin+":after_delete", hooks["delete"][1]),
+		callback.Row().Before("gorm:row").Register(plugin+":before_row", hooks["row"][0]),
+		callback.Row().After("gorm:row").Register(plugin+":after_row", hooks["row"][1]),
+		callback.Raw().Before("gorm:raw").Register(plugin+":before_raw", hooks["raw"][0]),
+		callback.Raw().After("gorm:raw").Register(plugin+":after_raw", hooks["raw"][1]),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package instrumentation
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type TestSuiteInstrumentation struct {
+	suite.Suite
+}
+
+func (s *TestSuiteInstrumentation) TestRespondErrors() {
+	e := echo.New()
+
+	var status int
+	var seen error
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			seen = next(c)
+			status = c.Response().Status
+			return seen
+		}
+	}, RespondErrors())
+	e.GET("/", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusTeapot)
+	})
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	s.Equal(http.StatusTeapot, status, "the response is written before outer middlewares return")
+	s.Equal(http.StatusTeapot, w.Code)
+	s.Error(seen, "outer middlewares still see the error")
+}
+
+func (s *TestSuiteInstrumentation) TestRoute() {
+	e := echo.New()
+
+	var routes []string
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			err := next(c)
+			routes = append(routes, Route(c))
+			return err
+		}
+	})
+	e.GET("/users/:id", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	for _, target := range []string{"/users/1", "/missing", "/accounts/1"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/users/1", nil))
+
+	s.Equal([]string{"/users/:id", "unmatched", "unmatched", "/users/:id"}, routes)
+}
+
+func (s *TestSuiteInstrumentation) TestRegisterCallbacks() {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	s.Require().NoError(err)
+
+	var calls []string
+	err = RegisterCallbacks(db, "test", func(operation string) (func(*gorm.DB), func(*gorm.DB)) {
+		return func(*gorm.DB) { calls = append(calls, "before "+operation) },
+			func(*gorm.DB) { calls = append(calls, "after "+operation) }
+	})
+	s.Require().NoError(err)
+
+	s.NoError(db.Exec("SELECT 1").Error)
+	var one int
+	s.NoError(db.Raw("SELECT 1").Row().Scan(&one))
+
+	s.Equal([]string{"before raw", "after raw", "before row", "after row"}, calls)
+}
+
+func TestInstrumentation(t *testing.T) {
+	suite.Run(t, new(TestSuiteInstrumentation))
+}
@@ -0,0 +1,116 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Lifecycle keeps track of what has to be stopped when the process shuts
+// down: resources registered with OnShutdown and background workers started
+// with Go.
+type Lifecycle struct {
+	mu    sync.Mutex
+	hooks []hook
+	done  bool
+}
+
+type hook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// ShutdownError lists the hooks that failed or did not return in time.
+type ShutdownError struct {
+	Errors []error
+}
+
+func (e *ShutdownError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+
+	return "shutdown: " + strings.Join(messages, "; ")
+}
+
+func New() *Lifecycle {
+	return &Lifecycle{}
+}
+
+// OnShutdown registers fn to run on Shutdown. Hooks run in the reverse order of
+// their registration, so anything registered after the resources it uses is
+// stopped before them.
+func (l *Lifecycle) OnShutdown(name string, fn func(ctx context.Context) error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.hooks = append(l.hooks, hook{name, fn})
+}
+
+// Go runs fn in its own goroutine. Its context is cancelled when Shutdown
+// reaches it, which then waits for fn to return.
+func (l *Lifecycle) Go(name string, fn func(ctx context.Context)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		fn(ctx)
+	}()
+
+	l.OnShutdown(name, func(shutdownCtx context.Context) error {
+		cancel()
+
+		select {
+		case <-done:
+			return nil
+		case <-shutdownCtx.Done():
+			return shutdownCtx.Err()
+		}
+	})
+}
+
+// Shutdown runs the hooks in reverse order. A hook still running when ctx is
+// done is abandoned and reported, and the next ones are still started. Only the
+// first call does anything.
+func (l *Lifecycle) Shutdown(ctx context.Context) error {
+	l.mu.Lock()
+	if l.done {
+		l.mu.Unlock()
+		return nil
+	}
+
+	l.done = true
+	hooks := l.hooks
+	l.mu.Unlock()
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		err := run(ctx, hooks[i])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", hooks[i].name, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return &ShutdownError{errs}
+	}
+
+	return nil
+}
+
+func run(ctx context.Context, h hook) error {
+	result := make(chan error, 1)
+	go func() {
+		result <- h.fn(ctx)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,169 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type TestSuiteLifecycle struct {
+	suite.Suite
+	lc *Lifecycle
+}
+
+func (s *TestSuiteLifecycle) SetupTest() {
+	s.lc = New()
+}
+
+func (s *TestSuiteLifecycle) TestShutdownRunsHooksInReverseOrder() {
+	var order []string
+	for _, name := range []string{"database", "cache", "server"} {
+		name := name
+		s.lc.OnShutdown(name, func(ctx context.Context) error {
+			order = append(order, name)
+			return nil
+		})
+	}
+
+	s.NoError(s.lc.Shutdown(context.Background()))
+	s.Equal([]string{"server", "cache", "database"}, order)
+}
+
+func (s *TestSuiteLifecycle) TestShutdownReportsFailures() {
+	var ran []string
+	s.lc.OnShutdown("database", func(ctx context.Context) error {
+		ran = append(ran, "database")
+		return errors.New("connection reset")
+	})
+	s.lc.OnShutdown("cache", func(ctx context.Context) error {
+		ran = append(ran, "cache")
+		return nil
+	})
+	s.lc.OnShutdown("tracer", func(ctx context.Context) error {
+		ran = append(ran, "tracer")
+		return errors.New("export failed")
+	})
+
+	err := s.lc.Shutdown(context.Background())
+
+	var shutdownErr *ShutdownError
+	s.Require().ErrorAs(err, &shutdownErr)
+	s.Len(shutdownErr.Errors, 2)
+	s.EqualError(err, "shutdown: tracer: export failed; database: connection reset")
+	s.Equal([]string{"tracer", "cache", "database"}, ran, "a failed hook does not stop the next ones")
+}
+
+func (s *TestSuiteLifecycle) TestShutdownAbandonsHookPastDeadline() {
+	release := make(chan struct{})
+	defer close(release)
+
+	laterHook := make(chan struct{})
+	s.lc.OnShutdown("database", func(ctx context.Context) error {
+		close(laterHook)
+		return nil
+	})
+	s.lc.OnShutdown("stuck", func(ctx context.Context) error {
+		// Ignores its context.
+		<-release
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := s.lc.Shutdown(ctx)
+	s.Less(time.Since(start), time.Second)
+
+	var shutdownErr *ShutdownError
+	s.Require().ErrorAs(err, &shutdownErr)
+	s.Require().NotEmpty(shutdownErr.Errors)
+	s.ErrorIs(shutdownErr.Errors[0], context.DeadlineExceeded)
+	s.ErrorContains(shutdownErr.Errors[0], "stuck: ")
+
+	select {
+	case <-laterHook:
+	case <-time.After(time.Second):
+		s.Fail("the hooks after the stuck one are not started")
+	}
+}
+
+func (s *TestSuiteLifecycle) TestGoCancelsAndWaitsForWorker() {
+	started := make(chan struct{})
+	var stopped bool
+	s.lc.Go("pruner", func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		stopped = true
+	})
+	<-started
+
+	s.NoError(s.lc.Shutdown(context.Background()))
+	s.True(stopped, "Shutdown returns once the worker did")
+}
+
+func (s *TestSuiteLifecycle) TestGoReportsWorkerPastDeadline() {
+	release := make(chan struct{})
+	defer close(release)
+
+	s.lc.Go("stuck", func(ctx context.Context) {
+		<-release
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err := s.lc.Shutdown(ctx)
+
+	var shutdownErr *ShutdownError
+	s.Require().ErrorAs(err, &shutdownErr)
+	s.Require().Len(shutdownErr.Errors, 1)
+	s.ErrorIs(shutdownErr.Errors[0], context.DeadlineExceeded)
+}
+
+func (s *TestSuiteLifecycle) TestGoWorkerReturningEarly() {
+	s.lc.Go("once", func(ctx context.Context) {})
+
+	s.NoError(s.lc.Shutdown(context.Background()))
+}
+
+func (s *TestSuiteLifecycle) TestShutdownIsIdempotent() {
+	var mu sync.Mutex
+	calls := 0
+	s.lc.OnShutdown("database", func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		return errors.New("connection reset")
+	})
+
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = s.lc.Shutdown(context.Background())
+		}(i)
+	}
+	wg.Wait()
+
+	s.Equal(1, calls)
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	s.Equal(1, failed, "only the first call runs the hooks and reports their errors")
+	s.NoError(s.lc.Shutdown(context.Background()))
+}
+
+func TestLifecycle(t *testing.T) {
+	suite.Run(t, new(TestSuiteLifecycle))
+}
@@ -0,0 +1,106 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"rewrite/pkg/instrumentation"
+	"time"
+
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+const (
+	slowQueryThreshold = 200 * time.Millisecond
+	startKey           = "logging:start"
+)
+
+// GormLogger sends the messages of GORM to the logger of the query context,
+// so they carry the request ID. Only the message is logged, as its arguments
+// may hold bound values.
+//
+// Trace does nothing: GORM interpolates the bound values into the SQL it hands
+// to loggers, and those values include emails, password hashes, token hashes
+// and TOTP secrets. GormPlugin logs the queries instead.
+type GormLogger struct{}
+
+func (l GormLogger) LogMode(gormlogger.LogLevel) gormlogger.Interface {
+	return l
+}
+
+func (GormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	FromContext(ctx).Info(msg)
+}
+
+func (GormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	FromContext(ctx).Warn(msg)
+}
+
+func (GormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	FromContext(ctx).Error(msg)
+}
+
+func (GormLogger) Trace(context.Context, time.Time, func() (string, int64), error) {}
+
+// GormPlugin logs the queries run through GORM with the logger of their
+// context. Failed and slow queries are logged as warnings, and every query at
+// the debug level. The statement is logged with placeholders, never with its
+// bound values. Install it with db.Use.
+type GormPlugin struct{}
+
+func (GormPlugin) Name() string {
+	return "logging"
+}
+
+func (GormPlugin) Initialize(db *gorm.DB) error {
+	return instrumentation.RegisterCallbacks(db, "logging", func(string) (func(*gorm.DB), func(*gorm.DB)) {
+		return before, after
+	})
+}
+
+func before(db *gorm.DB) {
+	db.InstanceSet(startKey, time.Now())
+}
+
+func after(db *gorm.DB) {
+	value, ok := db.InstanceGet(startKey)
+	if !ok {
+		return
+	}
+
+	start, ok := value.(time.Time)
+	if !ok {
+		return
+	}
+
+	ctx := db.Statement.Context
+	logger := FromContext(ctx)
+	elapsed := time.Since(start)
+
+	var level slog.Level
+	var msg string
+	switch {
+	case db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound):
+		// Callers handle some failures, such as unique violations, so the
+		// error is theirs to report.
+		level, msg = slog.LevelWarn, "query failed"
+	case elapsed > slowQueryThreshold:
+		level, msg = slog.LevelWarn, "slow query"
+	case logger.Enabled(ctx, slog.LevelDebug):
+		level, msg = slog.LevelDebug, "query"
+	default:
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("sql", db.Statement.SQL.String()),
+		slog.Float64("duration_ms", float64(elapsed)/float64(time.Millisecond)),
+		slog.Int64("rows", db.RowsAffected),
+	}
+	if db.Error != nil {
+		attrs = append(attrs, slog.String("error", db.Error.Error()))
+	}
+
+	logger.LogAttrs(ctx, level, msg, attrs...)
+}
@@ -0,0 +1,74 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"golang.org/x/exp/slog"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are parts of attribute keys whose values are never logged.
+var sensitiveKeys = []string{"password", "token", "secret", "authorization", "cookie", "recovery_code", "totp"}
+
+type contextKey struct{}
+
+// New returns a logger writing one JSON object per record to w, dropping
+// records below level. Values of attributes named like a credential, such as
+// password or refresh_token, are replaced before they reach w.
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if IsSensitive(a.Key) {
+				return slog.String(a.Key, redacted)
+			}
+			return a
+		},
+	}.NewJSONHandler(w))
+}
+
+// ParseLevel parses debug, info, warn or error.
+func ParseLevel(level string) (slog.Level, bool) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, true
+	case "info":
+		return slog.LevelInfo, true
+	case "warn":
+		return slog.LevelWarn, true
+	case "error":
+		return slog.LevelError, true
+	}
+
+	return 0, false
+}
+
+// IsSensitive tells whether values named key must be redacted.
+func IsSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WithContext returns a copy of ctx carrying logger.
+func WithContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger of ctx, which within a request carries the
+// request ID, or the default logger.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+
+	return slog.Default()
+}
@@ -0,0 +1,195 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"rewrite/pkg/instrumentation"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
+)
+
+type TestSuiteLogging struct {
+	suite.Suite
+	output *bytes.Buffer
+	logger *slog.Logger
+}
+
+func (s *TestSuiteLogging) SetupTest() {
+	s.output = &bytes.Buffer{}
+	s.logger = New(s.output, slog.LevelInfo)
+}
+
+func (s *TestSuiteLogging) records() []map[string]interface{} {
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(s.output.String()), "\n") {
+		if line == "" {
+			continue
+		}
+
+		var record map[string]interface{}
+		s.Require().NoError(json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+
+	return records
+}
+
+func (s *TestSuiteLogging) TestRedaction() {
+	s.logger.Info("message",
+		"email", "123@123.com",
+		"password", "secret123",
+		"refresh_token", "abc",
+		"Authorization", "Bearer abc",
+		slog.Group("request", slog.String("new_password", "secret456")),
+	)
+
+	records := s.records()
+	s.Require().Len(records, 1)
+	s.Equal("123@123.com", records[0]["email"])
+	s.Equal(redacted, records[0]["password"])
+	s.Equal(redacted, records[0]["refresh_token"])
+	s.Equal(redacted, records[0]["Authorization"])
+	s.Equal(redacted, records[0]["request"].(map[string]interface{})["new_password"])
+	s.NotContains(s.output.String(), "secret")
+}
+
+func (s *TestSuiteLogging) TestMiddleware() {
+	for _, tt := range []struct {
+		Name              string
+		Target            string
+		RequestID         string
+		HandlerErr        error
+		ExpectedRequestID string
+		ExpectedStatus    int
+		ExpectedLevel     string
+		ExpectedQuery     string
+	}{
+		{
+			Name:              "Request ID of the caller",
+			Target:            "/users/1",
+			RequestID:         "abc-123",
+			ExpectedRequestID: "abc-123",
+			ExpectedStatus:    http.StatusOK,
+			ExpectedLevel:     "INFO",
+		},
+		{
+			Name:           "Generated request ID",
+			Target:         "/users/1",
+			ExpectedStatus: http.StatusOK,
+			ExpectedLevel:  "INFO",
+		},
+		{
+			Name:           "Malformed request ID is replaced",
+			Target:         "/users/1",
+			RequestID:      "abc\"}\n{\"forged\":1",
+			ExpectedStatus: http.StatusOK,
+			ExpectedLevel:  "INFO",
+		},
+		{
+			Name:           "Token in query is redacted",
+			Target:         "/users/1?token=abc&page=2",
+			ExpectedStatus: http.StatusOK,
+			ExpectedLevel:  "INFO",
+			ExpectedQuery:  "page=2&token=%5BREDACTED%5D",
+		},
+		{
+			Name:           "Handler error",
+			Target:         "/users/1",
+			HandlerErr:     errors.New("Generic Error"),
+			ExpectedStatus: http.StatusInternalServerError,
+			ExpectedLevel:  "ERROR",
+		},
+	} {
+		s.SetupTest()
+		s.Run(tt.Name, func() {
+			e := echo.New()
+			e.Use(RequestID(s.logger), AccessLog(), instrumentation.RespondErrors())
+
+			var handlerRequestID string
+			e.GET("/users/:id", func(c echo.Context) error {
+				FromContext(c.Request().Context()).Info("handler")
+				handlerRequestID = c.Get(RequestIDKey).(string)
+				if tt.HandlerErr != nil {
+					return tt.HandlerErr
+				}
+				return c.NoContent(http.StatusOK)
+			})
+
+			r := httptest.NewRequest(http.MethodGet, tt.Target, nil)
+			if tt.RequestID != "" {
+				r.Header.Set(HeaderRequestID, tt.RequestID)
+			}
+			w := httptest.NewRecorder()
+
+			e.ServeHTTP(w, r)
+			s.Equal(tt.ExpectedStatus, w.Code)
+
+			requestID := w.Header().Get(HeaderRequestID)
+			if tt.ExpectedRequestID != "" {
+				s.Equal(tt.ExpectedRequestID, requestID)
+			} else {
+				s.Len(requestID, 32)
+			}
+			s.Equal(requestID, handlerRequestID)
+
+			records := s.records()
+			s.Require().Len(records, 2)
+			s.Equal("handler", records[0]["msg"])
+			s.Equal(requestID, records[0][RequestIDKey])
+
+			s.Equal("request", records[1]["msg"])
+			s.Equal(tt.ExpectedLevel, records[1]["level"])
+			s.Equal(requestID, records[1][RequestIDKey])
+			s.Equal("/users/:id", records[1]["route"])
+			s.Equal(float64(tt.ExpectedStatus), records[1]["status"])
+			if tt.ExpectedQuery != "" {
+				s.Equal(tt.ExpectedQuery, records[1]["query"])
+			} else {
+				s.NotContains(records[1], "query")
+			}
+			if tt.HandlerErr != nil {
+				s.Equal(tt.HandlerErr.Error(), records[1]["error"])
+			}
+		})
+	}
+}
+
+type secret struct {
+	ID   uint
+	Hash string
+}
+
+func (s *TestSuiteLogging) TestGormLogsNoBoundValues() {
+	const hash = "$argon2id$v=19$m=19456,t=2,p=1$c2FsdHNhbHQ$aGFzaGhhc2g"
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: GormLogger{}})
+	s.Require().NoError(err)
+	s.Require().NoError(db.Use(GormPlugin{}))
+	s.Require().NoError(db.AutoMigrate(&secret{}))
+
+	ctx := WithContext(context.Background(), New(s.output, slog.LevelDebug))
+	s.NoError(db.WithContext(ctx).Create(&secret{Hash: hash}).Error)
+	s.NoError(db.WithContext(ctx).Where("hash = ?", hash).First(&secret{}).Error)
+	s.Error(db.WithContext(ctx).Create(&secret{ID: 1, Hash: hash}).Error)
+	GormLogger{}.Error(ctx, "failed to parse %v", hash)
+
+	records := s.records()
+	s.Require().NotEmpty(records)
+	s.Contains(s.output.String(), "SELECT * FROM `secrets` WHERE hash = ?")
+	s.Contains(s.output.String(), "query failed")
+	s.NotContains(s.output.String(), "argon2id")
+}
+
+func TestLogging(t *testing.T) {
+	suite.Run(t, new(TestSuiteLogging))
+}
@@ -0,0 +1,134 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"rewrite/pkg/instrumentation"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	HeaderRequestID = "X-Request-ID"
+
+	// RequestIDKey is the key of the request ID in the echo context.
+	RequestIDKey = "request_id"
+
+	maxRequestIDLength = 128
+)
+
+// RequestID reuses the X-Request-ID of the caller, or generates one when it is
+// missing or malformed, and echoes it in the response. The request context
+// gets a logger tagged with the request ID, and with the trace ID when the
+// request is traced.
+func RequestID(logger *slog.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			request := c.Request()
+
+			requestID := request.Header.Get(HeaderRequestID)
+			if !validRequestID(requestID) {
+				requestID = newRequestID()
+			}
+
+			c.Set(RequestIDKey, requestID)
+			c.Response().Header().Set(HeaderRequestID, requestID)
+
+			requestLogger := logger.With(RequestIDKey, requestID)
+			if span := trace.SpanFromContext(request.Context()); span.SpanContext().IsValid() {
+				span.SetAttributes(attribute.String("http.request_id", requestID))
+				requestLogger = requestLogger.With("trace_id", span.SpanContext().TraceID().String())
+			}
+
+			c.SetRequest(request.WithContext(WithContext(request.Context(), requestLogger)))
+			return next(c)
+		}
+	}
+}
+
+// AccessLog logs every request once it is answered, with the logger set by
+// RequestID. Query parameters named like credentials are redacted. Errors
+// must be written inside it by instrumentation.RespondErrors.
+func AccessLog() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+
+			err := next(c)
+
+			request := c.Request()
+			response := c.Response()
+			attrs := []slog.Attr{
+				slog.String("method", request.Method),
+				slog.String("route", instrumentation.Route(c)),
+				slog.String("path", request.URL.Path),
+				slog.Int("status", response.Status),
+				slog.Float64("duration_ms", float64(time.Since(start))/float64(time.Millisecond)),
+				slog.Int64("bytes_out", response.Size),
+				slog.String("remote_ip", c.RealIP()),
+				slog.String("user_agent", request.UserAgent()),
+			}
+			if query := redactQuery(request.URL.Query()); query != "" {
+				attrs = append(attrs, slog.String("query", query))
+			}
+			if err != nil {
+				attrs = append(attrs, slog.String("error", err.Error()))
+			}
+
+			level := slog.LevelInfo
+			if response.Status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+
+			FromContext(request.Context()).LogAttrs(request.Context(), level, "request", attrs...)
+			return err
+		}
+	}
+}
+
+func redactQuery(query url.Values) string {
+	for key, values := range query {
+		if IsSensitive(key) {
+			for i := range values {
+				values[i] = redacted
+			}
+		}
+	}
+
+	return query.Encode()
+}
+
+// validRequestID accepts IDs of reasonable length made of characters that can
+// not forge log lines or headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':', r == '/', r == '+', r == '=':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// Requests are still worth serving without a unique ID.
+		return "unknown"
+	}
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,75 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// AsyncMailer queues messages and delivers them from a background goroutine,
+// so callers do not wait on the mail server. A caller that waits only for
+// some messages would otherwise leak through response timing which ones were
+// actually sent.
+type AsyncMailer struct {
+	mailer  Mailer
+	queue   chan Message
+	done    chan struct{}
+	onError func(error)
+
+	// mu guards closed, Send holds it while queueing so the queue is never
+	// closed under it.
+	mu     sync.RWMutex
+	closed bool
+}
+
+// ErrClosed is returned by Send once the mailer is closed.
+var ErrClosed = errors.New("mailer: closed")
+
+func NewAsyncMailer(mailer Mailer, size int, onError func(error)) *AsyncMailer {
+	async := &AsyncMailer{mailer: mailer, queue: make(chan Message, size), done: make(chan struct{}), onError: onError}
+	go async.run()
+	return async
+}
+
+func (a *AsyncMailer) Send(message Message, ctx context.Context) error {
+	err := message.validate()
+	if err != nil {
+		return err
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		return ErrClosed
+	}
+
+	select {
+	case a.queue <- message:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting messages and returns once the queue is drained.
+func (a *AsyncMailer) Close() {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+	}
+	a.mu.Unlock()
+
+	<-a.done
+}
+
+func (a *AsyncMailer) run() {
+	defer close(a.done)
+
+	for message := range a.queue {
+		if err := a.mailer.Send(message, context.Background()); err != nil && a.onError != nil {
+			a.onError(err)
+		}
+	}
+}
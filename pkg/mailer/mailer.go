@@ -0,0 +1,95 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/smtp"
+	"os"
+	"rewrite/pkg/config"
+	"strings"
+)
+
+// ErrHeaderInjection is returned for messages whose recipient or subject holds
+// a line break, which would let it add headers or recipients of its own.
+var ErrHeaderInjection = errors.New("mailer: line break in a message header")
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+func (m Message) validate() error {
+	if strings.ContainsAny(m.To, "\r\n") || strings.ContainsAny(m.Subject, "\r\n") {
+		return ErrHeaderInjection
+	}
+
+	return nil
+}
+
+type Mailer interface {
+	Send(message Message, ctx context.Context) error
+}
+
+// NewMailer returns an SMTP mailer when an SMTP host is configured and a
+// mailer that prints messages to stdout otherwise, which is handy in
+// development.
+func NewMailer(cfg config.MailConfig) Mailer {
+	if cfg.SMTPHost == "" {
+		return NewLogMailer(os.Stdout)
+	}
+
+	return NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUser, cfg.SMTPPassword, cfg.From)
+}
+
+type LogMailer struct {
+	w io.Writer
+}
+
+func NewLogMailer(w io.Writer) Mailer {
+	return &LogMailer{w}
+}
+
+func (l *LogMailer) Send(message Message, ctx context.Context) error {
+	err := message.validate()
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(l.w, "To: %s\nSubject: %s\n\n%s\n", message.To, message.Subject, message.Body)
+	return err
+}
+
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTPMailer(host, port, username, password, from string) Mailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTPMailer{host + ":" + port, auth, from}
+}
+
+func (s *SMTPMailer) Send(message Message, ctx context.Context) error {
+	err := message.validate()
+	if err != nil {
+		return err
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\n", s.from)
+	fmt.Fprintf(&body, "To: %s\r\n", message.To)
+	fmt.Fprintf(&body, "Subject: %s\r\n", message.Subject)
+	body.WriteString("MIME-Version: 1.0\r\n")
+	body.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n\r\n")
+	body.WriteString(message.Body)
+
+	return smtp.SendMail(s.addr, s.auth, s.from, []string{message.To}, []byte(body.String()))
+}
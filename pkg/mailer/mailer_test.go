@@ -0,0 +1,122 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// recordingMailer keeps the messages it is asked to send.
+type recordingMailer struct {
+	mu       sync.Mutex
+	messages []Message
+	delay    time.Duration
+}
+
+func (r *recordingMailer) Send(message Message, ctx context.Context) error {
+	time.Sleep(r.delay)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, message)
+	return nil
+}
+
+type TestSuiteMailer struct {
+	suite.Suite
+	ctx context.Context
+}
+
+func (s *TestSuiteMailer) SetupTest() {
+	s.ctx = context.Background()
+}
+
+func (s *TestSuiteMailer) TestHeaderInjection() {
+	for _, tt := range []struct {
+		Name        string
+		Message     Message
+		ExpectedErr error
+	}{
+		{Name: "Plain message", Message: Message{To: "123@123.com", Subject: "Reset your password", Body: "Line one\r\nLine two\n"}},
+		{Name: "Line feed in recipient", Message: Message{To: "123@123.com\nBcc: victim@example.com", Subject: "Hello"}, ExpectedErr: ErrHeaderInjection},
+		{Name: "Carriage return in recipient", Message: Message{To: "123@123.com\rBcc: victim@example.com", Subject: "Hello"}, ExpectedErr: ErrHeaderInjection},
+		{Name: "Line break in subject", Message: Message{To: "123@123.com", Subject: "Hello\r\nContent-Type: text/html"}, ExpectedErr: ErrHeaderInjection},
+	} {
+		s.Run(tt.Name, func() {
+			var out bytes.Buffer
+			s.Equal(tt.ExpectedErr, NewLogMailer(&out).Send(tt.Message, s.ctx))
+			if tt.ExpectedErr != nil {
+				s.Empty(out.String())
+
+				// Refused before connecting to the unreachable server.
+				s.Equal(tt.ExpectedErr, NewSMTPMailer("127.0.0.1", "1", "", "", "no-reply@localhost").Send(tt.Message, s.ctx))
+			}
+
+			async := NewAsyncMailer(&recordingMailer{}, 1, nil)
+			defer async.Close()
+			s.Equal(tt.ExpectedErr, async.Send(tt.Message, s.ctx))
+		})
+	}
+}
+
+func (s *TestSuiteMailer) TestAsyncMailerDrainsOnClose() {
+	recorder := &recordingMailer{delay: time.Millisecond}
+	async := NewAsyncMailer(recorder, 10, nil)
+
+	for _, to := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		s.NoError(async.Send(Message{To: to}, s.ctx))
+	}
+	async.Close()
+
+	s.Len(recorder.messages, 3)
+}
+
+func (s *TestSuiteMailer) TestAsyncMailerSendAfterClose() {
+	async := NewAsyncMailer(&recordingMailer{}, 1, nil)
+	async.Close()
+
+	s.Equal(ErrClosed, async.Send(Message{To: "123@123.com"}, s.ctx))
+	s.NotPanics(async.Close, "closing twice")
+}
+
+func (s *TestSuiteMailer) TestAsyncMailerSendDuringClose() {
+	async := NewAsyncMailer(&recordingMailer{delay: time.Millisecond}, 1, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := async.Send(Message{To: "123@123.com"}, s.ctx)
+			if err != nil {
+				s.Equal(ErrClosed, err)
+			}
+		}()
+	}
+
+	s.NotPanics(async.Close)
+	wg.Wait()
+}
+
+func (s *TestSuiteMailer) TestAsyncMailerSendCancelled() {
+	blocking := &recordingMailer{delay: 50 * time.Millisecond}
+	async := NewAsyncMailer(blocking, 1, nil)
+	defer async.Close()
+
+	// One message is being sent and one fills the queue.
+	s.NoError(async.Send(Message{To: "a@example.com"}, s.ctx))
+	time.Sleep(5 * time.Millisecond)
+	s.NoError(async.Send(Message{To: "b@example.com"}, s.ctx))
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	cancel()
+	s.Equal(context.Canceled, async.Send(Message{To: "c@example.com"}, ctx))
+}
+
+func TestMailer(t *testing.T) {
+	suite.Run(t, new(TestSuiteMailer))
+}
@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"rewrite/pkg/instrumentation"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "http_request_duration_seconds",
+	Help:    "Duration of HTTP requests, by method, route template and status.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"method", "route", "status"})
+
+// Middleware records the duration of every request. Routes are labelled with
+// their template, such as /users/:id, so the label values stay bounded.
+// Requests matching no route share a single label value. Errors must be
+// written inside it by instrumentation.RespondErrors.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+
+			err := next(c)
+
+			httpRequestDuration.WithLabelValues(
+				c.Request().Method,
+				instrumentation.Route(c),
+				strconv.Itoa(c.Response().Status),
+			).Observe(time.Since(start).Seconds())
+
+			return err
+		}
+	}
+}
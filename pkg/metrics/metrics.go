@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every metric exposed on /metrics. It is not the default
+// Prometheus registry, so dependencies can not add metrics behind our back.
+var Registry = prometheus.NewRegistry()
+
+// Results of a login attempt, the result label of LoginsTotal.
+const (
+	LoginSuccess            = "success"
+	LoginInvalidCredentials = "invalid_credentials"
+	LoginUnverified         = "unverified"
+	LoginMFARequired        = "mfa_required"
+	LoginMFAFailed          = "mfa_failed"
+	LoginThrottled          = "throttled"
+)
+
+// Kinds of issued tokens, the type label of TokensIssuedTotal.
+const (
+	TokenAccess  = "access"
+	TokenRefresh = "refresh"
+	TokenMFA     = "mfa"
+)
+
+var (
+	RegistrationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "user_registrations_total",
+		Help: "Users created, by source: signup or provisioned by an operator.",
+	}, []string{"source"})
+
+	LoginsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_logins_total",
+		Help: "Login attempts, by result.",
+	}, []string{"result"})
+
+	TokensIssuedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_tokens_issued_total",
+		Help: "Tokens issued, by type.",
+	}, []string{"type"})
+
+	RateLimitedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_rate_limited_total",
+		Help: "Requests refused for exceeding a rate limit, by route group.",
+	}, []string{"group"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequestDuration,
+		dbQueryDuration,
+		RegistrationsTotal,
+		LoginsTotal,
+		TokensIssuedTotal,
+		RateLimitedTotal,
+	)
+}
+
+// RegisterDBStats exposes the connection pool statistics of db.
+func RegisterDBStats(db *sql.DB, name string) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// Handler serves the metrics of Registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"rewrite/pkg/instrumentation"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type note struct {
+	ID   uint
+	Body string
+}
+
+type TestSuiteMetrics struct {
+	suite.Suite
+}
+
+// sampleCount returns how many observations the series of labels holds.
+func (s *TestSuiteMetrics) sampleCount(histogram *prometheus.HistogramVec, labels ...string) uint64 {
+	var metric dto.Metric
+	s.Require().NoError(histogram.WithLabelValues(labels...).(prometheus.Metric).Write(&metric))
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func (s *TestSuiteMetrics) TestMiddleware() {
+	e := echo.New()
+	e.Use(Middleware(), instrumentation.RespondErrors())
+	e.GET("/things/:id", func(c echo.Context) error {
+		if c.Param("id") == "secret" {
+			return echo.NewHTTPError(http.StatusForbidden)
+		}
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	for _, tt := range []struct {
+		Name           string
+		Method         string
+		Path           string
+		ExpectedLabels []string
+	}{
+		{Name: "Route template", Method: http.MethodGet, Path: "/things/1", ExpectedLabels: []string{"GET", "/things/:id", "204"}},
+		{Name: "Same route, other parameter", Method: http.MethodGet, Path: "/things/2", ExpectedLabels: []string{"GET", "/things/:id", "204"}},
+		{Name: "Error status", Method: http.MethodGet, Path: "/things/secret", ExpectedLabels: []string{"GET", "/things/:id", "403"}},
+		{Name: "No route", Method: http.MethodGet, Path: "/missing/1", ExpectedLabels: []string{"GET", "unmatched", "404"}},
+		{Name: "Other unmatched path", Method: http.MethodGet, Path: "/missing/2", ExpectedLabels: []string{"GET", "unmatched", "404"}},
+		{Name: "Method not allowed", Method: http.MethodPost, Path: "/things/1", ExpectedLabels: []string{"POST", "/things/:id", "405"}},
+	} {
+		s.Run(tt.Name, func() {
+			before := s.sampleCount(httpRequestDuration, tt.ExpectedLabels...)
+
+			w := httptest.NewRecorder()
+			e.ServeHTTP(w, httptest.NewRequest(tt.Method, tt.Path, nil))
+
+			s.Equal(before+1, s.sampleCount(httpRequestDuration, tt.ExpectedLabels...))
+		})
+	}
+
+	s.Zero(s.sampleCount(httpRequestDuration, "GET", "/missing/1", "404"), "raw paths are never used as labels")
+}
+
+func (s *TestSuiteMetrics) TestGormPlugin() {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	s.Require().NoError(err)
+	s.Require().NoError(db.AutoMigrate(&note{}))
+	s.Require().NoError(db.Use(GormPlugin{}))
+
+	for _, tt := range []struct {
+		Name           string
+		Run            func() error
+		ExpectedLabels []string
+	}{
+		{Name: "Create", Run: func() error { return db.Create(&note{Body: "first"}).Error }, ExpectedLabels: []string{"create", "notes"}},
+		{Name: "Query", Run: func() error { return db.Find(&[]note{}).Error }, ExpectedLabels: []string{"query", "notes"}},
+		{Name: "Update", Run: func() error { return db.Model(&note{ID: 1}).Update("body", "second").Error }, ExpectedLabels: []string{"update", "notes"}},
+		{Name: "Delete", Run: func() error { return db.Delete(&note{ID: 1}).Error }, ExpectedLabels: []string{"delete", "notes"}},
+		{Name: "Raw", Run: func() error { return db.Exec("DELETE FROM notes").Error }, ExpectedLabels: []string{"raw", "unknown"}},
+		{Name: "Failed query", Run: func() error {
+			s.Error(db.Table("missing").Find(&[]note{}).Error)
+			return nil
+		}, ExpectedLabels: []string{"query", "missing"}},
+	} {
+		s.Run(tt.Name, func() {
+			before := s.sampleCount(dbQueryDuration, tt.ExpectedLabels...)
+
+			s.Require().NoError(tt.Run())
+
+			s.Equal(before+1, s.sampleCount(dbQueryDuration, tt.ExpectedLabels...))
+		})
+	}
+}
+
+func (s *TestSuiteMetrics) TestHandler() {
+	LoginsTotal.WithLabelValues(LoginSuccess).Inc()
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	s.Equal(http.StatusOK, w.Code)
+	s.Contains(w.Body.String(), `auth_logins_total{result="success"}`)
+	s.Contains(w.Body.String(), "go_goroutines")
+	s.Contains(w.Body.String(), "process_")
+}
+
+func TestMetrics(t *testing.T) {
+	suite.Run(t, new(TestSuiteMetrics))
+}
@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often expired counters are dropped from a MemoryStore.
+const sweepInterval = time.Minute
+
+// MemoryStore counts requests in process. Every instance counts its own
+// requests, so a client may make as many requests as there are instances.
+type MemoryStore struct {
+	mu        sync.Mutex
+	counters  map[string]*counter
+	nextSweep time.Time
+}
+
+type counter struct {
+	start    time.Time
+	window   time.Duration
+	previous int
+	current  int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{counters: map[string]*counter{}}
+}
+
+func (m *MemoryStore) Take(key string, limit Limit, now time.Time, ctx context.Context) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sweep(now)
+
+	start, weight := window(limit, now)
+	c, ok := m.counters[key]
+	if !ok || !c.start.Equal(start) {
+		previous := 0
+		if ok && c.start.Equal(start.Add(-limit.Window)) {
+			previous = c.current
+		}
+
+		c = &counter{start: start, window: limit.Window, previous: previous}
+		m.counters[key] = c
+	}
+
+	allowed := count(c.previous, c.current, weight) < limit.Requests
+	if allowed {
+		c.current++
+	}
+
+	return newResult(limit, now, start, c.previous, c.current, allowed), nil
+}
+
+// sweep drops the counters whose requests have all left the sliding window.
+func (m *MemoryStore) sweep(now time.Time) {
+	if now.Before(m.nextSweep) {
+		return
+	}
+
+	for key, c := range m.counters {
+		if !now.Before(c.start.Add(2 * c.window)) {
+			delete(m.counters, key)
+		}
+	}
+
+	m.nextSweep = now.Add(sweepInterval)
+}
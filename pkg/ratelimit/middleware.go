@@ -0,0 +1,116 @@
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"rewrite/pkg/apperror"
+	"rewrite/pkg/config"
+	"rewrite/pkg/logging"
+	"rewrite/pkg/metrics"
+	"rewrite/pkg/utils"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Headers describing the limit of a route, from the IETF RateLimit header
+// fields draft.
+const (
+	HeaderLimit     = "RateLimit-Limit"
+	HeaderRemaining = "RateLimit-Remaining"
+	HeaderReset     = "RateLimit-Reset"
+	HeaderPolicy    = "RateLimit-Policy"
+)
+
+var ErrRateLimited = apperror.New(apperror.CodeRateLimited, apperror.TooManyRequests, "too many requests, try again later")
+
+// KeyFunc tells who a request is counted for.
+type KeyFunc func(c echo.Context) string
+
+// ByIP counts requests per client IP as found by the IPExtractor of Echo,
+// which must be set. The default one trusts X-Forwarded-For, a client
+// sending a new one with every request would never be limited.
+func ByIP(c echo.Context) string {
+	return "ip:" + c.RealIP()
+}
+
+// ByUser counts requests per user, and must run after the JWT middleware.
+// Requests without a token are counted by client IP.
+func ByUser(c echo.Context) string {
+	if claims, ok := c.Get("user").(*utils.Claims); ok {
+		return "user:" + strconv.FormatUint(uint64(claims.UserID), 10)
+	}
+
+	return ByIP(c)
+}
+
+// ByAPIKey counts requests per API key sent in header, and requests without
+// one by client IP. Keys are not checked, so a client sending a new key with
+// every request is never limited unless the route rejects unknown keys
+// first. Keys are hashed so they are not stored in clear.
+func ByAPIKey(header string) KeyFunc {
+	return func(c echo.Context) string {
+		apiKey := c.Request().Header.Get(header)
+		if apiKey == "" {
+			return ByIP(c)
+		}
+
+		sum := sha256.Sum256([]byte(apiKey))
+		return "api_key:" + hex.EncodeToString(sum[:16])
+	}
+}
+
+// KeyOf returns the KeyFunc of a configured key: ip, user or api_key.
+func KeyOf(key string, apiKeyHeader string) KeyFunc {
+	switch key {
+	case config.RateLimitByUser:
+		return ByUser
+	case config.RateLimitByAPIKey:
+		return ByAPIKey(apiKeyHeader)
+	}
+
+	return ByIP
+}
+
+// Middleware allows limit requests of every key to the routes of group. The
+// limit is described by the RateLimit headers, and refused requests get a
+// Retry-After header. Requests are let through when the store fails, an
+// outage of the store should not take the whole API down.
+func Middleware(store Store, group string, limit Limit, key KeyFunc) echo.MiddlewareFunc {
+	policy := fmt.Sprintf("%d;w=%d", limit.Requests, int(limit.Window.Seconds()))
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := c.Request().Context()
+
+			result, err := store.Take(group+":"+key(c), limit, time.Now(), ctx)
+			if err != nil {
+				logging.FromContext(ctx).Error("checking rate limit", "group", group, "error", err)
+				return next(c)
+			}
+
+			header := c.Response().Header()
+			header.Set(HeaderLimit, strconv.Itoa(limit.Requests))
+			header.Set(HeaderRemaining, strconv.Itoa(result.Remaining))
+			header.Set(HeaderReset, seconds(result.Reset))
+			header.Set(HeaderPolicy, policy)
+
+			if !result.Allowed {
+				header.Set(echo.HeaderRetryAfter, seconds(result.RetryAfter))
+				metrics.RateLimitedTotal.WithLabelValues(group).Inc()
+				return ErrRateLimited
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// seconds rounds d up to whole seconds, so clients waiting that long are not
+// refused again.
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Limit allows Requests requests per sliding Window.
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// Result tells whether a request was allowed and how much of the limit is
+// left for its key.
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// Reset is the time until the current fixed window ends and its requests
+	// start to expire.
+	Reset time.Duration
+	// RetryAfter is the time until a refused request would be allowed.
+	RetryAfter time.Duration
+}
+
+// Store counts the requests of every key. Requests are counted in a sliding
+// window approximated from two fixed windows: the requests of the previous
+// window are weighted by how much of it the sliding window still covers.
+type Store interface {
+	// Take counts a request of key at now, unless it would exceed limit.
+	Take(key string, limit Limit, now time.Time, ctx context.Context) (Result, error)
+}
+
+// window returns the start of the fixed window holding now, and the share of
+// the previous fixed window still inside the sliding window ending at now.
+func window(limit Limit, now time.Time) (time.Time, float64) {
+	start := now.Truncate(limit.Window)
+	return start, 1 - float64(now.Sub(start))/float64(limit.Window)
+}
+
+func count(previous, current int, weight float64) int {
+	return int(float64(previous)*weight) + current
+}
+
+// newResult builds the result of a request at now given the requests counted
+// in the previous and current fixed windows, the current one starting at
+// start.
+func newResult(limit Limit, now, start time.Time, previous, current int, allowed bool) Result {
+	_, weight := window(limit, now)
+
+	result := Result{
+		Allowed:   allowed,
+		Remaining: limit.Requests - count(previous, current, weight),
+		Reset:     start.Add(limit.Window).Sub(now),
+	}
+
+	if result.Remaining < 0 {
+		result.Remaining = 0
+	}
+
+	if !allowed {
+		result.RetryAfter = retryAfter(limit, now, start, previous, current)
+	}
+
+	return result
+}
+
+// retryAfter is the time until enough of the counted requests leave the
+// sliding window for one more to fit in.
+func retryAfter(limit Limit, now, start time.Time, previous, current int) time.Duration {
+	var at time.Time
+	if current < limit.Requests && previous > 0 {
+		// Once previous*weight drops below what current leaves free.
+		elapsed := 1 - float64(limit.Requests-current)/float64(previous)
+		at = start.Add(time.Duration(elapsed * float64(limit.Window)))
+	} else {
+		// The current window is full, so wait for the next one to cover
+		// little enough of it.
+		elapsed := 1 - float64(limit.Requests)/float64(current)
+		at = start.Add(limit.Window + time.Duration(elapsed*float64(limit.Window)))
+	}
+
+	if at.Before(now) {
+		return 0
+	}
+
+	return at.Sub(now)
+}
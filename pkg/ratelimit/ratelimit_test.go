@@ -0,0 +1,183 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"rewrite/pkg/apperror"
+	"rewrite/pkg/config"
+	"rewrite/pkg/metrics"
+	"rewrite/pkg/utils"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/suite"
+)
+
+type failingStore struct{}
+
+func (failingStore) Take(key string, limit Limit, now time.Time, ctx context.Context) (Result, error) {
+	return Result{}, errors.New("connection refused")
+}
+
+type TestSuiteRateLimit struct {
+	suite.Suite
+	redis *miniredis.Miniredis
+	ctx   context.Context
+}
+
+func (s *TestSuiteRateLimit) SetupTest() {
+	s.redis = miniredis.RunT(s.T())
+	s.ctx = context.Background()
+}
+
+func (s *TestSuiteRateLimit) TestStores() {
+	for _, tt := range []struct {
+		Name  string
+		Store Store
+	}{
+		{Name: "Memory", Store: NewMemoryStore()},
+		{Name: "Redis", Store: NewRedisStore(redis.NewClient(&redis.Options{Addr: s.redis.Addr()}))},
+	} {
+		s.Run(tt.Name, func() {
+			limit := Limit{Requests: 3, Window: time.Minute}
+			start := time.Date(2023, 1, 1, 10, 0, 0, 0, time.UTC)
+			take := func(key string, now time.Time) Result {
+				result, err := tt.Store.Take(key, limit, now, s.ctx)
+				s.NoError(err)
+				return result
+			}
+
+			for _, remaining := range []int{2, 1, 0} {
+				s.Equal(Result{Allowed: true, Remaining: remaining, Reset: 50 * time.Second}, take("ip:192.0.2.1", start.Add(10*time.Second)))
+			}
+
+			s.Equal(Result{Remaining: 0, Reset: 50 * time.Second, RetryAfter: 50 * time.Second}, take("ip:192.0.2.1", start.Add(10*time.Second)))
+			s.True(take("ip:192.0.2.2", start.Add(10*time.Second)).Allowed, "keys are counted apart")
+
+			// Half of the previous window is still covered, counting as one
+			// request.
+			next := start.Add(time.Minute)
+			s.Equal(Result{Allowed: true, Remaining: 1, Reset: 30 * time.Second}, take("ip:192.0.2.1", next.Add(30*time.Second)))
+			s.Equal(Result{Allowed: true, Remaining: 0, Reset: 30 * time.Second}, take("ip:192.0.2.1", next.Add(30*time.Second)))
+			s.Equal(Result{Remaining: 0, Reset: 30 * time.Second, RetryAfter: 10 * time.Second}, take("ip:192.0.2.1", next.Add(30*time.Second)))
+			s.True(take("ip:192.0.2.1", next.Add(41*time.Second)).Allowed)
+
+			s.Equal(Result{Allowed: true, Remaining: 2, Reset: time.Minute}, take("ip:192.0.2.1", start.Add(5*time.Minute)))
+		})
+	}
+}
+
+func (s *TestSuiteRateLimit) TestMemoryStoreSweep() {
+	store := NewMemoryStore()
+	limit := Limit{Requests: 1, Window: time.Minute}
+	now := time.Now()
+
+	_, err := store.Take("ip:192.0.2.1", limit, now, s.ctx)
+	s.NoError(err)
+	_, err = store.Take("ip:192.0.2.2", limit, now.Add(3*time.Minute), s.ctx)
+	s.NoError(err)
+
+	s.Len(store.counters, 1)
+}
+
+func (s *TestSuiteRateLimit) TestMiddleware() {
+	e := echo.New()
+	e.HTTPErrorHandler = apperror.HTTPErrorHandler
+	e.GET("/", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}, Middleware(NewMemoryStore(), "test", Limit{Requests: 2, Window: time.Hour}, ByIP))
+	e.GET("/failing", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}, Middleware(failingStore{}, "test", Limit{Requests: 2, Window: time.Hour}, ByIP))
+
+	limited := testutil.ToFloat64(metrics.RateLimitedTotal.WithLabelValues("test"))
+
+	var responses []*httptest.ResponseRecorder
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		responses = append(responses, w)
+	}
+
+	s.Equal(http.StatusNoContent, responses[0].Code)
+	s.Equal("2", responses[0].Header().Get(HeaderLimit))
+	s.Equal("1", responses[0].Header().Get(HeaderRemaining))
+	s.Equal("2;w=3600", responses[0].Header().Get(HeaderPolicy))
+	s.NotEmpty(responses[0].Header().Get(HeaderReset))
+	s.Empty(responses[0].Header().Get(echo.HeaderRetryAfter))
+
+	s.Equal(http.StatusTooManyRequests, responses[2].Code)
+	s.Equal("0", responses[2].Header().Get(HeaderRemaining))
+	s.NotEmpty(responses[2].Header().Get(echo.HeaderRetryAfter))
+	s.Contains(responses[2].Body.String(), string(apperror.CodeRateLimited))
+	s.Equal(limited+1, testutil.ToFloat64(metrics.RateLimitedTotal.WithLabelValues("test")))
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/failing", nil))
+	s.Equal(http.StatusNoContent, w.Code, "requests are let through when the store fails")
+}
+
+func (s *TestSuiteRateLimit) TestMiddlewareIgnoresForgedForwardedFor() {
+	e := echo.New()
+	e.IPExtractor = echo.ExtractIPDirect()
+	e.HTTPErrorHandler = apperror.HTTPErrorHandler
+	e.GET("/", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}, Middleware(NewMemoryStore(), "test", Limit{Requests: 2, Window: time.Hour}, ByIP))
+
+	var codes []int
+	for _, forwardedFor := range []string{"198.51.100.1", "198.51.100.2", "198.51.100.3"} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(echo.HeaderXForwardedFor, forwardedFor)
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, r)
+		codes = append(codes, w.Code)
+	}
+
+	s.Equal([]int{http.StatusNoContent, http.StatusNoContent, http.StatusTooManyRequests}, codes)
+}
+
+func (s *TestSuiteRateLimit) TestKeyOf() {
+	e := echo.New()
+	e.IPExtractor = echo.ExtractIPDirect()
+
+	for _, tt := range []struct {
+		Name     string
+		Key      string
+		Header   string
+		Claims   *utils.Claims
+		Expected string
+	}{
+		{Name: "Client IP", Key: config.RateLimitByIP, Expected: "ip:192.0.2.1"},
+		{Name: "User", Key: config.RateLimitByUser, Claims: &utils.Claims{UserID: 7}, Expected: "user:7"},
+		{Name: "User without token", Key: config.RateLimitByUser, Expected: "ip:192.0.2.1"},
+		{Name: "Hashed API key", Key: config.RateLimitByAPIKey, Header: "secret-key", Expected: "api_key:85dbe15d75ef9308c7ae0f33c7a324cc"},
+		{Name: "API key missing", Key: config.RateLimitByAPIKey, Expected: "ip:192.0.2.1"},
+	} {
+		s.Run(tt.Name, func() {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = "192.0.2.1:1234"
+			r.Header.Set(echo.HeaderXForwardedFor, "198.51.100.1")
+			if tt.Header != "" {
+				r.Header.Set("X-API-Key", tt.Header)
+			}
+
+			c := e.NewContext(r, httptest.NewRecorder())
+			if tt.Claims != nil {
+				c.Set("user", tt.Claims)
+			}
+
+			s.Equal(tt.Expected, KeyOf(tt.Key, "X-API-Key")(c))
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	suite.Run(t, new(TestSuiteRateLimit))
+}
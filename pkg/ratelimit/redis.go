@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const redisKeyPrefix = "ratelimit:"
+
+// takeScript counts a request in the current window KEYS[1] unless the
+// weighted count with the previous window KEYS[2] reaches the limit ARGV[1].
+// It returns whether the request was allowed and the counts of both windows.
+var takeScript = redis.NewScript(`
+local current = tonumber(redis.call("GET", KEYS[1]) or "0")
+local previous = tonumber(redis.call("GET", KEYS[2]) or "0")
+if math.floor(previous * tonumber(ARGV[2])) + current >= tonumber(ARGV[1]) then
+	return {0, previous, current}
+end
+current = redis.call("INCR", KEYS[1])
+redis.call("PEXPIRE", KEYS[1], ARGV[3])
+return {1, previous, current}
+`)
+
+// RedisStore counts requests in Redis, so every instance shares the limits.
+// Windows are computed from the clock of the instances, which must be in sync.
+type RedisStore struct {
+	client redis.UniversalClient
+}
+
+func NewRedisStore(client redis.UniversalClient) *RedisStore {
+	return &RedisStore{client}
+}
+
+func (r *RedisStore) Take(key string, limit Limit, now time.Time, ctx context.Context) (Result, error) {
+	start, weight := window(limit, now)
+
+	// The hash tag keeps both windows of a key on the same cluster node, as
+	// scripts require.
+	prefix := redisKeyPrefix + "{" + key + "}:"
+	keys := []string{
+		prefix + strconv.FormatInt(start.UnixMilli(), 10),
+		prefix + strconv.FormatInt(start.Add(-limit.Window).UnixMilli(), 10),
+	}
+
+	// Counters live for two windows, as long as they are the previous window
+	// of a later request.
+	reply, err := takeScript.Run(ctx, r.client, keys,
+		limit.Requests,
+		strconv.FormatFloat(weight, 'f', -1, 64),
+		(2 * limit.Window).Milliseconds(),
+	).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	return newResult(limit, now, start, int(reply[1]), int(reply[2]), reply[0] == 1), nil
+}
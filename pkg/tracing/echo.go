@@ -0,0 +1,54 @@
+package tracing
+
+import (
+	"net/http"
+	"rewrite/pkg/instrumentation"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware starts a server span for every request, continuing the trace of
+// the traceparent header when the caller sent one. The span is named after
+// the route template, and handlers find it in the request context. Errors
+// must be written inside it by instrumentation.RespondErrors.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			request := c.Request()
+			ctx := otel.GetTextMapPropagator().Extract(request.Context(), propagation.HeaderCarrier(request.Header))
+
+			route := instrumentation.Route(c)
+			ctx, span := Start(ctx, request.Method+" "+route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPMethodKey.String(request.Method),
+					semconv.HTTPRouteKey.String(route),
+					semconv.HTTPTargetKey.String(request.URL.Path),
+					semconv.HTTPClientIPKey.String(c.RealIP()),
+				),
+			)
+			defer span.End()
+
+			c.SetRequest(request.WithContext(ctx))
+
+			err := next(c)
+
+			status := c.Response().Status
+			span.SetAttributes(attribute.Int(string(semconv.HTTPStatusCodeKey), status))
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+			if err != nil {
+				span.RecordError(err)
+			}
+
+			return err
+		}
+	}
+}
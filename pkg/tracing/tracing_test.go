@@ -0,0 +1,188 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"rewrite/pkg/config"
+	"rewrite/pkg/instrumentation"
+	"sync"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+type TestSuiteTracing struct {
+	suite.Suite
+}
+
+func (s *TestSuiteTracing) TearDownTest() {
+	otel.SetTracerProvider(trace.NewNoopTracerProvider())
+}
+
+// collector stands in for an OpenTelemetry collector, keeping the spans it
+// receives on the OTLP/HTTP traces endpoint.
+type collector struct {
+	mu    sync.Mutex
+	paths []string
+	spans []string
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var request collectortrace.ExportTraceServiceRequest
+	err = proto.Unmarshal(body, &request)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.paths = append(c.paths, r.URL.Path)
+	for _, resourceSpans := range request.ResourceSpans {
+		for _, scopeSpans := range resourceSpans.ScopeSpans {
+			for _, span := range scopeSpans.Spans {
+				c.spans = append(c.spans, span.Name)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	response, _ := proto.Marshal(&collectortrace.ExportTraceServiceResponse{})
+	w.Write(response)
+}
+
+func (s *TestSuiteTracing) TestSetupOTLP() {
+	collector := &collector{}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	flush, err := Setup(config.TracingConfig{
+		Exporter:    config.ExporterOTLP,
+		Endpoint:    server.URL + "/otlp",
+		ServiceName: "test",
+		SampleRatio: 1,
+	})
+	s.Require().NoError(err)
+
+	ctx, parent := Start(context.Background(), "parent")
+	_, child := Start(ctx, "child")
+	child.End()
+	parent.End()
+
+	s.NoError(flush(context.Background()))
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	s.Equal([]string{"/otlp/v1/traces"}, collector.paths)
+	s.ElementsMatch([]string{"parent", "child"}, collector.spans)
+}
+
+func (s *TestSuiteTracing) TestSetupNone() {
+	flush, err := Setup(config.TracingConfig{Exporter: config.ExporterNone})
+	s.Require().NoError(err)
+	s.NoError(flush(context.Background()))
+
+	_, span := Start(context.Background(), "span")
+	s.False(span.IsRecording())
+}
+
+func (s *TestSuiteTracing) TestMiddleware() {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	for _, tt := range []struct {
+		Name           string
+		Target         string
+		Traceparent    string
+		HandlerErr     error
+		ExpectedName   string
+		ExpectedStatus int
+		ExpectedTrace  string
+		ExpectedParent string
+	}{
+		{
+			Name:           "Continues the trace of the caller",
+			Target:         "/users/1",
+			Traceparent:    "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			ExpectedName:   "GET /users/:id",
+			ExpectedStatus: http.StatusOK,
+			ExpectedTrace:  "4bf92f3577b34da6a3ce929d0e0e4736",
+			ExpectedParent: "00f067aa0ba902b7",
+		},
+		{
+			Name:           "Starts a trace without traceparent",
+			Target:         "/users/1",
+			ExpectedName:   "GET /users/:id",
+			ExpectedStatus: http.StatusOK,
+		},
+		{
+			Name:           "Handler error",
+			Target:         "/users/1",
+			HandlerErr:     echo.NewHTTPError(http.StatusInternalServerError),
+			ExpectedName:   "GET /users/:id",
+			ExpectedStatus: http.StatusInternalServerError,
+		},
+	} {
+		s.Run(tt.Name, func() {
+			e := echo.New()
+			e.Use(Middleware(), instrumentation.RespondErrors())
+
+			var handlerSpan trace.SpanContext
+			e.GET("/users/:id", func(c echo.Context) error {
+				handlerSpan = trace.SpanContextFromContext(c.Request().Context())
+				if tt.HandlerErr != nil {
+					return tt.HandlerErr
+				}
+				return c.NoContent(http.StatusOK)
+			})
+
+			r := httptest.NewRequest(http.MethodGet, tt.Target, nil)
+			if tt.Traceparent != "" {
+				r.Header.Set("traceparent", tt.Traceparent)
+			}
+			w := httptest.NewRecorder()
+
+			e.ServeHTTP(w, r)
+			s.Equal(tt.ExpectedStatus, w.Code)
+
+			spans := recorder.Ended()
+			s.Require().NotEmpty(spans)
+			span := spans[len(spans)-1]
+			s.Equal(tt.ExpectedName, span.Name())
+			s.Equal(span.SpanContext().SpanID(), handlerSpan.SpanID())
+
+			if tt.ExpectedTrace != "" {
+				s.Equal(tt.ExpectedTrace, span.SpanContext().TraceID().String())
+				s.Equal(tt.ExpectedParent, span.Parent().SpanID().String())
+			} else {
+				s.False(span.Parent().IsValid())
+			}
+
+			if tt.ExpectedStatus >= http.StatusInternalServerError {
+				s.Equal("Error", span.Status().Code.String())
+			}
+		})
+	}
+}
+
+func TestTracing(t *testing.T) {
+	suite.Run(t, new(TestSuiteTracing))
+}
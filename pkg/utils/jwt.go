@@ -1,20 +1,105 @@
 package utils
 
 import (
-	"rewrite/pkg/config"
+	"errors"
 	"rewrite/pkg/entity"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 )
 
-func GenerateToken(user *entity.User) (string, error) {
-	claims := jwt.MapClaims{
-		"authorized": true,
-		"user_id":    user.ID,
-		"exp":        time.Now().Add(time.Hour * 1).Unix(),
+var (
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// Token purposes. Every token we sign carries one so a token minted for one
+// flow, such as an email verification link, is never accepted by another.
+const (
+	PurposeAccess            = "access"
+	PurposeEmailVerification = "email_verification"
+	PurposeMFAPending        = "mfa_pending"
+)
+
+// Claims are the claims carried by tokens. SessionID ties an access token to
+// the refresh token family it was issued with. Roles are the names of the
+// roles the user had when the token was issued.
+type Claims struct {
+	Authorized bool     `json:"authorized"`
+	UserID     uint     `json:"user_id"`
+	Purpose    string   `json:"purpose"`
+	SessionID  string   `json:"sid,omitempty"`
+	Email      string   `json:"email,omitempty"`
+	Roles      []string `json:"roles,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// GenerateToken signs an access token. The user's roles must be loaded.
+func GenerateToken(keyRing *KeyRing, user *entity.User, sessionID string, ttl time.Duration) (string, error) {
+	var roles []string
+	for _, role := range user.Roles {
+		roles = append(roles, role.Name)
+	}
+
+	return generateToken(keyRing, Claims{
+		Authorized: true,
+		UserID:     user.ID,
+		Purpose:    PurposeAccess,
+		SessionID:  sessionID,
+		Roles:      roles,
+	}, ttl)
+}
+
+// GenerateVerificationToken signs the link token proving ownership of the
+// email the user currently has.
+func GenerateVerificationToken(keyRing *KeyRing, user *entity.User, ttl time.Duration) (string, error) {
+	return generateToken(keyRing, Claims{
+		UserID:  user.ID,
+		Purpose: PurposeEmailVerification,
+		Email:   user.Email,
+	}, ttl)
+}
+
+// GenerateMFAToken signs the short-lived token handed out after a correct
+// password when the user still has to present a second factor.
+func GenerateMFAToken(keyRing *KeyRing, user *entity.User, ttl time.Duration) (string, error) {
+	return generateToken(keyRing, Claims{
+		UserID:  user.ID,
+		Purpose: PurposeMFAPending,
+	}, ttl)
+}
+
+func generateToken(keyRing *KeyRing, claims Claims, ttl time.Duration) (string, error) {
+	jti, err := GenerateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        jti,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+	}
+
+	return keyRing.Sign(claims)
+}
+
+// ParseToken parses an access token.
+func ParseToken(keyRing *KeyRing, tokenString string) (*Claims, error) {
+	return ParseTokenWithPurpose(keyRing, tokenString, PurposeAccess)
+}
+
+func ParseTokenWithPurpose(keyRing *KeyRing, tokenString string, purpose string) (*Claims, error) {
+	var claims Claims
+
+	token, err := keyRing.Parse(tokenString, &claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid || claims.Purpose != purpose {
+		return nil, ErrInvalidToken
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(config.JWT_SECRET))
+	return &claims, nil
 }
@@ -0,0 +1,281 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"rewrite/pkg/config"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	ErrNoSigningKey       = errors.New("key ring has no signing key")
+	ErrUnknownKeyID       = errors.New("unknown key id")
+	ErrUnsupportedKeyType = errors.New("unsupported key type")
+)
+
+// Key is a single JWT key. SignKey is nil for keys that are only kept around
+// to verify tokens issued before a rotation.
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	SignKey   interface{}
+	VerifyKey interface{}
+}
+
+// KeyRing holds the key used to sign new tokens and every key still accepted
+// for verification, indexed by their kid. Rotating keys without downtime is
+// done by first publishing the new key as a verify-only key, then promoting it
+// to signing key and finally dropping the old one once its tokens expired.
+type KeyRing struct {
+	signing *Key
+	keys    map[string]*Key
+	ordered []*Key
+}
+
+func NewKeyRing(signing *Key, verifyOnly ...*Key) *KeyRing {
+	keyRing := &KeyRing{signing: signing, keys: map[string]*Key{}}
+	for _, key := range append([]*Key{signing}, verifyOnly...) {
+		if _, ok := keyRing.keys[key.ID]; ok {
+			continue
+		}
+
+		keyRing.keys[key.ID] = key
+		keyRing.ordered = append(keyRing.ordered, key)
+	}
+
+	return keyRing
+}
+
+// NewHMACKeyRing builds a key ring around a single HS256 shared secret.
+func NewHMACKeyRing(secret []byte) *KeyRing {
+	return NewKeyRing(&Key{
+		ID:        "hs256",
+		Method:    jwt.SigningMethodHS256,
+		SignKey:   secret,
+		VerifyKey: secret,
+	})
+}
+
+// LoadKeyRing loads the configured key files. The first file is the signing
+// key, the others are accepted for verification only. Without key files it
+// falls back to HS256 with the configured secret.
+func LoadKeyRing(cfg config.JWTConfig) (*KeyRing, error) {
+	if len(cfg.KeyFiles) == 0 {
+		return NewHMACKeyRing([]byte(cfg.Secret)), nil
+	}
+
+	keys := make([]*Key, 0, len(cfg.KeyFiles))
+	for _, path := range cfg.KeyFiles {
+		key, err := LoadKeyFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("load key %s: %w", path, err)
+		}
+		keys = append(keys, key)
+	}
+
+	if keys[0].SignKey == nil {
+		return nil, ErrNoSigningKey
+	}
+
+	return NewKeyRing(keys[0], keys[1:]...), nil
+}
+
+// LoadKeyFile reads a PEM encoded RSA, ECDSA or Ed25519 key. Private keys can
+// sign and verify, public keys can only verify. The kid is the RFC 7638
+// thumbprint of the public key.
+func LoadKeyFile(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var signKey, verifyKey interface{}
+	switch block.Type {
+	case "PUBLIC KEY":
+		verifyKey, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		verifyKey, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PRIVATE KEY":
+		signKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		signKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		signKey, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedKeyType, block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if signer, ok := signKey.(crypto.Signer); ok {
+		verifyKey = signer.Public()
+	}
+
+	method, err := signingMethodFor(verifyKey)
+	if err != nil {
+		return nil, err
+	}
+
+	jwk, err := publicJWK(verifyKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Key{
+		ID:        jwk.thumbprint(),
+		Method:    method,
+		SignKey:   signKey,
+		VerifyKey: verifyKey,
+	}, nil
+}
+
+func signingMethodFor(publicKey interface{}) (jwt.SigningMethod, error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return jwt.SigningMethodES256, nil
+		case elliptic.P384():
+			return jwt.SigningMethodES384, nil
+		case elliptic.P521():
+			return jwt.SigningMethodES512, nil
+		}
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	}
+
+	return nil, ErrUnsupportedKeyType
+}
+
+// Sign signs claims with the signing key and records its kid in the header.
+func (k *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.signing.Method, claims)
+	token.Header["kid"] = k.signing.ID
+	return token.SignedString(k.signing.SignKey)
+}
+
+// Parse verifies tokenString with the key named by its kid header and decodes
+// it into claims. Tokens without a kid are checked against the signing key.
+func (k *KeyRing) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		key := k.signing
+		if kid, ok := token.Header["kid"].(string); ok {
+			if key, ok = k.keys[kid]; !ok {
+				return nil, ErrUnknownKeyID
+			}
+		}
+
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, ErrInvalidToken
+		}
+
+		return key.VerifyKey, nil
+	})
+}
+
+// JWKS returns the public part of every asymmetric key in the ring. Shared
+// HMAC secrets are never published.
+func (k *KeyRing) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range k.ordered {
+		jwk, err := publicJWK(key.VerifyKey)
+		if err != nil {
+			continue
+		}
+
+		jwk.Kid = key.ID
+		jwk.Use = "sig"
+		jwk.Alg = key.Method.Alg()
+		set.Keys = append(set.Keys, *jwk)
+	}
+
+	return set
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+func publicJWK(publicKey interface{}) (*JWK, error) {
+	encode := base64.RawURLEncoding.EncodeToString
+
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return &JWK{
+			Kty: "RSA",
+			N:   encode(key.N.Bytes()),
+			E:   encode(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		return &JWK{
+			Kty: "EC",
+			Crv: key.Curve.Params().Name,
+			X:   encode(key.X.FillBytes(make([]byte, size))),
+			Y:   encode(key.Y.FillBytes(make([]byte, size))),
+		}, nil
+	case ed25519.PublicKey:
+		return &JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   encode(key),
+		}, nil
+	}
+
+	return nil, ErrUnsupportedKeyType
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint. Marshalling a map sorts the
+// members lexicographically, which is exactly what the RFC asks for.
+func (j *JWK) thumbprint() string {
+	members := map[string]string{"kty": j.Kty}
+	switch j.Kty {
+	case "RSA":
+		members["n"] = j.N
+		members["e"] = j.E
+	case "EC":
+		members["crv"] = j.Crv
+		members["x"] = j.X
+		members["y"] = j.Y
+	case "OKP":
+		members["crv"] = j.Crv
+		members["x"] = j.X
+	}
+
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
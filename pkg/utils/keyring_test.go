@@ -0,0 +1,262 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/suite"
+)
+
+type TestSuiteKeyRing struct {
+	suite.Suite
+	rsaKey     *rsa.PrivateKey
+	ecKey      *ecdsa.PrivateKey
+	ed25519Key ed25519.PrivateKey
+}
+
+func (s *TestSuiteKeyRing) SetupSuite() {
+	var err error
+	s.rsaKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	s.Require().NoError(err)
+	s.ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	s.Require().NoError(err)
+	_, s.ed25519Key, err = ed25519.GenerateKey(rand.Reader)
+	s.Require().NoError(err)
+}
+
+// writePEM writes a single PEM block to a file of the test and returns its
+// path.
+func (s *TestSuiteKeyRing) writePEM(blockType string, bytes []byte) string {
+	path := filepath.Join(s.T().TempDir(), "key.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: bytes})
+	s.Require().NoError(os.WriteFile(path, data, 0o600))
+	return path
+}
+
+func (s *TestSuiteKeyRing) pkcs8(key crypto.PrivateKey) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	s.Require().NoError(err)
+	return der
+}
+
+func (s *TestSuiteKeyRing) pkix(key crypto.PublicKey) []byte {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	s.Require().NoError(err)
+	return der
+}
+
+func (s *TestSuiteKeyRing) sec1(key *ecdsa.PrivateKey) []byte {
+	der, err := x509.MarshalECPrivateKey(key)
+	s.Require().NoError(err)
+	return der
+}
+
+func (s *TestSuiteKeyRing) TestLoadKeyFile() {
+	for _, tt := range []struct {
+		Name              string
+		BlockType         string
+		Bytes             []byte
+		ExpectedMethod    jwt.SigningMethod
+		ExpectedVerifyKey crypto.PublicKey
+		ExpectedCanSign   bool
+	}{
+		{
+			Name:              "RSA PKCS1 private key",
+			BlockType:         "RSA PRIVATE KEY",
+			Bytes:             x509.MarshalPKCS1PrivateKey(s.rsaKey),
+			ExpectedMethod:    jwt.SigningMethodRS256,
+			ExpectedVerifyKey: &s.rsaKey.PublicKey,
+			ExpectedCanSign:   true,
+		},
+		{
+			Name:              "RSA PKCS8 private key",
+			BlockType:         "PRIVATE KEY",
+			Bytes:             s.pkcs8(s.rsaKey),
+			ExpectedMethod:    jwt.SigningMethodRS256,
+			ExpectedVerifyKey: &s.rsaKey.PublicKey,
+			ExpectedCanSign:   true,
+		},
+		{
+			Name:              "EC private key",
+			BlockType:         "EC PRIVATE KEY",
+			Bytes:             s.sec1(s.ecKey),
+			ExpectedMethod:    jwt.SigningMethodES256,
+			ExpectedVerifyKey: &s.ecKey.PublicKey,
+			ExpectedCanSign:   true,
+		},
+		{
+			Name:              "Ed25519 private key",
+			BlockType:         "PRIVATE KEY",
+			Bytes:             s.pkcs8(s.ed25519Key),
+			ExpectedMethod:    jwt.SigningMethodEdDSA,
+			ExpectedVerifyKey: s.ed25519Key.Public(),
+			ExpectedCanSign:   true,
+		},
+		{
+			Name:              "RSA PKCS1 public key",
+			BlockType:         "RSA PUBLIC KEY",
+			Bytes:             x509.MarshalPKCS1PublicKey(&s.rsaKey.PublicKey),
+			ExpectedMethod:    jwt.SigningMethodRS256,
+			ExpectedVerifyKey: &s.rsaKey.PublicKey,
+		},
+		{
+			Name:              "EC public key",
+			BlockType:         "PUBLIC KEY",
+			Bytes:             s.pkix(&s.ecKey.PublicKey),
+			ExpectedMethod:    jwt.SigningMethodES256,
+			ExpectedVerifyKey: &s.ecKey.PublicKey,
+		},
+		{
+			Name:              "Ed25519 public key",
+			BlockType:         "PUBLIC KEY",
+			Bytes:             s.pkix(s.ed25519Key.Public()),
+			ExpectedMethod:    jwt.SigningMethodEdDSA,
+			ExpectedVerifyKey: s.ed25519Key.Public(),
+		},
+	} {
+		s.Run(tt.Name, func() {
+			key, err := LoadKeyFile(s.writePEM(tt.BlockType, tt.Bytes))
+			s.Require().NoError(err)
+
+			s.Equal(tt.ExpectedMethod, key.Method)
+			s.Equal(tt.ExpectedVerifyKey, key.VerifyKey)
+			s.Equal(tt.ExpectedCanSign, key.SignKey != nil)
+
+			jwk, err := publicJWK(tt.ExpectedVerifyKey)
+			s.Require().NoError(err)
+			s.Equal(jwk.thumbprint(), key.ID, "the kid is the thumbprint of the public key")
+		})
+	}
+}
+
+func (s *TestSuiteKeyRing) TestLoadKeyFileErrors() {
+	_, err := LoadKeyFile(filepath.Join(s.T().TempDir(), "missing.pem"))
+	s.ErrorIs(err, os.ErrNotExist)
+
+	path := filepath.Join(s.T().TempDir(), "key.pem")
+	s.Require().NoError(os.WriteFile(path, []byte("not a key"), 0o600))
+	_, err = LoadKeyFile(path)
+	s.EqualError(err, "no PEM block found")
+
+	_, err = LoadKeyFile(s.writePEM("CERTIFICATE", []byte("certificate")))
+	s.ErrorIs(err, ErrUnsupportedKeyType)
+
+	_, err = LoadKeyFile(s.writePEM("PRIVATE KEY", []byte("garbage")))
+	s.Error(err)
+
+	p224, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	s.Require().NoError(err)
+	_, err = LoadKeyFile(s.writePEM("PUBLIC KEY", s.pkix(&p224.PublicKey)))
+	s.ErrorIs(err, ErrUnsupportedKeyType)
+}
+
+func (s *TestSuiteKeyRing) TestThumbprint() {
+	// RFC 7638 section 3.1.
+	n, err := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	s.Require().NoError(err)
+
+	jwk, err := publicJWK(&rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537})
+	s.Require().NoError(err)
+	s.Equal("AQAB", jwk.E)
+	s.Equal("NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", jwk.thumbprint())
+
+	jwk.Kid = "ignored"
+	jwk.Alg = "RS256"
+	s.Equal("NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", jwk.thumbprint(), "only the required members are hashed")
+}
+
+func (s *TestSuiteKeyRing) TestJWKS() {
+	rsaKey, err := LoadKeyFile(s.writePEM("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(s.rsaKey)))
+	s.Require().NoError(err)
+	ecKey, err := LoadKeyFile(s.writePEM("PUBLIC KEY", s.pkix(&s.ecKey.PublicKey)))
+	s.Require().NoError(err)
+	ed25519Key, err := LoadKeyFile(s.writePEM("PRIVATE KEY", s.pkcs8(s.ed25519Key)))
+	s.Require().NoError(err)
+
+	keyRing := NewKeyRing(rsaKey, ecKey, ed25519Key, rsaKey)
+	data, err := json.Marshal(keyRing.JWKS())
+	s.Require().NoError(err)
+
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	s.Require().NoError(json.Unmarshal(data, &set))
+	s.Require().Len(set.Keys, 3, "duplicate keys are published once")
+
+	encode := base64.RawURLEncoding.EncodeToString
+	s.Equal(map[string]string{
+		"kty": "RSA",
+		"kid": rsaKey.ID,
+		"use": "sig",
+		"alg": "RS256",
+		"n":   encode(s.rsaKey.N.Bytes()),
+		"e":   "AQAB",
+	}, set.Keys[0])
+	s.Equal(map[string]string{
+		"kty": "EC",
+		"kid": ecKey.ID,
+		"use": "sig",
+		"alg": "ES256",
+		"crv": "P-256",
+		"x":   encode(s.ecKey.X.FillBytes(make([]byte, 32))),
+		"y":   encode(s.ecKey.Y.FillBytes(make([]byte, 32))),
+	}, set.Keys[1])
+	s.Equal(map[string]string{
+		"kty": "OKP",
+		"kid": ed25519Key.ID,
+		"use": "sig",
+		"alg": "EdDSA",
+		"crv": "Ed25519",
+		"x":   encode(s.ed25519Key.Public().(ed25519.PublicKey)),
+	}, set.Keys[2])
+	for _, key := range set.Keys {
+		s.NotContains(key, "d", "private parts are never published")
+	}
+
+	data, err = json.Marshal(NewHMACKeyRing([]byte("secret")).JWKS())
+	s.Require().NoError(err)
+	s.JSONEq(`{"keys":[]}`, string(data), "shared secrets are never published")
+}
+
+func (s *TestSuiteKeyRing) TestSignAndParse() {
+	signing, err := LoadKeyFile(s.writePEM("PRIVATE KEY", s.pkcs8(s.ed25519Key)))
+	s.Require().NoError(err)
+	previous, err := LoadKeyFile(s.writePEM("EC PRIVATE KEY", s.sec1(s.ecKey)))
+	s.Require().NoError(err)
+
+	claims := jwt.RegisteredClaims{Subject: "1", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))}
+	oldToken, err := NewKeyRing(previous).Sign(claims)
+	s.Require().NoError(err)
+
+	keyRing := NewKeyRing(signing, previous)
+	newToken, err := keyRing.Sign(claims)
+	s.Require().NoError(err)
+
+	for _, token := range []string{newToken, oldToken} {
+		var parsed jwt.RegisteredClaims
+		_, err = keyRing.Parse(token, &parsed)
+		s.NoError(err)
+		s.Equal("1", parsed.Subject)
+	}
+
+	_, err = NewKeyRing(signing).Parse(oldToken, &jwt.RegisteredClaims{})
+	s.ErrorIs(err, ErrUnknownKeyID, "keys dropped from the ring no longer verify")
+}
+
+func TestKeyRing(t *testing.T) {
+	suite.Run(t, new(TestSuiteKeyRing))
+}
@@ -0,0 +1,193 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"rewrite/pkg/config"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrPasswordMismatch    = errors.New("password does not match the hash")
+	ErrPasswordTooLong     = errors.New("password longer than the 72 bytes bcrypt hashes")
+	ErrUnknownPasswordHash = errors.New("unknown password hash format")
+)
+
+const (
+	argon2idPrefix  = "$argon2id$"
+	argon2SaltBytes = 16
+	argon2KeyBytes  = 32
+)
+
+// PasswordHasher hashes passwords with one algorithm, and verifies hashes of
+// every supported algorithm so users can log in while their hashes migrate.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify returns ErrPasswordMismatch when password does not match hash.
+	// needsRehash reports a matching hash made with another algorithm or
+	// other parameters than new hashes are.
+	Verify(hash string, password string) (needsRehash bool, err error)
+}
+
+// NewPasswordHasher returns the hasher of the configured algorithm.
+func NewPasswordHasher(cfg config.HashingConfig) PasswordHasher {
+	if cfg.Algorithm == config.HashBcrypt {
+		return &BcryptHasher{Cost: cfg.BcryptCost}
+	}
+
+	return &Argon2idHasher{
+		Memory:      uint32(cfg.Argon2Memory),
+		Iterations:  uint32(cfg.Argon2Iterations),
+		Parallelism: uint8(cfg.Argon2Parallelism),
+	}
+}
+
+// BcryptHasher hashes passwords in the modular crypt format of bcrypt, such
+// as $2a$10$..., which PHC keeps for bcrypt.
+type BcryptHasher struct {
+	Cost int
+}
+
+// Hash refuses passwords longer than 72 bytes rather than hashing only their
+// beginning.
+func (b *BcryptHasher) Hash(password string) (string, error) {
+	if len(password) > 72 {
+		return "", ErrPasswordTooLong
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+func (b *BcryptHasher) Verify(hash string, password string) (bool, error) {
+	err := verifyPassword(hash, password)
+	if err != nil {
+		return false, err
+	}
+
+	// Cost fails on hashes of other algorithms.
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != b.Cost, nil
+}
+
+// Argon2idHasher hashes passwords with Argon2id in the PHC string format,
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>.
+// Memory is in KiB.
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+func (a *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltBytes)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	params := argon2idParams{argon2.Version, a.Memory, a.Iterations, a.Parallelism}
+	key := argon2.IDKey([]byte(password), salt, a.Iterations, a.Memory, a.Parallelism, argon2KeyBytes)
+
+	return params.format(salt, key), nil
+}
+
+func (a *Argon2idHasher) Verify(hash string, password string) (bool, error) {
+	err := verifyPassword(hash, password)
+	if err != nil {
+		return false, err
+	}
+
+	params, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		// A hash of another algorithm.
+		return true, nil
+	}
+
+	current := argon2idParams{argon2.Version, a.Memory, a.Iterations, a.Parallelism}
+	return params != current || len(salt) != argon2SaltBytes || len(key) != argon2KeyBytes, nil
+}
+
+// verifyPassword checks password against a hash of any supported algorithm.
+func verifyPassword(hash string, password string) error {
+	if strings.HasPrefix(hash, argon2idPrefix) {
+		params, salt, key, err := parseArgon2id(hash)
+		if err != nil {
+			return err
+		}
+
+		derived := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(derived, key) != 1 {
+			return ErrPasswordMismatch
+		}
+
+		return nil
+	}
+
+	// Passwords longer than 72 bytes are compared by their beginning, as
+	// bcrypt hashed them before they were refused.
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	switch {
+	case err == bcrypt.ErrMismatchedHashAndPassword:
+		return ErrPasswordMismatch
+	case err != nil:
+		return ErrUnknownPasswordHash
+	}
+
+	return nil
+}
+
+type argon2idParams struct {
+	version     int
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+func (p argon2idParams) format(salt, key []byte) string {
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, p.version, p.memory, p.iterations, p.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+func parseArgon2id(hash string) (argon2idParams, []byte, []byte, error) {
+	var params argon2idParams
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+
+	_, err := fmt.Sscanf(parts[2], "v=%d", &params.version)
+	if err != nil || params.version != argon2.Version {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism)
+	if err != nil || params.iterations == 0 || params.parallelism == 0 {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+
+	return params, salt, key, nil
+}
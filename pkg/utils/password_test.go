@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type TestSuitePasswordHasher struct {
+	suite.Suite
+	bcrypt   *BcryptHasher
+	argon2id *Argon2idHasher
+}
+
+func (s *TestSuitePasswordHasher) SetupTest() {
+	s.bcrypt = &BcryptHasher{Cost: bcrypt.MinCost}
+	s.argon2id = &Argon2idHasher{Memory: 64, Iterations: 1, Parallelism: 1}
+}
+
+func (s *TestSuitePasswordHasher) TestHash() {
+	hash, err := s.argon2id.Hash("correct horse")
+	s.NoError(err)
+	s.True(strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$"), hash)
+
+	other, err := s.argon2id.Hash("correct horse")
+	s.NoError(err)
+	s.NotEqual(hash, other, "hashes are salted")
+
+	_, err = s.bcrypt.Hash(strings.Repeat("a", 73))
+	s.Equal(ErrPasswordTooLong, err)
+}
+
+func (s *TestSuitePasswordHasher) TestVerify() {
+	bcryptHash, err := s.bcrypt.Hash("correct horse")
+	s.NoError(err)
+	argon2idHash, err := s.argon2id.Hash("correct horse")
+	s.NoError(err)
+
+	for _, tt := range []struct {
+		Name                string
+		Hasher              PasswordHasher
+		Hash                string
+		Password            string
+		ExpectedNeedsRehash bool
+		ExpectedErr         error
+	}{
+		{Name: "Argon2id hash", Hasher: s.argon2id, Hash: argon2idHash, Password: "correct horse"},
+		{Name: "Bcrypt hash", Hasher: s.bcrypt, Hash: bcryptHash, Password: "correct horse"},
+		{Name: "Wrong password", Hasher: s.argon2id, Hash: argon2idHash, Password: "wrong horse", ExpectedErr: ErrPasswordMismatch},
+		{Name: "Wrong password of another algorithm", Hasher: s.argon2id, Hash: bcryptHash, Password: "wrong horse", ExpectedErr: ErrPasswordMismatch},
+		{Name: "Bcrypt hash with Argon2id current", Hasher: s.argon2id, Hash: bcryptHash, Password: "correct horse", ExpectedNeedsRehash: true},
+		{Name: "Argon2id hash with bcrypt current", Hasher: s.bcrypt, Hash: argon2idHash, Password: "correct horse", ExpectedNeedsRehash: true},
+		{
+			Name:                "Outdated Argon2id parameters",
+			Hasher:              &Argon2idHasher{Memory: 128, Iterations: 1, Parallelism: 1},
+			Hash:                argon2idHash,
+			Password:            "correct horse",
+			ExpectedNeedsRehash: true,
+		},
+		{
+			Name:                "Outdated bcrypt cost",
+			Hasher:              &BcryptHasher{Cost: bcrypt.MinCost + 1},
+			Hash:                bcryptHash,
+			Password:            "correct horse",
+			ExpectedNeedsRehash: true,
+		},
+		{Name: "Malformed Argon2id hash", Hasher: s.argon2id, Hash: "$argon2id$v=19$m=64,t=1$c2FsdA$a2V5", Password: "correct horse", ExpectedErr: ErrUnknownPasswordHash},
+		{Name: "Unknown hash", Hasher: s.argon2id, Hash: "5f4dcc3b5aa765d61d8327deb882cf99", Password: "password", ExpectedErr: ErrUnknownPasswordHash},
+	} {
+		s.Run(tt.Name, func() {
+			needsRehash, err := tt.Hasher.Verify(tt.Hash, tt.Password)
+			s.Equal(tt.ExpectedErr, err)
+			s.Equal(tt.ExpectedNeedsRehash, needsRehash)
+		})
+	}
+}
+
+func TestPasswordHasher(t *testing.T) {
+	suite.Run(t, new(TestSuitePasswordHasher))
+}
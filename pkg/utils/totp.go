@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters from RFC 6238. They are the defaults every authenticator
+// app understands, so they are not configurable.
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	totpSkew   = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a random 160 bit secret encoded in unpadded
+// base32, the form expected in otpauth URIs.
+func GenerateTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// TOTPURI builds the otpauth:// URI that authenticator apps import, usually
+// through a QR code.
+func TOTPURI(issuer, account, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// ValidateTOTP checks code against the secret at time t, allowing one step of
+// clock drift either way. It returns the time step that matched so callers
+// can refuse a code that was already used.
+func ValidateTOTP(secret, code string, t time.Time) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := t.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// GenerateTOTPCode returns the code for secret at time t.
+func GenerateTOTPCode(secret string, t time.Time) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	return totpCode(key, t.Unix()/totpPeriod), nil
+}
+
+// totpCode is the HOTP value of RFC 4226 for the given counter.
+func totpCode(key []byte, counter int64) string {
+	var message [8]byte
+	binary.BigEndian.PutUint64(message[:], uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// GenerateRecoveryCode returns a random code formatted as "xxxxx-xxxxx".
+func GenerateRecoveryCode() (string, error) {
+	return recoveryCode(rand.Reader)
+}
+
+// recoveryCode draws the characters of a recovery code from random. Bytes
+// past the largest multiple of the alphabet size are rejected, otherwise the
+// first characters of the alphabet would come up more often than the others.
+func recoveryCode(random io.Reader) (string, error) {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	const limit = 256 - 256%len(alphabet)
+
+	code := make([]byte, 0, 10)
+	b := make([]byte, cap(code))
+	for len(code) < cap(code) {
+		if _, err := io.ReadFull(random, b); err != nil {
+			return "", err
+		}
+
+		for _, v := range b {
+			if int(v) < limit && len(code) < cap(code) {
+				code = append(code, alphabet[int(v)%len(alphabet)])
+			}
+		}
+	}
+
+	return string(code[:5]) + "-" + string(code[5:]), nil
+}
+
+// NormalizeRecoveryCode strips the separators and case users tend to mangle
+// when typing a recovery code, so it can be hashed and compared.
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
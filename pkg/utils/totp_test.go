@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type TestSuiteTOTP struct {
+	suite.Suite
+	key    []byte
+	secret string
+}
+
+func (s *TestSuiteTOTP) SetupTest() {
+	// The SHA1 seed of RFC 6238 Appendix B.
+	s.key = []byte("12345678901234567890")
+	s.secret = totpEncoding.EncodeToString(s.key)
+}
+
+func (s *TestSuiteTOTP) TestRFC6238Vectors() {
+	// Appendix B lists 8 digit codes, ours are their last 6 digits.
+	for _, tt := range []struct {
+		Unix         int64
+		ExpectedCode string
+	}{
+		{Unix: 59, ExpectedCode: "287082"},
+		{Unix: 1111111109, ExpectedCode: "081804"},
+		{Unix: 1111111111, ExpectedCode: "050471"},
+		{Unix: 1234567890, ExpectedCode: "005924"},
+		{Unix: 2000000000, ExpectedCode: "279037"},
+		{Unix: 20000000000, ExpectedCode: "353130"},
+	} {
+		s.Run(tt.ExpectedCode, func() {
+			t := time.Unix(tt.Unix, 0)
+
+			code, err := GenerateTOTPCode(s.secret, t)
+			s.NoError(err)
+			s.Equal(tt.ExpectedCode, code)
+
+			step, ok := ValidateTOTP(s.secret, tt.ExpectedCode, t)
+			s.True(ok)
+			s.Equal(tt.Unix/totpPeriod, step)
+		})
+	}
+}
+
+func (s *TestSuiteTOTP) TestValidateTOTP() {
+	t := time.Unix(1111111111, 0)
+	step := t.Unix() / totpPeriod
+
+	for _, tt := range []struct {
+		Name         string
+		Secret       string
+		Code         string
+		ExpectedStep int64
+		ExpectedOK   bool
+	}{
+		{Name: "Current step", Secret: s.secret, Code: totpCode(s.key, step), ExpectedStep: step, ExpectedOK: true},
+		{Name: "Previous step", Secret: s.secret, Code: totpCode(s.key, step-1), ExpectedStep: step - 1, ExpectedOK: true},
+		{Name: "Next step", Secret: s.secret, Code: totpCode(s.key, step+1), ExpectedStep: step + 1, ExpectedOK: true},
+		{Name: "Lowercase secret", Secret: strings.ToLower(s.secret), Code: "050471", ExpectedStep: step, ExpectedOK: true},
+		{Name: "Two steps behind", Secret: s.secret, Code: totpCode(s.key, step-2)},
+		{Name: "Wrong code", Secret: s.secret, Code: "000000"},
+		{Name: "Wrong length", Secret: s.secret, Code: "50471"},
+		{Name: "Invalid secret", Secret: "not base32!", Code: "050471"},
+	} {
+		s.Run(tt.Name, func() {
+			step, ok := ValidateTOTP(tt.Secret, tt.Code, t)
+			s.Equal(tt.ExpectedOK, ok)
+			s.Equal(tt.ExpectedStep, step)
+		})
+	}
+}
+
+func (s *TestSuiteTOTP) TestGenerateRecoveryCode() {
+	pattern := regexp.MustCompile(`^[a-hjkmnp-z2-9]{5}-[a-hjkmnp-z2-9]{5}$`)
+	for i := 0; i < 100; i++ {
+		code, err := GenerateRecoveryCode()
+		s.Require().NoError(err)
+		s.Regexp(pattern, code)
+	}
+}
+
+func (s *TestSuiteTOTP) TestRecoveryCodeRejectsBiasedBytes() {
+	// 248 and above would map onto the first characters a second time.
+	random := bytes.NewReader([]byte{
+		248, 255, 0, 1, 2, 3, 4, 30, 31, 247,
+		250, 61, 62, 93, 0, 0, 0, 0, 0, 0,
+	})
+
+	code, err := recoveryCode(random)
+	s.NoError(err)
+	s.Equal("abcde-9a99a", code)
+
+	_, err = recoveryCode(bytes.NewReader([]byte{255, 255, 255, 255, 255, 255, 255, 255, 255, 255}))
+	s.ErrorIs(err, io.EOF)
+}
+
+func (s *TestSuiteTOTP) TestNormalizeRecoveryCode() {
+	s.Equal("abcde23456", NormalizeRecoveryCode(" ABCDE-23456"))
+}
+
+func TestTOTP(t *testing.T) {
+	suite.Run(t, new(TestSuiteTOTP))
+}
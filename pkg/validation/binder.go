@@ -0,0 +1,56 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"rewrite/pkg/apperror"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const unknownFieldPrefix = `json: unknown field "`
+
+// Binder binds requests like echo.DefaultBinder and then normalizes them.
+// Validation errors raised while binding, such as unknown fields, are returned
+// as they are rather than wrapped in an *echo.HTTPError.
+type Binder struct {
+	echo.DefaultBinder
+}
+
+func (b *Binder) Bind(i interface{}, c echo.Context) error {
+	err := b.DefaultBinder.Bind(i, c)
+	if err != nil {
+		var appErr *apperror.Error
+		if errors.As(err, &appErr) {
+			return appErr
+		}
+
+		return err
+	}
+
+	if normalizer, ok := i.(Normalizer); ok {
+		normalizer.Normalize()
+	}
+
+	return nil
+}
+
+// JSONSerializer is echo.DefaultJSONSerializer refusing request bodies with
+// fields the request does not have, so typos are not silently ignored.
+type JSONSerializer struct {
+	echo.DefaultJSONSerializer
+}
+
+func (JSONSerializer) Deserialize(c echo.Context, i interface{}) error {
+	decoder := json.NewDecoder(c.Request().Body)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(i)
+	if err != nil && strings.HasPrefix(err.Error(), unknownFieldPrefix) {
+		field := strings.TrimSuffix(strings.TrimPrefix(err.Error(), unknownFieldPrefix), `"`)
+		return apperror.Validation(apperror.FieldError{Field: field, Rule: "unknown", Message: "is not a known field"})
+	}
+
+	return err
+}
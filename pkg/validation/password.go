@@ -0,0 +1,242 @@
+package validation
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"rewrite/pkg/apperror"
+	"rewrite/pkg/config"
+	"strings"
+	"unicode"
+)
+
+// bundledBreached holds the SHA-1 hashes of the most common passwords, used
+// when no list is configured.
+//
+//go:embed breached.txt
+var bundledBreached string
+
+// prefixLength is the length of the hash prefixes of Pwned Passwords ranges.
+const prefixLength = 5
+
+// minEmailPartLength is the shortest part of an email a password may not
+// contain, shorter parts are too common to reject.
+const minEmailPartLength = 3
+
+// BreachedList looks passwords up by the SHA-1 of the password, as the
+// k-anonymity ranges of Pwned Passwords do: the range of the first 5 hex
+// digits of the hash is read, and its SUFFIX:COUNT lines hold the rest of the
+// hashes starting with them.
+type BreachedList struct {
+	openRange func(prefix string) (io.ReadCloser, error)
+}
+
+// OpenBreachedList reads the ranges from dir, one <PREFIX>.txt file per range
+// as written by the Pwned Passwords downloader. Missing files are empty
+// ranges.
+func OpenBreachedList(dir string) (*BreachedList, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return nil, fmt.Errorf("breached password list %s is not a directory", dir)
+	}
+
+	fsys := os.DirFS(dir)
+	return &BreachedList{func(prefix string) (io.ReadCloser, error) {
+		return fsys.Open(prefix + ".txt")
+	}}, nil
+}
+
+// BundledBreachedList returns the list of common passwords shipped with the
+// server. Its counts are left out, every password in it is rejected alike.
+func BundledBreachedList() *BreachedList {
+	ranges := map[string]string{}
+	for _, line := range strings.Split(bundledBreached, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) <= prefixLength || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		ranges[line[:prefixLength]] += line[prefixLength:] + "\n"
+	}
+
+	return &BreachedList{func(prefix string) (io.ReadCloser, error) {
+		lines, ok := ranges[prefix]
+		if !ok {
+			return nil, fs.ErrNotExist
+		}
+
+		return io.NopCloser(strings.NewReader(lines)), nil
+	}}
+}
+
+// Contains reports whether password is in the list.
+func (b *BreachedList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	r, err := b.openRange(hash[:prefixLength])
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		suffix, _, _ := strings.Cut(scanner.Text(), ":")
+		if strings.EqualFold(strings.TrimSpace(suffix), hash[prefixLength:]) {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
+
+// PasswordChecker checks how hard new passwords are to guess, beyond the
+// character rules of the password tag: whether they were breached, whether
+// they contain the email of their user and how much entropy they have. The
+// policy tells which of these checks apply.
+type PasswordChecker struct {
+	policy   config.PasswordConfig
+	breached *BreachedList
+}
+
+func NewPasswordChecker(policy config.PasswordConfig, breached *BreachedList) *PasswordChecker {
+	return &PasswordChecker{policy, breached}
+}
+
+// LoadPasswordChecker opens the breached password list of the policy, the
+// bundled one unless a BreachedPath is set.
+func LoadPasswordChecker(policy config.PasswordConfig) (*PasswordChecker, error) {
+	if !policy.CheckBreached {
+		return NewPasswordChecker(policy, nil), nil
+	}
+
+	if policy.BreachedPath == "" {
+		return NewPasswordChecker(policy, BundledBreachedList()), nil
+	}
+
+	breached, err := OpenBreachedList(policy.BreachedPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPasswordChecker(policy, breached), nil
+}
+
+// Check returns an apperror.Validation error listing every check the password
+// of the user with email fails, or nil when it passes them.
+func (p *PasswordChecker) Check(password string, email string) error {
+	var failures []apperror.FieldError
+	fail := func(rule string, message string) {
+		failures = append(failures, apperror.FieldError{Field: "password", Rule: rule, Message: message})
+	}
+
+	if p.policy.RejectEmail && derivedFromEmail(password, email) {
+		fail("email", "must not contain your email address")
+	}
+
+	if p.policy.MinEntropy > 0 && Entropy(password) < p.policy.MinEntropy {
+		fail("entropy", "is too easy to guess, use a longer password")
+	}
+
+	if p.policy.CheckBreached && p.breached != nil {
+		breached, err := p.breached.Contains(password)
+		if err != nil {
+			return err
+		}
+
+		if breached {
+			fail("breached", "has appeared in a data breach, choose another one")
+		}
+	}
+
+	if len(failures) == 0 {
+		return nil
+	}
+
+	return apperror.Validation(failures...)
+}
+
+// derivedFromEmail reports passwords containing, whatever their case, the
+// local part of email, one of its words or the name of its domain.
+func derivedFromEmail(password string, email string) bool {
+	password = strings.ToLower(password)
+	local, domain, ok := strings.Cut(strings.ToLower(email), "@")
+	if !ok {
+		return false
+	}
+
+	parts := strings.FieldsFunc(local, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	domainName, _, _ := strings.Cut(domain, ".")
+	parts = append(parts, local, domainName)
+
+	for _, part := range parts {
+		if len(part) >= minEmailPartLength && strings.Contains(password, part) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Entropy estimates the bits of entropy of password from the size of the
+// character classes it uses. Characters repeating or continuing a sequence of
+// the previous one, as in aaaa or 1234, count for a single bit, and
+// characters used before for half of their bits.
+func Entropy(password string) float64 {
+	var pool int
+	for _, class := range []struct {
+		size int
+		is   func(rune) bool
+	}{
+		{26, func(r rune) bool { return r >= 'a' && r <= 'z' }},
+		{26, func(r rune) bool { return r >= 'A' && r <= 'Z' }},
+		{10, func(r rune) bool { return r >= '0' && r <= '9' }},
+		{33, func(r rune) bool { return r < unicode.MaxASCII && !unicode.IsLetter(r) && !unicode.IsDigit(r) }},
+		{100, func(r rune) bool { return r > unicode.MaxASCII }},
+	} {
+		if strings.IndexFunc(password, class.is) != -1 {
+			pool += class.size
+		}
+	}
+
+	if pool == 0 {
+		return 0
+	}
+
+	bitsPerRune := math.Log2(float64(pool))
+	seen := map[rune]bool{}
+	var bits float64
+	var previous rune
+	for i, r := range []rune(password) {
+		switch {
+		case i > 0 && (r == previous || r == previous+1 || r == previous-1):
+			bits++
+		case seen[r]:
+			bits += bitsPerRune / 2
+		default:
+			bits += bitsPerRune
+		}
+
+		seen[r] = true
+		previous = r
+	}
+
+	return bits
+}
@@ -0,0 +1,143 @@
+package validation
+
+import (
+	"os"
+	"path/filepath"
+	"rewrite/pkg/apperror"
+	"rewrite/pkg/config"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type TestSuitePasswordChecker struct {
+	suite.Suite
+	policy config.PasswordConfig
+}
+
+func (s *TestSuitePasswordChecker) SetupTest() {
+	s.policy = config.PasswordConfig{
+		CheckBreached: true,
+		RejectEmail:   true,
+		MinEntropy:    30,
+	}
+}
+
+func (s *TestSuitePasswordChecker) TestBundledBreachedList() {
+	list := BundledBreachedList()
+
+	for _, tt := range []struct {
+		Name     string
+		Password string
+		Expected bool
+	}{
+		{Name: "Common password", Password: "password1", Expected: true},
+		{Name: "Case matters", Password: "PASSWORD1"},
+		{Name: "Uncommon password", Password: "Correct-horse-battery-1"},
+	} {
+		s.Run(tt.Name, func() {
+			breached, err := list.Contains(tt.Password)
+
+			s.NoError(err)
+			s.Equal(tt.Expected, breached)
+		})
+	}
+}
+
+func (s *TestSuitePasswordChecker) TestOpenBreachedList() {
+	dir := s.T().TempDir()
+	// SHA-1 of "hunter2" is F3BBBD66A63D4BF1747940578EC3D0103530E21D.
+	s.Require().NoError(os.WriteFile(filepath.Join(dir, "F3BBB.txt"), []byte(
+		"0000000000000000000000000000000000A:1\r\nD66A63D4BF1747940578EC3D0103530E21D:3284\r\n",
+	), 0o600))
+
+	list, err := OpenBreachedList(dir)
+	s.Require().NoError(err)
+
+	breached, err := list.Contains("hunter2")
+	s.NoError(err)
+	s.True(breached)
+
+	breached, err = list.Contains("Correct-horse-battery-1")
+	s.NoError(err)
+	s.False(breached)
+
+	_, err = OpenBreachedList(filepath.Join(dir, "F3BBB.txt"))
+	s.Error(err)
+
+	_, err = OpenBreachedList(filepath.Join(dir, "missing"))
+	s.Error(err)
+}
+
+func (s *TestSuitePasswordChecker) TestCheck() {
+	checker := NewPasswordChecker(s.policy, BundledBreachedList())
+
+	for _, tt := range []struct {
+		Name     string
+		Password string
+		Email    string
+		Expected []apperror.FieldError
+	}{
+		{Name: "Strong password", Password: "Correct-horse-battery-1", Email: "alice@example.com"},
+		{
+			Name:     "Breached password",
+			Password: "password1",
+			Email:    "alice@example.com",
+			Expected: []apperror.FieldError{
+				{Field: "password", Rule: "breached", Message: "has appeared in a data breach, choose another one"},
+			},
+		},
+		{
+			Name:     "Contains the local part",
+			Password: "Alice.Smith-battery-1",
+			Email:    "alice.smith@example.com",
+			Expected: []apperror.FieldError{
+				{Field: "password", Rule: "email", Message: "must not contain your email address"},
+			},
+		},
+		{
+			Name:     "Contains the domain name",
+			Password: "Staple-Example-battery-1",
+			Email:    "alice@example.com",
+			Expected: []apperror.FieldError{
+				{Field: "password", Rule: "email", Message: "must not contain your email address"},
+			},
+		},
+		{
+			Name:     "Easy to guess",
+			Password: "abcdefghijkl",
+			Email:    "alice@example.com",
+			Expected: []apperror.FieldError{
+				{Field: "password", Rule: "entropy", Message: "is too easy to guess, use a longer password"},
+			},
+		},
+		{Name: "Short words of the email are ignored", Password: "Correct-horse-battery-1", Email: "co@rr.io"},
+	} {
+		s.Run(tt.Name, func() {
+			err := checker.Check(tt.Password, tt.Email)
+
+			if tt.Expected == nil {
+				s.NoError(err)
+			} else {
+				s.Equal(apperror.Validation(tt.Expected...), err)
+			}
+		})
+	}
+}
+
+func (s *TestSuitePasswordChecker) TestCheckDisabled() {
+	checker := NewPasswordChecker(config.PasswordConfig{}, nil)
+
+	s.NoError(checker.Check("password1", "password1@example.com"))
+}
+
+func (s *TestSuitePasswordChecker) TestEntropy() {
+	s.Zero(Entropy(""))
+	s.Less(Entropy("aaaaaaaaaaaa"), Entropy("qzmxwvkr"))
+	s.Less(Entropy("abcdefghijkl"), Entropy("Xq7#mK2p"))
+	s.Less(Entropy("Xq7#mK2p"), Entropy("Correct-horse-battery-1"))
+}
+
+func TestPasswordChecker(t *testing.T) {
+	suite.Run(t, new(TestSuitePasswordChecker))
+}
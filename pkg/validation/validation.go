@@ -0,0 +1,123 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"rewrite/pkg/apperror"
+	"rewrite/pkg/config"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Normalizer is implemented by requests that clean up their fields, such as
+// lower casing emails, once they are bound.
+type Normalizer interface {
+	Normalize()
+}
+
+// Validator checks requests against the rules of their validate struct tags,
+// reporting every failing field at once. Besides the rules of
+// go-playground/validator, the password rule checks the password policy.
+type Validator struct {
+	validate *validator.Validate
+	policy   config.PasswordConfig
+}
+
+func New(policy config.PasswordConfig) *Validator {
+	v := &Validator{
+		validate: validator.New(),
+		policy:   policy,
+	}
+
+	// Fields are reported by the name clients send them with.
+	v.validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+
+		return name
+	})
+
+	v.validate.RegisterValidation("password", func(fl validator.FieldLevel) bool {
+		return v.CheckPassword(fl.Field().String()) == ""
+	})
+
+	return v
+}
+
+// Validate implements echo.Validator. Failures are returned as an
+// apperror.Validation error listing the fields and the rules they broke.
+func (v *Validator) Validate(i interface{}) error {
+	err := v.validate.Struct(i)
+
+	var failures validator.ValidationErrors
+	if !errors.As(err, &failures) {
+		return err
+	}
+
+	fields := make([]apperror.FieldError, 0, len(failures))
+	for _, failure := range failures {
+		fields = append(fields, apperror.FieldError{
+			Field:   fieldPath(failure),
+			Rule:    failure.Tag(),
+			Message: v.message(failure),
+		})
+	}
+
+	return apperror.Validation(fields...)
+}
+
+// CheckPassword returns what password misses to satisfy the policy, or an
+// empty string when it does.
+func (v *Validator) CheckPassword(password string) string {
+	switch {
+	case utf8.RuneCountInString(password) < v.policy.MinLength:
+		return fmt.Sprintf("must be at least %d characters long", v.policy.MinLength)
+	case len(password) > v.policy.MaxLength:
+		return fmt.Sprintf("must be at most %d bytes long", v.policy.MaxLength)
+	case v.policy.RequireUpper && strings.IndexFunc(password, unicode.IsUpper) == -1:
+		return "must contain an upper case letter"
+	case v.policy.RequireLower && strings.IndexFunc(password, unicode.IsLower) == -1:
+		return "must contain a lower case letter"
+	case v.policy.RequireDigit && strings.IndexFunc(password, unicode.IsDigit) == -1:
+		return "must contain a digit"
+	case v.policy.RequireSymbol && strings.IndexFunc(password, isSymbol) == -1:
+		return "must contain a symbol"
+	}
+
+	return ""
+}
+
+func isSymbol(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
+
+func (v *Validator) message(failure validator.FieldError) string {
+	switch failure.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "max":
+		return fmt.Sprintf("must be at most %s characters long", failure.Param())
+	case "min":
+		return fmt.Sprintf("must be at least %s characters long", failure.Param())
+	case "password":
+		password, _ := reflect.Indirect(reflect.ValueOf(failure.Value())).Interface().(string)
+		return v.CheckPassword(password)
+	}
+
+	return fmt.Sprintf("does not satisfy the %s rule", failure.Tag())
+}
+
+// fieldPath is the namespace of the failing field without the name of the
+// validated struct, such as roles[0].name.
+func fieldPath(failure validator.FieldError) string {
+	parts := strings.SplitN(failure.Namespace(), ".", 2)
+	return parts[len(parts)-1]
+}
@@ -0,0 +1,136 @@
+package validation
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"rewrite/pkg/apperror"
+	"rewrite/pkg/config"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/suite"
+)
+
+type request struct {
+	Email    string   `json:"email" validate:"required,email"`
+	Password *string  `json:"password" validate:"omitempty,password"`
+	Roles    []string `json:"roles" validate:"dive,required"`
+}
+
+func (r *request) Normalize() {
+	r.Email = strings.ToLower(r.Email)
+}
+
+type TestSuiteValidation struct {
+	suite.Suite
+	validator *Validator
+}
+
+func (s *TestSuiteValidation) SetupTest() {
+	s.validator = New(config.PasswordConfig{
+		MinLength:     8,
+		MaxLength:     72,
+		RequireUpper:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+	})
+}
+
+func (s *TestSuiteValidation) TestCheckPassword() {
+	for _, tt := range []struct {
+		Name     string
+		Password string
+		Expected string
+	}{
+		{Name: "Satisfies the policy", Password: "Correct-horse-1"},
+		{Name: "Counts characters, not bytes", Password: "Äöü-ß1ñé"},
+		{Name: "Too short", Password: "Ab-1", Expected: "must be at least 8 characters long"},
+		{Name: "Longer than bcrypt hashes", Password: strings.Repeat("Ä", 36) + "A-1", Expected: "must be at most 72 bytes long"},
+		{Name: "Without upper case letter", Password: "correct-horse-1", Expected: "must contain an upper case letter"},
+		{Name: "Without digit", Password: "Correct-horse", Expected: "must contain a digit"},
+		{Name: "Without symbol", Password: "Correcthorse1", Expected: "must contain a symbol"},
+	} {
+		s.Run(tt.Name, func() {
+			s.Equal(tt.Expected, s.validator.CheckPassword(tt.Password))
+		})
+	}
+}
+
+func (s *TestSuiteValidation) TestValidate() {
+	weak := "weak"
+	strong := "Correct-horse-1"
+
+	for _, tt := range []struct {
+		Name          string
+		Request       *request
+		ExpectedError error
+	}{
+		{
+			Name:    "Valid request",
+			Request: &request{Email: "123@123.com", Password: &strong, Roles: []string{"admin"}},
+		},
+		{
+			Name:    "Optional field left out",
+			Request: &request{Email: "123@123.com"},
+		},
+		{
+			Name:    "Every failing field is reported",
+			Request: &request{Email: "123", Password: &weak, Roles: []string{""}},
+			ExpectedError: apperror.Validation(
+				apperror.FieldError{Field: "email", Rule: "email", Message: "must be a valid email address"},
+				apperror.FieldError{Field: "password", Rule: "password", Message: "must be at least 8 characters long"},
+				apperror.FieldError{Field: "roles[0]", Rule: "required", Message: "is required"},
+			),
+		},
+	} {
+		s.Run(tt.Name, func() {
+			s.Equal(tt.ExpectedError, s.validator.Validate(tt.Request))
+		})
+	}
+}
+
+func (s *TestSuiteValidation) TestBind() {
+	for _, tt := range []struct {
+		Name            string
+		Body            string
+		ExpectedRequest request
+		ExpectedError   error
+	}{
+		{
+			Name:            "Normalized after binding",
+			Body:            `{"email": "Foo@Example.com"}`,
+			ExpectedRequest: request{Email: "foo@example.com"},
+		},
+		{
+			Name: "Unknown field",
+			Body: `{"email": "foo@example.com", "admin": true}`,
+			ExpectedError: apperror.Validation(
+				apperror.FieldError{Field: "admin", Rule: "unknown", Message: "is not a known field"},
+			),
+		},
+	} {
+		s.Run(tt.Name, func() {
+			e := echo.New()
+			e.Binder = &Binder{}
+			e.JSONSerializer = JSONSerializer{}
+
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.Body))
+			r.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			c := e.NewContext(r, httptest.NewRecorder())
+
+			var bound request
+			err := c.Bind(&bound)
+			if tt.ExpectedError != nil {
+				s.Equal(tt.ExpectedError, err)
+			} else {
+				s.NoError(err)
+				s.Equal(tt.ExpectedRequest, bound)
+			}
+		})
+	}
+}
+
+func TestValidation(t *testing.T) {
+	suite.Run(t, new(TestSuiteValidation))
+}